@@ -0,0 +1,509 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultTokenTTL = 15 * time.Minute
+	// Refreshing keeps a session going at most this long after sign-in
+	defaultMaxSession = 30 * 24 * time.Hour
+	tokenIssuer       = "spice-runner-leaderboard"
+
+	// Failed sign-ins are counted per username and per address in fixed
+	// windows; past the limit, sign-ins wait for the next window
+	cacheKeyLoginFailures       = "accounts:login:failures:%s:%d"
+	loginFailureWindow          = 15 * time.Minute
+	maxLoginFailuresPerUsername = 5
+	maxLoginFailuresPerAddress  = 20
+
+	minPasswordLength = 8
+	// bcrypt ignores everything past 72 bytes
+	maxPasswordLength = 72
+
+	// dummyPasswordHash is checked for unknown usernames, so they take as long
+	// to refuse as wrong passwords. It has bcrypt.DefaultCost, like real hashes.
+	dummyPasswordHash = "$2a$10$xsYbBOiyTfUUmag1mKRbqO7IrAl2HaiQ7cDk.YQZGNQ6RCN0YPPmi"
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,32}$`)
+
+	// jwtHeader is the only header issued and accepted: HMAC-SHA256
+	jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+	errInvalidToken = handlers.NewError(handlers.ErrUnauthenticated, "invalid or expired token", nil)
+	// errAccountRequired means the player ID or name belongs to a registered
+	// account and the submission wasn't signed in as it.
+	errAccountRequired = handlers.NewError(handlers.ErrUnauthenticated, "player belongs to a registered account", nil)
+)
+
+// accountAuth issues and checks the short-lived tokens of registered players.
+// Without a secret, accounts are disabled and every submission is anonymous.
+type accountAuth struct {
+	secret []byte
+	ttl    time.Duration
+	// maxSession caps how long refreshes keep a sign-in alive
+	maxSession time.Duration
+	anonymous  bool
+}
+
+func newAccountAuthFromEnv() *accountAuth {
+	auth := &accountAuth{
+		secret:     []byte(getEnv("JWT_SECRET", "")),
+		ttl:        defaultTokenTTL,
+		maxSession: defaultMaxSession,
+		anonymous:  getEnv("ANONYMOUS_SUBMISSIONS", "true") == "true",
+	}
+	if ttl, err := time.ParseDuration(getEnv("JWT_TTL", defaultTokenTTL.String())); err == nil && ttl > 0 {
+		auth.ttl = ttl
+	}
+	if maxSession, err := time.ParseDuration(getEnv("JWT_MAX_SESSION", defaultMaxSession.String())); err == nil && maxSession > 0 {
+		auth.maxSession = maxSession
+	}
+	return auth
+}
+
+func (a *accountAuth) enabled() bool {
+	return len(a.secret) > 0
+}
+
+// tokenClaims is the payload of an access token.
+type tokenClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Name      string `json:"name"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	// OriginalIssuedAt is when the player signed in. Refreshed tokens keep it,
+	// and never outlive it by more than maxSession.
+	OriginalIssuedAt int64 `json:"orig_iat"`
+}
+
+// signedInAt is when the session began; tokens from before orig_iat was
+// issued only have their own iat.
+func (c *tokenClaims) signedInAt() time.Time {
+	if c.OriginalIssuedAt == 0 {
+		return time.Unix(c.IssuedAt, 0)
+	}
+	return time.Unix(c.OriginalIssuedAt, 0)
+}
+
+func (a *accountAuth) sign(signingInput string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issue returns a signed token for the player, in a session that began at
+// signedInAt, and when it expires.
+func (a *accountAuth) issue(player *Player, signedInAt time.Time) (string, time.Time) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(a.ttl)
+	if sessionEnd := signedInAt.Add(a.maxSession).UTC(); sessionEnd.Before(expiresAt) {
+		expiresAt = sessionEnd
+	}
+	payload, _ := json.Marshal(tokenClaims{
+		Issuer:           tokenIssuer,
+		Subject:          player.ID,
+		Name:             player.DisplayName,
+		IssuedAt:         now.Unix(),
+		ExpiresAt:        expiresAt.Unix(),
+		OriginalIssuedAt: signedInAt.Unix(),
+	})
+	signingInput := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + a.sign(signingInput), expiresAt
+}
+
+// verify checks a token's signature, issuer, expiry and session lifetime.
+func (a *accountAuth) verify(token string) (*tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, errInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(a.sign(parts[0]+"."+parts[1]))) {
+		return nil, errInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errInvalidToken
+	}
+	now := time.Now()
+	if claims.Issuer != tokenIssuer || claims.Subject == "" || now.Unix() >= claims.ExpiresAt {
+		return nil, errInvalidToken
+	}
+	if !now.Before(claims.signedInAt().Add(a.maxSession)) {
+		return nil, errInvalidToken
+	}
+	return &claims, nil
+}
+
+// authenticate reads a bearer token. No token is not an error: it returns nil
+// claims and the caller decides whether anonymous requests are allowed.
+func (a *accountAuth) authenticate(authorization string) (*tokenClaims, error) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		return nil, nil
+	}
+	if !a.enabled() {
+		return nil, errInvalidToken
+	}
+	return a.verify(token)
+}
+
+// bindAccount makes a signed-in submission use the account's identity and
+// name, and refuses anonymous submissions when they are turned off. Trusted
+// backends with an API key may still submit without a player token.
+func (app *App) bindAccount(submission *ScoreSubmission, authorization string) error {
+	claims, err := app.accounts.authenticate(authorization)
+	if err != nil {
+		return err
+	}
+	if claims == nil {
+		if !app.accounts.anonymous && submission.apiKey == nil {
+			return fmt.Errorf("sign in to submit scores")
+		}
+		return nil
+	}
+	submission.PlayerID = claims.Subject
+	submission.PlayerName = claims.Name
+	submission.accountID = claims.Subject
+	return nil
+}
+
+type AccountRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// PlayerID adopts an existing anonymous identity, keeping its scores. The
+	// same ID must be sent in X-Player-Id, as for erasures and exports.
+	PlayerID string `json:"playerId,omitempty"`
+}
+
+type AccountToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	PlayerID  string    `json:"playerId"`
+	Username  string    `json:"username"`
+}
+
+func (app *App) writeAccountToken(w http.ResponseWriter, status int, player *Player, signedInAt time.Time) {
+	token, expiresAt := app.accounts.issue(player, signedInAt)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(AccountToken{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		PlayerID:  player.ID,
+		Username:  player.DisplayName,
+	})
+}
+
+func decodeAccountRequest(r *http.Request) (*AccountRequest, error) {
+	var req AccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, fmt.Errorf("Invalid request body")
+	}
+	if !usernamePattern.MatchString(req.Username) {
+		return nil, fmt.Errorf("username must be 3-32 letters, digits, '_' or '-'")
+	}
+	if req.Username == anonymousPlayerName {
+		return nil, fmt.Errorf("username is reserved")
+	}
+	if len(req.Password) < minPasswordLength || len(req.Password) > maxPasswordLength {
+		return nil, fmt.Errorf("password must be %d-%d characters", minPasswordLength, maxPasswordLength)
+	}
+	if len(req.PlayerID) > 100 {
+		return nil, fmt.Errorf("player ID too long (max 100 characters)")
+	}
+	return &req, nil
+}
+
+// registerHandler creates an account. The username becomes the player's bare
+// display name; an anonymous player already using it is moved to a
+// discriminator.
+func (app *App) registerHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "register")
+	defer span.End()
+
+	if !app.accounts.enabled() {
+		http.Error(w, "Accounts are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	req, err := decodeAccountRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Adopting an identity takes its scores, so the caller must hold its ID
+	// the way verifyPlayer expects, not just name it in the body
+	if req.PlayerID != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(playerIDHeader)), []byte(req.PlayerID)) != 1 {
+		http.Error(w, "Send the player ID to adopt in "+playerIDHeader, http.StatusUnauthorized)
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to register", http.StatusInternalServerError)
+		return
+	}
+
+	player := &Player{ID: req.PlayerID, DisplayName: req.Username}
+	if player.ID == "" {
+		idBytes := make([]byte, 16)
+		if _, err := rand.Read(idBytes); err != nil {
+			span.RecordError(err)
+			http.Error(w, "Failed to register", http.StatusInternalServerError)
+			return
+		}
+		player.ID = hex.EncodeToString(idBytes)
+	}
+	span.SetAttributes(attribute.String("player.id", player.ID), attribute.Bool("player.adopted", req.PlayerID != ""))
+
+	start := time.Now()
+	err = app.createAccount(ctx, player, string(hash), req.PlayerID != "")
+	store.ObserveQuery(ctx, "register", start)
+	if errors.Is(err, errAccountRequired) {
+		http.Error(w, "Player ID already belongs to an account", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, errPlayerUnverifiable) {
+		http.Error(w, "No player with that ID to adopt", http.StatusNotFound)
+		return
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		http.Error(w, "Username is taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to register", http.StatusInternalServerError)
+		return
+	}
+	accountRegistrationsTotal.Add(ctx, 1)
+	log.Printf("👤 Registered %s", player.DisplayName)
+
+	app.writeAccountToken(w, http.StatusCreated, player, time.Now())
+}
+
+// createAccount registers player. With adopt, player.ID must be an existing
+// anonymous identity, or errPlayerUnverifiable is returned.
+func (app *App) createAccount(ctx context.Context, player *Player, passwordHash string, adopt bool) error {
+	tx, err := app.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var registered bool
+	err = store.LockPlayerQuery.QueryRow(ctx, tx, player.ID).Scan(&registered)
+	if errors.Is(err, pgx.ErrNoRows) && adopt {
+		return errPlayerUnverifiable
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if registered {
+		return errAccountRequired
+	}
+
+	// Names belong to accounts: an anonymous player holding the bare name
+	// keeps playing under a discriminator
+	var squatter string
+	err = store.NameSquatterQuery.QueryRow(ctx, tx, player.DisplayName, player.ID).Scan(&squatter)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if squatter != "" {
+		if err := reassignDiscriminator(ctx, tx, squatter, player.DisplayName); err != nil {
+			return err
+		}
+	}
+
+	_, err = store.CreateAccountQuery.Exec(ctx, tx, player.ID, player.DisplayName, passwordHash)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// reassignDiscriminator moves a player off a bare name, like resolvePlayer
+// does for new identities.
+func reassignDiscriminator(ctx context.Context, tx pgx.Tx, playerID, displayName string) error {
+	for attempt := 0; attempt < maxDiscriminatorAttempts; attempt++ {
+		// A nested transaction is a savepoint, so a taken discriminator
+		// doesn't abort the outer one
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = store.ReassignDiscriminatorQuery.Exec(ctx, savepoint, playerID, randomDiscriminator())
+		if err == nil {
+			return savepoint.Commit(ctx)
+		}
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != pgUniqueViolation {
+			return err
+		}
+		if err := savepoint.Rollback(ctx); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("no free discriminator for %q", displayName)
+}
+
+// loginHandler exchanges a username and password for a token.
+func (app *App) loginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "login")
+	defer span.End()
+
+	if !app.accounts.enabled() {
+		http.Error(w, "Accounts are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	req, err := decodeAccountRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	address := clientAddress(r)
+	if throttled, retryAfter := app.loginThrottled(ctx, req.Username, address); throttled {
+		span.SetAttributes(attribute.Bool("login.throttled", true))
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		http.Error(w, "Too many failed sign-ins; try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	player := &Player{}
+	var hash string
+	err = store.LoginQuery.QueryRow(ctx, app.db, req.Username).Scan(&player.ID, &player.DisplayName, &hash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		span.RecordError(err)
+		http.Error(w, "Failed to sign in", http.StatusInternalServerError)
+		return
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		hash = dummyPasswordHash
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)) != nil || err != nil {
+		accountLoginFailuresTotal.Add(ctx, 1)
+		app.recordLoginFailure(ctx, req.Username, address)
+		span.SetAttributes(attribute.Bool("login.ok", false))
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+	span.SetAttributes(attribute.Bool("login.ok", true), attribute.String("player.id", player.ID))
+	app.clearLoginFailures(ctx, req.Username)
+
+	app.writeAccountToken(w, http.StatusOK, player, time.Now())
+}
+
+// loginFailureKeys are the current window's failure counters for a username,
+// matched regardless of case like usernames, and for an address.
+func loginFailureKeys(username, address string) (usernameKey, addressKey string, windowEnd time.Time) {
+	window := time.Now().Unix() / int64(loginFailureWindow.Seconds())
+	usernameKey = fmt.Sprintf(cacheKeyLoginFailures, "user:"+strings.ToLower(username), window)
+	addressKey = fmt.Sprintf(cacheKeyLoginFailures, "addr:"+address, window)
+	return usernameKey, addressKey, time.Unix((window+1)*int64(loginFailureWindow.Seconds()), 0)
+}
+
+// loginThrottled reports whether the username or address has used up its
+// failed sign-ins for the window, and how long to wait. It fails open when
+// Redis is unavailable, like the report limits.
+func (app *App) loginThrottled(ctx context.Context, username, address string) (bool, time.Duration) {
+	usernameKey, addressKey, windowEnd := loginFailureKeys(username, address)
+	counts, err := app.redis.MGet(ctx, usernameKey, addressKey).Result()
+	if err != nil {
+		log.Printf("Failed to read sign-in failures: %v", err)
+		return false, 0
+	}
+	for i, limit := range []int{maxLoginFailuresPerUsername, maxLoginFailuresPerAddress} {
+		raw, _ := counts[i].(string)
+		if count, err := strconv.Atoi(raw); err == nil && count >= limit {
+			return true, time.Until(windowEnd)
+		}
+	}
+	return false, 0
+}
+
+// recordLoginFailure counts a failed sign-in against the username and address.
+func (app *App) recordLoginFailure(ctx context.Context, username, address string) {
+	usernameKey, addressKey, _ := loginFailureKeys(username, address)
+	pipe := app.redis.TxPipeline()
+	for _, key := range []string{usernameKey, addressKey} {
+		pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, 2*loginFailureWindow)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to record sign-in failure: %v", err)
+	}
+}
+
+// clearLoginFailures forgets a username's failures once its owner signs in.
+// The address keeps its count, so one good account doesn't reset guessing at
+// others.
+func (app *App) clearLoginFailures(ctx context.Context, username string) {
+	usernameKey, _, _ := loginFailureKeys(username, "")
+	app.redis.Del(ctx, usernameKey)
+}
+
+// refreshTokenHandler swaps a token that is still valid for a fresh one in the
+// same session, which ends maxSession after sign-in whatever the refreshes.
+func (app *App) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "refreshToken")
+	defer span.End()
+
+	if !app.accounts.enabled() {
+		http.Error(w, "Accounts are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	claims, err := app.accounts.authenticate(r.Header.Get("Authorization"))
+	if err != nil || claims == nil {
+		http.Error(w, errInvalidToken.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Re-read the name in case an operator changed it since the token was issued
+	player := &Player{ID: claims.Subject}
+	if err := store.AccountNameQuery.QueryRow(ctx, app.db, player.ID).Scan(&player.DisplayName); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, errInvalidToken.Error(), http.StatusUnauthorized)
+			return
+		}
+		span.RecordError(err)
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	app.writeAccountToken(w, http.StatusOK, player, claims.signedInAt())
+}
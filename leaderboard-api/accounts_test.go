@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAccountAuth() *accountAuth {
+	return &accountAuth{secret: []byte("test-secret"), ttl: defaultTokenTTL, maxSession: defaultMaxSession}
+}
+
+// signedToken signs claims under header, the way a forger holding the secret,
+// or not, would.
+func signedToken(auth *accountAuth, header string, claims tokenClaims) string {
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + auth.sign(signingInput)
+}
+
+func TestAuthenticate(t *testing.T) {
+	auth := testAccountAuth()
+	now := time.Now()
+	claims := tokenClaims{
+		Issuer:           tokenIssuer,
+		Subject:          "player-1",
+		Name:             "Paul",
+		IssuedAt:         now.Unix(),
+		ExpiresAt:        now.Add(time.Minute).Unix(),
+		OriginalIssuedAt: now.Unix(),
+	}
+	with := func(change func(*tokenClaims)) tokenClaims {
+		c := claims
+		change(&c)
+		return c
+	}
+	const hs256 = `{"alg":"HS256","typ":"JWT"}`
+	valid := signedToken(auth, hs256, claims)
+	parts := strings.Split(valid, ".")
+	forged, _ := json.Marshal(with(func(c *tokenClaims) { c.Subject = "player-2" }))
+
+	tests := []struct {
+		name          string
+		auth          *accountAuth
+		authorization string
+		wantSubject   string
+		wantErr       bool
+	}{
+		{name: "valid", auth: auth, authorization: "Bearer " + valid, wantSubject: "player-1"},
+		{name: "issued by issue", auth: auth, authorization: "Bearer " + mustIssue(auth), wantSubject: "player-1"},
+		{name: "no header", auth: auth, authorization: ""},
+		{name: "not a bearer token", auth: auth, authorization: "Basic " + valid},
+		{name: "empty bearer token", auth: auth, authorization: "Bearer "},
+		{name: "tampered signature", auth: auth, authorization: "Bearer " + parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2])), wantErr: true},
+		{name: "tampered payload", auth: auth, authorization: "Bearer " + parts[0] + "." + base64.RawURLEncoding.EncodeToString(forged) + "." + parts[2], wantErr: true},
+		{name: "signed with another secret", auth: auth, authorization: "Bearer " + signedToken(&accountAuth{secret: []byte("other")}, hs256, claims), wantErr: true},
+		{name: "alg none", auth: auth, authorization: "Bearer " + base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + ".", wantErr: true},
+		{name: "alg none signed", auth: auth, authorization: "Bearer " + signedToken(auth, `{"alg":"none","typ":"JWT"}`, claims), wantErr: true},
+		{name: "alg HS512", auth: auth, authorization: "Bearer " + signedToken(auth, `{"alg":"HS512","typ":"JWT"}`, claims), wantErr: true},
+		{name: "expired", auth: auth, authorization: "Bearer " + signedToken(auth, hs256, with(func(c *tokenClaims) { c.ExpiresAt = now.Add(-time.Second).Unix() })), wantErr: true},
+		{name: "past the session lifetime", auth: auth, authorization: "Bearer " + signedToken(auth, hs256, with(func(c *tokenClaims) { c.OriginalIssuedAt = now.Add(-defaultMaxSession).Unix() })), wantErr: true},
+		{name: "no orig_iat, past the session lifetime", auth: auth, authorization: "Bearer " + signedToken(auth, hs256, with(func(c *tokenClaims) {
+			c.OriginalIssuedAt, c.IssuedAt = 0, now.Add(-defaultMaxSession).Unix()
+		})), wantErr: true},
+		{name: "wrong issuer", auth: auth, authorization: "Bearer " + signedToken(auth, hs256, with(func(c *tokenClaims) { c.Issuer = "elsewhere" })), wantErr: true},
+		{name: "no subject", auth: auth, authorization: "Bearer " + signedToken(auth, hs256, with(func(c *tokenClaims) { c.Subject = "" })), wantErr: true},
+		{name: "two parts", auth: auth, authorization: "Bearer " + parts[0] + "." + parts[1], wantErr: true},
+		{name: "payload not base64", auth: auth, authorization: "Bearer " + parts[0] + ".!!!." + auth.sign(parts[0]+".!!!"), wantErr: true},
+		{name: "payload not JSON", auth: auth, authorization: "Bearer " + parts[0] + ".bm90LWpzb24." + auth.sign(parts[0]+".bm90LWpzb24"), wantErr: true},
+		{name: "accounts disabled", auth: &accountAuth{maxSession: defaultMaxSession}, authorization: "Bearer " + valid, wantErr: true},
+		{name: "accounts disabled, no header", auth: &accountAuth{}, authorization: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.auth.authenticate(tt.authorization)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("authenticate = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("authenticate: %v", err)
+			}
+			subject := ""
+			if got != nil {
+				subject = got.Subject
+			}
+			if subject != tt.wantSubject {
+				t.Errorf("subject = %q, want %q", subject, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func mustIssue(auth *accountAuth) string {
+	token, _ := auth.issue(&Player{ID: "player-1", DisplayName: "Paul"}, time.Now())
+	return token
+}
+
+func TestIssueKeepsSessionStart(t *testing.T) {
+	auth := testAccountAuth()
+	signedInAt := time.Now().Add(-defaultMaxSession + 5*time.Minute)
+
+	token, expiresAt := auth.issue(&Player{ID: "player-1", DisplayName: "Paul"}, signedInAt)
+	if want := signedInAt.Add(defaultMaxSession); expiresAt.Unix() != want.Unix() {
+		t.Errorf("expiresAt = %v, want the session's end %v rather than a full TTL", expiresAt, want)
+	}
+	claims, err := auth.authenticate("Bearer " + token)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if claims.OriginalIssuedAt != signedInAt.Unix() {
+		t.Errorf("orig_iat = %d, want the sign-in time %d", claims.OriginalIssuedAt, signedInAt.Unix())
+	}
+}
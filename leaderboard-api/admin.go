@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Admin roles. Moderators handle scores, reports and bans; admins can also
+// change configuration and rewrite player history.
+const (
+	adminRoleAdmin     = "admin"
+	adminRoleModerator = "moderator"
+)
+
+// adminIdentity is the operator behind an admin request.
+type adminIdentity struct {
+	Name  string
+	Role  string
+	token string
+}
+
+type adminIdentityKey struct{}
+
+func adminFromContext(ctx context.Context) *adminIdentity {
+	admin, _ := ctx.Value(adminIdentityKey{}).(*adminIdentity)
+	return admin
+}
+
+// parseAdminTokens reads ADMIN_TOKEN (role admin) and ADMIN_TOKENS, a
+// comma-separated list of name:role:token for per-operator tokens.
+func parseAdminTokens(single, list string) ([]*adminIdentity, error) {
+	var admins []*adminIdentity
+	if single != "" {
+		admins = append(admins, &adminIdentity{Name: "admin", Role: adminRoleAdmin, token: single})
+	}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("admin token %q is not name:role:token", parts[0])
+		}
+		if parts[1] != adminRoleAdmin && parts[1] != adminRoleModerator {
+			return nil, fmt.Errorf("admin token %q: role must be %q or %q", parts[0], adminRoleAdmin, adminRoleModerator)
+		}
+		admins = append(admins, &adminIdentity{Name: parts[0], Role: parts[1], token: parts[2]})
+	}
+	return admins, nil
+}
+
+// adminAuthMiddleware guards operator endpoints with bearer tokens and records
+// who is calling. Admin routes are disabled entirely when no token is
+// configured.
+func adminAuthMiddleware(next http.Handler) http.Handler {
+	admins, err := parseAdminTokens(getEnv("ADMIN_TOKEN", ""), getEnv("ADMIN_TOKENS", ""))
+	if err != nil {
+		log.Fatalf("Failed to configure admin tokens: %v", err)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(admins) == 0 {
+			http.Error(w, "Admin API disabled", http.StatusNotFound)
+			return
+		}
+
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		var caller *adminIdentity
+		for _, admin := range admins {
+			// Compare against every token so timing doesn't reveal which matched
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(admin.token)) == 1 {
+				caller = admin
+			}
+		}
+		if caller == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminIdentityKey{}, caller)))
+	})
+}
+
+// requireAdminRole limits a route to the admin role.
+func requireAdminRole(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if admin := adminFromContext(r.Context()); admin == nil || admin.Role != adminRoleAdmin {
+			http.Error(w, "Forbidden: needs the admin role", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// adminAuditMiddleware wraps every admin change in an audit span naming the
+// operator, the route and its targets, and logs it. Reads aren't audited.
+func adminAuditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		action := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				action = template
+			}
+		}
+		vars := mux.Vars(r)
+		targets := make([]string, 0, len(vars))
+		for name, value := range vars {
+			targets = append(targets, name+"="+value)
+		}
+		sort.Strings(targets)
+
+		actor, role := "", ""
+		if admin := adminFromContext(r.Context()); admin != nil {
+			actor, role = admin.Name, admin.Role
+		}
+
+		ctx, span := tracer.Start(r.Context(), "audit "+r.Method+" "+action)
+		defer span.End()
+		span.SetAttributes(
+			attribute.String("audit.actor", actor),
+			attribute.String("audit.role", role),
+			attribute.String("audit.action", r.Method+" "+action),
+			attribute.StringSlice("audit.targets", targets),
+		)
+
+		wrapped := &handlers.ResponseWriter{ResponseWriter: w, StatusCode: http.StatusOK}
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("audit.status", wrapped.StatusCode))
+		log.Printf("📝 Audit: %s (%s) %s %s %s → %d", actor, role, r.Method, action,
+			strings.Join(targets, " "), wrapped.StatusCode)
+	})
+}
+
+// refreshLeaderboard rebuilds the ranking from Postgres and tells caches and
+// clients the board changed, after scores were changed in bulk. Without
+// playerNames every player's cached stats are dropped.
+func (app *App) refreshLeaderboard(ctx context.Context, playerNames ...string) {
+	if err := app.redis.Del(ctx, cacheKeyRankingReady).Err(); err != nil {
+		log.Printf("Failed to reset ranking: %v", err)
+	}
+	app.rankingReady(ctx)
+	app.invalidateCache(ctx)
+	// The featured runner, record holders and #1s may be among the players changed
+	app.cache.Del(ctx, cacheKeyFeaturedRunner)
+	app.invalidateRecords(ctx)
+	app.invalidateReigns(ctx)
+	app.dropCachedPlayerStats(ctx, playerNames...)
+	keys := []string{surrogateKeyLeaderboard}
+	for _, name := range playerNames {
+		keys = append(keys, surrogateKeyPlayer(name))
+	}
+	app.markSurrogateKeys(ctx, keys...)
+	app.publishChange(ctx)
+}
+
+// rebuildCacheHandler drops the cached leaderboards and rebuilds the ranking
+// sorted set from Postgres, for when Redis is suspected to be out of step.
+func (app *App) rebuildCacheHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "rebuildCache")
+	defer span.End()
+
+	if err := app.redis.Del(ctx, cacheKeyRankingReady).Err(); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to reset ranking", http.StatusInternalServerError)
+		return
+	}
+	app.rankingReady(ctx)
+	app.invalidateCache(ctx)
+	app.invalidateRecords(ctx)
+	app.dropCachedPlayerStats(ctx)
+	app.markSurrogateKeys(ctx, surrogateKeyLeaderboard)
+	app.publishChange(ctx)
+	log.Println("🛡️ Caches invalidated and ranking rebuilt")
+	w.WriteHeader(http.StatusNoContent)
+}
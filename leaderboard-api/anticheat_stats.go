@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Anti-cheat outcome counters, bucketed per minute and per hour
+	anticheatMinuteKey = "anticheat:stats:m:%d"
+	anticheatHourKey   = "anticheat:stats:h:%d"
+	anticheatMinuteTTL = 2 * time.Hour
+	anticheatHourTTL   = 8 * 24 * time.Hour
+
+	// Outcomes tracked per stage
+	outcomeEvaluated   = "evaluated"
+	outcomeRejected    = "rejected"
+	outcomeFlagged     = "flagged"
+	outcomeQuarantined = "quarantined"
+)
+
+// anticheatWindow is a reporting window summed from buckets of the given resolution.
+type anticheatWindow struct {
+	name       string
+	length     time.Duration
+	resolution time.Duration
+	keyFormat  string
+}
+
+var anticheatWindows = []anticheatWindow{
+	{name: "15m", length: 15 * time.Minute, resolution: time.Minute, keyFormat: anticheatMinuteKey},
+	{name: "1h", length: time.Hour, resolution: time.Minute, keyFormat: anticheatMinuteKey},
+	{name: "24h", length: 24 * time.Hour, resolution: time.Hour, keyFormat: anticheatHourKey},
+	{name: "7d", length: 7 * 24 * time.Hour, resolution: time.Hour, keyFormat: anticheatHourKey},
+}
+
+type StageStats struct {
+	Evaluated     int64   `json:"evaluated"`
+	Rejected      int64   `json:"rejected"`
+	Flagged       int64   `json:"flagged"`
+	Quarantined   int64   `json:"quarantined"`
+	RejectionRate float64 `json:"rejectionRate"`
+	FlagRate      float64 `json:"flagRate"`
+}
+
+type AnticheatStatsResponse struct {
+	Pipeline    []string                          `json:"pipeline"`
+	Windows     map[string]map[string]*StageStats `json:"windows"`
+	GeneratedAt time.Time                         `json:"generatedAt"`
+}
+
+// stageOutcome is one stage's contribution to the anti-cheat counters.
+type stageOutcome struct {
+	stage   string
+	outcome string
+}
+
+// recordAnticheatOutcomes bumps the minute and hour buckets for the given outcomes.
+// Stats are best-effort and never block a submission.
+func (app *App) recordAnticheatOutcomes(ctx context.Context, outcomes []stageOutcome) {
+	if len(outcomes) == 0 {
+		return
+	}
+	now := time.Now()
+	minuteKey := fmt.Sprintf(anticheatMinuteKey, now.Unix()/60)
+	hourKey := fmt.Sprintf(anticheatHourKey, now.Unix()/3600)
+
+	pipe := app.redis.Pipeline()
+	for _, o := range outcomes {
+		field := o.stage + "|" + o.outcome
+		pipe.HIncrBy(ctx, minuteKey, field, 1)
+		pipe.HIncrBy(ctx, hourKey, field, 1)
+	}
+	pipe.Expire(ctx, minuteKey, anticheatMinuteTTL)
+	pipe.Expire(ctx, hourKey, anticheatHourTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to record anti-cheat stats: %v", err)
+	}
+}
+
+// recordQuarantine counts a score quarantined by the given rule.
+func (app *App) recordQuarantine(ctx context.Context, rule string) {
+	app.recordAnticheatOutcomes(ctx, []stageOutcome{{stage: rule, outcome: outcomeQuarantined}})
+}
+
+func (app *App) anticheatStats(ctx context.Context, window anticheatWindow, now time.Time) (map[string]*StageStats, error) {
+	step := int64(window.resolution / time.Second)
+	current := now.Unix() / step
+	buckets := int64(window.length / window.resolution)
+
+	pipe := app.redis.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, 0, buckets)
+	for i := int64(0); i < buckets; i++ {
+		cmds = append(cmds, pipe.HGetAll(ctx, fmt.Sprintf(window.keyFormat, current-i)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	stats := make(map[string]*StageStats)
+	for _, cmd := range cmds {
+		for field, value := range cmd.Val() {
+			stage, outcome, ok := strings.Cut(field, "|")
+			if !ok {
+				continue
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			s, ok := stats[stage]
+			if !ok {
+				s = &StageStats{}
+				stats[stage] = s
+			}
+			switch outcome {
+			case outcomeEvaluated:
+				s.Evaluated += n
+			case outcomeRejected:
+				s.Rejected += n
+			case outcomeFlagged:
+				s.Flagged += n
+			case outcomeQuarantined:
+				s.Quarantined += n
+			}
+		}
+	}
+
+	for _, s := range stats {
+		if s.Evaluated > 0 {
+			s.RejectionRate = float64(s.Rejected) / float64(s.Evaluated)
+			s.FlagRate = float64(s.Flagged) / float64(s.Evaluated)
+		}
+	}
+	return stats, nil
+}
+
+func (app *App) getAnticheatStatsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getAnticheatStats")
+	defer span.End()
+
+	now := time.Now()
+	response := AnticheatStatsResponse{
+		Pipeline:    app.pipeline.names(),
+		Windows:     make(map[string]map[string]*StageStats),
+		GeneratedAt: now.UTC(),
+	}
+
+	for _, window := range anticheatWindows {
+		stats, err := app.anticheatStats(ctx, window, now)
+		if err != nil {
+			span.RecordError(err)
+			http.Error(w, "Failed to fetch anti-cheat stats", http.StatusInternalServerError)
+			return
+		}
+		response.Windows[window.name] = stats
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
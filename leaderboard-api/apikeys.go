@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	apiKeyPrefix = "sr_"
+
+	// Requests per minute for keys created without a limit of their own
+	defaultAPIKeyRateLimit = 600
+
+	// Lookups are cached by key hash; revoking a key drops its entry
+	cacheKeyAPIKey     = "apikey:%s"
+	cacheKeyAPIKeyRate = "apikey:rate:%d:%d"
+	apiKeyCacheTTL     = 5 * time.Minute
+	// Cached for unknown keys so guessing doesn't reach Postgres every time
+	apiKeyUnknown = "unknown"
+)
+
+var (
+	apiKeyNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+	errUnknownAPIKey = handlers.NewError(handlers.ErrUnauthenticated, "unknown or revoked API key", nil)
+)
+
+// APIKey identifies a trusted server-to-server submitter, such as the game
+// backend or the tournament service. Only the key's SHA-256 is stored.
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	RateLimit  int        `json:"rateLimit"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+// CreatedAPIKey is returned once, when the key is created.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type APIKeyRequest struct {
+	Name      string `json:"name"`
+	RateLimit int    `json:"rateLimit,omitempty"`
+}
+
+type apiKeyContextKey struct{}
+
+// apiKeyFromContext returns the key the request was made with, if any.
+func apiKeyFromContext(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return key
+}
+
+func hashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupAPIKey resolves a raw key, from Redis when cached.
+func (app *App) lookupAPIKey(ctx context.Context, raw string) (*APIKey, error) {
+	if !strings.HasPrefix(raw, apiKeyPrefix) {
+		return nil, errUnknownAPIKey
+	}
+	hash := hashAPIKey(raw)
+	cacheKey := fmt.Sprintf(cacheKeyAPIKey, hash)
+
+	if cached, err := app.cache.Get(ctx, cacheKey); err == nil {
+		if string(cached) == apiKeyUnknown {
+			return nil, errUnknownAPIKey
+		}
+		var key APIKey
+		if err := json.Unmarshal(cached, &key); err == nil {
+			return &key, nil
+		}
+	}
+
+	key := &APIKey{}
+	err := store.LookupAPIKeyQuery.QueryRow(ctx, app.db, hash).Scan(&key.ID, &key.Name, &key.Prefix, &key.RateLimit, &key.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		app.cache.Set(ctx, cacheKey, []byte(apiKeyUnknown), apiKeyCacheTTL)
+		return nil, errUnknownAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err := json.Marshal(key); err == nil {
+		app.cache.Set(ctx, cacheKey, data, apiKeyCacheTTL)
+	}
+	// Best effort, at most once per cache fill
+	store.TouchAPIKeyQuery.Exec(ctx, app.db, key.ID)
+	return key, nil
+}
+
+// allowAPIKey counts a request against the key's per-minute limit. It fails
+// open when Redis is unavailable and returns how long to wait otherwise.
+func (app *App) allowAPIKey(ctx context.Context, key *APIKey) (bool, time.Duration) {
+	if key.RateLimit <= 0 {
+		return true, 0
+	}
+	now := time.Now()
+	window := now.Unix() / 60
+	counterKey := fmt.Sprintf(cacheKeyAPIKeyRate, key.ID, window)
+
+	pipe := app.redis.TxPipeline()
+	count := pipe.Incr(ctx, counterKey)
+	pipe.Expire(ctx, counterKey, 2*time.Minute)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to rate limit API key %s: %v", key.Name, err)
+		return true, 0
+	}
+	if count.Val() > int64(key.RateLimit) {
+		return false, time.Unix((window+1)*60, 0).Sub(now)
+	}
+	return true, 0
+}
+
+// authenticateAPIKey checks a raw key and its rate limit, recording the result
+// per key. status is the HTTP status to reject with.
+func (app *App) authenticateAPIKey(ctx context.Context, raw string) (key *APIKey, status int, retryAfter time.Duration) {
+	key, err := app.lookupAPIKey(ctx, raw)
+	if err != nil {
+		if !errors.Is(err, errUnknownAPIKey) {
+			log.Printf("Failed to look up API key: %v", err)
+			apiKeyRequestsTotal.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("api_key.name", ""), attribute.String("api_key.result", "error")))
+			return nil, http.StatusServiceUnavailable, 0
+		}
+		apiKeyRequestsTotal.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("api_key.name", ""), attribute.String("api_key.result", "invalid")))
+		return nil, http.StatusUnauthorized, 0
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("api_key.name", key.Name))
+	allowed, retryAfter := app.allowAPIKey(ctx, key)
+	result := "ok"
+	if !allowed {
+		result = "rate_limited"
+	}
+	apiKeyRequestsTotal.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("api_key.name", key.Name), attribute.String("api_key.result", result)))
+	if !allowed {
+		return key, http.StatusTooManyRequests, retryAfter
+	}
+	return key, http.StatusOK, 0
+}
+
+// apiKeyMiddleware identifies requests carrying an X-API-Key. Requests without
+// one pass through as browser clients; an invalid key is rejected rather than
+// silently treated as anonymous.
+func (app *App) apiKeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := r.Header.Get(apiKeyHeader)
+		if raw == "" || strings.HasPrefix(r.URL.Path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, status, retryAfter := app.authenticateAPIKey(r.Context(), raw)
+		switch status {
+		case http.StatusOK:
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+		case http.StatusTooManyRequests:
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			http.Error(w, "API key rate limit exceeded", status)
+		case http.StatusUnauthorized:
+			http.Error(w, errUnknownAPIKey.Error(), status)
+		default:
+			http.Error(w, "Failed to check API key", status)
+		}
+	})
+}
+
+func (app *App) getAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getAPIKeys")
+	defer span.End()
+
+	rows, err := store.ListAPIKeysQuery.Query(ctx, app.db)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch API keys", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.RateLimit, &key.CreatedAt,
+			&key.LastUsedAt, &key.RevokedAt); err != nil {
+			log.Printf("Failed to scan row: %v", err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// createAPIKeyHandler issues a key. The key itself is only in this response.
+func (app *App) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "createAPIKey")
+	defer span.End()
+
+	var req APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !apiKeyNamePattern.MatchString(req.Name) {
+		http.Error(w, "name must be 1-64 lowercase letters, digits, '_' or '-'", http.StatusBadRequest)
+		return
+	}
+	if req.RateLimit < 0 {
+		http.Error(w, "rateLimit must not be negative", http.StatusBadRequest)
+		return
+	}
+	if req.RateLimit == 0 {
+		req.RateLimit = defaultAPIKeyRateLimit
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	raw := apiKeyPrefix + hex.EncodeToString(secret)
+	created := CreatedAPIKey{
+		APIKey: APIKey{Name: req.Name, Prefix: raw[:len(apiKeyPrefix)+6], RateLimit: req.RateLimit},
+		Key:    raw,
+	}
+
+	err := store.CreateAPIKeyQuery.QueryRow(ctx, app.db, req.Name, hashAPIKey(raw), created.Prefix, req.RateLimit).
+		Scan(&created.ID, &created.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		http.Error(w, "An API key with that name exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	// A guess of this key may have been cached as unknown
+	app.cache.Del(ctx, fmt.Sprintf(cacheKeyAPIKey, hashAPIKey(raw)))
+	log.Printf("🔑 API key %s created", req.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// revokeAPIKeyHandler revokes a key and drops its cached lookup. With Redis
+// every replica sees that at once; while the cache has failed over to memory,
+// other replicas may accept the key until their copy expires, within
+// apiKeyCacheTTL.
+func (app *App) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "revokeAPIKey")
+	defer span.End()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	var name, hash string
+	err = store.RevokeAPIKeyQuery.QueryRow(ctx, app.db, id).Scan(&name, &hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "API key not found or already revoked", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	if err := app.cache.Del(ctx, fmt.Sprintf(cacheKeyAPIKey, hash)); err != nil {
+		// The cached lookup expires on its own within apiKeyCacheTTL
+		log.Printf("Failed to drop cached API key %s: %v", name, err)
+	}
+	log.Printf("🔑 API key %s revoked", name)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/cache"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	backupFormat        = "spice-runner-leaderboard-backup"
+	backupFormatVersion = 1
+
+	// Rows inserted per statement on restore
+	restoreBatchSize = 1000
+)
+
+// backupTables are the tables a backup holds, in an order that restores
+// without breaking foreign keys. probe_scores, client_errors and
+// webhook_deliveries are left out.
+var backupTables = []string{
+	"seasons",
+	"players",
+	"api_keys",
+	"scores",
+	"score_reports",
+	"season_standings",
+	"season_rewards",
+	"season_reward_snapshots",
+	"board_reigns",
+	"player_spice",
+	"community_counters",
+	"community_milestones",
+	"game_rules",
+	"banned_sessions",
+	"shadow_bans",
+	"verified_runners",
+	"webhooks",
+	"scores_archive",
+	"data_requests",
+}
+
+// BackupHeader is the first line of a backup. Every further line is a
+// BackupRow.
+type BackupHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Service   string    `json:"service"`
+	CreatedAt time.Time `json:"createdAt"`
+	Tables    []string  `json:"tables"`
+}
+
+// BackupRow is one table row, with columns keyed by name so a backup restores
+// into a newer schema.
+type BackupRow struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// runBackupCommand runs `leaderboard-api backup` or `leaderboard-api restore`
+// and returns the process exit code.
+func runBackupCommand(ctx context.Context, command string, args []string) int {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	replace := flags.Bool("replace", false, "restore: delete existing data first instead of refusing")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: leaderboard-api %s [flags] [file]\n\nfile defaults to stdout (backup) or stdin (restore).\n", command)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// Spans and metrics go nowhere, but the shared code expects them set
+	tracer = otel.Tracer(serviceName)
+	meter = otel.Meter(serviceName)
+	if err := initMetrics(); err != nil {
+		log.Printf("Failed to initialize metrics: %v", err)
+		return 1
+	}
+
+	pool, err := connectDB(ctx)
+	if err != nil {
+		log.Printf("Failed to connect to database: %v", err)
+		return 1
+	}
+	defer pool.Close()
+	if err := initDB(ctx, pool); err != nil {
+		log.Printf("Failed to initialize database: %v", err)
+		return 1
+	}
+
+	path := flags.Arg(0)
+	switch command {
+	case "backup":
+		out := os.Stdout
+		if path != "" && path != "-" {
+			if out, err = os.Create(path); err != nil {
+				log.Printf("Failed to create backup: %v", err)
+				return 1
+			}
+			defer out.Close()
+		}
+		counts, err := backupDatabase(ctx, pool, out)
+		if err != nil {
+			log.Printf("Backup failed: %v", err)
+			return 1
+		}
+		log.Printf("✅ Backed up %s", formatTableCounts(counts))
+	case "restore":
+		in := os.Stdin
+		if path != "" && path != "-" {
+			if in, err = os.Open(path); err != nil {
+				log.Printf("Failed to open backup: %v", err)
+				return 1
+			}
+			defer in.Close()
+		}
+		counts, err := restoreDatabase(ctx, pool, in, *replace)
+		if err != nil {
+			log.Printf("Restore failed: %v", err)
+			return 1
+		}
+		log.Printf("✅ Restored %s", formatTableCounts(counts))
+
+		// The ranking and cached boards still reflect the old data
+		redisClient, err := connectRedis()
+		if err != nil {
+			log.Printf("⚠️ Failed to reset ranking, rebuild it with POST /admin/cache/rebuild: %v", err)
+			return 0
+		}
+		defer redisClient.Close()
+		app := &App{db: pool, redis: redisClient, cache: cache.NewRedis(redisClient)}
+		if err := redisClient.Del(ctx, cacheKeyRankingReady).Err(); err != nil {
+			log.Printf("⚠️ Failed to reset ranking, rebuild it with POST /admin/cache/rebuild: %v", err)
+			return 0
+		}
+		app.rebuildRanking(ctx)
+		app.invalidateCache(ctx)
+		app.invalidateRecords(ctx)
+		app.invalidateReigns(ctx)
+		app.dropCachedPlayerStats(ctx)
+		log.Println("✅ Rebuilt the Redis ranking")
+	}
+	return 0
+}
+
+func formatTableCounts(counts map[string]int) string {
+	parts := make([]string, 0, len(backupTables))
+	for _, table := range backupTables {
+		parts = append(parts, fmt.Sprintf("%s=%d", table, counts[table]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// backupDatabase writes every backup table as JSON lines, within one
+// snapshot so rows that reference each other are consistent.
+func backupDatabase(ctx context.Context, pool *pgxpool.Pool, w io.Writer) (map[string]int, error) {
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	out := bufio.NewWriter(w)
+	enc := json.NewEncoder(out)
+	header := BackupHeader{
+		Format:    backupFormat,
+		Version:   backupFormatVersion,
+		Service:   serviceName,
+		CreatedAt: time.Now().UTC(),
+		Tables:    backupTables,
+	}
+	if err := enc.Encode(header); err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for _, table := range backupTables {
+		// Table names come from backupTables, never from input
+		rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT to_jsonb(t) FROM %s t`, pgx.Identifier{table}.Sanitize()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", table, err)
+		}
+		for rows.Next() {
+			var row json.RawMessage
+			if err := rows.Scan(&row); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("%s: %w", table, err)
+			}
+			if err := enc.Encode(BackupRow{Table: table, Row: row}); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			counts[table]++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	return counts, out.Flush()
+}
+
+// restoreDatabase loads a backup in one transaction, replacing the contents of
+// every backup table. It refuses to restore over existing scores or players
+// unless replace is set.
+func restoreDatabase(ctx context.Context, pool *pgxpool.Pool, r io.Reader, replace bool) (map[string]int, error) {
+	in := bufio.NewReader(r)
+	dec := json.NewDecoder(in)
+
+	var header BackupHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("failed to read backup header: %w", err)
+	}
+	if header.Format != backupFormat {
+		return nil, fmt.Errorf("not a leaderboard backup")
+	}
+	if header.Version > backupFormatVersion {
+		return nil, fmt.Errorf("backup format version %d is newer than this build understands (%d)",
+			header.Version, backupFormatVersion)
+	}
+	known := map[string]bool{}
+	for _, table := range backupTables {
+		known[table] = true
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if !replace {
+		hasData, err := store.ScanExists(store.HasPlayerDataQuery.QueryRow(ctx, tx))
+		if err != nil {
+			return nil, err
+		}
+		if hasData {
+			return nil, errors.New("database already has scores or players; restore with -replace to overwrite them")
+		}
+	}
+	// Also clears what initDB seeds, such as the default game rule
+	tables := make([]string, len(backupTables))
+	for i, table := range backupTables {
+		tables[i] = pgx.Identifier{table}.Sanitize()
+	}
+	if _, err := tx.Exec(ctx, `TRUNCATE `+strings.Join(tables, ", ")+` CASCADE`); err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	var table string
+	var batch []json.RawMessage
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := restoreRows(ctx, tx, table, batch); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+		counts[table] += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		var row BackupRow
+		err := dec.Decode(&row)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		if !known[row.Table] {
+			return nil, fmt.Errorf("backup has unknown table %q", row.Table)
+		}
+		if row.Table != table || len(batch) == restoreBatchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			table = row.Table
+		}
+		batch = append(batch, row.Row)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	// Serial IDs carry on after the restored rows; tables without one get NULL
+	for restored := range counts {
+		resync := fmt.Sprintf(`SELECT setval(pg_get_serial_sequence($1, 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %s`,
+			pgx.Identifier{restored}.Sanitize())
+		hasID, err := store.ScanExists(store.HasIDColumnQuery.QueryRow(ctx, tx, restored))
+		if err != nil {
+			return nil, err
+		}
+		if !hasID {
+			continue
+		}
+		if _, err := tx.Exec(ctx, resync, restored); err != nil {
+			return nil, fmt.Errorf("%s: %w", restored, err)
+		}
+	}
+	return counts, tx.Commit(ctx)
+}
+
+// restoreRows inserts rows into table. Only the columns the rows carry are
+// set, so columns added since the backup get their defaults.
+func restoreRows(ctx context.Context, tx pgx.Tx, table string, rows []json.RawMessage) error {
+	var first map[string]json.RawMessage
+	if err := json.Unmarshal(rows[0], &first); err != nil {
+		return err
+	}
+	columns := make([]string, 0, len(first))
+	for column := range first {
+		columns = append(columns, pgx.Identifier{column}.Sanitize())
+	}
+	list := strings.Join(columns, ", ")
+	ident := pgx.Identifier{table}.Sanitize()
+	insert := fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM jsonb_populate_recordset(NULL::%s, $1::jsonb)`,
+		ident, list, list, ident)
+
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, insert, string(data))
+	return err
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SessionBan blocks every submission from a session until it is lifted.
+type SessionBan struct {
+	SessionID string    `json:"sessionId"`
+	Reason    string    `json:"reason,omitempty"`
+	BannedAt  time.Time `json:"bannedAt"`
+}
+
+func init() {
+	RegisterStage("ban", func(app *App) SubmissionStage {
+		return StageFunc{StageName: "ban", Fn: app.checkSessionBan}
+	})
+}
+
+// checkSessionBan rejects submissions from banned sessions. Bans are an
+// operator's decision, so they don't count against the session's reputation.
+func (app *App) checkSessionBan(ctx context.Context, submission *ScoreSubmission) error {
+	banned, err := store.ScanExists(store.SessionBanQuery.QueryRow(ctx, app.db, submission.SessionID))
+	if err != nil {
+		// Don't turn a database hiccup into rejected runs
+		log.Printf("Failed to check session ban: %v", err)
+		return nil
+	}
+	if banned {
+		return handlers.NewError(handlers.ErrBanned, "session is banned", nil)
+	}
+	return nil
+}
+
+func (app *App) getSessionBansHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getSessionBans")
+	defer span.End()
+
+	rows, err := store.ListSessionBansQuery.Query(ctx, app.db)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch bans", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	bans := []SessionBan{}
+	for rows.Next() {
+		var ban SessionBan
+		if err := rows.Scan(&ban.SessionID, &ban.Reason, &ban.BannedAt); err != nil {
+			log.Printf("Failed to scan row: %v", err)
+			continue
+		}
+		bans = append(bans, ban)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bans)
+}
+
+// putSessionBanHandler bans a session. The optional body is {"reason": "..."}.
+func (app *App) putSessionBanHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "putSessionBan")
+	defer span.End()
+
+	sessionID := mux.Vars(r)["id"]
+	if len(sessionID) > 100 {
+		http.Error(w, "session ID too long (max 100 characters)", http.StatusBadRequest)
+		return
+	}
+	var ban SessionBan
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&ban); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	ban.SessionID = sessionID
+	ban.Reason = strings.TrimSpace(ban.Reason)
+	if len(ban.Reason) > maxReportReasonLength {
+		http.Error(w, fmt.Sprintf("reason too long (max %d characters)", maxReportReasonLength), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.String("game.session_id", sessionID))
+
+	if err := store.BanSessionQuery.QueryRow(ctx, app.db, sessionID, ban.Reason).Scan(&ban.BannedAt); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to ban session", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🛡️ Session %s banned", sessionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ban)
+}
+
+func (app *App) deleteSessionBanHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "deleteSessionBan")
+	defer span.End()
+
+	sessionID := mux.Vars(r)["id"]
+	span.SetAttributes(attribute.String("game.session_id", sessionID))
+
+	tag, err := store.UnbanSessionQuery.Exec(ctx, app.db, sessionID)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to lift ban", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "Session not banned", http.StatusNotFound)
+		return
+	}
+	log.Printf("🛡️ Session %s unbanned", sessionID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/anticheat"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// Biomes in the order a run crosses them, with the score each starts at.
+	// Overridable with BIOMES.
+	defaultBiomes   = "arrakeen:0,shield-wall:1000,funeral-plain:2500,habbanya-erg:5000,deep-desert:10000"
+	maxBiomeNameLen = 32
+)
+
+// Biome is a stretch of the run, reached once the score passes MinScore.
+type Biome struct {
+	Name     string `json:"name"`
+	MinScore int    `json:"minScore"`
+	// MaxScore is where the next biome starts; unset for the last one
+	MaxScore *int `json:"maxScore,omitempty"`
+}
+
+// parseBiomes parses "name:minScore,..." in the order runs reach them. The
+// first biome must start at 0 and each later one further on.
+func parseBiomes(value string) ([]Biome, error) {
+	var biomes []Biome
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, minValue, ok := strings.Cut(entry, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("biome %q is not name:minScore", entry)
+		}
+		if len(name) > maxBiomeNameLen {
+			return nil, fmt.Errorf("biome %q: name too long (max %d characters)", entry, maxBiomeNameLen)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("biome %q listed twice", name)
+		}
+		minScore, err := strconv.Atoi(strings.TrimSpace(minValue))
+		if err != nil || minScore < 0 {
+			return nil, fmt.Errorf("biome %q: minScore must be a non-negative integer", entry)
+		}
+		if len(biomes) == 0 && minScore != 0 {
+			return nil, fmt.Errorf("biome %q: the first biome must start at 0", entry)
+		}
+		if len(biomes) > 0 {
+			previous := &biomes[len(biomes)-1]
+			if minScore <= previous.MinScore {
+				return nil, fmt.Errorf("biome %q must start after %q", name, previous.Name)
+			}
+			previous.MaxScore = &minScore
+		}
+		seen[name] = true
+		biomes = append(biomes, Biome{Name: name, MinScore: minScore})
+	}
+	return biomes, nil
+}
+
+// biome returns the configured biome with the given name.
+func (app *App) biome(name string) (Biome, bool) {
+	for _, biome := range app.biomes {
+		if biome.Name == name {
+			return biome, true
+		}
+	}
+	return Biome{}, false
+}
+
+// checkBiome normalizes the reported biome and checks the score falls in its
+// range. A run that claims a biome its score doesn't reach (or one it should
+// have passed) was tampered with.
+func (app *App) checkBiome(ctx context.Context, submission *ScoreSubmission) error {
+	submission.Biome = strings.ToLower(strings.TrimSpace(submission.Biome))
+	if submission.Biome == "" {
+		return nil
+	}
+	biome, ok := app.biome(submission.Biome)
+	if !ok {
+		return fmt.Errorf("unknown biome %q", submission.Biome)
+	}
+	if submission.Score < biome.MinScore || (biome.MaxScore != nil && submission.Score >= *biome.MaxScore) {
+		return anticheat.Suspicious(fmt.Errorf("score %d is outside biome %s", submission.Score, biome.Name))
+	}
+	return nil
+}
+
+// getBiomesHandler lists the configured biomes in the order runs reach them.
+func (app *App) getBiomesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(app.biomes)
+}
+
+// getBiomeLeaderboardHandler returns the current season's top runs that ended
+// in a biome.
+func (app *App) getBiomeLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getBiomeLeaderboard")
+	defer span.End()
+
+	name := strings.ToLower(mux.Vars(r)["biome"])
+	if _, ok := app.biome(name); !ok {
+		http.Error(w, "Unknown biome", http.StatusNotFound)
+		return
+	}
+	span.SetAttributes(attribute.String("query.biome", name))
+	app.serveFilteredTopScores(ctx, w, r, "biome", name)
+}
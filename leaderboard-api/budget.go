@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultQueryMaxRows   = 100000
+	defaultQueryTimeout   = 30 * time.Second
+	defaultQueryWorkMem   = "32MB"
+	truncatedTrailer      = "X-Truncated"
+	truncatedReasonHeader = "X-Truncated-Reason"
+
+	// Postgres query_canceled, which statement_timeout raises
+	pgQueryCanceled = "57014"
+)
+
+// queryBudget caps the reads clients can make arbitrarily expensive, such as
+// exports and streamed boards: at most maxRows rows, a statement timeout, and
+// a work_mem that makes Postgres spill large sorts to disk instead of growing.
+// A read that hits a cap ends early with a truncated flag rather than failing.
+type queryBudget struct {
+	maxRows int
+	timeout time.Duration
+	workMem string
+}
+
+// newQueryBudgetFromEnv reads QUERY_MAX_ROWS, QUERY_STATEMENT_TIMEOUT and
+// QUERY_WORK_MEM.
+func newQueryBudgetFromEnv() (*queryBudget, error) {
+	maxRows, err := strconv.Atoi(getEnv("QUERY_MAX_ROWS", strconv.Itoa(defaultQueryMaxRows)))
+	if err != nil || maxRows <= 0 {
+		return nil, fmt.Errorf("QUERY_MAX_ROWS must be a positive number")
+	}
+	timeout, err := time.ParseDuration(getEnv("QUERY_STATEMENT_TIMEOUT", defaultQueryTimeout.String()))
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("QUERY_STATEMENT_TIMEOUT must be a positive duration")
+	}
+	return &queryBudget{
+		maxRows: maxRows,
+		timeout: timeout,
+		workMem: getEnv("QUERY_WORK_MEM", defaultQueryWorkMem),
+	}, nil
+}
+
+// limit is the LIMIT for a read of up to want rows, 0 meaning all of them:
+// one row past the cap, so a capped read can tell it was cut short.
+func (b *queryBudget) limit(want int) int {
+	if want > 0 && want <= b.maxRows {
+		return want
+	}
+	return b.maxRows + 1
+}
+
+// budgetedQuery runs query in a read-only transaction with the budget's
+// statement timeout and work_mem. release closes the rows and ends the
+// transaction.
+func (app *App) budgetedQuery(ctx context.Context, query store.NamedQuery, args ...any) (rows pgx.Rows, release func(), err error) {
+	b := app.budget
+	tx, err := app.db.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, nil, store.Classify(err)
+	}
+	_, err = store.SetQueryBudgetQuery.Exec(ctx, tx, strconv.FormatInt(b.timeout.Milliseconds(), 10), b.workMem)
+	if err == nil {
+		rows, err = query.Query(ctx, tx, args...)
+	}
+	if err != nil {
+		tx.Rollback(context.WithoutCancel(ctx))
+		return nil, nil, store.Classify(err)
+	}
+	return rows, func() {
+		rows.Close()
+		tx.Rollback(context.WithoutCancel(ctx))
+	}, nil
+}
+
+// resultCap counts the rows of a budgeted read and records why it was cut
+// short, if it was.
+type resultCap struct {
+	endpoint string
+	max      int
+	rows     int
+	reason   string
+}
+
+func (app *App) newResultCap(endpoint string) *resultCap {
+	return &resultCap{endpoint: endpoint, max: app.budget.maxRows}
+}
+
+// allow counts a row, or reports false for the row past the cap.
+func (c *resultCap) allow() bool {
+	if c.rows >= c.max {
+		c.reason = "row_cap"
+		return false
+	}
+	c.rows++
+	return true
+}
+
+// finish records a statement timeout in err as the reason, and returns err
+// unless that's what it was.
+func (c *resultCap) finish(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgQueryCanceled {
+		c.reason = "timeout"
+		return nil
+	}
+	return err
+}
+
+// declare announces the truncation trailers; it must be called before the
+// body is written.
+func (c *resultCap) declare(w http.ResponseWriter) {
+	w.Header().Add("Trailer", truncatedTrailer)
+	w.Header().Add("Trailer", truncatedReasonHeader)
+}
+
+// report sets the trailers declared by declare and counts a truncated read.
+func (c *resultCap) report(ctx context.Context, w http.ResponseWriter) {
+	truncated := c.reason != ""
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Bool("query.truncated", truncated),
+		attribute.Int("query.rows", c.rows),
+	)
+	w.Header().Set(truncatedTrailer, strconv.FormatBool(truncated))
+	if !truncated {
+		return
+	}
+	w.Header().Set(truncatedReasonHeader, c.reason)
+	queryTruncationsTotal.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("endpoint", c.endpoint),
+		attribute.String("truncation_reason", c.reason),
+	))
+}
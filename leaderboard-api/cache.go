@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/cache"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	defaultCacheFallback       = "memory"
+	defaultCacheFallbackSize   = 10000
+	defaultCacheFallbackTTL    = 30 * time.Second
+	defaultCacheHealthInterval = 2 * time.Second
+)
+
+// newCacheFromEnv wraps client in a cache.Failover configured by
+// CACHE_FALLBACK ("memory" or "none"), CACHE_FALLBACK_SIZE,
+// CACHE_FALLBACK_TTL and CACHE_HEALTH_INTERVAL.
+func newCacheFromEnv(ctx context.Context, client *redis.Client) (*cache.Failover, error) {
+	opts := cache.FailoverOptions{
+		OnSwitch: func(ctx context.Context, backend string) {
+			cacheSwitchesTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.backend", backend)))
+		},
+	}
+
+	switch mode := getEnv("CACHE_FALLBACK", defaultCacheFallback); mode {
+	case "memory":
+		size, err := strconv.Atoi(getEnv("CACHE_FALLBACK_SIZE", strconv.Itoa(defaultCacheFallbackSize)))
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("CACHE_FALLBACK_SIZE must be a positive number")
+		}
+		opts.Fallback = cache.NewMemory(size)
+	case "none":
+		opts.Fallback = cache.Noop{}
+	default:
+		return nil, fmt.Errorf("CACHE_FALLBACK must be memory or none, got %q", mode)
+	}
+
+	var err error
+	if opts.FallbackTTL, err = time.ParseDuration(getEnv("CACHE_FALLBACK_TTL", defaultCacheFallbackTTL.String())); err != nil || opts.FallbackTTL <= 0 {
+		return nil, fmt.Errorf("CACHE_FALLBACK_TTL must be a positive duration")
+	}
+	if opts.HealthInterval, err = time.ParseDuration(getEnv("CACHE_HEALTH_INTERVAL", defaultCacheHealthInterval.String())); err != nil || opts.HealthInterval <= 0 {
+		return nil, fmt.Errorf("CACHE_HEALTH_INTERVAL must be a positive duration")
+	}
+
+	return cache.NewFailover(ctx, client, opts), nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/anticheat"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Rank engines. The sorted set is the default; Postgres answers every rank
+// query from SQL, as the API did before the sorted set existed.
+const (
+	rankEngineZSet     = "zset"
+	rankEnginePostgres = "postgres"
+)
+
+// configureCanary reads RANK_ENGINE, CANARY_COMPARE_PERCENT and
+// SUBMISSION_PIPELINE_CANDIDATE.
+func (app *App) configureCanary() error {
+	app.rankEngine = getEnv("RANK_ENGINE", rankEngineZSet)
+	if app.rankEngine != rankEngineZSet && app.rankEngine != rankEnginePostgres {
+		return fmt.Errorf("RANK_ENGINE must be %q or %q", rankEngineZSet, rankEnginePostgres)
+	}
+
+	percent, err := strconv.ParseFloat(getEnv("CANARY_COMPARE_PERCENT", "0"), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return fmt.Errorf("CANARY_COMPARE_PERCENT must be between 0 and 100")
+	}
+	app.canaryPercent = percent
+
+	if stages := getEnv("SUBMISSION_PIPELINE_CANDIDATE", ""); stages != "" {
+		candidate, err := newSubmissionPipeline(app, strings.Split(stages, ","))
+		if err != nil {
+			return fmt.Errorf("candidate pipeline: %w", err)
+		}
+		app.candidatePipeline = candidate
+	}
+	return nil
+}
+
+// otherRankEngine is the engine compared against the enforced one.
+func (app *App) otherRankEngine() string {
+	if app.rankEngine == rankEnginePostgres {
+		return rankEngineZSet
+	}
+	return rankEnginePostgres
+}
+
+// canaryComparison describes one comparison between the enforced and the
+// candidate implementation. Same defaults to reflect.DeepEqual.
+type canaryComparison[T any] struct {
+	Component string
+	Operation string
+	Enforced  T
+	Candidate func(ctx context.Context) (T, error)
+	Same      func(enforced, candidate T) bool
+	Details   []attribute.KeyValue
+}
+
+// canaryCompare runs the candidate on a sample of calls and compares its
+// result with the enforced one. The enforced result is always what the caller
+// uses; divergences are logged with the details and trace ID, and counted in
+// canary_comparisons_total. A candidate that can't answer right now (such as
+// a sorted set still being rebuilt) is skipped rather than counted.
+func canaryCompare[T any](ctx context.Context, app *App, c canaryComparison[T]) {
+	if app.canaryPercent <= 0 || rand.Float64()*100 >= app.canaryPercent {
+		return
+	}
+
+	same := c.Same
+	if same == nil {
+		same = func(a, b T) bool { return reflect.DeepEqual(a, b) }
+	}
+	ctx, span := tracer.Start(ctx, "canary."+c.Component+"."+c.Operation)
+	defer span.End()
+
+	start := time.Now()
+	got, err := c.Candidate(ctx)
+	if errors.Is(err, errRankingUnavailable) {
+		return
+	}
+
+	result := "match"
+	switch {
+	case err != nil:
+		result = "error"
+		span.RecordError(err)
+	case !same(c.Enforced, got):
+		result = "diverged"
+	}
+
+	span.SetAttributes(append(c.Details, attribute.String("canary.result", result))...)
+	canaryComparisonsTotal.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("canary.component", c.Component),
+		attribute.String("canary.operation", c.Operation),
+		attribute.String("canary.result", result),
+	))
+	canaryCandidateDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("canary.component", c.Component),
+		attribute.String("canary.operation", c.Operation),
+	))
+
+	if result == "diverged" {
+		fields := make([]string, 0, len(c.Details))
+		for _, kv := range c.Details {
+			fields = append(fields, fmt.Sprintf("%s=%s", kv.Key, kv.Value.Emit()))
+		}
+		log.Printf("🚩 Canary divergence in %s.%s: enforced %+v, candidate %+v (%s, trace %s)",
+			c.Component, c.Operation, c.Enforced, got, strings.Join(fields, " "),
+			trace.SpanContextFromContext(ctx).TraceID())
+	}
+}
+
+// compareCandidatePipeline runs the candidate pipeline on a copy of the
+// submission and compares its verdict with the enforced one.
+func (app *App) compareCandidatePipeline(ctx context.Context, submission *ScoreSubmission, enforcedErr error) {
+	if app.candidatePipeline == nil {
+		return
+	}
+	copied := *submission
+	canaryCompare(ctx, app, canaryComparison[pipelineOutcome]{
+		Component: "pipeline",
+		Operation: "validate",
+		Enforced:  newPipelineOutcome(enforcedErr),
+		Candidate: func(ctx context.Context) (pipelineOutcome, error) {
+			return newPipelineOutcome(app.candidatePipeline.check(ctx, &copied)), nil
+		},
+		// Different reasons for the same verdict, such as a changed limit in
+		// the message, are not a divergence
+		Same: func(enforced, candidate pipelineOutcome) bool { return enforced.Verdict == candidate.Verdict },
+		Details: []attribute.KeyValue{
+			attribute.String("game.session_id", submission.SessionID),
+			attribute.String("player.name", submission.PlayerName),
+			attribute.Int("game.score", submission.Score),
+			attribute.String("game.mode", submission.Mode),
+			attribute.String("game.difficulty", submission.Difficulty),
+		},
+	})
+}
+
+// check runs the stages like run, but without recording outcomes or counting
+// rejections against the session, so candidates have no side effects.
+func (p *submissionPipeline) check(ctx context.Context, submission *ScoreSubmission) error {
+	for _, stage := range p.stages {
+		if err := stage.Check(ctx, submission); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pipelineOutcome is a pipeline's verdict, "accepted", "rejected" or, for
+// anti-cheat verdicts, "flagged", with the rejection reason.
+type pipelineOutcome struct {
+	Verdict string
+	Reason  string
+}
+
+func newPipelineOutcome(err error) pipelineOutcome {
+	switch {
+	case err == nil:
+		return pipelineOutcome{Verdict: "accepted"}
+	case anticheat.IsSuspicious(err):
+		return pipelineOutcome{Verdict: "flagged", Reason: err.Error()}
+	default:
+		return pipelineOutcome{Verdict: "rejected", Reason: err.Error()}
+	}
+}
+
+// compareRankOf checks the rank of a score value against the other engine.
+func (app *App) compareRankOf(ctx context.Context, score, rank int) {
+	canaryCompare(ctx, app, canaryComparison[int]{
+		Component: "ranking",
+		Operation: "rank_of",
+		Enforced:  rank,
+		Candidate: func(ctx context.Context) (int, error) {
+			if app.rankEngine == rankEngineZSet {
+				return app.store.Rank(ctx, score)
+			}
+			return app.rankingRankOf(ctx, score)
+		},
+		Details: []attribute.KeyValue{
+			attribute.String("ranking.engine", app.rankEngine),
+			attribute.Int("game.score", score),
+		},
+	})
+}
+
+// comparePosition checks a stored score's position against the other engine.
+func (app *App) comparePosition(ctx context.Context, scoreID, score, rank int) {
+	canaryCompare(ctx, app, canaryComparison[int]{
+		Component: "ranking",
+		Operation: "position",
+		Enforced:  rank,
+		Candidate: func(ctx context.Context) (int, error) {
+			if app.rankEngine == rankEngineZSet {
+				return app.postgresPosition(ctx, scoreID, score)
+			}
+			return app.rankingPosition(ctx, scoreID)
+		},
+		Details: []attribute.KeyValue{
+			attribute.String("ranking.engine", app.rankEngine),
+			attribute.Int("score.id", scoreID),
+			attribute.Int("game.score", score),
+		},
+	})
+}
+
+// compareTop checks the order of the unfiltered board against the other engine.
+func (app *App) compareTop(ctx context.Context, limit int, leaderboard []LeaderboardEntry) {
+	ids := make([]int, len(leaderboard))
+	for i, entry := range leaderboard {
+		ids[i] = entry.ID
+	}
+	canaryCompare(ctx, app, canaryComparison[[]int]{
+		Component: "ranking",
+		Operation: "top",
+		Enforced:  ids,
+		Candidate: func(ctx context.Context) ([]int, error) {
+			if app.rankEngine == rankEngineZSet {
+				return app.postgresTopIDs(ctx, limit)
+			}
+			return app.rankingTop(ctx, limit)
+		},
+		Details: []attribute.KeyValue{
+			attribute.String("ranking.engine", app.rankEngine),
+			attribute.Int("query.limit", limit),
+		},
+	})
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// Only one replica purges per debounce window
+	cacheKeyPurgeLock = "leaderboard:cdn:purge:lock"
+	// Surrogate keys touched since the last purge
+	cacheKeyPurgeKeys = "leaderboard:cdn:purge:keys"
+
+	surrogateKeyLeaderboard = handlers.SurrogateKeyLeaderboard
+
+	// Cloudflare accepts at most 30 cache tags per purge call
+	cloudflareMaxTagsPerPurge = 30
+)
+
+// surrogateKeyPlayer is the surrogate key of one player's responses.
+func surrogateKeyPlayer(name string) string {
+	return handlers.SurrogateKeyPlayer(name)
+}
+
+// cdnPurger invalidates cached copies of public URLs at an edge cache.
+type cdnPurger interface {
+	Name() string
+	Purge(ctx context.Context, urls []string) error
+	PurgeKeys(ctx context.Context, keys []string) error
+}
+
+// cdnConfig describes what to purge and how long the edge may cache responses.
+// In key mode the responses' surrogate keys are purged instead of fixed URLs.
+type cdnConfig struct {
+	purger   cdnPurger
+	urls     []string
+	byKey    bool
+	sMaxAge  int
+	debounce time.Duration
+}
+
+// newCDNConfigFromEnv returns nil when CDN purging is not configured.
+func newCDNConfigFromEnv() (*cdnConfig, error) {
+	var purger cdnPurger
+	switch provider := getEnv("CDN_PURGE_PROVIDER", ""); provider {
+	case "":
+		return nil, nil
+	case "cloudflare":
+		purger = &cloudflarePurger{
+			zoneID: getEnv("CLOUDFLARE_ZONE_ID", ""),
+			token:  getEnv("CLOUDFLARE_API_TOKEN", ""),
+			client: &http.Client{Timeout: 10 * time.Second},
+		}
+	case "fastly":
+		purger = &fastlyPurger{
+			token:     getEnv("FASTLY_API_TOKEN", ""),
+			serviceID: getEnv("FASTLY_SERVICE_ID", ""),
+			client:    &http.Client{Timeout: 10 * time.Second},
+		}
+	case "varnish":
+		purger = &varnishPurger{
+			purgeURL: getEnv("VARNISH_PURGE_URL", ""),
+			client:   &http.Client{Timeout: 10 * time.Second},
+		}
+	default:
+		return nil, fmt.Errorf("unknown CDN purge provider %q", provider)
+	}
+
+	var byKey bool
+	switch mode := getEnv("CDN_PURGE_MODE", "urls"); mode {
+	case "urls":
+	case "keys":
+		byKey = true
+	default:
+		return nil, fmt.Errorf("unknown CDN purge mode %q", mode)
+	}
+
+	var urls []string
+	for _, u := range strings.Split(getEnv("CDN_PURGE_URLS", ""), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 && !byKey {
+		return nil, fmt.Errorf("CDN_PURGE_URLS is required when CDN_PURGE_MODE is urls")
+	}
+
+	sMaxAge, err := strconv.Atoi(getEnv("CDN_CACHE_MAX_AGE", "300"))
+	if err != nil || sMaxAge < 0 {
+		return nil, fmt.Errorf("invalid CDN_CACHE_MAX_AGE")
+	}
+	debounce, err := time.ParseDuration(getEnv("CDN_PURGE_DEBOUNCE", "2s"))
+	if err != nil || debounce <= 0 {
+		return nil, fmt.Errorf("invalid CDN_PURGE_DEBOUNCE")
+	}
+
+	return &cdnConfig{purger: purger, urls: urls, byKey: byKey, sMaxAge: sMaxAge, debounce: debounce}, nil
+}
+
+// cacheControl is the header for purgeable GET responses: browsers revalidate,
+// the edge keeps the copy until it is purged or s-maxage runs out.
+func (c *cdnConfig) cacheControl() string {
+	return fmt.Sprintf("public, max-age=0, s-maxage=%d", c.sMaxAge)
+}
+
+// runCDNPurger purges the configured URLs, or the touched surrogate keys, after
+// each burst of leaderboard changes.
+func (app *App) runCDNPurger(ctx context.Context, c *cdnConfig) {
+	if c.byKey {
+		log.Printf("✅ CDN purging enabled (%s, by surrogate key)", c.purger.Name())
+	} else {
+		log.Printf("✅ CDN purging enabled (%s, %d URLs)", c.purger.Name(), len(c.urls))
+	}
+
+	app.followChanges(ctx, cacheKeyPurgeLock, c.debounce, func(ctx context.Context) {
+		app.purgeCDN(ctx, c)
+	})
+}
+
+func (app *App) purgeCDN(ctx context.Context, c *cdnConfig) {
+	ctx, span := tracer.Start(ctx, "purgeCDN")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("cdn.provider", c.purger.Name()))
+
+	var err error
+	if c.byKey {
+		err = app.purgeSurrogateKeys(ctx, c)
+	} else {
+		span.SetAttributes(attribute.Int("cdn.urls", len(c.urls)))
+		err = c.purger.Purge(ctx, c.urls)
+	}
+
+	result := "success"
+	if err != nil {
+		result = "failed"
+		span.RecordError(err)
+		log.Printf("Failed to purge CDN cache: %v", err)
+	}
+	cdnPurgeTotal.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("provider", c.purger.Name()),
+		attribute.String("result", result),
+	))
+}
+
+// purgeSurrogateKeys purges every key touched since the last purge. Keys are
+// put back if the purge fails so the next round retries them.
+func (app *App) purgeSurrogateKeys(ctx context.Context, c *cdnConfig) error {
+	pipe := app.redis.TxPipeline()
+	members := pipe.SMembers(ctx, cacheKeyPurgeKeys)
+	pipe.Del(ctx, cacheKeyPurgeKeys)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	keys := members.Val()
+	if len(keys) == 0 {
+		return nil
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("cdn.keys", len(keys)))
+
+	if err := c.purger.PurgeKeys(ctx, keys); err != nil {
+		app.redis.SAdd(ctx, cacheKeyPurgeKeys, keys)
+		return err
+	}
+	return nil
+}
+
+// markSurrogateKeys queues keys whose cached responses are now stale.
+func (app *App) markSurrogateKeys(ctx context.Context, keys ...string) {
+	if app.cdn == nil || !app.cdn.byKey || len(keys) == 0 {
+		return
+	}
+	if err := app.redis.SAdd(ctx, cacheKeyPurgeKeys, keys).Err(); err != nil {
+		log.Printf("Failed to queue surrogate keys for purge: %v", err)
+	}
+}
+
+// cloudflarePurger purges by URL through the Cloudflare v4 API.
+type cloudflarePurger struct {
+	zoneID string
+	token  string
+	client *http.Client
+}
+
+func (p *cloudflarePurger) Name() string { return "cloudflare" }
+
+func (p *cloudflarePurger) Purge(ctx context.Context, urls []string) error {
+	body, err := json.Marshal(map[string][]string{"files": urls})
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/purge_cache", p.zoneID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	return doPurgeRequest(p.client, req)
+}
+
+// PurgeKeys purges by cache tag, which Cloudflare reads from the Cache-Tag header.
+func (p *cloudflarePurger) PurgeKeys(ctx context.Context, keys []string) error {
+	endpoint := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/purge_cache", p.zoneID)
+	for start := 0; start < len(keys); start += cloudflareMaxTagsPerPurge {
+		end := start + cloudflareMaxTagsPerPurge
+		if end > len(keys) {
+			end = len(keys)
+		}
+		body, err := json.Marshal(map[string][]string{"tags": keys[start:end]})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+p.token)
+		req.Header.Set("Content-Type", "application/json")
+
+		if err := doPurgeRequest(p.client, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fastlyPurger purges by URL or surrogate key through the Fastly API.
+type fastlyPurger struct {
+	token     string
+	serviceID string
+	client    *http.Client
+}
+
+func (p *fastlyPurger) Name() string { return "fastly" }
+
+func (p *fastlyPurger) Purge(ctx context.Context, urls []string) error {
+	for _, u := range urls {
+		target := strings.TrimPrefix(strings.TrimPrefix(u, "https://"), "http://")
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.fastly.com/purge/"+target, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Fastly-Key", p.token)
+		req.Header.Set("Accept", "application/json")
+
+		if err := doPurgeRequest(p.client, req); err != nil {
+			return fmt.Errorf("purge %s: %w", u, err)
+		}
+	}
+	return nil
+}
+
+func (p *fastlyPurger) PurgeKeys(ctx context.Context, keys []string) error {
+	if p.serviceID == "" {
+		return fmt.Errorf("FASTLY_SERVICE_ID is required to purge by surrogate key")
+	}
+	body, err := json.Marshal(map[string][]string{"surrogate_keys": keys})
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("https://api.fastly.com/service/%s/purge", p.serviceID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Fastly-Key", p.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	return doPurgeRequest(p.client, req)
+}
+
+// varnishPurger sends PURGE requests to a Varnish instance. Key purges use the
+// xkey vmod's xkey-purge header; the VCL must accept PURGE from the API.
+type varnishPurger struct {
+	purgeURL string
+	client   *http.Client
+}
+
+func (p *varnishPurger) Name() string { return "varnish" }
+
+func (p *varnishPurger) Purge(ctx context.Context, urls []string) error {
+	for _, u := range urls {
+		req, err := http.NewRequestWithContext(ctx, "PURGE", u, nil)
+		if err != nil {
+			return err
+		}
+		if err := doPurgeRequest(p.client, req); err != nil {
+			return fmt.Errorf("purge %s: %w", u, err)
+		}
+	}
+	return nil
+}
+
+func (p *varnishPurger) PurgeKeys(ctx context.Context, keys []string) error {
+	if p.purgeURL == "" {
+		return fmt.Errorf("VARNISH_PURGE_URL is required to purge by surrogate key")
+	}
+	req, err := http.NewRequestWithContext(ctx, "PURGE", p.purgeURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("xkey-purge", strings.Join(keys, " "))
+
+	return doPurgeRequest(p.client, req)
+}
+
+func doPurgeRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("purge API returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// setEdgeCacheHeaders labels a GET response with its surrogate keys and marks it
+// cacheable at the edge when purging is enabled. Cache-Tag is Cloudflare's
+// name for the same thing. In URL mode only leaderboard listings are purged,
+// so nothing else is cached.
+func (app *App) setEdgeCacheHeaders(w http.ResponseWriter, keys ...string) {
+	if len(keys) > 0 {
+		w.Header().Set("Surrogate-Key", strings.Join(keys, " "))
+		w.Header().Set("Cache-Tag", strings.Join(keys, ","))
+	}
+	if app.cdn != nil && (app.cdn.byKey || slices.Contains(keys, surrogateKeyLeaderboard)) {
+		w.Header().Set("Cache-Control", app.cdn.cacheControl())
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// Redis keys for cross-replica change notification
+	cacheKeyLeaderboardVersion = "leaderboard:version"
+	changesChannel             = "leaderboard:changes"
+
+	// Long-poll limits (kept below the server WriteTimeout)
+	defaultChangesWait = 10 * time.Second
+	maxChangesWait     = 30 * time.Second
+
+	// Backoff for a version bump Redis refused
+	changeRetryBaseDelay = 250 * time.Millisecond
+	changeRetryMaxDelay  = 5 * time.Second
+
+	// A burst that never settles is still followed after this many debounces
+	maxDebounceWindows = 10
+)
+
+// changeFeed tracks a monotonically increasing leaderboard version and wakes
+// every waiting long-poll request when it moves forward.
+type changeFeed struct {
+	mu      sync.Mutex
+	version int64
+	changed chan struct{}
+	// retrying is set while a failed version bump is being retried
+	retrying atomic.Bool
+}
+
+type ChangesResponse struct {
+	Cursor  string `json:"cursor"`
+	Changed bool   `json:"changed"`
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{changed: make(chan struct{})}
+}
+
+// current returns the latest version and a channel that is closed on the next change.
+func (f *changeFeed) current() (int64, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.version, f.changed
+}
+
+// advance moves the feed to version and wakes waiters. Stale versions are ignored.
+func (f *changeFeed) advance(version int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if version <= f.version {
+		return
+	}
+	f.version = version
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// publishChange bumps the shared leaderboard version and notifies other replicas.
+// When Redis is unavailable only waiters on this replica are woken.
+func (app *App) publishChange(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "publishChange")
+	defer span.End()
+
+	version, err := app.redis.Incr(ctx, cacheKeyLeaderboardVersion).Result()
+	if err != nil {
+		// The version only ever comes from Redis: one made up here would put
+		// the since cursors this replica hands out out of step with the others'
+		span.RecordError(err)
+		log.Printf("Failed to bump leaderboard version, retrying: %v", err)
+		app.retryPublishChange(context.WithoutCancel(ctx))
+		return
+	}
+	span.SetAttributes(attribute.Int64("leaderboard.version", version))
+	app.announceChange(ctx, version)
+}
+
+// retryPublishChange bumps the version in the background until Redis
+// answers. Changes that fail while a retry is pending share its bump, since
+// one bump tells waiters the same as several.
+func (app *App) retryPublishChange(ctx context.Context) {
+	if !app.changes.retrying.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		delay := changeRetryBaseDelay
+		for {
+			time.Sleep(delay)
+			// Cleared before the attempt, so a change failing during it
+			// starts a retry of its own instead of being folded into this one
+			app.changes.retrying.Store(false)
+			version, err := app.redis.Incr(ctx, cacheKeyLeaderboardVersion).Result()
+			if err == nil {
+				app.announceChange(ctx, version)
+				return
+			}
+			if !app.changes.retrying.CompareAndSwap(false, true) {
+				return
+			}
+			delay = min(delay*2, changeRetryMaxDelay)
+		}
+	}()
+}
+
+// announceChange moves this replica to version and tells the others.
+func (app *App) announceChange(ctx context.Context, version int64) {
+	app.changes.advance(version)
+	if err := app.redis.Publish(ctx, changesChannel, version).Err(); err != nil {
+		log.Printf("Failed to publish leaderboard change: %v", err)
+	}
+}
+
+// watchChanges follows change notifications published by other replicas.
+func (app *App) watchChanges(ctx context.Context) {
+	if version, err := app.redis.Get(ctx, cacheKeyLeaderboardVersion).Int64(); err == nil {
+		app.changes.advance(version)
+	}
+
+	pubsub := app.redis.Subscribe(ctx, changesChannel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		version, err := strconv.ParseInt(msg.Payload, 10, 64)
+		if err != nil {
+			continue
+		}
+		app.changes.advance(version)
+	}
+}
+
+// followChanges calls fn after each burst of leaderboard changes has settled for
+// debounce, with every change restarting the wait. A steady stream of changes
+// still calls fn every maxDebounceWindows debounces. lockKey ensures only one
+// replica runs fn per debounce window.
+func (app *App) followChanges(ctx context.Context, lockKey string, debounce time.Duration, fn func(ctx context.Context)) {
+	handled, _ := app.changes.current()
+	for {
+		version, changed := app.changes.current()
+		if version == handled {
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		deadline := time.After(maxDebounceWindows * debounce)
+		quiet := time.After(debounce)
+	settle:
+		for {
+			_, changed := app.changes.current()
+			select {
+			case <-changed:
+				quiet = time.After(debounce)
+			case <-quiet:
+				break settle
+			case <-deadline:
+				break settle
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		handled, _ = app.changes.current()
+		acquired, err := app.redis.SetNX(ctx, lockKey, 1, debounce).Result()
+		if err == nil && !acquired {
+			// Another replica handles this window
+			continue
+		}
+		fn(ctx)
+	}
+}
+
+func (app *App) getChangesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getChanges")
+	defer span.End()
+
+	var since int64
+	if sinceStr := r.URL.Query().Get("since"); sinceStr != "" {
+		s, err := strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil || s < 0 {
+			http.Error(w, "Invalid since cursor", http.StatusBadRequest)
+			return
+		}
+		since = s
+	}
+
+	wait := defaultChangesWait
+	if waitStr := r.URL.Query().Get("wait"); waitStr != "" {
+		d, err := time.ParseDuration(waitStr)
+		if err != nil || d < 0 {
+			http.Error(w, "Invalid wait duration", http.StatusBadRequest)
+			return
+		}
+		wait = d
+	}
+	if wait > maxChangesWait {
+		wait = maxChangesWait
+	}
+	span.SetAttributes(
+		attribute.Int64("changes.since", since),
+		attribute.Float64("changes.wait_seconds", wait.Seconds()),
+	)
+
+	// Long polls outlive the default write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 5*time.Second)); err != nil {
+		log.Printf("Failed to extend write deadline: %v", err)
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	version, changed := app.changes.current()
+	for version <= since {
+		select {
+		case <-changed:
+			version, changed = app.changes.current()
+		case <-timer.C:
+			span.SetAttributes(attribute.Bool("changes.timed_out", true))
+			writeChanges(w, version, false)
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	span.SetAttributes(attribute.Bool("changes.timed_out", false))
+	writeChanges(w, version, true)
+}
+
+func writeChanges(w http.ResponseWriter, version int64, changed bool) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(ChangesResponse{
+		Cursor:  strconv.FormatInt(version, 10),
+		Changed: changed,
+	})
+}
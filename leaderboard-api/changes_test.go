@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFollowChangesWaitsForBurstToSettle(t *testing.T) {
+	app, _ := newTestApp(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const debounce = 100 * time.Millisecond
+	calls := make(chan time.Time, 10)
+	go app.followChanges(ctx, "test:follow:lock", debounce, func(context.Context) {
+		calls <- time.Now()
+	})
+
+	// A burst lasting longer than the debounce, with shorter gaps
+	var last time.Time
+	for version := int64(1); version <= 8; version++ {
+		app.changes.advance(version)
+		last = time.Now()
+		time.Sleep(debounce / 3)
+	}
+
+	select {
+	case called := <-calls:
+		if called.Before(last.Add(debounce)) {
+			t.Errorf("fn ran %v after the last change, want at least %v", called.Sub(last), debounce)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("fn never ran after the burst")
+	}
+	select {
+	case <-calls:
+		t.Error("fn ran more than once for one burst")
+	case <-time.After(2 * debounce):
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	checksumAlgorithm = "sha256-chain-v1"
+
+	// A checkpoint is reported every this many entries, so a mirror that
+	// disagrees can find the first entry that differs
+	checksumCheckpointInterval = 10
+)
+
+// LeaderboardChecksum is a rolling hash over the board as
+// /api/leaderboard/top serves it with the same limit and tags.
+type LeaderboardChecksum struct {
+	Algorithm   string               `json:"algorithm"`
+	Limit       int                  `json:"limit"`
+	Tags        []string             `json:"tags,omitempty"`
+	Entries     int                  `json:"entries"`
+	Checksum    string               `json:"checksum"`
+	Checkpoints []ChecksumCheckpoint `json:"checkpoints"`
+	// Version is the leaderboard version this replica last saw
+	Version    int64     `json:"version"`
+	ComputedAt time.Time `json:"computedAt"`
+}
+
+// ChecksumCheckpoint is the rolling hash after the entry at Rank.
+type ChecksumCheckpoint struct {
+	Rank     int    `json:"rank"`
+	Checksum string `json:"checksum"`
+}
+
+// checksumLeaf encodes one entry as rank, id, player name, score and UTC
+// creation time, newline-separated. Player names can't hold control
+// characters, so the encoding is unambiguous.
+func checksumLeaf(entry LeaderboardEntry) []byte {
+	return []byte(fmt.Sprintf("%d\n%d\n%s\n%d\n%s", entry.Rank, entry.ID, entry.PlayerName, entry.Score,
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano)))
+}
+
+// leaderboardChecksum chains the entries in rank order: each step hashes the
+// previous hash with the hash of the next leaf, starting from the hash of the
+// algorithm name. It returns the final hash and a checkpoint every interval
+// entries.
+func leaderboardChecksum(entries []LeaderboardEntry, interval int) (string, []ChecksumCheckpoint) {
+	sum := sha256.Sum256([]byte(checksumAlgorithm))
+	checkpoints := []ChecksumCheckpoint{}
+	for i, entry := range entries {
+		leaf := sha256.Sum256(checksumLeaf(entry))
+		sum = sha256.Sum256(append(sum[:], leaf[:]...))
+		if (i+1)%interval == 0 {
+			checkpoints = append(checkpoints, ChecksumCheckpoint{Rank: entry.Rank, Checksum: hex.EncodeToString(sum[:])})
+		}
+	}
+	return hex.EncodeToString(sum[:]), checkpoints
+}
+
+// getLeaderboardChecksumHandler returns the checksum of the board this
+// replica serves, cache included, so mirrors and clients can compare
+// replicas or check a copy of the board without downloading it again.
+func (app *App) getLeaderboardChecksumHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getLeaderboardChecksum")
+	defer span.End()
+
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 || parsed > maxJSONLeaderboardLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxJSONLeaderboardLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	tags, err := parseTagFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.Int("query.limit", limit), attribute.StringSlice("query.tags", tags))
+
+	version, _ := app.changes.current()
+	leaderboard, err := app.topScores(ctx, limit, tags)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	// Hash the names as /api/leaderboard/top shows them
+	leaderboard = maskEntries(app.nameMask(), leaderboard)
+	checksum, checkpoints := leaderboardChecksum(leaderboard, checksumCheckpointInterval)
+	span.SetAttributes(attribute.String("leaderboard.checksum", checksum))
+
+	app.setEdgeCacheHeaders(w, surrogateKeyLeaderboard)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LeaderboardChecksum{
+		Algorithm:   checksumAlgorithm,
+		Limit:       limit,
+		Tags:        tags,
+		Entries:     len(leaderboard),
+		Checksum:    checksum,
+		Checkpoints: checkpoints,
+		Version:     version,
+		ComputedAt:  time.Now().UTC(),
+	})
+}
@@ -0,0 +1,240 @@
+// Package client is a Go client for the Spice Runner leaderboard API.
+//
+// Requests carry the caller's W3C trace context, so they join the caller's
+// trace in Tempo, and failed requests are retried with backoff. Score
+// submissions are given a submission ID when they don't have one, which makes
+// retrying them safe: the API stores a submission at most once.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultMaxRetries = 3
+	defaultBackoff    = 200 * time.Millisecond
+	maxBackoff        = 5 * time.Second
+)
+
+// Client calls the leaderboard API. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+	userAgent  string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client requests are sent with. Wrap its
+// transport with otelhttp to get client spans as well as propagation.
+func WithHTTPClient(c *http.Client) Option {
+	return func(client *Client) { client.httpClient = c }
+}
+
+// WithRetries sets how many times a failed request is retried (default 3) and
+// the delay before the first retry, which doubles on each attempt.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(client *Client) {
+		client.maxRetries = maxRetries
+		client.backoff = backoff
+	}
+}
+
+// WithUserAgent sets the User-Agent header, e.g. to name the calling service.
+func WithUserAgent(userAgent string) Option {
+	return func(client *Client) { client.userAgent = userAgent }
+}
+
+// New returns a client for the API at baseURL, e.g.
+// "http://leaderboard-api.default.svc.cluster.local".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+		userAgent:  "spice-runner-leaderboard-client",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// APIError is a response with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("leaderboard API: %d %s", e.StatusCode, e.Message)
+}
+
+// Retryable reports whether the request may succeed if sent again.
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// SubmitScore submits a finished run. If submission.SubmissionID is empty one
+// is generated, so a retried request can't store the run twice. Replayed is
+// set on the response when the API had already stored it.
+func (c *Client) SubmitScore(ctx context.Context, submission ScoreSubmission) (*ScoreResponse, error) {
+	if submission.SubmissionID == "" {
+		id, err := newSubmissionID()
+		if err != nil {
+			return nil, err
+		}
+		submission.SubmissionID = id
+	}
+	body, err := json.Marshal(submission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode submission: %w", err)
+	}
+
+	var response ScoreResponse
+	resp, err := c.do(ctx, http.MethodPost, "/api/scores", nil, body, &response)
+	if err != nil {
+		return nil, err
+	}
+	response.Replayed = resp.Header.Get("Idempotent-Replayed") == "true"
+	return &response, nil
+}
+
+// TopScores returns the current season's top limit scores carrying every tag.
+// limit is at most 1000; 0 asks for the default of 100.
+func (c *Client) TopScores(ctx context.Context, limit int, tags ...string) ([]LeaderboardEntry, error) {
+	if limit > 1000 {
+		return nil, fmt.Errorf("limit must be at most 1000")
+	}
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	for _, tag := range tags {
+		query.Add("tag", tag)
+	}
+
+	var entries []LeaderboardEntry
+	if _, err := c.do(ctx, http.MethodGet, "/api/leaderboard/top", query, nil, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// PlayerStats returns a player's best scores, rank and recent runs.
+func (c *Client) PlayerStats(ctx context.Context, playerName string) (*PlayerStats, error) {
+	var stats PlayerStats
+	if _, err := c.do(ctx, http.MethodGet, "/api/leaderboard/player/"+url.PathEscape(playerName), nil, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// do sends a request, retrying network errors, 429s and 5xx responses, and
+// decodes a successful JSON response into out.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte, out interface{}) (*http.Response, error) {
+	u := c.baseURL.JoinPath(path)
+	u.RawQuery = query.Encode()
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, u.String(), body, out)
+		if err == nil {
+			return resp, nil
+		}
+		if attempt >= c.maxRetries || !retryable(err) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, u string, body []byte, out interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// Carry the caller's trace so the API's spans join it
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return resp, nil
+}
+
+func retryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable()
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// newSubmissionID returns a random (version 4) UUID.
+func newSubmissionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate submission ID: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ScoreSubmission is a finished run. Mode, Difficulty and Extras are optional;
+// see the API's README for the allowed tags and extras.
+type ScoreSubmission struct {
+	SubmissionID   string                     `json:"submissionId,omitempty"`
+	PlayerName     string                     `json:"playerName"`
+	Score          int                        `json:"score"`
+	SessionID      string                     `json:"sessionId"`
+	PlayerID       string                     `json:"playerId,omitempty"`
+	Tags           []string                   `json:"tags,omitempty"`
+	ExtrasVersion  int                        `json:"extrasVersion,omitempty"`
+	Extras         map[string]json.RawMessage `json:"extras,omitempty"`
+	Mode           string                     `json:"mode,omitempty"`
+	Difficulty     string                     `json:"difficulty,omitempty"`
+	EventLog       string                     `json:"eventLog,omitempty"`
+	SpiceCollected int                        `json:"spiceCollected,omitempty"`
+}
+
+type ScoreResponse struct {
+	ID            int       `json:"id"`
+	PlayerName    string    `json:"playerName"`
+	DisplayName   string    `json:"displayName,omitempty"`
+	Discriminator string    `json:"discriminator,omitempty"`
+	Score         int       `json:"score"`
+	Rank          int       `json:"rank"`
+	CreatedAt     time.Time `json:"createdAt"`
+	// Replayed is set when the submission had already been stored.
+	Replayed bool `json:"-"`
+}
+
+type LeaderboardEntry struct {
+	Rank          int                        `json:"rank"`
+	ID            int                        `json:"id,omitempty"`
+	PlayerName    string                     `json:"playerName"`
+	Score         int                        `json:"score"`
+	Tags          []string                   `json:"tags,omitempty"`
+	ExtrasVersion int                        `json:"extrasVersion,omitempty"`
+	Extras        map[string]json.RawMessage `json:"extras,omitempty"`
+	CreatedAt     time.Time                  `json:"createdAt"`
+}
+
+type PlayerStats struct {
+	PlayerName   string             `json:"playerName"`
+	BestScore    int                `json:"bestScore"`
+	SeasonBest   int                `json:"seasonBest"`
+	CurrentRank  int                `json:"currentRank"`
+	TotalGames   int                `json:"totalGames"`
+	RecentScores []LeaderboardEntry `json:"recentScores"`
+}
@@ -0,0 +1,358 @@
+// Command spice-admin runs moderation and maintenance tasks against a
+// leaderboard API through its /admin endpoints, so operators never need to
+// run SQL against production.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type adminClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// do sends an admin request and decodes a JSON response into out, if given.
+func (c *adminClient) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.baseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// moderationItem mirrors the API's ModerationItem.
+type moderationItem struct {
+	ScoreID          int       `json:"scoreId"`
+	PlayerName       string    `json:"playerName"`
+	Score            int       `json:"score"`
+	SessionID        string    `json:"sessionId"`
+	CreatedAt        time.Time `json:"createdAt"`
+	Quarantined      bool      `json:"quarantined"`
+	QuarantineReason string    `json:"quarantineReason,omitempty"`
+	OpenReports      int       `json:"openReports"`
+	Reasons          []string  `json:"reasons"`
+}
+
+type sessionBan struct {
+	SessionID string    `json:"sessionId"`
+	Reason    string    `json:"reason,omitempty"`
+	BannedAt  time.Time `json:"bannedAt"`
+}
+
+// playerChange mirrors the API's PlayerChange.
+type playerChange struct {
+	PlayerName string `json:"playerName"`
+	Scores     int64  `json:"scores"`
+}
+
+type season struct {
+	ID        int        `json:"id"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndsAt    *time.Time `json:"endsAt,omitempty"`
+}
+
+func main() {
+	client := &adminClient{http: &http.Client{Timeout: 60 * time.Second}}
+	var asJSON, yes bool
+
+	root := &cobra.Command{
+		Use:           "spice-admin",
+		Short:         "Moderate and maintain the Spice Runner leaderboard",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if client.token == "" {
+				return fmt.Errorf("an admin token is required (--token or ADMIN_TOKEN)")
+			}
+			if _, err := url.ParseRequestURI(client.baseURL); err != nil {
+				return fmt.Errorf("invalid --url: %w", err)
+			}
+			return nil
+		},
+	}
+	root.PersistentFlags().StringVar(&client.baseURL, "url", envOr("SPICE_ADMIN_URL", "http://localhost:8080"), "leaderboard API base URL (SPICE_ADMIN_URL)")
+	root.PersistentFlags().StringVar(&client.token, "token", os.Getenv("ADMIN_TOKEN"), "admin bearer token (ADMIN_TOKEN)")
+	root.PersistentFlags().BoolVar(&asJSON, "json", false, "print JSON instead of a table")
+
+	// confirm asks before destructive commands unless --yes was given
+	confirm := func(prompt string) bool {
+		if yes {
+			return true
+		}
+		fmt.Fprintf(os.Stderr, "%s [y/N] ", prompt)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		return strings.EqualFold(strings.TrimSpace(answer), "y")
+	}
+	root.PersistentFlags().BoolVarP(&yes, "yes", "y", false, "don't ask for confirmation")
+
+	scores := &cobra.Command{Use: "scores", Short: "Review and remove scores"}
+	scores.AddCommand(
+		&cobra.Command{
+			Use:   "suspicious",
+			Short: "List quarantined and reported scores, most reported first",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				var queue []moderationItem
+				if err := client.do(http.MethodGet, "/admin/moderation/queue", nil, &queue); err != nil {
+					return err
+				}
+				if asJSON {
+					return printJSON(queue)
+				}
+				tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "ID\tPLAYER\tSCORE\tSESSION\tQUARANTINED\tREPORTS\tREASONS")
+				for _, item := range queue {
+					quarantined := "-"
+					if item.Quarantined {
+						quarantined = item.QuarantineReason
+					}
+					fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\t%d\t%s\n", item.ScoreID, item.PlayerName, item.Score,
+						item.SessionID, quarantined, item.OpenReports, strings.Join(item.Reasons, "; "))
+				}
+				return tw.Flush()
+			},
+		},
+		&cobra.Command{
+			Use:   "delete SCORE_ID...",
+			Short: "Delete scores for good",
+			Args:  cobra.MinimumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return resolveScores(client, args, "remove", confirm)
+			},
+		},
+		&cobra.Command{
+			Use:   "restore SCORE_ID...",
+			Short: "Un-quarantine scores and close their reports",
+			Args:  cobra.MinimumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return resolveScores(client, args, "restore", nil)
+			},
+		},
+	)
+
+	var banReason string
+	ban := &cobra.Command{
+		Use:   "ban SESSION_ID...",
+		Short: "Ban sessions from submitting scores",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, id := range args {
+				if err := client.do(http.MethodPut, "/admin/sessions/"+url.PathEscape(id)+"/ban",
+					map[string]string{"reason": banReason}, nil); err != nil {
+					return err
+				}
+				fmt.Printf("Banned session %s\n", id)
+			}
+			return nil
+		},
+	}
+	ban.Flags().StringVar(&banReason, "reason", "", "why the session is banned")
+
+	sessions := &cobra.Command{Use: "sessions", Short: "Ban and unban sessions"}
+	sessions.AddCommand(
+		ban,
+		&cobra.Command{
+			Use:   "unban SESSION_ID...",
+			Short: "Lift session bans",
+			Args:  cobra.MinimumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				for _, id := range args {
+					if err := client.do(http.MethodDelete, "/admin/sessions/"+url.PathEscape(id)+"/ban", nil, nil); err != nil {
+						return err
+					}
+					fmt.Printf("Unbanned session %s\n", id)
+				}
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "bans",
+			Short: "List banned sessions",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				var bans []sessionBan
+				if err := client.do(http.MethodGet, "/admin/sessions/bans", nil, &bans); err != nil {
+					return err
+				}
+				if asJSON {
+					return printJSON(bans)
+				}
+				tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "SESSION\tBANNED AT\tREASON")
+				for _, b := range bans {
+					fmt.Fprintf(tw, "%s\t%s\t%s\n", b.SessionID, b.BannedAt.Format(time.RFC3339), b.Reason)
+				}
+				return tw.Flush()
+			},
+		},
+	)
+
+	players := &cobra.Command{Use: "players", Short: "Rename, merge and purge players"}
+	players.AddCommand(
+		&cobra.Command{
+			Use:   "rename NAME NEW_NAME",
+			Short: "Rename a player's scores, spice total and account",
+			Args:  cobra.ExactArgs(2),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				var change playerChange
+				if err := client.do(http.MethodPost, "/admin/players/"+url.PathEscape(args[0])+"/rename",
+					map[string]string{"name": args[1]}, &change); err != nil {
+					return err
+				}
+				fmt.Printf("Renamed %s to %s (%d scores)\n", args[0], change.PlayerName, change.Scores)
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "merge NAME INTO",
+			Short: "Move a player's scores and spice total to another player",
+			Args:  cobra.ExactArgs(2),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if !confirm(fmt.Sprintf("Merge %s into %s?", args[0], args[1])) {
+					return fmt.Errorf("aborted")
+				}
+				var change playerChange
+				if err := client.do(http.MethodPost, "/admin/players/"+url.PathEscape(args[0])+"/merge",
+					map[string]string{"into": args[1]}, &change); err != nil {
+					return err
+				}
+				fmt.Printf("Merged %s into %s (%d scores)\n", args[0], change.PlayerName, change.Scores)
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "purge NAME",
+			Short: "Delete a player's scores, spice total and account",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if !confirm(fmt.Sprintf("Delete all of %s's history?", args[0])) {
+					return fmt.Errorf("aborted")
+				}
+				var change playerChange
+				if err := client.do(http.MethodDelete, "/admin/players/"+url.PathEscape(args[0]), nil, &change); err != nil {
+					return err
+				}
+				fmt.Printf("Purged %s (%d scores)\n", change.PlayerName, change.Scores)
+				return nil
+			},
+		},
+	)
+
+	cache := &cobra.Command{Use: "cache", Short: "Manage the Redis caches"}
+	cache.AddCommand(&cobra.Command{
+		Use:   "rebuild",
+		Short: "Drop cached leaderboards and rebuild the ranking from Postgres",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := client.do(http.MethodPost, "/admin/cache/rebuild", nil, nil); err != nil {
+				return err
+			}
+			fmt.Println("Caches invalidated; ranking rebuild started")
+			return nil
+		},
+	})
+
+	seasons := &cobra.Command{Use: "season", Short: "Manage leaderboard seasons"}
+	seasons.AddCommand(&cobra.Command{
+		Use:   "rollover",
+		Short: "End the current season now and start the next one",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !confirm("End the current season now? Its standings will be archived and the board reset.") {
+				return fmt.Errorf("aborted")
+			}
+			var next season
+			if err := client.do(http.MethodPost, "/admin/seasons/rollover", nil, &next); err != nil {
+				return err
+			}
+			if asJSON {
+				return printJSON(next)
+			}
+			fmt.Printf("Season %d started at %s\n", next.ID, next.StartedAt.Format(time.RFC3339))
+			return nil
+		},
+	})
+
+	root.AddCommand(scores, players, sessions, cache, seasons, newReplayCommand())
+	if err := root.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// resolveScores applies a moderation action to each score ID. confirm, if not
+// nil, is asked first.
+func resolveScores(client *adminClient, args []string, action string, confirm func(string) bool) error {
+	ids := make([]int, len(args))
+	for i, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id <= 0 {
+			return fmt.Errorf("invalid score ID %q", arg)
+		}
+		ids[i] = id
+	}
+	if confirm != nil && !confirm(fmt.Sprintf("%s %d score(s)?", strings.ToUpper(action[:1])+action[1:], len(ids))) {
+		return fmt.Errorf("aborted")
+	}
+	for _, id := range ids {
+		path := fmt.Sprintf("/admin/moderation/scores/%d", id)
+		if err := client.do(http.MethodPost, path, map[string]string{"action": action}, nil); err != nil {
+			return err
+		}
+		fmt.Printf("Score %d: %sd\n", id, action)
+	}
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// combinedLogLine matches the Combined/Common Log Format written by nginx and
+// most ingress controllers.
+var combinedLogLine = regexp.MustCompile(`^\S+ \S+ \S+ \[([^\]]+)\] "(\S+) (\S+)[^"]*"`)
+
+const combinedLogTime = "02/Jan/2006:15:04:05 -0700"
+
+// recordedRequest is one line of an NDJSON capture. Access logs are parsed
+// into the same shape, without headers or bodies.
+type recordedRequest struct {
+	Time    time.Time         `json:"time"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+func parseRecordedRequest(line, format string) (recordedRequest, error) {
+	var req recordedRequest
+	if format == "auto" {
+		format = "combined"
+		if strings.HasPrefix(line, "{") {
+			format = "ndjson"
+		}
+	}
+	switch format {
+	case "ndjson":
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			return req, err
+		}
+	case "combined":
+		m := combinedLogLine.FindStringSubmatch(line)
+		if m == nil {
+			return req, fmt.Errorf("not a combined log line")
+		}
+		t, err := time.Parse(combinedLogTime, m[1])
+		if err != nil {
+			return req, err
+		}
+		req = recordedRequest{Time: t, Method: m[2], Path: m[3]}
+	default:
+		return req, fmt.Errorf("unknown format %q", format)
+	}
+	if req.Method == "" || !strings.HasPrefix(req.Path, "/") {
+		return req, fmt.Errorf("missing method or path")
+	}
+	return req, nil
+}
+
+// replayStats collects the outcome of every replayed request.
+type replayStats struct {
+	mu        sync.Mutex
+	statuses  map[int]int
+	errors    int
+	skipped   int
+	latencies []time.Duration
+	maxLag    time.Duration
+}
+
+func (s *replayStats) record(status int, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errors++
+		return
+	}
+	s.statuses[status]++
+	s.latencies = append(s.latencies, latency)
+}
+
+func (s *replayStats) print(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+	percentile := func(p float64) time.Duration {
+		if len(s.latencies) == 0 {
+			return 0
+		}
+		return s.latencies[int(p*float64(len(s.latencies)-1))]
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Replayed\t%d in %s\n", len(s.latencies)+s.errors, elapsed.Round(time.Millisecond))
+	fmt.Fprintf(tw, "Skipped\t%d\n", s.skipped)
+	fmt.Fprintf(tw, "Network errors\t%d\n", s.errors)
+	codes := make([]int, 0, len(s.statuses))
+	for code := range s.statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(tw, "HTTP %d\t%d\n", code, s.statuses[code])
+	}
+	fmt.Fprintf(tw, "Latency p50/p95/p99\t%s / %s / %s\n",
+		percentile(0.50).Round(time.Millisecond), percentile(0.95).Round(time.Millisecond), percentile(0.99).Round(time.Millisecond))
+	fmt.Fprintf(tw, "Max schedule lag\t%s\n", s.maxLag.Round(time.Millisecond))
+	tw.Flush()
+}
+
+func newReplayCommand() *cobra.Command {
+	var (
+		target      string
+		format      string
+		speed       float64
+		concurrency int
+		writes      bool
+	)
+	cmd := &cobra.Command{
+		Use:   "replay FILE",
+		Short: "Replay recorded traffic against an environment",
+		Long: `Replay reads an access log in Combined Log Format, or an NDJSON capture, and
+sends its requests to --target with their original spacing divided by --speed.
+Only GETs are replayed unless --writes is set; access logs carry no bodies, so
+writes are only replayed from NDJSON captures. /admin requests are never
+replayed. Use "-" to read from stdin.`,
+		Args: cobra.ExactArgs(1),
+		// Replay doesn't use the admin API, so it needs no token
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if target == "" {
+				return fmt.Errorf("--target is required")
+			}
+			if speed < 0 || concurrency <= 0 {
+				return fmt.Errorf("--speed must be >= 0 and --concurrency > 0")
+			}
+			var input io.Reader = os.Stdin
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				input = f
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+			stats := &replayStats{statuses: make(map[int]int)}
+			started := time.Now()
+			err := replay(ctx, input, replayOptions{
+				target:      strings.TrimSuffix(target, "/"),
+				format:      format,
+				speed:       speed,
+				concurrency: concurrency,
+				writes:      writes,
+			}, stats)
+			stats.print(os.Stdout, time.Since(started))
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&target, "target", "", "base URL to replay against")
+	cmd.Flags().StringVar(&format, "format", "auto", "input format: auto, combined or ndjson")
+	cmd.Flags().Float64Var(&speed, "speed", 1, "speed-up over the recording; 0 sends as fast as possible")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 50, "maximum requests in flight")
+	cmd.Flags().BoolVar(&writes, "writes", false, "also replay POST, PUT, PATCH and DELETE requests")
+	return cmd
+}
+
+type replayOptions struct {
+	target      string
+	format      string
+	speed       float64
+	concurrency int
+	writes      bool
+}
+
+// replay streams requests from input and sends each one when it is due. A
+// request that can't be sent on time because every slot is busy is sent late
+// rather than dropped, and the lag is reported.
+func replay(ctx context.Context, input io.Reader, opts replayOptions, stats *replayStats) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	slots := make(chan struct{}, opts.concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var recordStart, replayStart time.Time
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		rec, err := parseRecordedRequest(line, opts.format)
+		if err != nil || strings.HasPrefix(rec.Path, "/admin") || (rec.Method != http.MethodGet && !opts.writes) {
+			stats.mu.Lock()
+			stats.skipped++
+			stats.mu.Unlock()
+			continue
+		}
+
+		if recordStart.IsZero() {
+			recordStart, replayStart = rec.Time, time.Now()
+		}
+		due := time.Now()
+		if opts.speed > 0 {
+			due = replayStart.Add(time.Duration(float64(rec.Time.Sub(recordStart)) / opts.speed))
+			if wait := time.Until(due); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case slots <- struct{}{}:
+		}
+		if lag := time.Since(due); opts.speed > 0 && lag > 0 {
+			stats.mu.Lock()
+			if lag > stats.maxLag {
+				stats.maxLag = lag
+			}
+			stats.mu.Unlock()
+		}
+		wg.Add(1)
+		go func(rec recordedRequest) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			status, latency, err := send(ctx, client, opts.target, rec)
+			stats.record(status, latency, err)
+		}(rec)
+	}
+	return scanner.Err()
+}
+
+func send(ctx context.Context, client *http.Client, target string, rec recordedRequest) (int, time.Duration, error) {
+	var body io.Reader
+	if len(rec.Body) > 0 {
+		body = strings.NewReader(string(rec.Body))
+	}
+	req, err := http.NewRequestWithContext(ctx, rec.Method, target+rec.Path, body)
+	if err != nil {
+		return 0, 0, err
+	}
+	for name, value := range rec.Headers {
+		req.Header.Set(name, value)
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("User-Agent", "spice-admin-replay")
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, time.Since(start), nil
+}
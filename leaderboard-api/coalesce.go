@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// coalesce runs fn once for concurrent callers with the same key, so when a
+// cached board expires under load one query rebuilds it instead of one per
+// request. The key carries the leaderboard version, so a request arriving
+// after a change never joins a query started before it. fn is detached from
+// the caller's cancellation, since other callers may be waiting on it, and
+// what it returns is shared: return values callers can't mutate, such as
+// encoded JSON.
+func coalesce[T any](ctx context.Context, app *App, kind, key string, fn func(context.Context) (T, error)) (T, error) {
+	var version int64
+	if app.changes != nil {
+		version, _ = app.changes.current()
+	}
+	flightKey := fmt.Sprintf("%s:%s:%d", kind, key, version)
+	v, err, shared := app.flights.Do(flightKey, func() (any, error) {
+		return fn(context.WithoutCancel(ctx))
+	})
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cache.coalesced", shared))
+	if shared {
+		cacheCoalescedTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", kind)))
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v.(T), nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the service's core configuration. Each setting starts from its
+// built-in default, is replaced by the YAML file named by CONFIG_FILE, and
+// then by its environment variable, so a deployment can keep a shared file
+// and override single values per environment. It is validated once at
+// startup.
+type Config struct {
+	Port          string        `yaml:"port" env:"PORT"`
+	GRPCPort      string        `yaml:"grpcPort" env:"GRPC_PORT"`
+	ShutdownDelay time.Duration `yaml:"shutdownDelay" env:"SHUTDOWN_DELAY"`
+	// CacheTTL is how long cached top scores boards live when no change drops
+	// them; CacheTTLs sets the other responses'
+	CacheTTL time.Duration `yaml:"cacheTTL" env:"CACHE_TTL"`
+	// CacheMode is expire or stale-while-revalidate, which serves top scores
+	// boards up to CacheStaleTTL old while refreshing them
+	CacheMode        string        `yaml:"cacheMode" env:"CACHE_MODE"`
+	CacheStaleTTL    time.Duration `yaml:"cacheStaleTTL" env:"CACHE_STALE_TTL"`
+	FeaturedRotation time.Duration `yaml:"featuredRotation" env:"FEATURED_RUNNER_ROTATION"`
+
+	CacheTTLs   CacheTTLConfig    `yaml:"cacheTTLs"`
+	AntiCheat   AntiCheatConfig   `yaml:"antiCheat"`
+	Submissions SubmissionsConfig `yaml:"submissions"`
+	Seasons     SeasonsConfig     `yaml:"seasons"`
+	Privacy     PrivacyConfig     `yaml:"privacy"`
+
+	// Env sets any other variable read by the service, e.g. CDN_PURGE_PROVIDER.
+	// The environment still wins over it.
+	Env map[string]string `yaml:"env"`
+}
+
+// CacheTTLConfig sets how long each kind of cached response lives when no
+// change drops it. Player stats and ranks are only cached when theirs is set.
+type CacheTTLConfig struct {
+	FilteredBoards time.Duration `yaml:"filteredBoards" env:"CACHE_TTL_FILTERED_BOARDS"`
+	Records        time.Duration `yaml:"records" env:"CACHE_TTL_RECORDS"`
+	Reigns         time.Duration `yaml:"reigns" env:"CACHE_TTL_REIGNS"`
+	SpiceStats     time.Duration `yaml:"spiceStats" env:"CACHE_TTL_SPICE_STATS"`
+	PlayerStats    time.Duration `yaml:"playerStats" env:"CACHE_TTL_PLAYER_STATS"`
+	PlayerRank     time.Duration `yaml:"playerRank" env:"CACHE_TTL_PLAYER_RANK"`
+}
+
+// AntiCheatConfig holds the built-in limits, which apply to modes without a
+// row in game_rules, and the validation pipeline.
+type AntiCheatConfig struct {
+	MaxScore              int           `yaml:"maxScore" env:"MAX_SCORE"`
+	MinSubmissionInterval time.Duration `yaml:"minSubmissionInterval" env:"MIN_SUBMISSION_INTERVAL"`
+	PipelineStages        string        `yaml:"pipelineStages" env:"SUBMISSION_PIPELINE_STAGES"`
+	GameRulesRefresh      time.Duration `yaml:"gameRulesRefresh" env:"GAME_RULES_REFRESH"`
+}
+
+type SubmissionsConfig struct {
+	SchemaMinVersion int           `yaml:"schemaMinVersion" env:"SUBMISSION_SCHEMA_MIN_VERSION"`
+	IdempotencyTTL   time.Duration `yaml:"idempotencyTTL" env:"IDEMPOTENCY_TTL"`
+	// MaxBodyBytes limits a submission's body, not counting its event log,
+	// which anticheat.MaxEncodedRunLog limits on its own
+	MaxBodyBytes int `yaml:"maxBodyBytes" env:"SUBMISSION_MAX_BODY_BYTES"`
+}
+
+type SeasonsConfig struct {
+	Schedule    string `yaml:"schedule" env:"SEASON_SCHEDULE"`
+	RewardTiers string `yaml:"rewardTiers" env:"SEASON_REWARD_TIERS"`
+}
+
+// fileEnv is the config file's env section as loaded at startup, which
+// getEnv falls back to.
+var fileEnv map[string]string
+
+func defaultConfig() *Config {
+	return &Config{
+		Port:             "8080",
+		GRPCPort:         "9090",
+		ShutdownDelay:    defaultShutdownDelay,
+		CacheTTL:         defaultCacheTTL,
+		CacheMode:        cacheModeExpire,
+		CacheStaleTTL:    defaultCacheStaleTTL,
+		FeaturedRotation: defaultFeaturedRotation,
+		CacheTTLs: CacheTTLConfig{
+			FilteredBoards: defaultCacheTTL,
+			Records:        defaultRecordsCacheTTL,
+			Reigns:         defaultReignsCacheTTL,
+			SpiceStats:     defaultSpiceStatsCacheTTL,
+		},
+		AntiCheat: AntiCheatConfig{
+			MaxScore:              defaultMaxScore,
+			MinSubmissionInterval: defaultMinSubmissionInterval,
+			PipelineStages:        defaultPipelineStages,
+			GameRulesRefresh:      defaultGameRulesRefresh,
+		},
+		Submissions: SubmissionsConfig{
+			SchemaMinVersion: 1,
+			IdempotencyTTL:   defaultIdempotencyTTL,
+			MaxBodyBytes:     defaultSubmissionMaxBodyBytes,
+		},
+		Seasons: SeasonsConfig{RewardTiers: defaultRewardTiers},
+		Privacy: PrivacyConfig{NameMasking: nameMaskingOff},
+	}
+}
+
+// loadConfig reads CONFIG_FILE, when set, over the defaults, applies the
+// environment and validates the result.
+func loadConfig() (*Config, error) {
+	c := defaultConfig()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+
+	typed := map[string]bool{}
+	if err := applyEnvOverrides(reflect.ValueOf(c).Elem(), typed); err != nil {
+		return nil, err
+	}
+	for name := range c.Env {
+		if typed[name] {
+			return nil, fmt.Errorf("config file sets %s under env; use its own setting instead", name)
+		}
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// applyEnvOverrides sets each field tagged env from its variable, when set,
+// and records the tagged names in typed.
+func applyEnvOverrides(v reflect.Value, typed map[string]bool) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnvOverrides(value, typed); err != nil {
+				return err
+			}
+			continue
+		}
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		typed[name] = true
+		raw := os.Getenv(name)
+		if raw == "" {
+			continue
+		}
+
+		switch {
+		case field.Type == reflect.TypeOf(time.Duration(0)):
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q", name, raw)
+			}
+			value.SetInt(int64(d))
+		case field.Type.Kind() == reflect.Int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q", name, raw)
+			}
+			value.SetInt(int64(n))
+		case field.Type.Kind() == reflect.String:
+			value.SetString(raw)
+		default:
+			return fmt.Errorf("%s has an unsupported type %s", name, field.Type)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
+	if c.Port == "" || c.GRPCPort == "" || c.Port == c.GRPCPort {
+		return fmt.Errorf("port and grpcPort must be set and differ")
+	}
+	if c.ShutdownDelay < 0 {
+		return fmt.Errorf("shutdownDelay must not be negative")
+	}
+	for name, d := range map[string]time.Duration{
+		"cacheTTL":                   c.CacheTTL,
+		"cacheTTLs.filteredBoards":   c.CacheTTLs.FilteredBoards,
+		"cacheTTLs.records":          c.CacheTTLs.Records,
+		"cacheTTLs.reigns":           c.CacheTTLs.Reigns,
+		"cacheTTLs.spiceStats":       c.CacheTTLs.SpiceStats,
+		"featuredRotation":           c.FeaturedRotation,
+		"antiCheat.gameRulesRefresh": c.AntiCheat.GameRulesRefresh,
+		"submissions.idempotencyTTL": c.Submissions.IdempotencyTTL,
+	} {
+		if d <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+	if c.CacheTTLs.PlayerStats < 0 || c.CacheTTLs.PlayerRank < 0 {
+		return fmt.Errorf("cacheTTLs.playerStats and cacheTTLs.playerRank must not be negative")
+	}
+	if c.CacheMode != cacheModeExpire && c.CacheMode != cacheModeStaleWhileRevalidate {
+		return fmt.Errorf("cacheMode must be %s or %s", cacheModeExpire, cacheModeStaleWhileRevalidate)
+	}
+	if c.CacheStaleTTL < c.CacheTTL {
+		return fmt.Errorf("cacheStaleTTL must be no shorter than cacheTTL")
+	}
+	if c.AntiCheat.MaxScore <= 0 {
+		return fmt.Errorf("antiCheat.maxScore must be positive")
+	}
+	if c.AntiCheat.MinSubmissionInterval < 0 {
+		return fmt.Errorf("antiCheat.minSubmissionInterval must not be negative")
+	}
+	if c.Submissions.SchemaMinVersion < 1 {
+		return fmt.Errorf("submissions.schemaMinVersion must be at least 1")
+	}
+	if c.Submissions.MaxBodyBytes <= 0 {
+		return fmt.Errorf("submissions.maxBodyBytes must be positive")
+	}
+	return c.Privacy.validate()
+}
+
+// builtinGameRule is the rule for modes with no row in game_rules.
+func (c *Config) builtinGameRule() GameRule {
+	return GameRule{
+		Mode:          defaultGameMode,
+		Difficulty:    defaultGameDifficulty,
+		MaxScore:      c.AntiCheat.MaxScore,
+		MinIntervalMs: int(c.AntiCheat.MinSubmissionInterval / time.Millisecond),
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+func connectDB(ctx context.Context) (*pgxpool.Pool, error) {
+	dsn := getEnv("DATABASE_URL", defaultDatabaseURL)
+
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+	if err := configureStatementCache(config); err != nil {
+		return nil, err
+	}
+	if err := configurePool(config); err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+	}
+
+	// Test connection with retries
+	maxRetries := 10
+	for i := 0; i < maxRetries; i++ {
+		if err := pool.Ping(ctx); err == nil {
+			log.Println("✅ Connected to PostgreSQL")
+			return pool, nil
+		}
+		log.Printf("⏳ Waiting for PostgreSQL (attempt %d/%d)...", i+1, maxRetries)
+		time.Sleep(2 * time.Second)
+	}
+
+	return pool, fmt.Errorf("%w after %d retries", errDatabaseUnreachable, maxRetries)
+}
+
+const defaultStatementCacheCapacity = 512
+
+// queryExecModes are the DB_QUERY_EXEC_MODE values. Behind PgBouncer in
+// transaction mode, where prepared statements don't survive, use exec or
+// simple_protocol.
+var queryExecModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
+// configureStatementCache sets how pgx runs queries, from DB_QUERY_EXEC_MODE
+// and DB_STATEMENT_CACHE_CAPACITY. By default each connection prepares a
+// statement the first time it runs it and reuses the plan from then on, which
+// the fixed SQL of the named queries in internal/store makes effective.
+func configureStatementCache(config *pgxpool.Config) error {
+	mode := getEnv("DB_QUERY_EXEC_MODE", "cache_statement")
+	execMode, ok := queryExecModes[mode]
+	if !ok {
+		return fmt.Errorf("unknown DB_QUERY_EXEC_MODE %q", mode)
+	}
+	capacity, err := strconv.Atoi(getEnv("DB_STATEMENT_CACHE_CAPACITY", strconv.Itoa(defaultStatementCacheCapacity)))
+	if err != nil || capacity <= 0 {
+		return fmt.Errorf("DB_STATEMENT_CACHE_CAPACITY must be a positive number")
+	}
+	config.ConnConfig.DefaultQueryExecMode = execMode
+	config.ConnConfig.StatementCacheCapacity = capacity
+	config.ConnConfig.DescriptionCacheCapacity = capacity
+	return nil
+}
+
+// initDB brings the schema up to date, or with DB_AUTO_MIGRATE=false only
+// checks that it is, leaving migrations to `leaderboard-api migrate`.
+func initDB(ctx context.Context, pool *pgxpool.Pool) error {
+	ctx, span := tracer.Start(ctx, "initDB")
+	defer span.End()
+
+	if getEnv("DB_AUTO_MIGRATE", "true") != "true" {
+		pending, err := pendingMigrations(ctx, pool)
+		if err != nil {
+			return fmt.Errorf("failed to check migrations: %w", err)
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d migrations pending (first %s), run `leaderboard-api migrate up`",
+				len(pending), pending[0].filename())
+		}
+		log.Println("✅ Database schema up to date")
+		return nil
+	}
+
+	applied, err := migrateUp(ctx, pool, 0)
+	if err != nil {
+		return fmt.Errorf("failed to migrate database schema: %w", err)
+	}
+	log.Printf("✅ Database schema initialized (%d migrations applied)", applied)
+	return nil
+}
+
+func connectRedis() (*redis.Client, error) {
+	opts := &redis.Options{
+		Addr: getEnv("REDIS_URL", "localhost:6379"),
+	}
+	if err := configureRedisPool(opts); err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+
+	// Test connection with retries
+	ctx := context.Background()
+	maxRetries := 10
+	for i := 0; i < maxRetries; i++ {
+		if err := client.Ping(ctx).Err(); err == nil {
+			log.Println("✅ Connected to Redis")
+			return client, nil
+		}
+		log.Printf("⏳ Waiting for Redis (attempt %d/%d)...", i+1, maxRetries)
+		time.Sleep(2 * time.Second)
+	}
+
+	log.Println("⚠️ Redis connection failed, continuing on the fallback cache")
+	return client, nil
+}
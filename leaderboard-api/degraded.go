@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+)
+
+const defaultDegradedRetryInterval = 5 * time.Second
+
+// errDatabaseUnreachable is returned by connectDB when Postgres didn't answer
+// any of its pings. The pool it returns alongside is still usable once
+// Postgres comes up.
+var errDatabaseUnreachable = errors.New("database unreachable")
+
+// errReadOnly rejects writes while the API runs without Postgres.
+var errReadOnly = handlers.NewError(handlers.ErrStoreUnavailable,
+	"Score store unavailable, the leaderboard is read-only until it's back", nil)
+
+// degradedStartup lets the API boot when Postgres isn't up yet, as happens
+// when pods start before the database in Kubernetes. Until it is reached the
+// API is read-only: boards come from the caches, submissions are rejected
+// with a 503 straight away, and the startup steps that need the database run
+// once it answers.
+type degradedStartup struct {
+	retry  time.Duration
+	active atomic.Bool
+}
+
+// newDegradedStartupFromEnv reads DEGRADED_STARTUP and DEGRADED_RETRY_INTERVAL.
+// It returns nil when DEGRADED_STARTUP=false, to fail at boot as before.
+func newDegradedStartupFromEnv() (*degradedStartup, error) {
+	if getEnv("DEGRADED_STARTUP", "true") != "true" {
+		return nil, nil
+	}
+	retry, err := time.ParseDuration(getEnv("DEGRADED_RETRY_INTERVAL", defaultDegradedRetryInterval.String()))
+	if err != nil || retry <= 0 {
+		return nil, fmt.Errorf("DEGRADED_RETRY_INTERVAL must be a positive duration")
+	}
+	return &degradedStartup{retry: retry}, nil
+}
+
+// readOnly reports whether the API is waiting for Postgres.
+func (app *App) readOnly() bool {
+	return app.degraded != nil && app.degraded.active.Load()
+}
+
+// initFromDB runs the startup steps that need Postgres: migrations, community
+// goal seeding and the current season.
+func (app *App) initFromDB(ctx context.Context) error {
+	if err := initDB(ctx, app.db); err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	if err := app.initCommunityGoals(ctx); err != nil {
+		return fmt.Errorf("failed to initialize community goals: %w", err)
+	}
+	season, err := app.ensureSeason(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open season: %w", err)
+	}
+	if season.EndsAt != nil {
+		log.Printf("✅ Season %d ends %s", season.ID, season.EndsAt.Format(time.RFC3339))
+	} else {
+		log.Printf("✅ Season %d (no end scheduled)", season.ID)
+	}
+	return nil
+}
+
+// awaitDatabase pings Postgres every retry interval until it answers, then
+// runs initFromDB and reconciles what was skipped meanwhile: game rules, the
+// ranking set and the caches. A failing step is retried on the next tick.
+func (app *App) awaitDatabase(ctx context.Context) {
+	ticker := time.NewTicker(app.degraded.retry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := app.db.Ping(ctx); err != nil {
+			continue
+		}
+		if err := app.initFromDB(ctx); err != nil {
+			log.Printf("⚠️ PostgreSQL reachable but startup failed, retrying: %v", err)
+			continue
+		}
+		if err := app.loadGameRules(ctx); err != nil {
+			log.Printf("⚠️ Failed to load game rules, using built-in limits: %v", err)
+		}
+		app.degraded.active.Store(false)
+		app.rankingReady(ctx)
+		app.invalidateCache(ctx)
+		app.dropCachedPlayerStats(ctx)
+		go app.warmCaches(ctx)
+		log.Println("✅ Connected to PostgreSQL, accepting submissions again")
+		return
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Demo scenarios switch one request onto an older or slower code path, so a
+// talk can show before and after without a redeploy. They change how results
+// are computed, never the results.
+const (
+	// demoNoCache skips the Redis cache of the top scores
+	demoNoCache = "no-cache"
+	// demoSlowQuery reads the top scores with a query the score indexes
+	// can't serve, the way the board was read before they existed
+	demoSlowQuery = "slow-query"
+	// demoPostgresRank ranks with COUNT queries instead of the sorted set
+	demoPostgresRank = "postgres-rank"
+)
+
+var demoScenarios = []string{demoNoCache, demoSlowQuery, demoPostgresRank}
+
+type demoScenariosKey struct{}
+
+// demoMiddleware reads X-Demo-Scenario, a comma-separated list of scenarios,
+// on requests that carry DEMO_SCENARIO_TOKEN in X-Demo-Token. The header is
+// ignored when no token is configured.
+func demoMiddleware(next http.Handler) http.Handler {
+	token := getEnv("DEMO_SCENARIO_TOKEN", "")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("X-Demo-Scenario")
+		if token == "" || header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Demo-Token")), []byte(token)) != 1 {
+			http.Error(w, "X-Demo-Scenario needs a valid X-Demo-Token", http.StatusUnauthorized)
+			return
+		}
+
+		var scenarios []string
+		for _, scenario := range strings.Split(header, ",") {
+			scenario = strings.TrimSpace(scenario)
+			if scenario == "" {
+				continue
+			}
+			if !slices.Contains(demoScenarios, scenario) {
+				http.Error(w, fmt.Sprintf("unknown demo scenario %q (want one of %s)", scenario,
+					strings.Join(demoScenarios, ", ")), http.StatusBadRequest)
+				return
+			}
+			scenarios = append(scenarios, scenario)
+		}
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.StringSlice("demo.scenarios", scenarios))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), demoScenariosKey{}, scenarios)))
+	})
+}
+
+// demoScenario reports whether the request asked for scenario.
+func demoScenario(ctx context.Context, scenario string) bool {
+	scenarios, _ := ctx.Value(demoScenariosKey{}).([]string)
+	return slices.Contains(scenarios, scenario)
+}
+
+// rankEngineFor is the rank engine for this request: Postgres under the
+// postgres-rank scenario, the configured one otherwise.
+func (app *App) rankEngineFor(ctx context.Context) string {
+	if demoScenario(ctx, demoPostgresRank) {
+		return rankEnginePostgres
+	}
+	return app.rankEngine
+}
+
+// slowTopScores ranks every visible score of the season by an expression,
+// which no index covers, before taking the top limit.
+func (app *App) slowTopScores(ctx context.Context, limit int, tags []string) ([]LeaderboardEntry, error) {
+	rows, err := store.SelectTopSlowQuery.Query(ctx, app.db, limit, store.TagsJSON(tags))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return store.ScanEntries(rows)
+}
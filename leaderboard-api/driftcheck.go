@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// Ways the ranking sorted set can disagree with Postgres
+	driftMissing = "missing" // visible in Postgres, absent from the set
+	driftStale   = "stale"   // in the set, but deleted, hidden or from another season
+	driftScore   = "score"   // in both with different scores
+	driftCount   = "count"   // the set and Postgres hold different numbers of scores
+
+	defaultDriftCheckInterval = 5 * time.Minute
+	defaultDriftCheckSample   = 500
+
+	// Only one replica checks per interval; the count streak is shared so
+	// consecutive checks on different replicas still add up
+	cacheKeyDriftCheckLock   = "leaderboard:ranking:drift:lock"
+	cacheKeyDriftCountStreak = "leaderboard:ranking:drift:count"
+)
+
+// driftChecker compares samples of the ranking sorted set with Postgres and
+// repairs what it finds. A count that still disagrees after the repairs on
+// two checks in a row means drift outside the samples, so the set is rebuilt.
+type driftChecker struct {
+	interval time.Duration
+	sample   int
+}
+
+// newDriftCheckerFromEnv returns nil when RANKING_DRIFT_CHECK_INTERVAL is 0.
+func newDriftCheckerFromEnv() (*driftChecker, error) {
+	interval, err := time.ParseDuration(getEnv("RANKING_DRIFT_CHECK_INTERVAL", defaultDriftCheckInterval.String()))
+	if err != nil || interval < 0 {
+		return nil, fmt.Errorf("invalid RANKING_DRIFT_CHECK_INTERVAL")
+	}
+	if interval == 0 {
+		return nil, nil
+	}
+	sample, err := strconv.Atoi(getEnv("RANKING_DRIFT_CHECK_SAMPLE", strconv.Itoa(defaultDriftCheckSample)))
+	if err != nil || sample <= 0 {
+		return nil, fmt.Errorf("invalid RANKING_DRIFT_CHECK_SAMPLE")
+	}
+	return &driftChecker{interval: interval, sample: sample}, nil
+}
+
+// runDriftCheck checks the ranking on the checker's schedule.
+func (app *App) runDriftCheck(ctx context.Context, c *driftChecker) {
+	log.Printf("✅ Ranking drift check enabled (%d scores sampled every %v)", c.sample, c.interval)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			acquired, err := app.redis.SetNX(ctx, cacheKeyDriftCheckLock, 1, c.interval/2).Result()
+			if err == nil && !acquired {
+				// Another replica checks this interval
+				continue
+			}
+			if err := app.checkRankingDrift(ctx, c); err != nil {
+				log.Printf("Failed to check ranking drift: %v", err)
+			}
+		}
+	}
+}
+
+// checkRankingDrift compares the top of the board, a random slice of
+// Postgres and a random sample of the set, fixing each mismatch in the set.
+// Scores submitted during the check may show up as missing; adding them again
+// is harmless.
+func (app *App) checkRankingDrift(ctx context.Context, c *driftChecker) error {
+	if !app.rankingReady(ctx) {
+		// Being rebuilt, so nothing to compare against yet
+		return nil
+	}
+	ctx, span := tracer.Start(ctx, "checkRankingDrift")
+	defer span.End()
+
+	start := time.Now()
+	expected := map[int]int{}
+	ids, err := app.postgresTopIDs(ctx, c.sample)
+	if err != nil {
+		return err
+	}
+	var maxID int
+	if err := store.MaxScoreIDQuery.QueryRow(ctx, app.db).Scan(&maxID); err != nil {
+		return err
+	}
+	rows, err := store.RankedScoreSliceQuery.Query(ctx, app.db, rand.Intn(maxID+1), c.sample)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id, score int
+		if err := rows.Scan(&id, &score); err != nil {
+			rows.Close()
+			return err
+		}
+		expected[id] = score
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		rows, err := store.ScoresByIDQuery.Query(ctx, app.db, ids)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id, score int
+			if err := rows.Scan(&id, &score); err != nil {
+				rows.Close()
+				return err
+			}
+			expected[id] = score
+		}
+		rows.Close()
+	}
+	store.ObserveQuery(ctx, "ranking_drift_sample", start)
+
+	drift := map[string]int{}
+
+	// Every sampled Postgres score must be in the set with the same value
+	pipe := app.redis.Pipeline()
+	scoreCmds := make(map[int]*redis.FloatCmd, len(expected))
+	for id := range expected {
+		scoreCmds[id] = pipe.ZScore(ctx, cacheKeyRanking, rankingMember(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return err
+	}
+	for id, cmd := range scoreCmds {
+		got, err := cmd.Result()
+		switch {
+		case err == redis.Nil:
+			drift[driftMissing]++
+			app.rankingAdd(ctx, id, expected[id])
+		case err != nil:
+			return err
+		case int(got) != expected[id]:
+			drift[driftScore]++
+			app.rankingAdd(ctx, id, expected[id])
+		}
+	}
+
+	// Every sampled member of the set must still be a visible score
+	members, err := app.redis.ZRandMemberWithScores(ctx, cacheKeyRanking, c.sample).Result()
+	if err != nil {
+		return err
+	}
+	sampled := make([]int, 0, len(members))
+	for _, member := range members {
+		name, _ := member.Member.(string)
+		id, err := rankingScoreID(name)
+		if err != nil {
+			continue
+		}
+		sampled = append(sampled, id)
+	}
+	visible := map[int]int{}
+	if len(sampled) > 0 {
+		rows, err := store.RankedScoresByIDQuery.Query(ctx, app.db, sampled)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id, score int
+			if err := rows.Scan(&id, &score); err != nil {
+				rows.Close()
+				return err
+			}
+			visible[id] = score
+		}
+		rows.Close()
+	}
+	for _, member := range members {
+		name, _ := member.Member.(string)
+		id, err := rankingScoreID(name)
+		if err != nil {
+			continue
+		}
+		score, ok := visible[id]
+		switch {
+		case !ok:
+			drift[driftStale]++
+			app.rankingRemove(ctx, id)
+		case int(member.Score) != score:
+			if _, checked := expected[id]; !checked {
+				drift[driftScore]++
+				app.rankingAdd(ctx, id, score)
+			}
+		}
+	}
+
+	// Drift outside the samples only shows in the totals
+	var total int64
+	if err := store.CountRankedQuery.QueryRow(ctx, app.db).Scan(&total); err != nil {
+		return err
+	}
+	size, err := app.redis.ZCard(ctx, cacheKeyRanking).Result()
+	if err != nil {
+		return err
+	}
+	rebuild := false
+	if size != total {
+		drift[driftCount]++
+		streak, err := app.redis.Incr(ctx, cacheKeyDriftCountStreak).Result()
+		app.redis.Expire(ctx, cacheKeyDriftCountStreak, 3*c.interval)
+		rebuild = err == nil && streak >= 2
+	} else {
+		app.redis.Del(ctx, cacheKeyDriftCountStreak)
+	}
+	span.SetAttributes(attribute.Int64("ranking.size", size), attribute.Int64("ranking.expected_size", total))
+
+	found := 0
+	for kind, n := range drift {
+		found += n
+		rankingDriftTotal.Add(ctx, int64(n), metric.WithAttributes(attribute.String("drift.kind", kind)))
+		span.SetAttributes(attribute.Int("ranking.drift."+kind, n))
+	}
+	if found == 0 {
+		return nil
+	}
+	log.Printf("⚠️ Ranking drift: %d missing, %d stale, %d wrong scores, %d in the set vs %d in Postgres",
+		drift[driftMissing], drift[driftStale], drift[driftScore], size, total)
+
+	if rebuild {
+		log.Println("⚠️ Ranking size still drifting, rebuilding it from Postgres")
+		app.redis.Del(ctx, cacheKeyDriftCountStreak, cacheKeyRankingReady)
+		app.rankingReady(ctx)
+	} else if found == drift[driftCount] {
+		// Nothing repaired, so the cached boards still match the set
+		return nil
+	}
+	app.invalidateCache(ctx)
+	app.dropCachedPlayerStats(ctx)
+	app.markSurrogateKeys(ctx, surrogateKeyLeaderboard)
+	app.publishChange(ctx)
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	// Redis channel carrying every outbound event as a CloudEvents JSON envelope
+	eventsChannel = "leaderboard:events"
+
+	cloudEventsSpecVersion = "1.0"
+	eventSource            = "/spice-runner/leaderboard-api"
+
+	// Event types
+	eventTypeScoreAccepted    = "com.spicerunner.leaderboard.score.accepted"
+	eventTypeMilestoneReached = "com.spicerunner.leaderboard.community.milestone.reached"
+	eventTypeReignStarted     = "com.spicerunner.leaderboard.reign.started"
+)
+
+// CloudEvent is a CloudEvents 1.0 structured-mode envelope. The traceparent and
+// tracestate extensions follow the CloudEvents distributed tracing extension so
+// consumers can continue the producer's trace.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+	TraceParent     string          `json:"traceparent,omitempty"`
+	TraceState      string          `json:"tracestate,omitempty"`
+}
+
+type ScoreAcceptedEvent struct {
+	ID         int       `json:"id"`
+	PlayerName string    `json:"playerName"`
+	Score      int       `json:"score"`
+	Rank       int       `json:"rank"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// CommunityMilestoneEvent announces a community goal being reached. ReachedBy
+// is the player whose run crossed the target.
+type CommunityMilestoneEvent struct {
+	Metric    string    `json:"metric"`
+	Target    int64     `json:"target"`
+	Value     int64     `json:"value"`
+	ReachedBy string    `json:"reachedBy"`
+	ReachedAt time.Time `json:"reachedAt"`
+}
+
+// newCloudEvent wraps data in an envelope carrying the trace context of ctx.
+func newCloudEvent(ctx context.Context, eventType, subject string, data interface{}) (*CloudEvent, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event data: %w", err)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate event ID: %w", err)
+	}
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return &CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              hex.EncodeToString(id),
+		Source:          eventSource,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            payload,
+		TraceParent:     carrier.Get("traceparent"),
+		TraceState:      carrier.Get("tracestate"),
+	}, nil
+}
+
+// Context returns ctx with the producer's trace context extracted from the event.
+func (e *CloudEvent) Context(ctx context.Context) context.Context {
+	carrier := propagation.MapCarrier{}
+	if e.TraceParent != "" {
+		carrier.Set("traceparent", e.TraceParent)
+	}
+	if e.TraceState != "" {
+		carrier.Set("tracestate", e.TraceState)
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// maskEvent returns an event's subject and data with the players' names
+// masked, as they leave the cluster.
+func maskEvent(mask func(string) string, subject string, data interface{}) (string, interface{}) {
+	switch d := data.(type) {
+	case ScoreAcceptedEvent:
+		d.PlayerName = mask(d.PlayerName)
+		return mask(subject), d
+	case *ReignStartedEvent:
+		masked := *d
+		masked.PlayerName = mask(masked.PlayerName)
+		if masked.PreviousHolder != "" {
+			masked.PreviousHolder = mask(masked.PreviousHolder)
+		}
+		return mask(subject), &masked
+	case CommunityMilestoneEvent:
+		d.ReachedBy = mask(d.ReachedBy)
+		return subject, d
+	}
+	return subject, data
+}
+
+// webhookEvent is event as webhooks receive it: the same envelope, with the
+// names masked per the privacy policy.
+func (app *App) webhookEvent(event *CloudEvent, subject string, data interface{}) (*CloudEvent, []byte, error) {
+	maskedSubject, maskedData := maskEvent(app.nameMask(), subject, data)
+	payload, err := json.Marshal(maskedData)
+	if err != nil {
+		return nil, nil, err
+	}
+	masked := *event
+	masked.Subject, masked.Data = maskedSubject, payload
+	body, err := json.Marshal(&masked)
+	return &masked, body, err
+}
+
+// emitEvent publishes a CloudEvent to the events channel and queues it for
+// subscribed webhooks. The channel stays inside the cluster and carries real
+// names; webhooks get them masked. Delivery is best-effort.
+func (app *App) emitEvent(ctx context.Context, eventType, subject string, data interface{}) {
+	ctx, span := tracer.Start(ctx, "emitEvent")
+	defer span.End()
+
+	event, err := newCloudEvent(ctx, eventType, subject, data)
+	if err != nil {
+		span.RecordError(err)
+		log.Printf("Failed to build %s event: %v", eventType, err)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("cloudevents.event_type", event.Type),
+		attribute.String("cloudevents.event_id", event.ID),
+		attribute.String("cloudevents.event_subject", event.Subject),
+	)
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		span.RecordError(err)
+		log.Printf("Failed to encode %s event: %v", eventType, err)
+		return
+	}
+	if hooked, hookedBody, err := app.webhookEvent(event, subject, data); err == nil {
+		app.enqueueWebhooks(ctx, hooked, hookedBody)
+	} else {
+		span.RecordError(err)
+		log.Printf("Failed to encode %s event for webhooks: %v", eventType, err)
+	}
+	if err := app.redis.Publish(ctx, eventsChannel, body).Err(); err != nil {
+		span.RecordError(err)
+		log.Printf("Failed to publish %s event: %v", eventType, err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Experiment applies an alternative threshold for one anti-cheat rule to a
+// percentage of sessions in log-only mode: would-be verdicts are recorded but
+// never enforced.
+type Experiment struct {
+	Name      string  `json:"name"`
+	Rule      string  `json:"rule"`
+	Threshold float64 `json:"threshold"`
+	Percent   int     `json:"percent"`
+
+	stage SubmissionStage
+	// replaces is the pipeline stage whose verdict the experiment's is
+	// compared with
+	replaces string
+}
+
+// experimentRuleStages is the pipeline stage each experiment rule stands in for.
+var experimentRuleStages = map[string]string{
+	"max_score":                 "plausibility",
+	"min_interval_seconds":      "rate",
+	"max_suspicious_rejections": "reputation",
+}
+
+// experimentRules builds a candidate check for each rule that supports alternative thresholds.
+var experimentRules = map[string]func(app *App, threshold float64) func(ctx context.Context, submission *ScoreSubmission) error{
+	"max_score": func(app *App, threshold float64) func(ctx context.Context, submission *ScoreSubmission) error {
+		return func(ctx context.Context, submission *ScoreSubmission) error {
+			return plausibilityCheck(app.inputScoreCeiling(int(threshold), submission.InputMethod))(ctx, submission)
+		}
+	},
+	"min_interval_seconds": func(app *App, threshold float64) func(ctx context.Context, submission *ScoreSubmission) error {
+		return app.submissionRateCheck(time.Duration(threshold * float64(time.Second)))
+	},
+	"max_suspicious_rejections": func(app *App, threshold float64) func(ctx context.Context, submission *ScoreSubmission) error {
+		return app.reputationCheck(int(threshold))
+	},
+}
+
+// loadExperiments parses ANTICHEAT_EXPERIMENTS, a JSON array of experiments.
+func loadExperiments(app *App, raw string) ([]*Experiment, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var experiments []*Experiment
+	if err := json.Unmarshal([]byte(raw), &experiments); err != nil {
+		return nil, fmt.Errorf("failed to parse experiments: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, exp := range experiments {
+		if exp.Name == "" {
+			return nil, fmt.Errorf("experiment name required")
+		}
+		if seen[exp.Name] {
+			return nil, fmt.Errorf("duplicate experiment %q", exp.Name)
+		}
+		seen[exp.Name] = true
+
+		build, ok := experimentRules[exp.Rule]
+		if !ok {
+			return nil, fmt.Errorf("experiment %q: unknown rule %q", exp.Name, exp.Rule)
+		}
+		if exp.Percent < 0 || exp.Percent > 100 {
+			return nil, fmt.Errorf("experiment %q: percent must be between 0 and 100", exp.Name)
+		}
+		exp.stage = StageFunc{StageName: "experiment:" + exp.Name, Fn: build(app, exp.Threshold)}
+		exp.replaces = experimentRuleStages[exp.Rule]
+	}
+	return experiments, nil
+}
+
+// assigned reports whether the session falls into the experiment's traffic slice.
+// Assignment is sticky per session so a player sees consistent treatment.
+func (exp *Experiment) assigned(sessionID string) bool {
+	h := fnv.New32a()
+	h.Write([]byte(exp.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(sessionID))
+	return int(h.Sum32()%100) < exp.Percent
+}
+
+// runExperiments evaluates every assigned experiment against the submission and
+// records what it would have decided next to the verdict of the stage it
+// replaces. ran lists the stages the pipeline ran, the last one rejecting the
+// submission when enforcedErr is set. An experiment whose stage didn't run,
+// because an earlier one rejected the submission or the pipeline leaves it
+// out, has nothing to compare with and is skipped.
+func (app *App) runExperiments(ctx context.Context, submission *ScoreSubmission, ran []string, enforcedErr error) {
+	if len(app.experiments) == 0 {
+		return
+	}
+
+	var outcomes []stageOutcome
+	for _, exp := range app.experiments {
+		if !exp.assigned(submission.SessionID) {
+			continue
+		}
+		enforced, ok := stageVerdict(exp.replaces, ran, enforcedErr)
+		if !ok {
+			continue
+		}
+
+		// Candidates see a copy so they cannot normalize the real submission
+		candidate := *submission
+		err := exp.stage.Check(ctx, &candidate)
+
+		verdict := "accepted"
+		if err != nil {
+			verdict = "rejected"
+		}
+
+		outcomes = append(outcomes, stageOutcome{stage: exp.stage.Name(), outcome: outcomeEvaluated})
+		if err != nil {
+			outcomes = append(outcomes, stageOutcome{stage: exp.stage.Name(), outcome: outcomeRejected})
+		}
+
+		experimentVerdictsTotal.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("experiment", exp.Name),
+			attribute.String("verdict", verdict),
+			attribute.String("enforced", enforced),
+		))
+		trace.SpanFromContext(ctx).AddEvent("anticheat.experiment", trace.WithAttributes(
+			attribute.String("experiment.name", exp.Name),
+			attribute.String("experiment.verdict", verdict),
+			attribute.String("experiment.enforced", enforced),
+		))
+
+		if verdict != enforced {
+			log.Printf("🧪 Experiment %s would have %s score %d from session %s (enforced: %s, reason: %v)",
+				exp.Name, verdict, submission.Score, submission.SessionID, enforced, err)
+		}
+	}
+
+	app.recordAnticheatOutcomes(ctx, outcomes)
+}
+
+// stageVerdict is what stage decided in a pipeline run that ran the stages in
+// ran, or false if it didn't run.
+func stageVerdict(stage string, ran []string, enforcedErr error) (string, bool) {
+	for i, name := range ran {
+		if name != stage {
+			continue
+		}
+		if enforcedErr != nil && i == len(ran)-1 {
+			return "rejected", true
+		}
+		return "accepted", true
+	}
+	return "", false
+}
+
+func (app *App) getExperimentsHandler(w http.ResponseWriter, r *http.Request) {
+	experiments := app.experiments
+	if experiments == nil {
+		experiments = []*Experiment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(experiments)
+}
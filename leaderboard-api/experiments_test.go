@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStageVerdict(t *testing.T) {
+	rejected := errors.New("rejected")
+	tests := []struct {
+		name   string
+		stage  string
+		ran    []string
+		err    error
+		want   string
+		wantOK bool
+	}{
+		{"accepted run", "plausibility", []string{"schema", "rate", "plausibility", "reputation"}, nil, "accepted", true},
+		{"rejected by the stage", "plausibility", []string{"schema", "rate", "plausibility"}, rejected, "rejected", true},
+		{"rejected by a later stage", "plausibility", []string{"schema", "plausibility", "reputation"}, rejected, "accepted", true},
+		{"rejected before the stage", "plausibility", []string{"schema"}, rejected, "", false},
+		{"stage left out", "reputation", []string{"schema", "rate", "plausibility"}, nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := stageVerdict(tt.stage, tt.ran, tt.err)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("stageVerdict = %q, %v; want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
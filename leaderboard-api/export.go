@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// Flush after this many rows; writes block on slow clients, which in turn
+	// stops us reading further rows from Postgres
+	streamFlushRows = 500
+	// Each flush pushes the write deadline out by this much
+	streamWriteWindow = 30 * time.Second
+
+	maxJSONLeaderboardLimit = handlers.MaxJSONLeaderboardLimit
+)
+
+// streamWriter writes a long response in flushed chunks, extending the write
+// deadline as it goes so the server's WriteTimeout doesn't cut it off.
+type streamWriter struct {
+	w    io.Writer
+	rc   *http.ResponseController
+	rows int
+}
+
+func newStreamWriter(w http.ResponseWriter) *streamWriter {
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(streamWriteWindow))
+	return &streamWriter{w: w, rc: rc}
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+// rowDone counts a written row and flushes every streamFlushRows rows.
+// flushBuffered, if set, first pushes out anything an encoder is buffering.
+func (s *streamWriter) rowDone(flushBuffered func() error) error {
+	s.rows++
+	if s.rows%streamFlushRows != 0 {
+		return nil
+	}
+	return s.flush(flushBuffered)
+}
+
+func (s *streamWriter) flush(flushBuffered func() error) error {
+	if flushBuffered != nil {
+		if err := flushBuffered(); err != nil {
+			return err
+		}
+	}
+	s.rc.SetWriteDeadline(time.Now().Add(streamWriteWindow))
+	return s.rc.Flush()
+}
+
+// ScoreExport is one row of a score export.
+type ScoreExport struct {
+	ID          int       `json:"id"`
+	PlayerName  string    `json:"playerName"`
+	Score       int       `json:"score"`
+	SessionID   string    `json:"sessionId"`
+	PlayerID    string    `json:"playerId,omitempty"`
+	Mode        string    `json:"mode"`
+	Difficulty  string    `json:"difficulty"`
+	Season      int       `json:"season"`
+	Tags        []string  `json:"tags"`
+	Quarantined bool      `json:"quarantined"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+var scoreExportColumns = []string{
+	"id", "player_name", "score", "session_id", "player_id", "game_mode", "difficulty", "season_id", "tags", "quarantined",
+	"created_at",
+}
+
+// scoreExportEncoder writes export rows in one output format.
+type scoreExportEncoder interface {
+	contentType() string
+	begin() error
+	encode(row ScoreExport) error
+	flush() error
+}
+
+type ndjsonExportEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExportEncoder) contentType() string { return "application/x-ndjson" }
+
+func (e *ndjsonExportEncoder) begin() error { return nil }
+
+func (e *ndjsonExportEncoder) encode(row ScoreExport) error { return e.enc.Encode(row) }
+
+func (e *ndjsonExportEncoder) flush() error { return nil }
+
+type csvExportEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvExportEncoder) contentType() string { return "text/csv" }
+
+func (e *csvExportEncoder) begin() error { return e.w.Write(scoreExportColumns) }
+
+func (e *csvExportEncoder) encode(row ScoreExport) error {
+	return e.w.Write([]string{
+		strconv.Itoa(row.ID),
+		row.PlayerName,
+		strconv.Itoa(row.Score),
+		row.SessionID,
+		row.PlayerID,
+		row.Mode,
+		row.Difficulty,
+		strconv.Itoa(row.Season),
+		strings.Join(row.Tags, ","),
+		strconv.FormatBool(row.Quarantined),
+		row.CreatedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (e *csvExportEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// exportScoresHandler streams every score as CSV or NDJSON, oldest first,
+// without holding the result set in memory.
+func (app *App) exportScoresHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "exportScores")
+	defer span.End()
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+	span.SetAttributes(attribute.String("export.format", format))
+
+	stream := newStreamWriter(w)
+	var enc scoreExportEncoder
+	switch format {
+	case "ndjson":
+		enc = &ndjsonExportEncoder{enc: json.NewEncoder(stream)}
+	case "csv":
+		enc = &csvExportEncoder{w: csv.NewWriter(stream)}
+	default:
+		http.Error(w, `format must be "csv" or "ndjson"`, http.StatusBadRequest)
+		return
+	}
+
+	rows, err := store.ExportAllScoresQuery.Query(ctx, app.db)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to export scores", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", enc.contentType())
+	w.Header().Set("Content-Disposition", "attachment; filename=scores."+format)
+	if err := enc.begin(); err != nil {
+		span.RecordError(err)
+		return
+	}
+
+	for rows.Next() {
+		var row ScoreExport
+		if err := rows.Scan(&row.ID, &row.PlayerName, &row.Score, &row.SessionID, &row.PlayerID, &row.Mode,
+			&row.Difficulty, &row.Season, &row.Tags, &row.Quarantined, &row.CreatedAt); err != nil {
+			log.Printf("Failed to scan row: %v", err)
+			continue
+		}
+		if err := enc.encode(row); err != nil {
+			// The client went away; stop reading
+			span.RecordError(err)
+			return
+		}
+		if err := stream.rowDone(enc.flush); err != nil {
+			span.RecordError(err)
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		// Headers are already sent, so the truncated body is all we can signal
+		span.RecordError(err)
+		log.Printf("Score export failed after %d rows: %v", stream.rows, err)
+	}
+	stream.flush(enc.flush)
+	span.SetAttributes(attribute.Int("export.rows", stream.rows))
+}
+
+// streamTopScores writes the top limit scores as NDJSON, one entry per line, as
+// they are read from the database. It stops at the query budget's row cap.
+func (app *App) streamTopScores(ctx context.Context, w http.ResponseWriter, limit int, tags []string) {
+	span := trace.SpanFromContext(ctx)
+
+	rows, release, err := app.budgetedQuery(ctx, store.StreamTopQuery, app.budget.limit(limit), store.TagsJSON(tags))
+	if err != nil {
+		span.RecordError(err)
+		handlers.WriteError(w, err, "Failed to fetch leaderboard")
+		return
+	}
+	defer release()
+
+	capped := app.newResultCap("leaderboard_stream")
+	capped.declare(w)
+	defer capped.report(ctx, w)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	stream := newStreamWriter(w)
+	enc := json.NewEncoder(stream)
+	mask := app.nameMask()
+	for rows.Next() {
+		if !capped.allow() {
+			break
+		}
+		var entry LeaderboardEntry
+		if err := rows.Scan(&entry.Rank, &entry.ID, &entry.PlayerName, &entry.Score, &entry.CreatedAt, &entry.Tags,
+			&entry.Extras, &entry.ExtrasVersion); err != nil {
+			log.Printf("Failed to scan row: %v", err)
+			continue
+		}
+		entry.PlayerName = mask(entry.PlayerName)
+		if err := enc.Encode(entry); err != nil {
+			span.RecordError(err)
+			return
+		}
+		if err := stream.rowDone(nil); err != nil {
+			span.RecordError(err)
+			return
+		}
+	}
+	if err := capped.finish(rows.Err()); err != nil {
+		span.RecordError(err)
+		log.Printf("Leaderboard stream failed after %d rows: %v", stream.rows, err)
+	}
+	stream.flush(nil)
+	span.SetAttributes(attribute.Int("stream.rows", stream.rows))
+}
+
+// LeaderboardExportEntry is one row of a leaderboard export.
+type LeaderboardExportEntry struct {
+	Rank          int                        `json:"rank"`
+	ID            int                        `json:"id"`
+	PlayerName    string                     `json:"playerName"`
+	Score         int                        `json:"score"`
+	SeasonID      int                        `json:"seasonId,omitempty"`
+	Tags          []string                   `json:"tags,omitempty"`
+	ExtrasVersion int                        `json:"extrasVersion,omitempty"`
+	Extras        map[string]json.RawMessage `json:"extras,omitempty"`
+	CreatedAt     time.Time                  `json:"createdAt"`
+}
+
+var leaderboardExportColumns = []string{"rank", "id", "player_name", "score", "season_id", "tags", "created_at"}
+
+// exportLeaderboardHandler streams a whole leaderboard, best first, as CSV or
+// NDJSON. It covers one season (the current one by default, or "all") and
+// optionally only scores from the last window, up to the query budget.
+func (app *App) exportLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "exportLeaderboard")
+	defer span.End()
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "ndjson" {
+		http.Error(w, `format must be "csv" or "ndjson"`, http.StatusBadRequest)
+		return
+	}
+	tags, err := parseTagFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A nil season or since leaves that filter off
+	var seasonID *int
+	switch season := query.Get("season"); season {
+	case "", "current":
+		current, err := app.currentSeason(ctx)
+		if err != nil {
+			span.RecordError(err)
+			http.Error(w, "Failed to fetch season", http.StatusInternalServerError)
+			return
+		}
+		seasonID = &current.ID
+	case "all":
+	default:
+		id, err := strconv.Atoi(season)
+		if err != nil {
+			http.Error(w, `season must be a season ID, "current" or "all"`, http.StatusBadRequest)
+			return
+		}
+		var exists bool
+		if err := store.SeasonExistsQuery.QueryRow(ctx, app.db, id).Scan(&exists); err != nil {
+			span.RecordError(err)
+			http.Error(w, "Failed to fetch season", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "Season not found", http.StatusNotFound)
+			return
+		}
+		seasonID = &id
+	}
+	var since *time.Time
+	if raw := query.Get("window"); raw != "" {
+		window, err := time.ParseDuration(raw)
+		if err != nil || window <= 0 {
+			http.Error(w, "window must be a positive duration, e.g. 24h", http.StatusBadRequest)
+			return
+		}
+		t := time.Now().Add(-window)
+		since = &t
+	}
+
+	span.SetAttributes(attribute.String("export.format", format), attribute.StringSlice("query.tags", tags))
+	if seasonID != nil {
+		span.SetAttributes(attribute.Int("season.id", *seasonID))
+	}
+
+	rows, release, err := app.budgetedQuery(ctx, store.ExportLeaderboardQuery, store.TagsJSON(tags), seasonID, since,
+		app.budget.limit(0))
+	if err != nil {
+		span.RecordError(err)
+		handlers.WriteError(w, err, "Failed to export leaderboard")
+		return
+	}
+	defer release()
+
+	capped := app.newResultCap("leaderboard_export")
+	capped.declare(w)
+	defer capped.report(ctx, w)
+	stream := newStreamWriter(w)
+	var encode func(entry LeaderboardExportEntry) error
+	var flushBuffered func() error
+	if format == "csv" {
+		cw := csv.NewWriter(stream)
+		flushBuffered = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+		encode = func(entry LeaderboardExportEntry) error {
+			return cw.Write([]string{
+				strconv.Itoa(entry.Rank),
+				strconv.Itoa(entry.ID),
+				entry.PlayerName,
+				strconv.Itoa(entry.Score),
+				strconv.Itoa(entry.SeasonID),
+				strings.Join(entry.Tags, ","),
+				entry.CreatedAt.UTC().Format(time.RFC3339),
+			})
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		cw.Write(leaderboardExportColumns)
+	} else {
+		enc := json.NewEncoder(stream)
+		encode = func(entry LeaderboardExportEntry) error { return enc.Encode(entry) }
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename=leaderboard."+format)
+
+	mask := app.nameMask()
+	for rows.Next() {
+		if !capped.allow() {
+			break
+		}
+		var entry LeaderboardExportEntry
+		if err := rows.Scan(&entry.Rank, &entry.ID, &entry.PlayerName, &entry.Score, &entry.SeasonID, &entry.Tags,
+			&entry.Extras, &entry.ExtrasVersion, &entry.CreatedAt); err != nil {
+			log.Printf("Failed to scan row: %v", err)
+			continue
+		}
+		entry.PlayerName = mask(entry.PlayerName)
+		if err := encode(entry); err != nil {
+			// The client went away; stop reading
+			span.RecordError(err)
+			return
+		}
+		if err := stream.rowDone(flushBuffered); err != nil {
+			span.RecordError(err)
+			return
+		}
+	}
+	if err := capped.finish(rows.Err()); err != nil {
+		// Headers are already sent, so the truncated body is all we can signal
+		span.RecordError(err)
+		log.Printf("Leaderboard export failed after %d rows: %v", stream.rows, err)
+	}
+	stream.flush(flushBuffered)
+	span.SetAttributes(attribute.Int("export.rows", stream.rows))
+}
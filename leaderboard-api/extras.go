@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// Fields accepted per extras schema version, overridable with SCORE_EXTRAS_SCHEMAS
+	defaultExtrasSchemas = `{"1":["character","device","distance","runDurationMs"]}`
+
+	// Extras are display data, not a blob store
+	maxExtrasBytes      = 2048
+	maxExtrasValueBytes = 256
+)
+
+// extrasSchemas maps an extras schema version to its allowed field names.
+var extrasSchemas, _ = parseExtrasSchemas(defaultExtrasSchemas)
+
+// parseExtrasSchemas reads a JSON object of version → field names.
+func parseExtrasSchemas(raw string) (map[int]map[string]bool, error) {
+	var config map[string][]string
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		return nil, fmt.Errorf("invalid extras schemas: %w", err)
+	}
+
+	schemas := make(map[int]map[string]bool, len(config))
+	for key, fields := range config {
+		version, err := strconv.Atoi(key)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid extras schema version %q", key)
+		}
+		allowed := make(map[string]bool, len(fields))
+		for _, field := range fields {
+			allowed[field] = true
+		}
+		schemas[version] = allowed
+	}
+	return schemas, nil
+}
+
+func extrasVersions() []int {
+	versions := make([]int, 0, len(extrasSchemas))
+	for version := range extrasSchemas {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// checkExtras drops fields the submission's schema version does not allow, so
+// newer clients keep working against older servers, and rejects anything that
+// is not a small scalar.
+func checkExtras(ctx context.Context, submission *ScoreSubmission) error {
+	if len(submission.Extras) == 0 {
+		submission.Extras = nil
+		submission.ExtrasVersion = 0
+		return nil
+	}
+
+	allowed, ok := extrasSchemas[submission.ExtrasVersion]
+	if !ok {
+		return fmt.Errorf("unsupported extras version %d", submission.ExtrasVersion)
+	}
+
+	dropped := 0
+	for field, value := range submission.Extras {
+		if !allowed[field] {
+			delete(submission.Extras, field)
+			dropped++
+			continue
+		}
+		value = bytes.TrimSpace(value)
+		if len(value) == 0 || bytes.Equal(value, []byte("null")) {
+			delete(submission.Extras, field)
+			continue
+		}
+		if value[0] == '{' || value[0] == '[' {
+			return fmt.Errorf("extras field %q must be a string, number or boolean", field)
+		}
+		if len(value) > maxExtrasValueBytes {
+			return fmt.Errorf("extras field %q too long (max %d bytes)", field, maxExtrasValueBytes)
+		}
+		submission.Extras[field] = value
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("extras.dropped_fields", dropped))
+
+	if len(submission.Extras) == 0 {
+		submission.Extras = nil
+		submission.ExtrasVersion = 0
+		return nil
+	}
+	if len(store.ExtrasJSON(submission.Extras)) > maxExtrasBytes {
+		return fmt.Errorf("extras too large (max %d bytes)", maxExtrasBytes)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	mrand "math/rand"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	cacheKeyFeaturedRunner = "leaderboard:featured"
+
+	defaultFeaturedRotation = 10 * time.Minute
+
+	// Only runners active this recently can be featured
+	featuredActivityWindow = 7 * 24 * time.Hour
+	featuredMaxCandidates  = 500
+)
+
+// FeaturedRunner is the player spotlighted on the game's menu screen until
+// FeaturedUntil.
+type FeaturedRunner struct {
+	PlayerName    string    `json:"playerName"`
+	SeasonBest    int       `json:"seasonBest"`
+	CurrentRank   int       `json:"currentRank"`
+	TotalGames    int       `json:"totalGames"`
+	RecentRuns    int       `json:"recentRuns"`
+	FurthestBiome string    `json:"furthestBiome,omitempty"`
+	FeaturedUntil time.Time `json:"featuredUntil"`
+}
+
+type featuredCandidate struct {
+	playerName string
+	runs       int
+	rank       int
+}
+
+// featuredWeight favours runners who play a lot and place well, with
+// diminishing returns on both so the leader doesn't take every rotation.
+func featuredWeight(c featuredCandidate) float64 {
+	return math.Log2(1+float64(c.runs)) * (1 + 1/math.Sqrt(float64(c.rank)))
+}
+
+// pickFeatured draws a candidate at random in proportion to its weight.
+func pickFeatured(candidates []featuredCandidate) featuredCandidate {
+	total := 0.0
+	for _, c := range candidates {
+		total += featuredWeight(c)
+	}
+	n := mrand.Float64() * total
+	for _, c := range candidates {
+		n -= featuredWeight(c)
+		if n < 0 {
+			return c
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// getFeaturedHandler returns the featured runner, drawing a new one when the
+// current rotation ends. Replicas share the pick through Redis.
+func (app *App) getFeaturedHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getFeatured")
+	defer span.End()
+
+	var featured *FeaturedRunner
+	if cached, err := app.cache.Get(ctx, cacheKeyFeaturedRunner); err == nil && json.Unmarshal(cached, &featured) == nil {
+		cacheHitTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "featured")))
+	} else {
+		cacheMissTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "featured")))
+
+		featured, err = app.drawFeatured(ctx)
+		if err != nil {
+			span.RecordError(err)
+			http.Error(w, "Failed to pick featured runner", http.StatusInternalServerError)
+			return
+		}
+		if featured == nil {
+			http.Error(w, "No active runners to feature", http.StatusNotFound)
+			return
+		}
+		span.SetAttributes(attribute.String("featured.player", featured.PlayerName))
+
+		// The first replica to draw sets the rotation; the others serve its pick
+		data, err := json.Marshal(featured)
+		if err != nil {
+			http.Error(w, "Failed to encode featured runner", http.StatusInternalServerError)
+			return
+		}
+		if set, err := app.cache.SetNX(ctx, cacheKeyFeaturedRunner, data, app.cfg().FeaturedRotation); err == nil && !set {
+			if cached, err := app.cache.Get(ctx, cacheKeyFeaturedRunner); err == nil {
+				json.Unmarshal(cached, &featured)
+			}
+		}
+	}
+
+	featured.PlayerName = app.nameMask()(featured.PlayerName)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(featured)
+}
+
+// drawFeatured picks a runner from the players active in the current season
+// over the last week. It returns nil if there are none.
+func (app *App) drawFeatured(ctx context.Context) (*FeaturedRunner, error) {
+	rows, err := store.FeaturedCandidatesQuery.Query(ctx, app.db, time.Now().Add(-featuredActivityWindow), featuredMaxCandidates)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (featuredCandidate, error) {
+		var c featuredCandidate
+		err := row.Scan(&c.playerName, &c.runs, &c.rank)
+		return c, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	pick := pickFeatured(candidates)
+	stats, err := app.playerStats(ctx, pick.playerName)
+	if err != nil {
+		return nil, err
+	}
+	return &FeaturedRunner{
+		PlayerName:    pick.playerName,
+		SeasonBest:    stats.SeasonBest,
+		CurrentRank:   stats.CurrentRank,
+		TotalGames:    stats.TotalGames,
+		RecentRuns:    pick.runs,
+		FurthestBiome: stats.FurthestBiome,
+		FeaturedUntil: time.Now().Add(app.cfg().FeaturedRotation).UTC(),
+	}, nil
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// Hash of source name to its latest federatedSource, shared by replicas
+	cacheKeyFederation = "leaderboard:federation"
+	// Only one replica pulls from the peers per interval
+	cacheKeyFederationLock = "leaderboard:federation:lock"
+
+	federationTokenHeader = "X-Federation-Token"
+
+	// Largest body a peer may push
+	federationMaxPushBytes = 1 << 20
+)
+
+// federationPeer is a leaderboard instance whose top scores are pulled.
+type federationPeer struct {
+	name    string
+	baseURL string
+}
+
+// federation merges this instance's board with other instances', such as
+// other regions' or a live event's, into a global board. Peers are pulled
+// from their public /api/leaderboard/top every interval, or push their board
+// with the shared token. Each source's latest board is kept in Redis, so
+// every replica serves the same global board.
+type federation struct {
+	source     string
+	peers      []federationPeer
+	token      string
+	topN       int
+	interval   time.Duration
+	staleAfter time.Duration
+	client     *http.Client
+}
+
+// newFederationFromEnv reads FEDERATION_PEERS, a comma-separated list of
+// name=baseURL, and FEDERATION_TOKEN, which lets peers push. It returns nil
+// when neither is set.
+func newFederationFromEnv() (*federation, error) {
+	f := &federation{
+		source: getEnv("FEDERATION_SOURCE_NAME", "local"),
+		token:  getEnv("FEDERATION_TOKEN", ""),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, peer := range strings.Split(getEnv("FEDERATION_PEERS", ""), ",") {
+		if peer = strings.TrimSpace(peer); peer == "" {
+			continue
+		}
+		name, baseURL, ok := strings.Cut(peer, "=")
+		if !ok || !apiKeyNamePattern.MatchString(name) || !strings.HasPrefix(baseURL, "http") {
+			return nil, fmt.Errorf("FEDERATION_PEERS entries must be name=http(s)://base-url, got %q", peer)
+		}
+		f.peers = append(f.peers, federationPeer{name: name, baseURL: strings.TrimSuffix(baseURL, "/")})
+	}
+	if len(f.peers) == 0 && f.token == "" {
+		return nil, nil
+	}
+	if !apiKeyNamePattern.MatchString(f.source) {
+		return nil, fmt.Errorf("FEDERATION_SOURCE_NAME must be 1-64 lowercase letters, digits, '_' or '-'")
+	}
+
+	var err error
+	if f.topN, err = strconv.Atoi(getEnv("FEDERATION_TOP_N", "100")); err != nil || f.topN <= 0 || f.topN > maxJSONLeaderboardLimit {
+		return nil, fmt.Errorf("FEDERATION_TOP_N must be between 1 and %d", maxJSONLeaderboardLimit)
+	}
+	if f.interval, err = time.ParseDuration(getEnv("FEDERATION_PULL_INTERVAL", "30s")); err != nil || f.interval < time.Second {
+		return nil, fmt.Errorf("FEDERATION_PULL_INTERVAL must be a duration of at least 1s")
+	}
+	if f.staleAfter, err = time.ParseDuration(getEnv("FEDERATION_STALE_AFTER", "10m")); err != nil || f.staleAfter < f.interval {
+		return nil, fmt.Errorf("FEDERATION_STALE_AFTER must be a duration no shorter than FEDERATION_PULL_INTERVAL")
+	}
+	return f, nil
+}
+
+// federatedSource is a source's latest board as kept in Redis. Error is set
+// when the last pull failed; Entries are then the last ones pulled.
+type federatedSource struct {
+	Entries   []LeaderboardEntry `json:"entries"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// GlobalEntry is an entry of the global board. SourceRank is its rank on its
+// source's own board.
+type GlobalEntry struct {
+	Rank       int       `json:"rank"`
+	Source     string    `json:"source"`
+	SourceRank int       `json:"sourceRank"`
+	PlayerName string    `json:"playerName"`
+	Score      int       `json:"score"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// FederationSourceStatus says how current a source's part of the board is. A
+// stale source is left out of the board.
+type FederationSourceStatus struct {
+	Name      string     `json:"name"`
+	Entries   int        `json:"entries"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	Stale     bool       `json:"stale"`
+	Error     string     `json:"error,omitempty"`
+}
+
+type GlobalLeaderboard struct {
+	Entries     []GlobalEntry            `json:"entries"`
+	Sources     []FederationSourceStatus `json:"sources"`
+	GeneratedAt time.Time                `json:"generatedAt"`
+}
+
+// runFederationPuller pulls every peer's board each interval until ctx is
+// done.
+func (app *App) runFederationPuller(ctx context.Context, f *federation) {
+	log.Printf("✅ Federating the leaderboard as %s with %d peers", f.source, len(f.peers))
+	if len(f.peers) == 0 {
+		return
+	}
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		acquired, err := app.redis.SetNX(ctx, cacheKeyFederationLock, 1, f.interval/2).Result()
+		if err != nil || acquired {
+			for _, peer := range f.peers {
+				app.pullFederationPeer(ctx, f, peer)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pullFederationPeer fetches a peer's top scores and stores them. A failed
+// pull keeps the entries from the last one, until they go stale.
+func (app *App) pullFederationPeer(ctx context.Context, f *federation, peer federationPeer) {
+	ctx, span := tracer.Start(ctx, "pullFederationPeer")
+	defer span.End()
+	span.SetAttributes(attribute.String("federation.source", peer.name))
+
+	entries, err := f.fetch(ctx, peer)
+	result := "success"
+	source := federatedSource{Entries: entries, UpdatedAt: time.Now().UTC()}
+	if err != nil {
+		result = "error"
+		span.RecordError(err)
+		log.Printf("Failed to pull leaderboard from peer %s: %v", peer.name, err)
+		previous, _ := app.federatedSources(ctx)
+		source = previous[peer.name]
+		source.Error = err.Error()
+	}
+	federationPullsTotal.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("federation.source", peer.name),
+		attribute.String("federation.result", result),
+	))
+	if err := app.storeFederatedSource(ctx, peer.name, source); err != nil {
+		log.Printf("Failed to store leaderboard from peer %s: %v", peer.name, err)
+	}
+}
+
+func (f *federation) fetch(ctx context.Context, peer federationPeer) ([]LeaderboardEntry, error) {
+	endpoint := fmt.Sprintf("%s/api/leaderboard/top?limit=%d", peer.baseURL, f.topN)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer answered %s", resp.Status)
+	}
+	var entries []LeaderboardEntry
+	if err := json.NewDecoder(io.LimitReader(resp.Body, federationMaxPushBytes)).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode peer leaderboard: %w", err)
+	}
+	if len(entries) > f.topN {
+		entries = entries[:f.topN]
+	}
+	return entries, nil
+}
+
+func (app *App) storeFederatedSource(ctx context.Context, name string, source federatedSource) error {
+	data, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+	return app.redis.HSet(ctx, cacheKeyFederation, name, data).Err()
+}
+
+// federatedSources returns every peer's stored board, by source name.
+func (app *App) federatedSources(ctx context.Context) (map[string]federatedSource, error) {
+	fields, err := app.redis.HGetAll(ctx, cacheKeyFederation).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	sources := make(map[string]federatedSource, len(fields))
+	for name, data := range fields {
+		var source federatedSource
+		if err := json.Unmarshal([]byte(data), &source); err == nil {
+			sources[name] = source
+		}
+	}
+	return sources, nil
+}
+
+// globalLeaderboard merges this instance's top with every fresh peer's and
+// ranks the result by score, earlier runs first on ties.
+func (app *App) globalLeaderboard(ctx context.Context, limit int) (*GlobalLeaderboard, error) {
+	f := app.federation
+	now := time.Now().UTC()
+	board := &GlobalLeaderboard{Entries: []GlobalEntry{}, GeneratedAt: now}
+
+	local, err := app.topScores(ctx, f.topN, nil)
+	if err != nil {
+		return nil, err
+	}
+	add := func(name string, entries []LeaderboardEntry) {
+		for _, entry := range entries {
+			board.Entries = append(board.Entries, GlobalEntry{
+				Source:     name,
+				SourceRank: entry.Rank,
+				PlayerName: entry.PlayerName,
+				Score:      entry.Score,
+				CreatedAt:  entry.CreatedAt,
+			})
+		}
+	}
+	add(f.source, local)
+	board.Sources = append(board.Sources, FederationSourceStatus{Name: f.source, Entries: len(local), UpdatedAt: &now})
+
+	// Peers' boards are optional: without Redis the global board is ours
+	sources, err := app.federatedSources(ctx)
+	if err != nil {
+		log.Printf("Failed to read federated leaderboards: %v", err)
+	}
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		if name != f.source {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		source := sources[name]
+		updatedAt := source.UpdatedAt
+		status := FederationSourceStatus{Name: name, Entries: len(source.Entries), Error: source.Error}
+		if !updatedAt.IsZero() {
+			status.UpdatedAt = &updatedAt
+		}
+		status.Stale = updatedAt.IsZero() || now.Sub(updatedAt) > f.staleAfter
+		if !status.Stale {
+			add(name, source.Entries)
+		}
+		board.Sources = append(board.Sources, status)
+	}
+
+	sort.SliceStable(board.Entries, func(i, j int) bool {
+		a, b := board.Entries[i], board.Entries[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.Source < b.Source
+	})
+	if len(board.Entries) > limit {
+		board.Entries = board.Entries[:limit]
+	}
+	for i := range board.Entries {
+		board.Entries[i].Rank = i + 1
+	}
+	return board, nil
+}
+
+// getGlobalLeaderboardHandler serves the merged board, with ?limit (default
+// 100, at most FEDERATION_TOP_N times the number of sources).
+func (app *App) getGlobalLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getGlobalLeaderboard")
+	defer span.End()
+
+	if app.federation == nil {
+		http.Error(w, "Federation is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	limit := defaultTopScoresLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 || parsed > maxJSONLeaderboardLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxJSONLeaderboardLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	span.SetAttributes(attribute.Int("query.limit", limit))
+
+	board, err := app.globalLeaderboard(ctx, limit)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch global leaderboard", http.StatusInternalServerError)
+		return
+	}
+	span.SetAttributes(attribute.Int("federation.sources", len(board.Sources)))
+
+	mask := app.nameMask()
+	for i := range board.Entries {
+		board.Entries[i].PlayerName = mask(board.Entries[i].PlayerName)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(board)
+}
+
+// FederationPush is a peer's board pushed to this instance.
+type FederationPush struct {
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+// pushFederationHandler stores a board pushed by a peer carrying the
+// federation token, for peers this instance can't reach to pull from.
+func (app *App) pushFederationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "pushFederation")
+	defer span.End()
+
+	f := app.federation
+	if f == nil || f.token == "" {
+		http.Error(w, "Federation pushes are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(federationTokenHeader)), []byte(f.token)) != 1 {
+		http.Error(w, "Invalid federation token", http.StatusUnauthorized)
+		return
+	}
+	name := mux.Vars(r)["source"]
+	if !apiKeyNamePattern.MatchString(name) || name == f.source {
+		http.Error(w, "Invalid source name", http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.String("federation.source", name))
+
+	var push FederationPush
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, federationMaxPushBytes)).Decode(&push); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(push.Entries) > f.topN {
+		push.Entries = push.Entries[:f.topN]
+	}
+	source := federatedSource{Entries: push.Entries, UpdatedAt: time.Now().UTC()}
+	if err := app.storeFederatedSource(ctx, name, source); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to store leaderboard", http.StatusServiceUnavailable)
+		return
+	}
+	federationPullsTotal.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("federation.source", name),
+		attribute.String("federation.result", "pushed"),
+	))
+	w.WriteHeader(http.StatusNoContent)
+}
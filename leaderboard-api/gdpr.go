@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// playerIDHeader proves ownership of an identity without an account: the
+	// playerId the game client keeps in local storage.
+	playerIDHeader = "X-Player-Id"
+
+	dataRequestErasure = "erasure"
+	dataRequestExport  = "export"
+)
+
+var (
+	// errPlayerNotVerified means the request didn't prove it comes from the
+	// player.
+	errPlayerNotVerified = errors.New("player not verified")
+	// errPlayerUnverifiable means no identity carries the name, so nobody can
+	// prove they own it; an operator has to handle the request.
+	errPlayerUnverifiable = errors.New("player has no identity to verify")
+)
+
+// PlayerDataExport is everything stored about a player, returned by
+// GET /api/players/{name}/export.
+type PlayerDataExport struct {
+	PlayerName string           `json:"playerName"`
+	ExportedAt time.Time        `json:"exportedAt"`
+	Identity   ExportedIdentity `json:"identity"`
+	Scores     []ExportedScore  `json:"scores"`
+	// ArchivedScores are rows the retention job moved out of scores, as stored
+	ArchivedScores  []json.RawMessage   `json:"archivedScores"`
+	Spice           *ExportedSpice      `json:"spice,omitempty"`
+	SeasonStandings []ExportedStanding  `json:"seasonStandings"`
+	SeasonRewards   []PlayerReward      `json:"seasonRewards"`
+	Reigns          []Reign             `json:"reigns"`
+	ReportsFiled    []ExportedReport    `json:"reportsFiled"`
+	Milestones      []ExportedMilestone `json:"milestones"`
+}
+
+// ExportedIdentity is the player's row in players, without the password hash.
+type ExportedIdentity struct {
+	ID            string    `json:"id"`
+	DisplayName   string    `json:"displayName"`
+	Discriminator string    `json:"discriminator,omitempty"`
+	Registered    bool      `json:"registered"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// ExportedScore is a stored run with every column kept for it.
+type ExportedScore struct {
+	ID               int             `json:"id"`
+	Score            int             `json:"score"`
+	SessionID        string          `json:"sessionId"`
+	PlayerID         *string         `json:"playerId,omitempty"`
+	SubmissionID     *string         `json:"submissionId,omitempty"`
+	SeasonID         *int            `json:"seasonId,omitempty"`
+	Mode             string          `json:"mode"`
+	Difficulty       string          `json:"difficulty"`
+	Biome            *string         `json:"biome,omitempty"`
+	InputMethod      *string         `json:"inputMethod,omitempty"`
+	Tags             json.RawMessage `json:"tags"`
+	ExtrasVersion    int             `json:"extrasVersion"`
+	Extras           json.RawMessage `json:"extras"`
+	Quarantined      bool            `json:"quarantined"`
+	QuarantineReason *string         `json:"quarantineReason,omitempty"`
+	TraceParent      *string         `json:"traceParent,omitempty"`
+	CreatedAt        time.Time       `json:"createdAt"`
+}
+
+// ExportedSpice is the player's lifetime spice total.
+type ExportedSpice struct {
+	Spice     int64     `json:"spice"`
+	Runs      int       `json:"runs"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ExportedStanding is a place in an ended season's final standings.
+type ExportedStanding struct {
+	SeasonID  int       `json:"seasonId"`
+	Rank      int       `json:"rank"`
+	ScoreID   int       `json:"scoreId"`
+	Score     int       `json:"score"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ExportedReport is a report the player filed against someone's score.
+type ExportedReport struct {
+	ID        int       `json:"id"`
+	ScoreID   int       `json:"scoreId"`
+	Reason    string    `json:"reason"`
+	Resolved  bool      `json:"resolved"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ExportedMilestone is a community goal the player's run completed.
+type ExportedMilestone struct {
+	Metric    string    `json:"metric"`
+	Target    int64     `json:"target"`
+	ReachedAt time.Time `json:"reachedAt"`
+}
+
+// verifyPlayer checks the request comes from the owner of playerName and
+// returns the identity's ID and how it was proven. Accounts need their bearer
+// token; anonymous identities need their playerId in X-Player-Id.
+func (app *App) verifyPlayer(ctx context.Context, r *http.Request, playerName string) (string, string, error) {
+	var playerID string
+	var registered bool
+	err := store.VerifyPlayerQuery.QueryRow(ctx, app.db, playerName).Scan(&playerID, &registered)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", errPlayerUnverifiable
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	if registered {
+		claims, err := app.accounts.authenticate(r.Header.Get("Authorization"))
+		if err != nil || claims == nil || claims.Subject != playerID {
+			return "", "", errPlayerNotVerified
+		}
+		return playerID, "account", nil
+	}
+	presented := r.Header.Get(playerIDHeader)
+	if presented == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(playerID)) != 1 {
+		return "", "", errPlayerNotVerified
+	}
+	return playerID, "player_id", nil
+}
+
+// writeVerifyError answers a request verifyPlayer refused.
+func writeVerifyError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, errPlayerUnverifiable):
+		http.Error(w, "Player has no identity to verify; contact an operator", http.StatusForbidden)
+	case errors.Is(err, errPlayerNotVerified):
+		http.Error(w, "Sign in, or send the player's ID in "+playerIDHeader, http.StatusUnauthorized)
+	default:
+		return false
+	}
+	return true
+}
+
+// recordDataRequest keeps an audit entry of an erasure or export. Only a hash
+// of the name is stored, so the log doesn't hold on to what was erased.
+func (app *App) recordDataRequest(ctx context.Context, kind, playerName, verifiedBy string, rows int64) {
+	sum := sha256.Sum256([]byte(playerName))
+	if _, err := store.RecordDataRequestQuery.Exec(ctx, app.db, kind, hex.EncodeToString(sum[:]), verifiedBy, rows); err != nil {
+		log.Printf("Failed to record %s request: %v", kind, err)
+	}
+}
+
+// erasePlayerHandler deletes a player's scores, identity and spice total at
+// their own request, and anonymizes them in ended seasons' standings and
+// rewards.
+func (app *App) erasePlayerHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "erasePlayer")
+	defer span.End()
+
+	playerName := mux.Vars(r)["name"]
+	playerID, verifiedBy, err := app.verifyPlayer(ctx, r, playerName)
+	if writeVerifyError(w, err) {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to look up player", http.StatusInternalServerError)
+		return
+	}
+	span.SetAttributes(attribute.String("player.id", playerID), attribute.String("data_request.verified_by", verifiedBy))
+
+	start := time.Now()
+	change, err := app.erasePlayer(ctx, playerName, playerID)
+	store.ObserveQuery(ctx, "erase_player", start)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to erase player", http.StatusInternalServerError)
+		return
+	}
+	span.SetAttributes(attribute.Int64("data_request.scores", change.Scores))
+	app.recordDataRequest(ctx, dataRequestErasure, playerName, verifiedBy, change.Scores)
+	log.Printf("🗑️ Player %s erased at their request (%d scores)", playerID, change.Scores)
+
+	app.refreshLeaderboard(ctx, playerName)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(change)
+}
+
+func (app *App) erasePlayer(ctx context.Context, playerName, playerID string) (*PlayerChange, error) {
+	tx, err := app.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	change, err := purgePlayerTx(ctx, tx, playerName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := store.DeleteReporterReportsQuery.Exec(ctx, tx, playerID); err != nil {
+		return nil, err
+	}
+	if _, err := store.ForgetMilestonesQuery.Exec(ctx, tx, playerName); err != nil {
+		return nil, err
+	}
+
+	// Ended seasons keep their ranks under a name that can't be traced back.
+	// Signed reward artifacts that named the player are dropped and signed
+	// again from the anonymized rows when next requested.
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate placeholder name: %w", err)
+	}
+	placeholder := "erased-" + hex.EncodeToString(suffix)
+	if _, err := store.RenameStandingsQuery.Exec(ctx, tx, playerName, placeholder); err != nil {
+		return nil, err
+	}
+	if _, err := store.AnonymizeRewardsQuery.Exec(ctx, tx, playerName, placeholder); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// exportPlayerHandler returns everything stored about a player, at their own
+// request. Moderation records such as shadow bans are left out.
+func (app *App) exportPlayerHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "exportPlayer")
+	defer span.End()
+
+	playerName := mux.Vars(r)["name"]
+	playerID, verifiedBy, err := app.verifyPlayer(ctx, r, playerName)
+	if writeVerifyError(w, err) {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to look up player", http.StatusInternalServerError)
+		return
+	}
+	span.SetAttributes(attribute.String("player.id", playerID), attribute.String("data_request.verified_by", verifiedBy))
+
+	start := time.Now()
+	export, err := app.exportPlayer(ctx, playerName, playerID)
+	store.ObserveQuery(ctx, "export_player", start)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to export player data", http.StatusInternalServerError)
+		return
+	}
+	app.recordDataRequest(ctx, dataRequestExport, playerName, verifiedBy, int64(len(export.Scores)))
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="spice-runner-data.json"`)
+	json.NewEncoder(w).Encode(export)
+}
+
+func (app *App) exportPlayer(ctx context.Context, playerName, playerID string) (*PlayerDataExport, error) {
+	export := &PlayerDataExport{
+		PlayerName:      playerName,
+		ExportedAt:      time.Now().UTC(),
+		Scores:          []ExportedScore{},
+		ArchivedScores:  []json.RawMessage{},
+		SeasonStandings: []ExportedStanding{},
+		SeasonRewards:   []PlayerReward{},
+		Reigns:          []Reign{},
+		ReportsFiled:    []ExportedReport{},
+		Milestones:      []ExportedMilestone{},
+	}
+
+	identity := &export.Identity
+	err := store.ExportIdentityQuery.QueryRow(ctx, app.db, playerID).Scan(&identity.ID, &identity.DisplayName, &identity.Discriminator, &identity.Registered,
+		&identity.CreatedAt, &identity.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := store.ExportScoresQuery.Query(ctx, app.db, playerName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s ExportedScore
+		if err := rows.Scan(&s.ID, &s.Score, &s.SessionID, &s.PlayerID, &s.SubmissionID, &s.SeasonID, &s.Mode,
+			&s.Difficulty, &s.Biome, &s.InputMethod, &s.Tags, &s.ExtrasVersion, &s.Extras, &s.Quarantined,
+			&s.QuarantineReason, &s.TraceParent, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		export.Scores = append(export.Scores, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = store.ExportArchivedScoresQuery.Query(ctx, app.db, playerName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data json.RawMessage
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		export.ArchivedScores = append(export.ArchivedScores, data)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var spice ExportedSpice
+	err = store.PlayerSpiceQuery.QueryRow(ctx, app.db, playerName).Scan(&spice.Spice, &spice.Runs, &spice.UpdatedAt)
+	if err == nil {
+		export.Spice = &spice
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	rows, err = store.ExportStandingsQuery.Query(ctx, app.db, playerName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s ExportedStanding
+		if err := rows.Scan(&s.SeasonID, &s.Rank, &s.ScoreID, &s.Score, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		export.SeasonStandings = append(export.SeasonStandings, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = store.ExportRewardsQuery.Query(ctx, app.db, playerName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reward PlayerReward
+		if err := rows.Scan(&reward.SeasonID, &reward.Rank, &reward.PlayerName, &reward.Score,
+			&reward.Percentile, &reward.Tier); err != nil {
+			return nil, err
+		}
+		export.SeasonRewards = append(export.SeasonRewards, reward)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = store.ExportReignsQuery.Query(ctx, app.db, playerName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reign Reign
+		if err := rows.Scan(&reign.PlayerName, &reign.SeasonID, &reign.Score, &reign.StartedAt, &reign.EndedAt,
+			&reign.Seconds); err != nil {
+			return nil, err
+		}
+		export.Reigns = append(export.Reigns, reign)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = store.ExportReportsQuery.Query(ctx, app.db, playerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var report ExportedReport
+		if err := rows.Scan(&report.ID, &report.ScoreID, &report.Reason, &report.Resolved, &report.CreatedAt); err != nil {
+			return nil, err
+		}
+		export.ReportsFiled = append(export.ReportsFiled, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = store.ExportMilestonesQuery.Query(ctx, app.db, playerName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var milestone ExportedMilestone
+		if err := rows.Scan(&milestone.Metric, &milestone.Target, &milestone.ReachedAt); err != nil {
+			return nil, err
+		}
+		export.Milestones = append(export.Milestones, milestone)
+	}
+	return export, rows.Err()
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Community counters goals can be set on
+const (
+	goalMetricRuns  = "runs"
+	goalMetricSpice = "spice"
+)
+
+const defaultCommunityGoals = "runs:100000,runs:1000000,spice:1000000,spice:1000000000"
+
+// CommunityGoal is a target for a community-wide counter. A metric can have
+// several goals, one per milestone.
+type CommunityGoal struct {
+	Metric string `json:"metric"`
+	Target int64  `json:"target"`
+}
+
+// CommunityGoalProgress is a goal with the counter's current value.
+type CommunityGoalProgress struct {
+	CommunityGoal
+	Current   int64      `json:"current"`
+	Progress  float64    `json:"progress"`
+	Reached   bool       `json:"reached"`
+	ReachedAt *time.Time `json:"reachedAt,omitempty"`
+}
+
+// parseCommunityGoals parses "metric:target,..." and sorts the goals by metric
+// and target.
+func parseCommunityGoals(value string) ([]CommunityGoal, error) {
+	var goals []CommunityGoal
+	seen := map[CommunityGoal]bool{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		metricName, targetValue, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("goal %q is not metric:target", entry)
+		}
+		if metricName != goalMetricRuns && metricName != goalMetricSpice {
+			return nil, fmt.Errorf("goal %q: metric must be %q or %q", entry, goalMetricRuns, goalMetricSpice)
+		}
+		target, err := strconv.ParseInt(targetValue, 10, 64)
+		if err != nil || target <= 0 {
+			return nil, fmt.Errorf("goal %q: target must be a positive integer", entry)
+		}
+		goal := CommunityGoal{Metric: metricName, Target: target}
+		if !seen[goal] {
+			seen[goal] = true
+			goals = append(goals, goal)
+		}
+	}
+	sort.Slice(goals, func(i, j int) bool {
+		if goals[i].Metric != goals[j].Metric {
+			return goals[i].Metric < goals[j].Metric
+		}
+		return goals[i].Target < goals[j].Target
+	})
+	return goals, nil
+}
+
+// initCommunityGoals starts the counters from the stored history the first
+// time they are created; later runs are counted as they are submitted. Goals
+// already passed, such as ones just added to the configuration, are recorded
+// as reached without an event.
+func (app *App) initCommunityGoals(ctx context.Context) error {
+	if _, err := store.SeedCommunityCountersQuery.Exec(ctx, app.db); err != nil {
+		return err
+	}
+
+	metrics := make([]string, len(app.communityGoals))
+	targets := make([]int64, len(app.communityGoals))
+	for i, goal := range app.communityGoals {
+		metrics[i], targets[i] = goal.Metric, goal.Target
+	}
+	_, err := store.RecordPassedGoalsQuery.Exec(ctx, app.db, metrics, targets)
+	return err
+}
+
+// advanceCommunityGoals counts a visible run towards the community counters
+// and announces every milestone the run crossed. The counters advance even
+// with no goals configured, so goals added later start from the right value. Each milestone is recorded
+// once, so replicas racing past the same target emit a single event.
+func (app *App) advanceCommunityGoals(ctx context.Context, submission *ScoreSubmission) {
+	rows, err := store.AdvanceCommunityGoalsQuery.Query(ctx, app.db, int64(submission.SpiceCollected))
+	if err != nil {
+		log.Printf("Failed to advance community goals: %v", err)
+		return
+	}
+	increments := map[string]int64{goalMetricRuns: 1, goalMetricSpice: int64(submission.SpiceCollected)}
+	values := map[string]int64{}
+	for rows.Next() {
+		var metricName string
+		var value int64
+		if err := rows.Scan(&metricName, &value); err != nil {
+			log.Printf("Failed to advance community goals: %v", err)
+			continue
+		}
+		values[metricName] = value
+	}
+	rows.Close()
+
+	for _, goal := range app.communityGoals {
+		value, ok := values[goal.Metric]
+		if !ok || value < goal.Target || value-increments[goal.Metric] >= goal.Target {
+			continue
+		}
+		app.reachCommunityGoal(ctx, goal, value, submission.PlayerName)
+	}
+}
+
+func (app *App) reachCommunityGoal(ctx context.Context, goal CommunityGoal, value int64, playerName string) {
+	var reachedAt time.Time
+	if err := store.ReachCommunityGoalQuery.QueryRow(ctx, app.db, goal.Metric, goal.Target, playerName).Scan(&reachedAt); err != nil {
+		// pgx.ErrNoRows: already recorded
+		return
+	}
+
+	communityMilestonesTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("goal.metric", goal.Metric)))
+	log.Printf("🎉 Community goal reached: %d %s", goal.Target, goal.Metric)
+	app.emitEvent(ctx, eventTypeMilestoneReached, goal.Metric, CommunityMilestoneEvent{
+		Metric:    goal.Metric,
+		Target:    goal.Target,
+		Value:     value,
+		ReachedBy: playerName,
+		ReachedAt: reachedAt,
+	})
+}
+
+// getCommunityGoalsHandler returns every configured goal with its progress.
+func (app *App) getCommunityGoalsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getCommunityGoals")
+	defer span.End()
+
+	goals, err := app.communityGoalProgress(ctx)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch community goals", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(goals)
+}
+
+func (app *App) communityGoalProgress(ctx context.Context) ([]CommunityGoalProgress, error) {
+	start := time.Now()
+	defer func() {
+		store.ObserveQuery(ctx, "community_goals", start)
+	}()
+
+	values := map[string]int64{}
+	rows, err := store.CommunityCountersQuery.Query(ctx, app.db)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var metricName string
+		var value int64
+		if err := rows.Scan(&metricName, &value); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		values[metricName] = value
+	}
+	rows.Close()
+
+	reached := map[CommunityGoal]time.Time{}
+	rows, err = store.CommunityMilestonesQuery.Query(ctx, app.db)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var goal CommunityGoal
+		var reachedAt time.Time
+		if err := rows.Scan(&goal.Metric, &goal.Target, &reachedAt); err != nil {
+			return nil, err
+		}
+		reached[goal] = reachedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	progress := make([]CommunityGoalProgress, 0, len(app.communityGoals))
+	for _, goal := range app.communityGoals {
+		p := CommunityGoalProgress{CommunityGoal: goal, Current: values[goal.Metric], Progress: 1}
+		if reachedAt, ok := reached[goal]; ok {
+			p.ReachedAt = &reachedAt
+		}
+		if p.Current < goal.Target {
+			p.Progress = float64(p.Current) / float64(goal.Target)
+		}
+		p.Reached = p.ReachedAt != nil || p.Current >= goal.Target
+		progress = append(progress, p)
+	}
+	return progress, nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	otelgraphql "github.com/graph-gophers/graphql-go/trace/otel"
+	"github.com/jackc/pgx/v5"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+)
+
+const (
+	// Deep enough for player { history { ... } } with room for fragments
+	graphqlMaxDepth     = 6
+	maxHistoryLimit     = 100
+	defaultHistoryLimit = 20
+)
+
+// graphqlSchema lets the frontend fetch the leaderboard, player stats and
+// score history in one request, asking only for the fields it shows.
+const graphqlSchema = `
+	schema {
+		query: Query
+	}
+
+	scalar Time
+
+	type Query {
+		# The current season's top scores, optionally only those with every tag.
+		leaderboard(limit: Int = 100, tags: [String!]): [LeaderboardEntry!]!
+		# A player's stats and scores. Unknown players have zero stats.
+		player(name: String!): Player!
+	}
+
+	type LeaderboardEntry {
+		rank: Int!
+		id: Int!
+		playerName: String!
+		score: Int!
+		tags: [String!]!
+		createdAt: Time!
+	}
+
+	type Player {
+		name: String!
+		bestScore: Int!
+		seasonBest: Int!
+		currentRank: Int!
+		totalGames: Int!
+		# Furthest biome reported by the player's runs, if any.
+		furthestBiome: String
+		recentScores: [Score!]!
+		# Every accepted score, newest first.
+		history(limit: Int = 20, offset: Int = 0): [Score!]!
+	}
+
+	type Score {
+		id: Int
+		score: Int!
+		tags: [String!]!
+		createdAt: Time!
+	}
+`
+
+// newGraphQLHandler parses the schema against the resolvers and returns the
+// POST /graphql handler. Resolvers are traced by graphql-go's OTel tracer.
+func newGraphQLHandler(app *App) *relay.Handler {
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{app: app},
+		graphql.MaxDepth(graphqlMaxDepth),
+		graphql.Tracer(otelgraphql.DefaultTracer()),
+	)
+	return &relay.Handler{Schema: schema}
+}
+
+type graphqlResolver struct {
+	app *App
+}
+
+func (r *graphqlResolver) Leaderboard(ctx context.Context, args struct {
+	Limit *int32
+	Tags  *[]string
+}) ([]*leaderboardEntryResolver, error) {
+	limit := 100
+	if args.Limit != nil {
+		limit = int(*args.Limit)
+	}
+	if limit <= 0 || limit > maxJSONLeaderboardLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxJSONLeaderboardLimit)
+	}
+	var tags []string
+	if args.Tags != nil {
+		var err error
+		if tags, err = normalizeTags(*args.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := r.app.topScores(ctx, limit, tags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch leaderboard")
+	}
+	entries = maskEntries(r.app.nameMask(), entries)
+	resolvers := make([]*leaderboardEntryResolver, len(entries))
+	for i := range entries {
+		resolvers[i] = &leaderboardEntryResolver{entries[i]}
+	}
+	return resolvers, nil
+}
+
+func (r *graphqlResolver) Player(args struct{ Name string }) *playerResolver {
+	return &playerResolver{app: r.app, name: args.Name}
+}
+
+type leaderboardEntryResolver struct {
+	entry LeaderboardEntry
+}
+
+func (r *leaderboardEntryResolver) Rank() int32        { return int32(r.entry.Rank) }
+func (r *leaderboardEntryResolver) ID() int32          { return int32(r.entry.ID) }
+func (r *leaderboardEntryResolver) PlayerName() string { return r.entry.PlayerName }
+func (r *leaderboardEntryResolver) Score() int32       { return int32(r.entry.Score) }
+func (r *leaderboardEntryResolver) Tags() []string     { return nonNilTags(r.entry.Tags) }
+func (r *leaderboardEntryResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.entry.CreatedAt}
+}
+
+// playerResolver loads the player's stats only if a stats field is selected,
+// and only once however many are.
+type playerResolver struct {
+	app   *App
+	name  string
+	once  sync.Once
+	stats *PlayerStats
+	err   error
+}
+
+func (r *playerResolver) load(ctx context.Context) (*PlayerStats, error) {
+	r.once.Do(func() {
+		r.stats, r.err = r.app.playerStats(ctx, r.name)
+		if r.err != nil {
+			r.err = fmt.Errorf("failed to fetch player stats")
+		}
+	})
+	return r.stats, r.err
+}
+
+func (r *playerResolver) Name() string { return r.app.nameMask()(r.name) }
+
+func (r *playerResolver) BestScore(ctx context.Context) (int32, error) {
+	stats, err := r.load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int32(stats.BestScore), nil
+}
+
+func (r *playerResolver) SeasonBest(ctx context.Context) (int32, error) {
+	stats, err := r.load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int32(stats.SeasonBest), nil
+}
+
+func (r *playerResolver) CurrentRank(ctx context.Context) (int32, error) {
+	stats, err := r.load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int32(stats.CurrentRank), nil
+}
+
+func (r *playerResolver) TotalGames(ctx context.Context) (int32, error) {
+	stats, err := r.load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int32(stats.TotalGames), nil
+}
+
+func (r *playerResolver) FurthestBiome(ctx context.Context) (*string, error) {
+	stats, err := r.load(ctx)
+	if err != nil || stats.FurthestBiome == "" {
+		return nil, err
+	}
+	return &stats.FurthestBiome, nil
+}
+
+func (r *playerResolver) RecentScores(ctx context.Context) ([]*scoreResolver, error) {
+	stats, err := r.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return scoreResolvers(stats.RecentScores), nil
+}
+
+func (r *playerResolver) History(ctx context.Context, args struct {
+	Limit  *int32
+	Offset *int32
+}) ([]*scoreResolver, error) {
+	limit, offset := defaultHistoryLimit, 0
+	if args.Limit != nil {
+		limit = int(*args.Limit)
+	}
+	if args.Offset != nil {
+		offset = int(*args.Offset)
+	}
+	if limit <= 0 || limit > maxHistoryLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxHistoryLimit)
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("offset must not be negative")
+	}
+
+	scores, err := r.app.scoreHistory(ctx, r.name, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch score history")
+	}
+	return scoreResolvers(scores), nil
+}
+
+type scoreResolver struct {
+	entry LeaderboardEntry
+}
+
+func scoreResolvers(entries []LeaderboardEntry) []*scoreResolver {
+	resolvers := make([]*scoreResolver, len(entries))
+	for i := range entries {
+		resolvers[i] = &scoreResolver{entries[i]}
+	}
+	return resolvers
+}
+
+// ID is null for recent scores, which are loaded without one.
+func (r *scoreResolver) ID() *int32 {
+	if r.entry.ID == 0 {
+		return nil
+	}
+	id := int32(r.entry.ID)
+	return &id
+}
+
+func (r *scoreResolver) Score() int32   { return int32(r.entry.Score) }
+func (r *scoreResolver) Tags() []string { return nonNilTags(r.entry.Tags) }
+func (r *scoreResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.entry.CreatedAt}
+}
+
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+// scoreHistory returns a page of a player's accepted scores, newest first.
+func (app *App) scoreHistory(ctx context.Context, playerName string, limit, offset int) ([]LeaderboardEntry, error) {
+	rows, err := store.ScoreHistoryQuery.Query(ctx, app.db, playerName, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	history, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (LeaderboardEntry, error) {
+		entry := LeaderboardEntry{PlayerName: playerName}
+		err := row.Scan(&entry.ID, &entry.Score, &entry.Tags, &entry.CreatedAt)
+		return entry, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if history == nil {
+		history = []LeaderboardEntry{}
+	}
+	return history, nil
+}
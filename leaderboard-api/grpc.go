@@ -0,0 +1,190 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative leaderboardpb/leaderboard.proto
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/leaderboardpb"
+)
+
+// grpcServer serves the leaderboard over gRPC using the same code paths as
+// the JSON handlers.
+type grpcServer struct {
+	leaderboardpb.UnimplementedLeaderboardServer
+	app *App
+}
+
+// newGRPCServer returns a gRPC server with the Leaderboard service registered
+// and every RPC traced and measured by otelgrpc.
+func newGRPCServer(app *App) *grpc.Server {
+	srv := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	leaderboardpb.RegisterLeaderboardServer(srv, &grpcServer{app: app})
+	return srv
+}
+
+func (s *grpcServer) SubmitScore(ctx context.Context, req *leaderboardpb.SubmitScoreRequest) (*leaderboardpb.SubmitScoreResponse, error) {
+	ctx, span := tracer.Start(ctx, "submitScore")
+	defer span.End()
+
+	submission := ScoreSubmission{
+		SubmissionID: req.GetSubmissionId(),
+		PlayerName:   req.GetPlayerName(),
+		Score:        int(req.GetScore()),
+		SessionID:    req.GetSessionId(),
+		PlayerID:     req.GetPlayerId(),
+		Tags:         req.GetTags(),
+		Mode:         req.GetMode(),
+		Difficulty:   req.GetDifficulty(),
+	}
+	// Signed-in players send their token as "authorization: Bearer ..." metadata,
+	// trusted backends their key as "x-api-key"
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+		// gRPC-Web calls come through apiKeyMiddleware, which already checked it
+		if key := apiKeyFromContext(ctx); key != nil {
+			submission.apiKey = key
+		} else if values := md.Get("x-api-key"); len(values) > 0 {
+			key, httpStatus, _ := s.app.authenticateAPIKey(ctx, values[0])
+			switch httpStatus {
+			case http.StatusOK:
+				submission.apiKey = key
+			case http.StatusTooManyRequests:
+				return nil, status.Error(codes.ResourceExhausted, "API key rate limit exceeded")
+			case http.StatusUnauthorized:
+				return nil, status.Error(codes.Unauthenticated, errUnknownAPIKey.Error())
+			default:
+				return nil, status.Error(codes.Unavailable, "failed to check API key")
+			}
+		}
+	}
+	submission.source = classifySource(func(key string) string {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}, submission.apiKey != nil)
+	if err := s.app.bindAccount(&submission, authorization); err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	response, replayed, err := s.app.submitScore(ctx, &submission)
+	if err != nil {
+		return nil, grpcError(err, "failed to save score")
+	}
+
+	return &leaderboardpb.SubmitScoreResponse{
+		Id:            int32(response.ID),
+		PlayerName:    response.PlayerName,
+		DisplayName:   response.DisplayName,
+		Discriminator: response.Discriminator,
+		Score:         int32(response.Score),
+		Rank:          int32(response.Rank),
+		CreatedAt:     timestamppb.New(response.CreatedAt),
+		Replayed:      replayed,
+	}, nil
+}
+
+func (s *grpcServer) GetTopScores(ctx context.Context, req *leaderboardpb.GetTopScoresRequest) (*leaderboardpb.GetTopScoresResponse, error) {
+	ctx, span := tracer.Start(ctx, "getTopScores")
+	defer span.End()
+
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = 100
+	}
+	// Larger boards are only served by the NDJSON stream and the export
+	if limit > maxJSONLeaderboardLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be at most %d", maxJSONLeaderboardLimit)
+	}
+	tags, err := normalizeTags(req.GetTags())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	span.SetAttributes(attribute.Int("query.limit", limit), attribute.StringSlice("query.tags", tags))
+
+	leaderboard, err := s.app.topScores(ctx, limit, tags)
+	if err != nil {
+		span.RecordError(err)
+		return nil, grpcError(err, "failed to fetch leaderboard")
+	}
+	return &leaderboardpb.GetTopScoresResponse{Entries: leaderboardEntriesToProto(maskEntries(s.app.nameMask(), leaderboard))}, nil
+}
+
+func (s *grpcServer) GetPlayerStats(ctx context.Context, req *leaderboardpb.GetPlayerStatsRequest) (*leaderboardpb.PlayerStats, error) {
+	ctx, span := tracer.Start(ctx, "getPlayerStats")
+	defer span.End()
+
+	if req.GetPlayerName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "player_name is required")
+	}
+	span.SetAttributes(attribute.String("player.name", req.GetPlayerName()))
+
+	stats, err := s.app.playerStats(ctx, req.GetPlayerName())
+	if err != nil {
+		span.RecordError(err)
+		return nil, grpcError(err, "failed to fetch player stats")
+	}
+	mask := s.app.nameMask()
+	return &leaderboardpb.PlayerStats{
+		PlayerName:   mask(stats.PlayerName),
+		BestScore:    int32(stats.BestScore),
+		SeasonBest:   int32(stats.SeasonBest),
+		CurrentRank:  int32(stats.CurrentRank),
+		TotalGames:   int32(stats.TotalGames),
+		RecentScores: leaderboardEntriesToProto(maskEntries(mask, stats.RecentScores)),
+	}, nil
+}
+
+// grpcError is the gRPC status for a domain error, the counterpart of
+// errorStatus.
+func grpcError(err error, fallback string) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, handlers.ErrValidation):
+		code = codes.InvalidArgument
+	case errors.Is(err, handlers.ErrUnauthenticated):
+		code = codes.Unauthenticated
+	case errors.Is(err, handlers.ErrBanned):
+		code = codes.PermissionDenied
+	case errors.Is(err, handlers.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, handlers.ErrConflict):
+		code = codes.AlreadyExists
+	case errors.Is(err, handlers.ErrRateLimited):
+		code = codes.ResourceExhausted
+	case errors.Is(err, handlers.ErrStoreUnavailable):
+		code = codes.Unavailable
+	}
+	return status.Error(code, handlers.ErrorMessage(err, fallback))
+}
+
+func leaderboardEntriesToProto(entries []LeaderboardEntry) []*leaderboardpb.LeaderboardEntry {
+	out := make([]*leaderboardpb.LeaderboardEntry, len(entries))
+	for i, entry := range entries {
+		out[i] = &leaderboardpb.LeaderboardEntry{
+			Rank:       int32(entry.Rank),
+			Id:         int32(entry.ID),
+			PlayerName: entry.PlayerName,
+			Score:      int32(entry.Score),
+			Tags:       entry.Tags,
+			CreatedAt:  timestamppb.New(entry.CreatedAt),
+		}
+	}
+	return out
+}
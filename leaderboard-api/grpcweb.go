@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/leaderboardpb"
+)
+
+// grpcWebPrefix is the path gRPC-Web clients call, /<service>/<method>.
+var grpcWebPrefix = "/" + leaderboardpb.Leaderboard_ServiceDesc.ServiceName + "/"
+
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+
+	// grpcWebTrailerFlag marks the frame that carries the status in the body,
+	// since browsers can't read HTTP trailers.
+	grpcWebTrailerFlag = 0x80
+)
+
+// grpcWebEnabled reports whether GRPC_WEB_ENABLED is true.
+func grpcWebEnabled() bool {
+	return getEnv("GRPC_WEB_ENABLED", "false") == "true"
+}
+
+// grpcWebHandler serves gRPC-Web on the HTTP port by handing each call to srv
+// as a native gRPC request, so the browser game gets the same RPCs, metadata
+// and otelgrpc instrumentation as native clients. Both the binary
+// (application/grpc-web) and base64 (application/grpc-web-text) encodings
+// are accepted; only unary RPCs are served.
+func grpcWebHandler(srv *grpc.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType := r.Header.Get("Content-Type")
+		if !strings.HasPrefix(contentType, grpcWebContentType) {
+			http.Error(w, "Content-Type must be application/grpc-web", http.StatusUnsupportedMediaType)
+			return
+		}
+		text := strings.HasPrefix(contentType, grpcWebTextContentType)
+		trace.SpanFromContext(r.Context()).SetAttributes(
+			attribute.String("rpc.protocol", "grpc-web"),
+			attribute.Bool("grpc_web.text", text),
+		)
+
+		// grpc.Server.ServeHTTP only accepts HTTP/2 requests with a gRPC
+		// content type; the framing of the body is already the same.
+		req := r.Clone(r.Context())
+		req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
+		req.Header.Set("Content-Type", grpcContentType(contentType))
+		req.Header.Del("Content-Length")
+		req.ContentLength = -1
+		if text {
+			req.Body = struct {
+				io.Reader
+				io.Closer
+			}{base64.NewDecoder(base64.StdEncoding, r.Body), r.Body}
+		}
+
+		gw := newGRPCWebResponseWriter(w, contentType, text)
+		srv.ServeHTTP(gw, req)
+		gw.finish()
+	})
+}
+
+// grpcContentType maps a gRPC-Web content type to the native one, keeping
+// the codec suffix, e.g. application/grpc-web-text+proto to
+// application/grpc+proto.
+func grpcContentType(contentType string) string {
+	contentType = strings.TrimPrefix(contentType, grpcWebTextContentType)
+	contentType = strings.TrimPrefix(contentType, grpcWebContentType)
+	return "application/grpc" + contentType
+}
+
+// grpcWebResponseWriter turns a native gRPC response into a gRPC-Web one. The
+// gRPC server declares its trailers in the Trailer header and sets them once
+// the handler returns; finish writes them as the trailer frame.
+type grpcWebResponseWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	body        io.Writer
+	encoder     io.WriteCloser
+	contentType string
+	wroteHeader bool
+}
+
+func newGRPCWebResponseWriter(w http.ResponseWriter, contentType string, text bool) *grpcWebResponseWriter {
+	gw := &grpcWebResponseWriter{w: w, header: http.Header{}, body: w, contentType: contentType}
+	if text {
+		gw.encoder = base64.NewEncoder(base64.StdEncoding, w)
+		gw.body = gw.encoder
+	}
+	return gw
+}
+
+func (gw *grpcWebResponseWriter) Header() http.Header {
+	return gw.header
+}
+
+func (gw *grpcWebResponseWriter) WriteHeader(code int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.wroteHeader = true
+
+	h := gw.w.Header()
+	for k, v := range gw.header {
+		if k == "Trailer" || strings.HasPrefix(k, http.TrailerPrefix) || v == nil {
+			continue
+		}
+		h[k] = v
+	}
+	h.Set("Content-Type", gw.contentType)
+	h.Set("Access-Control-Expose-Headers", "Grpc-Status, Grpc-Message")
+	gw.w.WriteHeader(code)
+}
+
+func (gw *grpcWebResponseWriter) Write(b []byte) (int, error) {
+	gw.WriteHeader(http.StatusOK)
+	return gw.body.Write(b)
+}
+
+// Flush lets the gRPC server push each message as soon as it's written.
+func (gw *grpcWebResponseWriter) Flush() {
+	gw.WriteHeader(http.StatusOK)
+	http.NewResponseController(gw.w).Flush()
+}
+
+// finish writes the trailer frame: the declared trailers and any sent
+// undeclared, as "key: value" lines.
+func (gw *grpcWebResponseWriter) finish() {
+	gw.WriteHeader(http.StatusOK)
+
+	trailers := map[string][]string{}
+	for _, declared := range gw.header.Values("Trailer") {
+		for _, k := range strings.Split(declared, ",") {
+			k = http.CanonicalHeaderKey(strings.TrimSpace(k))
+			if v := gw.header.Values(k); len(v) > 0 {
+				trailers[strings.ToLower(k)] = v
+			}
+		}
+	}
+	for k, v := range gw.header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			trailers[strings.ToLower(strings.TrimPrefix(k, http.TrailerPrefix))] = v
+		}
+	}
+	keys := make([]string, 0, len(trailers))
+	for k := range trailers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var block strings.Builder
+	for _, k := range keys {
+		for _, v := range trailers[k] {
+			fmt.Fprintf(&block, "%s: %s\r\n", k, v)
+		}
+	}
+	frame := make([]byte, 5, 5+block.Len())
+	frame[0] = grpcWebTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(block.Len()))
+	frame = append(frame, block.String()...)
+
+	gw.body.Write(frame)
+	if gw.encoder != nil {
+		gw.encoder.Close()
+	}
+	http.NewResponseController(gw.w).Flush()
+}
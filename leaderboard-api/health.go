@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/redis/go-redis/v9"
+)
+
+// HealthStatus is the probes' response, kept here for the OpenAPI document.
+type HealthStatus = handlers.HealthStatus
+
+// healthProbes returns the health, liveness and readiness probes over the
+// API's dependencies.
+func (app *App) healthProbes() *handlers.Health {
+	return &handlers.Health{
+		Service:   serviceName,
+		Version:   serviceVersion,
+		Database:  app.db,
+		Redis:     redisPinger{app.redis},
+		Lifecycle: appLifecycle{app},
+	}
+}
+
+// redisPinger adapts the Redis client to handlers.Pinger.
+type redisPinger struct {
+	client *redis.Client
+}
+
+func (p redisPinger) Ping(ctx context.Context) error {
+	return p.client.Ping(ctx).Err()
+}
+
+// appLifecycle is the pod's state for the readiness probe.
+type appLifecycle struct {
+	app *App
+}
+
+func (l appLifecycle) Draining() bool { return l.app.lifecycle.draining.Load() }
+func (l appLifecycle) Warmed() bool   { return l.app.lifecycle.warmed.Load() }
+func (l appLifecycle) ReadOnly() bool { return l.app.readOnly() }
+
+func (l appLifecycle) MigrationsApplied(ctx context.Context) bool {
+	return l.app.migrationsApplied(ctx)
+}
+
+// migrationsApplied reports whether every migration in this build has been
+// applied. Once they have, the answer is kept: the schema only moves back
+// through `leaderboard-api migrate down`.
+func (app *App) migrationsApplied(ctx context.Context) bool {
+	if app.lifecycle.migrated.Load() {
+		return true
+	}
+	pending, err := pendingMigrations(ctx, app.db)
+	if err != nil || len(pending) > 0 {
+		return false
+	}
+	app.lifecycle.migrated.Store(true)
+	return true
+}
+
+// warmCaches fills the default board before the pod reports ready, so the
+// first requests after a rollout don't all miss. A failure is logged and the
+// pod becomes ready anyway, to serve uncached.
+func (app *App) warmCaches(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "warmCaches")
+	defer span.End()
+	defer app.lifecycle.warmed.Store(true)
+
+	if _, err := app.topScores(ctx, defaultTopScoresLimit, nil); err != nil {
+		span.RecordError(err)
+		log.Printf("⚠️ Failed to warm leaderboard cache: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+)
+
+// newReadHedgerFromEnv returns nil when hedging is disabled.
+func newReadHedgerFromEnv(ctx context.Context, primary *pgxpool.Pool) *store.ReadHedger {
+	if getEnv("HEDGE_READS", "false") != "true" {
+		return nil
+	}
+
+	// "p95" (the default) tracks recent read latency
+	var delay time.Duration
+	if raw := getEnv("HEDGE_DELAY", "p95"); raw != "p95" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			log.Printf("⚠️ Invalid HEDGE_DELAY %q, using p95", raw)
+		} else {
+			delay = d
+		}
+	}
+
+	var replica *pgxpool.Pool
+	if dsn := getEnv("DATABASE_REPLICA_URL", ""); dsn != "" {
+		pool, err := newReplicaPool(ctx, dsn)
+		if err != nil {
+			log.Printf("⚠️ Failed to configure read replica, hedging against primary: %v", err)
+		} else {
+			replica = pool
+		}
+	}
+
+	target := "primary"
+	if replica != nil {
+		target = "replica"
+	}
+	when := "p95"
+	if delay > 0 {
+		when = delay.String()
+	}
+	log.Printf("✅ Hedging leaderboard reads to %s after %s", target, when)
+	return store.NewReadHedger(primary, replica, delay)
+}
+
+// newReplicaPool opens the replica's pool with the same statement cache and
+// sizing as the primary's.
+func newReplicaPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := configureStatementCache(config); err != nil {
+		return nil, err
+	}
+	if err := configurePool(config); err != nil {
+		return nil, err
+	}
+	return pgxpool.NewWithConfig(ctx, config)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newHTTP3ServerFromEnv returns an experimental HTTP/3 (QUIC) server for the
+// same routes when HTTP3_ENABLED is true, or nil. QUIC always runs over TLS,
+// so HTTP3_TLS_CERT and HTTP3_TLS_KEY are required.
+func newHTTP3ServerFromEnv(handler http.Handler) (*http3.Server, string, string, error) {
+	if getEnv("HTTP3_ENABLED", "false") != "true" {
+		return nil, "", "", nil
+	}
+	certFile, keyFile := getEnv("HTTP3_TLS_CERT", ""), getEnv("HTTP3_TLS_KEY", "")
+	if certFile == "" || keyFile == "" {
+		return nil, "", "", fmt.Errorf("HTTP3_TLS_CERT and HTTP3_TLS_KEY are required with HTTP3_ENABLED")
+	}
+	srv := &http3.Server{
+		Addr:    ":" + getEnv("HTTP3_PORT", "8443"),
+		Handler: handler,
+	}
+	return srv, certFile, keyFile, nil
+}
+
+// altSvcMiddleware advertises the HTTP/3 listener on TCP responses, so
+// browsers switch to QUIC for later requests.
+func altSvcMiddleware(srv *http3.Server) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ProtoMajor < 3 {
+				if err := srv.SetQuicHeaders(w.Header()); err != nil {
+					log.Printf("Failed to set Alt-Svc: %v", err)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// errDuplicateSubmission means a score with the same submission ID is already
+// stored; the caller should replay it rather than report an error.
+var errDuplicateSubmission = handlers.NewError(handlers.ErrConflict, "duplicate submission", store.ErrDuplicateSubmission)
+
+// idempotency keeps the responses to requests with an Idempotency-Key in the
+// API's cache, for the configured TTL.
+func (app *App) idempotency() *handlers.Idempotency {
+	return &handlers.Idempotency{
+		Cache: app.cache,
+		TTL:   func() time.Duration { return app.cfg().Submissions.IdempotencyTTL },
+	}
+}
+
+// normalizeSubmissionID checks that id is a UUID in its canonical text form and
+// lower-cases it.
+func normalizeSubmissionID(id string) (string, error) {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if len(id) != 36 {
+		return "", fmt.Errorf("submissionId must be a UUID")
+	}
+	for i, c := range id {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return "", fmt.Errorf("submissionId must be a UUID")
+			}
+		default:
+			if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+				return "", fmt.Errorf("submissionId must be a UUID")
+			}
+		}
+	}
+	return id, nil
+}
+
+// findSubmission returns the stored result for a submission ID, or nil if no
+// score carries it.
+func (app *App) findSubmission(ctx context.Context, submissionID string) (*ScoreResponse, error) {
+	stored, err := app.store.FindSubmission(ctx, submissionID)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	return &ScoreResponse{
+		ID:            stored.ID,
+		PlayerName:    stored.PlayerName,
+		DisplayName:   stored.DisplayName,
+		Discriminator: stored.Discriminator,
+		Score:         stored.Score,
+		CreatedAt:     stored.CreatedAt,
+	}, nil
+}
+
+// replaySubmission prepares the stored result of a retried submission, which
+// is not validated, counted or announced again. The rank is refreshed.
+func (app *App) replaySubmission(ctx context.Context, response *ScoreResponse) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Bool("submission.duplicate", true), attribute.Int("score.id", response.ID))
+	duplicateSubmissionsTotal.Add(ctx, 1)
+
+	rank, err := app.scoreRank(ctx, response.ID, response.Score)
+	if err != nil {
+		rank = -1
+	}
+	response.Rank = rank
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// Input methods the game reports, with the share of the mode's score
+	// ceiling each is held to. Touch runs trail keyboard runs, so a touch
+	// score near the keyboard record is itself suspicious. Overridable with
+	// INPUT_METHODS.
+	defaultInputMethods = "keyboard:1,touch:0.8"
+	maxInputMethodLen   = 16
+)
+
+// InputMethod is how a run was played and the share of the score ceiling it
+// is allowed.
+type InputMethod struct {
+	Name        string  `json:"name"`
+	ScoreFactor float64 `json:"scoreFactor"`
+}
+
+// parseInputMethods parses "name:scoreFactor,..." into a map by name.
+func parseInputMethods(value string) (map[string]float64, error) {
+	methods := map[string]float64{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, factorValue, ok := strings.Cut(entry, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("input method %q is not name:scoreFactor", entry)
+		}
+		if len(name) > maxInputMethodLen {
+			return nil, fmt.Errorf("input method %q: name too long (max %d characters)", entry, maxInputMethodLen)
+		}
+		factor, err := strconv.ParseFloat(strings.TrimSpace(factorValue), 64)
+		if err != nil || factor <= 0 || factor > 1 {
+			return nil, fmt.Errorf("input method %q: scoreFactor must be above 0 and at most 1", entry)
+		}
+		methods[name] = factor
+	}
+	return methods, nil
+}
+
+// checkInputMethod normalizes the reported input method. Runs that don't
+// report one are stored without it.
+func (app *App) checkInputMethod(ctx context.Context, submission *ScoreSubmission) error {
+	submission.InputMethod = strings.ToLower(strings.TrimSpace(submission.InputMethod))
+	if submission.InputMethod == "" {
+		return nil
+	}
+	if _, ok := app.inputMethods[submission.InputMethod]; !ok {
+		return fmt.Errorf("unknown input method %q", submission.InputMethod)
+	}
+	return nil
+}
+
+// inputScoreCeiling scales a score ceiling to the run's input method. Runs
+// without one get the full ceiling.
+func (app *App) inputScoreCeiling(maxScore int, inputMethod string) int {
+	factor, ok := app.inputMethods[inputMethod]
+	if !ok {
+		return maxScore
+	}
+	return int(float64(maxScore) * factor)
+}
+
+// getInputMethodsHandler lists the configured input methods.
+func (app *App) getInputMethodsHandler(w http.ResponseWriter, r *http.Request) {
+	methods := make([]InputMethod, 0, len(app.inputMethods))
+	for name, factor := range app.inputMethods {
+		methods = append(methods, InputMethod{Name: name, ScoreFactor: factor})
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(methods)
+}
+
+// getInputLeaderboardHandler returns the current season's top runs played
+// with one input method.
+func (app *App) getInputLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getInputLeaderboard")
+	defer span.End()
+
+	name := strings.ToLower(mux.Vars(r)["input"])
+	if _, ok := app.inputMethods[name]; !ok {
+		http.Error(w, "Unknown input method", http.StatusNotFound)
+		return
+	}
+	span.SetAttributes(attribute.String("query.input_method", name))
+	app.serveFilteredTopScores(ctx, w, r, "input_method", name)
+}
@@ -0,0 +1,150 @@
+package anticheat
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// MaxEncodedRunLog is the largest event log a submission may carry, base64
+// encoded.
+const MaxEncodedRunLog = 256 << 10
+
+const (
+	// Limits on the decoded run event log
+	runLogMaxDecoded = 4 << 20
+	runLogMaxEvents  = 100000
+
+	// Game physics, from Runner.config in scripts/runner.js. Distances are in
+	// the game's pixels; the score is the distance times runDistanceCoefficient.
+	runInitialSpeed        = 6.0
+	runAcceleration        = 0.003
+	runMaxSpeed            = 13.0
+	runSpeedScaleInterval  = 1000
+	runSpeedScaleAmount    = 1.5
+	runAbsoluteMaxSpeed    = 25.0
+	runMsPerFrame          = 1000.0 / 60
+	runDistanceCoefficient = 0.025
+	runClearTimeMs         = 3000
+
+	// The game accelerates once per animation frame, so fast displays speed up
+	// sooner. Allow for up to a 240Hz display.
+	runMaxFrameRate = 240
+	// Widest obstacle group (three Harkonnens, 195px) plus the largest gap
+	// after it at top speed: (195*25 + 200*0.6) * 1.5 + 195 ≈ 7700px. Nobody
+	// covers more than this without jumping once obstacles have started.
+	runMaxDistanceWithoutJump = 8000
+	// Timer and rounding slack when comparing distance covered with the bound
+	runDistanceSlack = 1.02
+)
+
+// Run event types
+const (
+	EventTick   = "tick"
+	EventJump   = "jump"
+	EventPickup = "pickup"
+)
+
+// RunEvent is one entry of a run's event log. T is milliseconds since the run
+// started. Ticks carry D, the total distance run so far in game pixels.
+type RunEvent struct {
+	Type string  `json:"type"`
+	T    float64 `json:"t"`
+	D    float64 `json:"d,omitempty"`
+}
+
+// DecodeRunLog unpacks a base64, gzip-compressed JSON array of RunEvents.
+func DecodeRunLog(encoded string) ([]RunEvent, error) {
+	if len(encoded) > MaxEncodedRunLog {
+		return nil, fmt.Errorf("too large (max %d bytes)", MaxEncodedRunLog)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("not base64")
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("not gzip")
+	}
+	defer zr.Close()
+
+	// Read one byte past the limit to tell a full log from a truncated one
+	raw, err := io.ReadAll(io.LimitReader(zr, runLogMaxDecoded+1))
+	if err != nil {
+		return nil, fmt.Errorf("corrupt gzip stream")
+	}
+	if len(raw) > runLogMaxDecoded {
+		return nil, fmt.Errorf("too large when decompressed (max %d bytes)", runLogMaxDecoded)
+	}
+
+	var events []RunEvent
+	if err := json.Unmarshal(raw, &events); err != nil {
+		return nil, fmt.Errorf("not a JSON array of events")
+	}
+	if len(events) > runLogMaxEvents {
+		return nil, fmt.Errorf("too many events (max %d)", runLogMaxEvents)
+	}
+	return events, nil
+}
+
+// runSpeedLimit is the fastest the game can be running t milliseconds into a
+// run that has covered distance pixels.
+func runSpeedLimit(t, distance float64) float64 {
+	accelerated := runInitialSpeed + runAcceleration*t*runMaxFrameRate/1000
+	intervals := math.Floor(math.Round(distance*runDistanceCoefficient) / runSpeedScaleInterval)
+	scaled := runMaxSpeed + intervals*runSpeedScaleAmount
+	return math.Min(accelerated, math.Min(scaled, runAbsoluteMaxSpeed))
+}
+
+// VerifyRunLog checks that the events describe a run the game could produce
+// and that it ends at the submitted score. It returns the final distance.
+func VerifyRunLog(events []RunEvent, score int) (float64, error) {
+	var lastT, lastD, lastJumpD float64
+	ticks := 0
+	for i, event := range events {
+		if event.T < lastT || math.IsNaN(event.T) || math.IsInf(event.T, 0) {
+			return lastD, fmt.Errorf("event %d is out of order", i)
+		}
+
+		switch event.Type {
+		case EventTick:
+			if event.D < lastD || math.IsNaN(event.D) || math.IsInf(event.D, 0) {
+				return lastD, fmt.Errorf("distance goes backwards at event %d", i)
+			}
+			// Speed only grows, so the limit at the end of the interval bounds all of it
+			limit := runSpeedLimit(event.T, event.D) * (event.T - lastT) / runMsPerFrame
+			if event.D-lastD > limit*runDistanceSlack+1 {
+				return lastD, fmt.Errorf("covered %.0fpx in %.0fms at event %d, max %.0fpx",
+					event.D-lastD, event.T-lastT, i, limit)
+			}
+			if event.T <= runClearTimeMs {
+				// No obstacles yet
+				lastJumpD = event.D
+			} else if event.D-lastJumpD > runMaxDistanceWithoutJump {
+				return lastD, fmt.Errorf("ran %.0fpx without jumping at event %d", event.D-lastJumpD, i)
+			}
+			lastD = event.D
+			ticks++
+		case EventJump:
+			lastJumpD = lastD
+		case EventPickup:
+			// Pickups add spice, not score; callers count them
+		default:
+			return lastD, fmt.Errorf("unknown event type %q", event.Type)
+		}
+		lastT = event.T
+	}
+
+	if ticks == 0 {
+		return lastD, fmt.Errorf("no distance ticks")
+	}
+	// The game rounds the final distance, and clients may ceil it first
+	if recomputed := int(math.Round(lastD * runDistanceCoefficient)); math.Abs(float64(recomputed-score)) > 1 {
+		return lastD, fmt.Errorf("events add up to a score of %d, not %d", recomputed, score)
+	}
+	return lastD, nil
+}
@@ -0,0 +1,48 @@
+// Package anticheat holds what the score submission pipeline is built from:
+// the stage contract, the suspicious verdict that sets anti-cheat rejections
+// apart from bad input, and the replay of a run's event log against the
+// game's physics.
+package anticheat
+
+import (
+	"context"
+	"errors"
+)
+
+// Stage is a single step of a submission pipeline over submissions of type S.
+// Stages may normalize the submission in place and return an error to reject
+// it.
+type Stage[S any] interface {
+	Name() string
+	Check(ctx context.Context, submission S) error
+}
+
+// StageFunc adapts a plain function to the Stage interface.
+type StageFunc[S any] struct {
+	StageName string
+	Fn        func(ctx context.Context, submission S) error
+}
+
+func (s StageFunc[S]) Name() string { return s.StageName }
+
+func (s StageFunc[S]) Check(ctx context.Context, submission S) error {
+	return s.Fn(ctx, submission)
+}
+
+// suspiciousError marks a rejection as an anti-cheat verdict rather than bad input.
+type suspiciousError struct {
+	error
+}
+
+// Suspicious marks err as an anti-cheat verdict.
+func Suspicious(err error) error {
+	return suspiciousError{err}
+}
+
+func (s suspiciousError) Unwrap() error { return s.error }
+
+// IsSuspicious reports whether err is, or wraps, an anti-cheat verdict.
+func IsSuspicious(err error) bool {
+	var s suspiciousError
+	return errors.As(err, &s)
+}
@@ -0,0 +1,122 @@
+// Package cache holds the response caches the leaderboard handlers read
+// through, backed by Redis with an in-process fallback for outages.
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrMiss is returned by Get and HGet for a key that isn't cached.
+var ErrMiss = errors.New("cache miss")
+
+// Cache holds the response caches handlers read through: top-score boards,
+// records, reigns, API keys, idempotent responses and the like. Everything it holds can be rebuilt
+// from Postgres, so callers treat any error as a miss. Ranking sets, locks,
+// rate counters and pub/sub stay on app.redis, where they need Redis itself.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetNX sets key only if it isn't cached, reporting whether it did.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	Del(ctx context.Context, keys ...string) error
+	HGet(ctx context.Context, key, field string) ([]byte, error)
+	// HSet sets field and gives the whole hash a ttl.
+	HSet(ctx context.Context, key, field string, value []byte, ttl time.Duration) error
+	SAdd(ctx context.Context, key string, members ...string) error
+	SMembers(ctx context.Context, key string) ([]string, error)
+}
+
+// GetInt64 reads an integer written with SetInt64.
+func GetInt64(ctx context.Context, c Cache, key string) (int64, error) {
+	data, err := c.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(data), 10, 64)
+}
+
+func SetInt64(ctx context.Context, c Cache, key string, value int64, ttl time.Duration) error {
+	return c.Set(ctx, key, []byte(strconv.FormatInt(value, 10)), ttl)
+}
+
+// Redis is the shared cache every replica reads and invalidates.
+type Redis struct {
+	client *redis.Client
+}
+
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client}
+}
+
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := c.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrMiss
+	}
+	return data, err
+}
+
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (c *Redis) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return c.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (c *Redis) Del(ctx context.Context, keys ...string) error {
+	return c.client.Del(ctx, keys...).Err()
+}
+
+func (c *Redis) HGet(ctx context.Context, key, field string) ([]byte, error) {
+	data, err := c.client.HGet(ctx, key, field).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrMiss
+	}
+	return data, err
+}
+
+func (c *Redis) HSet(ctx context.Context, key, field string, value []byte, ttl time.Duration) error {
+	pipe := c.client.TxPipeline()
+	pipe.HSet(ctx, key, field, value)
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *Redis) SAdd(ctx context.Context, key string, members ...string) error {
+	args := make([]any, len(members))
+	for i, m := range members {
+		args[i] = m
+	}
+	return c.client.SAdd(ctx, key, args...).Err()
+}
+
+func (c *Redis) SMembers(ctx context.Context, key string) ([]string, error) {
+	return c.client.SMembers(ctx, key).Result()
+}
+
+// Noop caches nothing, so every read goes to Postgres.
+type Noop struct{}
+
+func (Noop) Get(context.Context, string) ([]byte, error) { return nil, ErrMiss }
+func (Noop) Set(context.Context, string, []byte, time.Duration) error {
+	return nil
+}
+func (Noop) SetNX(context.Context, string, []byte, time.Duration) (bool, error) {
+	return true, nil
+}
+func (Noop) Del(context.Context, ...string) error { return nil }
+func (Noop) HGet(context.Context, string, string) ([]byte, error) {
+	return nil, ErrMiss
+}
+func (Noop) HSet(context.Context, string, string, []byte, time.Duration) error {
+	return nil
+}
+func (Noop) SAdd(context.Context, string, ...string) error      { return nil }
+func (Noop) SMembers(context.Context, string) ([]string, error) { return nil, nil }
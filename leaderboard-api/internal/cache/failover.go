@@ -0,0 +1,258 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	healthTimeout = 500 * time.Millisecond
+
+	// maxPendingDels bounds the keys remembered during an outage; past it the
+	// rest are left to expire on their own TTLs.
+	maxPendingDels = 10000
+)
+
+// errForced is why the fallback is in use when a demo scenario switched to
+// it.
+var errForced = errors.New("switched to the fallback by a scenario")
+
+// FailoverOptions configures NewFailover.
+type FailoverOptions struct {
+	// Fallback serves while Redis is unreachable.
+	Fallback Cache
+	// FallbackTTL caps TTLs while falling back: a replica's own cache doesn't
+	// see the others' invalidations, so entries mustn't outlive a few seconds.
+	FallbackTTL time.Duration
+	// HealthInterval is how often Run pings Redis.
+	HealthInterval time.Duration
+	// OnSwitch, if set, is called with "redis" or "fallback" each time the
+	// cache in use changes.
+	OnSwitch func(ctx context.Context, backend string)
+}
+
+// Failover reads and writes Redis while it answers, and a fallback cache
+// while it doesn't, so an outage costs handlers a cache miss rather than a
+// Redis timeout on every call. A health check switches back once Redis
+// answers again.
+type Failover struct {
+	redis *Redis
+	opts  FailoverOptions
+
+	healthy atomic.Bool
+	// forced keeps the fallback in use while Redis answers, for demo
+	// scenarios
+	forced atomic.Bool
+
+	// pending holds the keys deleted during an outage, deleted from Redis
+	// before switching back so it doesn't serve what was invalidated.
+	mu      sync.Mutex
+	pending map[string]struct{}
+}
+
+// NewFailover wraps client, starting on the fallback if Redis doesn't answer
+// a ping.
+func NewFailover(ctx context.Context, client *redis.Client, opts FailoverOptions) *Failover {
+	c := &Failover{redis: NewRedis(client), opts: opts, pending: map[string]struct{}{}}
+	c.healthy.Store(c.ping(ctx) == nil)
+	if !c.healthy.Load() {
+		log.Println("⚠️ Redis unreachable, serving response caches from the fallback cache")
+	}
+	return c
+}
+
+// Backend is the cache currently in use, "redis" or "fallback".
+func (c *Failover) Backend() string {
+	if c.healthy.Load() {
+		return "redis"
+	}
+	return "fallback"
+}
+
+func (c *Failover) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+	return c.redis.client.Ping(ctx).Err()
+}
+
+// Run checks Redis every HealthInterval, switching caches when it goes away
+// or comes back, until ctx is done.
+func (c *Failover) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.HealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := c.ping(ctx)
+		switch {
+		case err != nil:
+			c.markDown(err)
+		case c.forced.Load():
+		case !c.healthy.Load():
+			c.recover(ctx)
+		}
+	}
+}
+
+func (c *Failover) switched(ctx context.Context, backend string) {
+	if c.opts.OnSwitch != nil {
+		c.opts.OnSwitch(ctx, backend)
+	}
+}
+
+// markDown switches to the fallback after err from Redis. The fallback starts
+// empty, so it holds nothing left over from an earlier outage.
+func (c *Failover) markDown(err error) {
+	if !c.healthy.CompareAndSwap(true, false) {
+		return
+	}
+	if m, ok := c.opts.Fallback.(*Memory); ok {
+		m.Clear()
+	}
+	log.Printf("⚠️ Redis unreachable, serving response caches from the fallback cache: %v", err)
+	c.switched(context.Background(), "fallback")
+}
+
+// Force switches to the fallback and keeps it in use while down is true, as
+// if Redis were unreachable. Switching back waits for the next health check.
+func (c *Failover) Force(down bool) {
+	c.forced.Store(down)
+	if down {
+		c.markDown(errForced)
+	}
+}
+
+// recover replays the deletes made during the outage and switches back to
+// Redis, staying on the fallback if the replay fails.
+func (c *Failover) recover(ctx context.Context) {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.pending))
+	for key := range c.pending {
+		keys = append(keys, key)
+	}
+	c.mu.Unlock()
+
+	if len(keys) > 0 {
+		if err := c.redis.Del(ctx, keys...); err != nil {
+			log.Printf("⚠️ Failed to replay cache invalidations, staying on the fallback cache: %v", err)
+			return
+		}
+	}
+	c.mu.Lock()
+	for _, key := range keys {
+		delete(c.pending, key)
+	}
+	c.mu.Unlock()
+
+	c.healthy.Store(true)
+	log.Printf("✅ Redis reachable again, switched response caches back (%d invalidations replayed)", len(keys))
+	c.switched(ctx, "redis")
+}
+
+// check switches to the fallback when err means Redis couldn't be reached.
+func (c *Failover) check(err error) {
+	var netErr interface{ Timeout() bool }
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		c.markDown(err)
+	}
+}
+
+func (c *Failover) capTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > c.opts.FallbackTTL {
+		return c.opts.FallbackTTL
+	}
+	return ttl
+}
+
+func (c *Failover) Get(ctx context.Context, key string) ([]byte, error) {
+	if c.healthy.Load() {
+		data, err := c.redis.Get(ctx, key)
+		c.check(err)
+		return data, err
+	}
+	return c.opts.Fallback.Get(ctx, key)
+}
+
+func (c *Failover) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if c.healthy.Load() {
+		err := c.redis.Set(ctx, key, value, ttl)
+		c.check(err)
+		return err
+	}
+	return c.opts.Fallback.Set(ctx, key, value, c.capTTL(ttl))
+}
+
+func (c *Failover) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	if c.healthy.Load() {
+		ok, err := c.redis.SetNX(ctx, key, value, ttl)
+		c.check(err)
+		return ok, err
+	}
+	return c.opts.Fallback.SetNX(ctx, key, value, c.capTTL(ttl))
+}
+
+func (c *Failover) Del(ctx context.Context, keys ...string) error {
+	if c.healthy.Load() {
+		err := c.redis.Del(ctx, keys...)
+		if err == nil {
+			return nil
+		}
+		c.check(err)
+		if c.healthy.Load() {
+			return err
+		}
+	}
+	c.mu.Lock()
+	for _, key := range keys {
+		if len(c.pending) < maxPendingDels {
+			c.pending[key] = struct{}{}
+		}
+	}
+	c.mu.Unlock()
+	return c.opts.Fallback.Del(ctx, keys...)
+}
+
+func (c *Failover) HGet(ctx context.Context, key, field string) ([]byte, error) {
+	if c.healthy.Load() {
+		data, err := c.redis.HGet(ctx, key, field)
+		c.check(err)
+		return data, err
+	}
+	return c.opts.Fallback.HGet(ctx, key, field)
+}
+
+func (c *Failover) HSet(ctx context.Context, key, field string, value []byte, ttl time.Duration) error {
+	if c.healthy.Load() {
+		err := c.redis.HSet(ctx, key, field, value, ttl)
+		c.check(err)
+		return err
+	}
+	return c.opts.Fallback.HSet(ctx, key, field, value, c.capTTL(ttl))
+}
+
+func (c *Failover) SAdd(ctx context.Context, key string, members ...string) error {
+	if c.healthy.Load() {
+		err := c.redis.SAdd(ctx, key, members...)
+		c.check(err)
+		return err
+	}
+	return c.opts.Fallback.SAdd(ctx, key, members...)
+}
+
+func (c *Failover) SMembers(ctx context.Context, key string) ([]string, error) {
+	if c.healthy.Load() {
+		members, err := c.redis.SMembers(ctx, key)
+		c.check(err)
+		return members, err
+	}
+	return c.opts.Fallback.SMembers(ctx, key)
+}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process LRU with per-entry TTLs. Each replica has its own,
+// so it doesn't see invalidations made by the others.
+type Memory struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	hash    map[string][]byte
+	set     map[string]struct{}
+	expires time.Time // zero for no expiry
+}
+
+// NewMemory returns an empty Memory holding at most max keys.
+func NewMemory(max int) *Memory {
+	return &Memory{max: max, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// lookup returns key's live entry, marking it used. c.mu must be held.
+func (c *Memory) lookup(key string) *memoryEntry {
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*memoryEntry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil
+	}
+	c.order.MoveToFront(el)
+	return e
+}
+
+// store returns key's entry, creating it and evicting the least recently
+// used past max. c.mu must be held.
+func (c *Memory) store(key string) *memoryEntry {
+	if e := c.lookup(key); e != nil {
+		return e
+	}
+	e := &memoryEntry{key: key}
+	c.entries[key] = c.order.PushFront(e)
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return e
+}
+
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func (c *Memory) Get(_ context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.lookup(key)
+	if e == nil || e.value == nil {
+		return nil, ErrMiss
+	}
+	return e.value, nil
+}
+
+func (c *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.store(key)
+	e.value, e.hash, e.set = value, nil, nil
+	e.expires = expiry(ttl)
+	return nil
+}
+
+func (c *Memory) SetNX(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lookup(key) != nil {
+		return false, nil
+	}
+	e := c.store(key)
+	e.value = value
+	e.expires = expiry(ttl)
+	return true, nil
+}
+
+func (c *Memory) Del(_ context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.order.Remove(el)
+			delete(c.entries, key)
+		}
+	}
+	return nil
+}
+
+func (c *Memory) HGet(_ context.Context, key, field string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.lookup(key)
+	if e == nil {
+		return nil, ErrMiss
+	}
+	value, ok := e.hash[field]
+	if !ok {
+		return nil, ErrMiss
+	}
+	return value, nil
+}
+
+func (c *Memory) HSet(_ context.Context, key, field string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.store(key)
+	if e.hash == nil {
+		e.hash = map[string][]byte{}
+	}
+	e.hash[field] = value
+	e.expires = expiry(ttl)
+	return nil
+}
+
+func (c *Memory) SAdd(_ context.Context, key string, members ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.store(key)
+	if e.set == nil {
+		e.set = map[string]struct{}{}
+	}
+	for _, m := range members {
+		e.set[m] = struct{}{}
+	}
+	return nil
+}
+
+func (c *Memory) SMembers(_ context.Context, key string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.lookup(key)
+	if e == nil {
+		return nil, nil
+	}
+	members := make([]string, 0, len(e.set))
+	for m := range e.set {
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// Clear drops every entry.
+func (c *Memory) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = map[string]*list.Element{}
+}
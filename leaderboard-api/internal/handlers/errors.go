@@ -0,0 +1,105 @@
+// Package handlers is the HTTP plumbing every endpoint shares: domain errors
+// and the statuses they answer with, cacheable JSON responses, and the
+// metrics and CORS middleware.
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+)
+
+// Domain error kinds. Storage, anti-cheat and cache code return errors of one
+// of these kinds, and handlers answer with WriteError, so a new endpoint maps
+// them to the same statuses as every other without a switch of its own.
+var (
+	// ErrValidation means the request itself is wrong; retrying won't help.
+	ErrValidation = errors.New("validation failed")
+	// ErrRateLimited means the caller should wait before trying again.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrBanned means an operator has barred the session or player.
+	ErrBanned          = errors.New("banned")
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	// ErrStoreUnavailable means Postgres or Redis couldn't be reached; the
+	// same request may well succeed later.
+	ErrStoreUnavailable = store.ErrUnavailable
+)
+
+// DomainError is an error with a message fit for clients. errors.Is matches
+// both its kind and its cause; an error without a kind is internal.
+type DomainError struct {
+	kind    error
+	message string
+	cause   error
+}
+
+func (e *DomainError) Error() string { return e.message }
+
+func (e *DomainError) Unwrap() []error {
+	var errs []error
+	for _, err := range []error{e.kind, e.cause} {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// NewError returns an error of kind with message for the client. cause may
+// be nil.
+func NewError(kind error, message string, cause error) error {
+	return &DomainError{kind: kind, message: message, cause: cause}
+}
+
+// InternalError is a failure the client can't act on, with message for it.
+func InternalError(message string, cause error) error {
+	return &DomainError{message: message, cause: cause}
+}
+
+// ErrorStatus is the HTTP status for err by its kind, 500 for anything else.
+func ErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrBanned):
+		return http.StatusForbidden
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrStoreUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ErrorMessage is the client message carried by err, or fallback when err
+// has none.
+func ErrorMessage(err error, fallback string) string {
+	var domainErr *DomainError
+	if errors.As(err, &domainErr) {
+		return domainErr.message
+	}
+	if errors.Is(err, store.ErrUnavailable) {
+		return "Score store unavailable"
+	}
+	return fallback
+}
+
+// WriteError answers with err's status and message, using fallback for
+// errors without a message of their own.
+func WriteError(w http.ResponseWriter, err error, fallback string) {
+	status := ErrorStatus(err)
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "5")
+	}
+	http.Error(w, ErrorMessage(err, fallback), status)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+type HealthStatus struct {
+	Status   string `json:"status"`
+	Service  string `json:"service,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Database string `json:"database,omitempty"`
+	Redis    string `json:"redis,omitempty"`
+	// Migrations and Cache are only reported by /readyz
+	Migrations string `json:"migrations,omitempty"`
+	Cache      string `json:"cache,omitempty"`
+}
+
+// Pinger is a dependency the probes check.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Lifecycle is the pod's state as readiness sees it.
+type Lifecycle interface {
+	Draining() bool
+	// Warmed reports whether the caches have been filled since startup
+	Warmed() bool
+	// ReadOnly reports whether the pod started without Postgres
+	ReadOnly() bool
+	MigrationsApplied(ctx context.Context) bool
+}
+
+// Health serves the health, liveness and readiness probes.
+type Health struct {
+	Service   string
+	Version   string
+	Database  Pinger
+	Redis     Pinger
+	Lifecycle Lifecycle
+}
+
+// Health reports the database and Redis, failing only without the database.
+func (h *Health) Health(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	health := HealthStatus{
+		Status:   "healthy",
+		Service:  h.Service,
+		Version:  h.Version,
+		Database: "up",
+		Redis:    "up",
+	}
+
+	// Check database
+	status := http.StatusOK
+	if err := h.Database.Ping(ctx); err != nil {
+		health.Status = "unhealthy"
+		health.Database = "down"
+		status = http.StatusServiceUnavailable
+	}
+
+	// Check Redis
+	if err := h.Redis.Ping(ctx); err != nil {
+		health.Redis = "down"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(health)
+}
+
+// Livez is the liveness probe. It only shows the process can serve requests: a
+// restart doesn't fix an unreachable database, so dependencies are left to
+// /readyz.
+func (h *Health) Livez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HealthStatus{Status: "alive", Service: h.Service, Version: h.Version})
+}
+
+// Readyz is the readiness probe. It fails while the pod drains, while the
+// database is unreachable or behind this build's migrations, and until the
+// caches have been warmed. Redis is reported but doesn't fail it, since the API
+// serves uncached without it. A pod that started without Postgres reports
+// "degraded" and passes, to serve the cached boards read-only meanwhile.
+func (h *Health) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	if h.Lifecycle.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(HealthStatus{Status: "draining"})
+		return
+	}
+
+	ready := HealthStatus{
+		Status:     "ready",
+		Service:    h.Service,
+		Version:    h.Version,
+		Database:   "up",
+		Redis:      "up",
+		Migrations: "applied",
+		Cache:      "warm",
+	}
+	if err := h.Database.Ping(ctx); err != nil {
+		ready.Database = "down"
+		ready.Migrations = "unknown"
+	} else if !h.Lifecycle.MigrationsApplied(ctx) {
+		ready.Migrations = "pending"
+	}
+	if err := h.Redis.Ping(ctx); err != nil {
+		ready.Redis = "down"
+	}
+	if !h.Lifecycle.Warmed() {
+		ready.Cache = "cold"
+	}
+
+	if h.Lifecycle.ReadOnly() {
+		ready.Status = "degraded"
+	} else if ready.Database != "up" || ready.Migrations != "applied" || ready.Cache != "warm" {
+		ready.Status = "not_ready"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(ready)
+}
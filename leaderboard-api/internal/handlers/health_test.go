@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakePinger struct{ err error }
+
+func (p fakePinger) Ping(context.Context) error { return p.err }
+
+type fakeLifecycle struct {
+	draining, warmed, readOnly, migrated bool
+}
+
+func (l fakeLifecycle) Draining() bool                         { return l.draining }
+func (l fakeLifecycle) Warmed() bool                           { return l.warmed }
+func (l fakeLifecycle) ReadOnly() bool                         { return l.readOnly }
+func (l fakeLifecycle) MigrationsApplied(context.Context) bool { return l.migrated }
+
+func TestReadyz(t *testing.T) {
+	down := fakePinger{errors.New("connection refused")}
+	ready := fakeLifecycle{warmed: true, migrated: true}
+
+	tests := []struct {
+		name       string
+		database   Pinger
+		redis      Pinger
+		lifecycle  fakeLifecycle
+		wantCode   int
+		wantStatus string
+	}{
+		{"ready", fakePinger{}, fakePinger{}, ready, http.StatusOK, "ready"},
+		{"redis down", fakePinger{}, down, ready, http.StatusOK, "ready"},
+		{"database down", down, fakePinger{}, ready, http.StatusServiceUnavailable, "not_ready"},
+		{"pending migrations", fakePinger{}, fakePinger{}, fakeLifecycle{warmed: true}, http.StatusServiceUnavailable, "not_ready"},
+		{"cold cache", fakePinger{}, fakePinger{}, fakeLifecycle{migrated: true}, http.StatusServiceUnavailable, "not_ready"},
+		{"read-only", down, fakePinger{}, fakeLifecycle{readOnly: true, warmed: true}, http.StatusOK, "degraded"},
+		{"draining", fakePinger{}, fakePinger{}, fakeLifecycle{draining: true, warmed: true, migrated: true}, http.StatusServiceUnavailable, "draining"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Health{Service: "test", Database: tt.database, Redis: tt.redis, Lifecycle: tt.lifecycle}
+			rec := httptest.NewRecorder()
+			h.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			var got HealthStatus
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode %q: %v", rec.Body.String(), err)
+			}
+			if rec.Code != tt.wantCode || got.Status != tt.wantStatus {
+				t.Errorf("got %d %q, want %d %q", rec.Code, got.Status, tt.wantCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHealthOnlyFailsWithoutDatabase(t *testing.T) {
+	down := fakePinger{errors.New("connection refused")}
+
+	h := &Health{Database: fakePinger{}, Redis: down}
+	rec := httptest.NewRecorder()
+	h.Health(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("without Redis: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	h.Database = down
+	rec = httptest.NewRecorder()
+	h.Health(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("without the database: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
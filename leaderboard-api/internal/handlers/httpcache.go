@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// responseETag is a strong validator over the exact body, so it changes with
+// the board, the masking policy and anything else that shows in the response.
+func responseETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag. Weak
+// validators match too, as If-None-Match compares weakly.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteCacheableJSON writes a board's JSON body with an ETag, or 304 Not
+// Modified when the client already has it. Browsers reuse their copy for ttl,
+// how long the server caches it, and may show it for another ttl while they
+// revalidate. With a CDN in front, a Cache-Control header already set is kept
+// instead.
+func WriteCacheableJSON(w http.ResponseWriter, r *http.Request, body []byte, ttl time.Duration) {
+	etag := responseETag(body)
+	header := w.Header()
+	header.Set("ETag", etag)
+	if header.Get("Cache-Control") == "" {
+		header.Set("Cache-Control", cacheControl(ttl))
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		notModifiedTotal.Add(r.Context(), 1, metric.WithAttributes(attribute.String("http.route", route)))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// cacheControl is the Cache-Control for a response the server caches for ttl:
+// fresh for ttl, then served stale for up to another ttl while revalidating.
+// A response the server doesn't cache is always revalidated.
+func cacheControl(ttl time.Duration) string {
+	seconds := int(ttl.Seconds())
+	if seconds <= 0 {
+		return "public, max-age=0"
+	}
+	return fmt.Sprintf("public, max-age=%d, stale-while-revalidate=%d", seconds, seconds)
+}
+
+// EncodeCacheableJSON encodes v as json.Encoder would, then writes it with
+// WriteCacheableJSON.
+func EncodeCacheableJSON(w http.ResponseWriter, r *http.Request, v any, ttl time.Duration) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	WriteCacheableJSON(w, r, append(body, '\n'), ttl)
+}
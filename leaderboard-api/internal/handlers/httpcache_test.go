@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriteCacheableJSON(t *testing.T) {
+	body := []byte(`[{"rank":1}]` + "\n")
+
+	rec := httptest.NewRecorder()
+	WriteCacheableJSON(rec, httptest.NewRequest(http.MethodGet, "/api/leaderboard/top", nil), body, 5*time.Minute)
+	if got, want := rec.Header().Get("Cache-Control"), "public, max-age=300, stale-while-revalidate=300"; got != want {
+		t.Errorf("Cache-Control = %q, want %q", got, want)
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != string(body) {
+		t.Errorf("got %d %q, want the body", rec.Code, rec.Body.String())
+	}
+
+	// The ETag it sent gets a 304 back
+	req := httptest.NewRequest(http.MethodGet, "/api/leaderboard/top", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	WriteCacheableJSON(rec, req, body, 5*time.Minute)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("got %d %q, want an empty 304", rec.Code, rec.Body.String())
+	}
+
+	// Uncached responses are always revalidated
+	rec = httptest.NewRecorder()
+	WriteCacheableJSON(rec, httptest.NewRequest(http.MethodGet, "/api/leaderboard/player/Paul", nil), body, 0)
+	if got, want := rec.Header().Get("Cache-Control"), "public, max-age=0"; got != want {
+		t.Errorf("Cache-Control = %q, want %q", got, want)
+	}
+}
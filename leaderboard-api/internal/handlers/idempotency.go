@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/cache"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+
+	// A request holding a key has this long to finish before a retry may take over
+	idempotencyLockTTL  = 30 * time.Second
+	cacheKeyIdempotency = "idempotency:%s"
+
+	// Claims given up between our SetNX and Get are retried this many times
+	maxIdempotencyClaims = 3
+)
+
+var (
+	// ErrIdempotencyInProgress means another request with the key hasn't finished.
+	ErrIdempotencyInProgress = NewError(ErrConflict, "a request with this Idempotency-Key is in progress", nil)
+	// ErrIdempotencyKeyReused means the key was first sent with a different body.
+	ErrIdempotencyKeyReused = errors.New("Idempotency-Key was already used for a different request")
+)
+
+// IdempotentResponse is the first response to a request with an
+// Idempotency-Key. Status is 0 while the request is still running.
+type IdempotentResponse struct {
+	Fingerprint string          `json:"fingerprint"`
+	Status      int             `json:"status"`
+	Body        json.RawMessage `json:"body,omitempty"`
+}
+
+// Idempotency answers retries of a request with the response to its first
+// attempt, keeping the responses in Cache. Keys are scoped to their caller,
+// such as an account or API key, so callers that pick the same key never see
+// each other's responses.
+type Idempotency struct {
+	Cache cache.Cache
+	// TTL returns how long responses are kept; it reloads with the config
+	TTL func() time.Duration
+}
+
+// CheckIdempotencyKey rejects keys that are too long or not printable ASCII.
+func CheckIdempotencyKey(key string) error {
+	if len(key) > maxIdempotencyKeyLen {
+		return fmt.Errorf("Idempotency-Key too long (max %d characters)", maxIdempotencyKeyLen)
+	}
+	for _, c := range key {
+		if c < 0x21 || c > 0x7e {
+			return fmt.Errorf("Idempotency-Key must be printable ASCII")
+		}
+	}
+	return nil
+}
+
+func idempotencyCacheKey(scope, key string) string {
+	sum := sha256.Sum256([]byte(scope + "\x00" + key))
+	return fmt.Sprintf(cacheKeyIdempotency, hex.EncodeToString(sum[:]))
+}
+
+func fingerprint(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// IdempotencySubmissionID derives a submission ID from an Idempotency-Key, so
+// Postgres still stores the run once if the cache loses the key. The body is
+// part of it: a key reused for another run, after the TTL, stores that run
+// rather than replaying the first.
+func IdempotencySubmissionID(scope, key string, body []byte) string {
+	sum := sha256.Sum256([]byte("idempotency-key:" + scope + "\x00" + key + "\x00" + fingerprint(body)))
+	id := hex.EncodeToString(sum[:16])
+	return id[0:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:32]
+}
+
+// Begin claims scope's key for a request with the given body. It returns the
+// stored response if the key has already been answered. If the cache fails
+// the request goes ahead, protected only by the derived submission ID.
+func (i *Idempotency) Begin(ctx context.Context, scope, key string, body []byte) (*IdempotentResponse, error) {
+	fp := fingerprint(body)
+	cacheKey := idempotencyCacheKey(scope, key)
+
+	claim, _ := json.Marshal(IdempotentResponse{Fingerprint: fp})
+	var data []byte
+	for attempt := 0; ; attempt++ {
+		claimed, err := i.Cache.SetNX(ctx, cacheKey, claim, idempotencyLockTTL)
+		if err != nil {
+			log.Printf("Failed to claim idempotency key: %v", err)
+			return nil, nil
+		}
+		if claimed {
+			return nil, nil
+		}
+
+		data, err = i.Cache.Get(ctx, cacheKey)
+		if errors.Is(err, cache.ErrMiss) {
+			// The other request gave the key up in the meantime: claim it again
+			if attempt+1 < maxIdempotencyClaims {
+				continue
+			}
+			return nil, ErrIdempotencyInProgress
+		}
+		if err != nil {
+			log.Printf("Failed to read idempotency key: %v", err)
+			return nil, nil
+		}
+		break
+	}
+	var stored IdempotentResponse
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	switch {
+	case stored.Fingerprint != fp:
+		return nil, ErrIdempotencyKeyReused
+	case stored.Status == 0:
+		return nil, ErrIdempotencyInProgress
+	}
+	return &stored, nil
+}
+
+// Finish stores the response for replays of scope's key.
+func (i *Idempotency) Finish(ctx context.Context, scope, key string, body []byte, status int, response []byte) {
+	data, err := json.Marshal(IdempotentResponse{Fingerprint: fingerprint(body), Status: status, Body: response})
+	if err != nil {
+		return
+	}
+	if err := i.Cache.Set(ctx, idempotencyCacheKey(scope, key), data, i.TTL()); err != nil {
+		log.Printf("Failed to store idempotent response: %v", err)
+	}
+}
+
+// Abort releases scope's key after a failed request, so the client can retry
+// it.
+func (i *Idempotency) Abort(ctx context.Context, scope, key string) {
+	i.Cache.Del(ctx, idempotencyCacheKey(scope, key))
+}
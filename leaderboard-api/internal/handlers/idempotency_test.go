@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/cache"
+)
+
+func newTestIdempotency(c cache.Cache) *Idempotency {
+	return &Idempotency{Cache: c, TTL: func() time.Duration { return time.Hour }}
+}
+
+func TestIdempotency(t *testing.T) {
+	ctx := context.Background()
+	i := newTestIdempotency(cache.NewMemory(10))
+	body := []byte(`{"score":1200}`)
+
+	if stored, err := i.Begin(ctx, "session:a", "key", body); stored != nil || err != nil {
+		t.Fatalf("first Begin = %+v, %v; want the key claimed", stored, err)
+	}
+	if _, err := i.Begin(ctx, "session:a", "key", body); !errors.Is(err, ErrIdempotencyInProgress) {
+		t.Errorf("Begin while running: err = %v, want %v", err, ErrIdempotencyInProgress)
+	}
+
+	i.Finish(ctx, "session:a", "key", body, http.StatusCreated, []byte(`{"id":1}`))
+	stored, err := i.Begin(ctx, "session:a", "key", body)
+	if err != nil || stored == nil || stored.Status != http.StatusCreated || string(stored.Body) != `{"id":1}` {
+		t.Errorf("Begin after Finish = %+v, %v; want the stored response", stored, err)
+	}
+	if _, err := i.Begin(ctx, "session:a", "key", []byte(`{"score":9999}`)); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("Begin with another body: err = %v, want %v", err, ErrIdempotencyKeyReused)
+	}
+}
+
+func TestIdempotencyScopesKeys(t *testing.T) {
+	ctx := context.Background()
+	i := newTestIdempotency(cache.NewMemory(10))
+	body := []byte(`{"score":1200}`)
+
+	i.Begin(ctx, "account:a", "1", body)
+	i.Finish(ctx, "account:a", "1", body, http.StatusCreated, []byte(`{"id":1}`))
+	if stored, err := i.Begin(ctx, "account:b", "1", body); stored != nil || err != nil {
+		t.Errorf("Begin for another caller = %+v, %v; want the key claimed afresh", stored, err)
+	}
+
+	if IdempotencySubmissionID("account:a", "1", body) == IdempotencySubmissionID("account:b", "1", body) {
+		t.Error("callers sharing a key share a submission ID")
+	}
+	if IdempotencySubmissionID("account:a", "1", body) == IdempotencySubmissionID("account:a", "1", []byte(`{"score":1}`)) {
+		t.Error("a key reused for another run keeps its submission ID")
+	}
+}
+
+func TestIdempotencyAbortFreesKey(t *testing.T) {
+	ctx := context.Background()
+	i := newTestIdempotency(cache.NewMemory(10))
+	body := []byte(`{"score":1200}`)
+
+	i.Begin(ctx, "session:a", "key", body)
+	i.Abort(ctx, "session:a", "key")
+	if stored, err := i.Begin(ctx, "session:a", "key", body); stored != nil || err != nil {
+		t.Errorf("Begin after Abort = %+v, %v; want the key claimed again", stored, err)
+	}
+}
+
+// releasedClaim loses the first SetNX to a request that gives the key up
+// before the Get.
+type releasedClaim struct {
+	cache.Cache
+	lost bool
+}
+
+func (c *releasedClaim) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	if !c.lost {
+		c.lost = true
+		return false, nil
+	}
+	return c.Cache.SetNX(ctx, key, value, ttl)
+}
+
+func TestIdempotencyReclaimsReleasedKey(t *testing.T) {
+	i := newTestIdempotency(&releasedClaim{Cache: cache.NewMemory(10)})
+	if stored, err := i.Begin(context.Background(), "session:a", "key", []byte(`{}`)); stored != nil || err != nil {
+		t.Errorf("Begin = %+v, %v; want the released key claimed", stored, err)
+	}
+}
+
+func TestCheckIdempotencyKey(t *testing.T) {
+	if err := CheckIdempotencyKey("a1b2-c3"); err != nil {
+		t.Errorf("valid key rejected: %v", err)
+	}
+	if err := CheckIdempotencyKey("has space"); err == nil {
+		t.Error("key with a space accepted")
+	}
+	if id := IdempotencySubmissionID("session:a", "key", nil); id != IdempotencySubmissionID("session:a", "key", nil) || len(id) != 36 {
+		t.Error("IdempotencySubmissionID is not a stable UUID")
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// DefaultTopScoresLimit is the size of the board when ?limit is not given.
+	DefaultTopScoresLimit = 100
+	// Leaderboard requests above this limit are streamed as NDJSON
+	MaxJSONLeaderboardLimit = 1000
+
+	// Surrogate key carried by every leaderboard listing
+	SurrogateKeyLeaderboard = "leaderboard"
+)
+
+// SurrogateKeyPlayer is the surrogate key of one player's responses. Keys are
+// space-separated in headers, so the name is escaped.
+func SurrogateKeyPlayer(name string) string {
+	return "player:" + url.PathEscape(name)
+}
+
+type PlayerStats struct {
+	PlayerName   string                   `json:"playerName"`
+	BestScore    int                      `json:"bestScore"`
+	SeasonBest   int                      `json:"seasonBest"`
+	CurrentRank  int                      `json:"currentRank"`
+	TotalGames   int                      `json:"totalGames"`
+	RecentScores []store.LeaderboardEntry `json:"recentScores"`
+	// FurthestBiome is empty until one of the player's runs reports a biome
+	FurthestBiome string `json:"furthestBiome,omitempty"`
+	// Retention is set when old runs are pruned
+	Retention *RetentionNotice `json:"retention,omitempty"`
+	// DaysAtNumberOne is the player's time at #1, across every season
+	DaysAtNumberOne float64 `json:"daysAtNumberOne"`
+}
+
+// RetentionNotice tells a player how the retention policy treats their runs.
+type RetentionNotice struct {
+	Mode    string `json:"mode"`
+	MaxAge  string `json:"maxAge"`
+	KeepTop int    `json:"keepTop"`
+	// NextExpiresAt is when the player's oldest run outside the kept top is
+	// due to be pruned, unset when none is
+	NextExpiresAt *time.Time `json:"nextExpiresAt,omitempty"`
+}
+
+// Board is the leaderboard behind the read endpoints. What it returns is
+// ready to serve: cached, ranked, annotated and with names masked.
+type Board interface {
+	// Tags normalizes a ?tag filter, rejecting tags the board doesn't know
+	Tags(tags []string) ([]string, error)
+	TopScores(ctx context.Context, limit int, tags []string) ([]store.LeaderboardEntry, error)
+	// ServeTopScoresPage writes the board one ?cursor and ?pageSize at a time
+	ServeTopScoresPage(ctx context.Context, w http.ResponseWriter, r *http.Request, tags []string)
+	// StreamTopScores writes a board too long for one JSON array as NDJSON
+	StreamTopScores(ctx context.Context, w http.ResponseWriter, limit int, tags []string)
+	PlayerStats(ctx context.Context, playerName string) (*PlayerStats, error)
+}
+
+// EdgeCache decides how long clients and the CDN keep the board's responses.
+type EdgeCache interface {
+	// SetHeaders labels a response with its surrogate keys
+	SetHeaders(w http.ResponseWriter, keys ...string)
+	BoardTTL() time.Duration
+	PlayerStatsTTL() time.Duration
+}
+
+// Leaderboard serves the top scores and player stats.
+type Leaderboard struct {
+	Board Board
+	Edge  EdgeCache
+}
+
+// TopScores serves the top ?limit scores carrying every ?tag, paginated for
+// ?cursor or ?pageSize and streamed above MaxJSONLeaderboardLimit.
+func (l *Leaderboard) TopScores(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getTopScores")
+	defer span.End()
+
+	limitStr := r.URL.Query().Get("limit")
+	limit := DefaultTopScoresLimit
+	stream := false
+	if limitStr != "" {
+		if n, err := strconv.Atoi(limitStr); err == nil && n > 0 {
+			// Larger boards are streamed as NDJSON instead of one JSON array
+			limit, stream = n, n > MaxJSONLeaderboardLimit
+		}
+	}
+	span.SetAttributes(attribute.Int("query.limit", limit), attribute.Bool("query.stream", stream))
+
+	tags, err := l.Board.Tags(r.URL.Query()["tag"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.StringSlice("query.tags", tags))
+
+	if wantsPage(r) {
+		l.Board.ServeTopScoresPage(ctx, w, r, tags)
+		return
+	}
+	if stream {
+		l.Board.StreamTopScores(ctx, w, limit, tags)
+		return
+	}
+
+	leaderboard, err := l.Board.TopScores(ctx, limit, tags)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	l.Edge.SetHeaders(w, SurrogateKeyLeaderboard)
+	EncodeCacheableJSON(w, r, leaderboard, l.Edge.BoardTTL())
+}
+
+// PlayerStats serves the stats of the player in the path.
+func (l *Leaderboard) PlayerStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getPlayerStats")
+	defer span.End()
+
+	playerName := mux.Vars(r)["name"]
+	span.SetAttributes(attribute.String("player.name", playerName))
+
+	stats, err := l.Board.PlayerStats(ctx, playerName)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch player stats", http.StatusInternalServerError)
+		return
+	}
+
+	l.Edge.SetHeaders(w, SurrogateKeyPlayer(playerName))
+	EncodeCacheableJSON(w, r, stats, l.Edge.PlayerStatsTTL())
+}
+
+// wantsPage reports whether the request asked for the paginated form. Plain
+// ?limit= requests keep returning a bare array.
+func wantsPage(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Has("cursor") || query.Has("pageSize")
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+)
+
+// fakeBoard records how the handlers read it.
+type fakeBoard struct {
+	entries []store.LeaderboardEntry
+	stats   *PlayerStats
+	err     error
+
+	limit    int
+	tags     []string
+	paged    bool
+	streamed bool
+}
+
+func (b *fakeBoard) Tags(tags []string) ([]string, error) {
+	for _, tag := range tags {
+		if tag != "speedrun" {
+			return nil, errors.New("unknown tag " + tag)
+		}
+	}
+	return tags, nil
+}
+
+func (b *fakeBoard) TopScores(ctx context.Context, limit int, tags []string) ([]store.LeaderboardEntry, error) {
+	b.limit, b.tags = limit, tags
+	return b.entries, b.err
+}
+
+func (b *fakeBoard) ServeTopScoresPage(ctx context.Context, w http.ResponseWriter, r *http.Request, tags []string) {
+	b.paged = true
+}
+
+func (b *fakeBoard) StreamTopScores(ctx context.Context, w http.ResponseWriter, limit int, tags []string) {
+	b.streamed, b.limit = true, limit
+}
+
+func (b *fakeBoard) PlayerStats(ctx context.Context, playerName string) (*PlayerStats, error) {
+	return b.stats, b.err
+}
+
+type fakeEdge struct{ keys []string }
+
+func (e *fakeEdge) SetHeaders(w http.ResponseWriter, keys ...string) { e.keys = keys }
+func (e *fakeEdge) BoardTTL() time.Duration                          { return time.Minute }
+func (e *fakeEdge) PlayerStatsTTL() time.Duration                    { return 0 }
+
+func leaderboardRouter(l *Leaderboard) http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/leaderboard/top", l.TopScores)
+	router.HandleFunc("/api/leaderboard/player/{name}", l.PlayerStats)
+	return router
+}
+
+func TestTopScores(t *testing.T) {
+	board := &fakeBoard{entries: []store.LeaderboardEntry{{Rank: 1, PlayerName: "Paul", Score: 1200}}}
+	edge := &fakeEdge{}
+	router := leaderboardRouter(&Leaderboard{Board: board, Edge: edge})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/leaderboard/top?limit=10&tag=speedrun", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var got []store.LeaderboardEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got) != 1 || got[0].PlayerName != "Paul" {
+		t.Errorf("body = %q, want Paul's entry", rec.Body.String())
+	}
+	if board.limit != 10 || len(board.tags) != 1 {
+		t.Errorf("read limit %d tags %v, want 10 [speedrun]", board.limit, board.tags)
+	}
+	if len(edge.keys) != 1 || edge.keys[0] != SurrogateKeyLeaderboard {
+		t.Errorf("surrogate keys = %v, want [%s]", edge.keys, SurrogateKeyLeaderboard)
+	}
+}
+
+func TestTopScoresForms(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		check    func(*fakeBoard) bool
+	}{
+		{"default limit", "", http.StatusOK, func(b *fakeBoard) bool { return b.limit == DefaultTopScoresLimit }},
+		{"invalid limit", "?limit=abc", http.StatusOK, func(b *fakeBoard) bool { return b.limit == DefaultTopScoresLimit }},
+		{"page", "?pageSize=50", http.StatusOK, func(b *fakeBoard) bool { return b.paged }},
+		{"stream", "?limit=5000", http.StatusOK, func(b *fakeBoard) bool { return b.streamed && b.limit == 5000 }},
+		{"unknown tag", "?tag=cheat", http.StatusBadRequest, func(b *fakeBoard) bool { return b.limit == 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board := &fakeBoard{}
+			router := leaderboardRouter(&Leaderboard{Board: board, Edge: &fakeEdge{}})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/leaderboard/top"+tt.query, nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if !tt.check(board) {
+				t.Errorf("board read as %+v", board)
+			}
+		})
+	}
+}
+
+func TestPlayerStats(t *testing.T) {
+	edge := &fakeEdge{}
+	board := &fakeBoard{stats: &PlayerStats{PlayerName: "Paul", BestScore: 1200}}
+	router := leaderboardRouter(&Leaderboard{Board: board, Edge: edge})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/leaderboard/player/Paul%20A", nil))
+	var got PlayerStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.BestScore != 1200 {
+		t.Errorf("body = %q, want Paul's stats", rec.Body.String())
+	}
+	if want := SurrogateKeyPlayer("Paul A"); len(edge.keys) != 1 || edge.keys[0] != want {
+		t.Errorf("surrogate keys = %v, want [%s]", edge.keys, want)
+	}
+
+	board.err = errors.New("connection refused")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/leaderboard/player/Paul", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Metrics records http.server.request.duration and http.server.requests.total
+// for every request.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := r.Context()
+
+		// Create a response writer wrapper to capture status code
+		wrapped := &ResponseWriter{ResponseWriter: w, StatusCode: http.StatusOK}
+
+		// Serve the request
+		next.ServeHTTP(wrapped, r)
+
+		// Record metrics
+		duration := time.Since(start).Seconds()
+		route := r.URL.Path
+		method := r.Method
+		status := strconv.Itoa(wrapped.StatusCode)
+
+		attrs := metric.WithAttributes(
+			attribute.String("http.method", method),
+			attribute.String("http.route", route),
+			attribute.String("http.status_code", status),
+			attribute.String("http.status_class", telemetry.StatusClass(wrapped.StatusCode)),
+			attribute.String("network.protocol.version", ProtocolVersion(r)),
+		)
+
+		requestDuration.Record(ctx, duration, attrs)
+		requestsTotal.Add(ctx, 1, attrs)
+	})
+}
+
+// ResponseWriter remembers the status code written through it.
+type ResponseWriter struct {
+	http.ResponseWriter
+	StatusCode int
+}
+
+func (rw *ResponseWriter) WriteHeader(code int) {
+	rw.StatusCode = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// CORS lets browsers on any origin call the API.
+func CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, traceparent, X-Player-Id, X-Demo-Scenario, X-Demo-Token, X-Grpc-Web, X-User-Agent, Grpc-Timeout")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ProtocolVersion is the network.protocol.version of a request: "1.1", "2"
+// or "3".
+func ProtocolVersion(r *http.Request) string {
+	if r.ProtoMajor == 1 {
+		return fmt.Sprintf("1.%d", r.ProtoMinor)
+	}
+	return fmt.Sprint(r.ProtoMajor)
+}
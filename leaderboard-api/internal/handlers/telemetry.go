@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// tracer follows the global tracer provider, set up by the telemetry package.
+var tracer = otel.Tracer("github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers")
+
+// The package's instruments, no-ops until InitTelemetry.
+var (
+	requestDuration  metric.Float64Histogram
+	requestsTotal    metric.Int64Counter
+	notModifiedTotal metric.Int64Counter
+)
+
+func init() {
+	meter := noop.NewMeterProvider().Meter("")
+	requestDuration, _ = meter.Float64Histogram("")
+	requestsTotal, _ = meter.Int64Counter("")
+	notModifiedTotal, _ = meter.Int64Counter("")
+}
+
+// InitTelemetry creates the package's metrics with meter.
+func InitTelemetry(meter metric.Meter) error {
+	var err error
+	requestDuration, err = meter.Float64Histogram(
+		"http.server.request.duration.seconds",
+		metric.WithDescription("Duration of HTTP server requests in seconds"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	requestsTotal, err = meter.Int64Counter(
+		"http.server.requests.total",
+		metric.WithDescription("Total number of HTTP server requests"),
+	)
+	if err != nil {
+		return err
+	}
+
+	notModifiedTotal, err = meter.Int64Counter(
+		"http.server.not_modified",
+		metric.WithDescription("Total number of conditional GETs answered 304 Not Modified"),
+	)
+	return err
+}
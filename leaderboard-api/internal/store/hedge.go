@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// Until enough reads have been timed, hedge after a fixed delay
+	hedgeLatencySamples  = 200
+	hedgeMinSamples      = 20
+	defaultHedgeDelay    = 50 * time.Millisecond
+	minAdaptiveHedgeWait = 5 * time.Millisecond
+)
+
+// ReadHedger sends a second copy of a slow read, to the replica when one is
+// configured, and returns whichever answers first.
+type ReadHedger struct {
+	primary *pgxpool.Pool
+	replica *pgxpool.Pool
+	delay   time.Duration // fixed delay; zero means track p95
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+}
+
+// NewReadHedger hedges reads on primary to replica, or to primary again when
+// replica is nil, after delay or, when delay is zero, the recent p95.
+func NewReadHedger(primary, replica *pgxpool.Pool, delay time.Duration) *ReadHedger {
+	return &ReadHedger{
+		primary:   primary,
+		replica:   replica,
+		delay:     delay,
+		latencies: make([]time.Duration, 0, hedgeLatencySamples),
+	}
+}
+
+// Replica is the replica's pool, nil when hedges go to the primary.
+func (h *ReadHedger) Replica() *pgxpool.Pool {
+	return h.replica
+}
+
+func (h *ReadHedger) hedgePool() *pgxpool.Pool {
+	if h.replica != nil {
+		return h.replica
+	}
+	return h.primary
+}
+
+// wait returns how long to give the first read before hedging.
+func (h *ReadHedger) wait() time.Duration {
+	if h.delay > 0 {
+		return h.delay
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeMinSamples {
+		return defaultHedgeDelay
+	}
+	sorted := make([]time.Duration, len(h.latencies))
+	copy(sorted, h.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	p95 := sorted[len(sorted)*95/100]
+	if p95 < minAdaptiveHedgeWait {
+		return minAdaptiveHedgeWait
+	}
+	return p95
+}
+
+func (h *ReadHedger) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeLatencySamples {
+		h.latencies = append(h.latencies, latency)
+		return
+	}
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % hedgeLatencySamples
+}
+
+type hedgeResult[T any] struct {
+	value T
+	err   error
+	hedge bool
+}
+
+// HedgedRead runs read against the primary and, if it has not answered after the
+// hedge delay, against the hedge pool as well. The first success wins and the
+// loser is cancelled. Without a hedger it is a plain read on primary.
+func HedgedRead[T any](ctx context.Context, h *ReadHedger, primary *pgxpool.Pool, name string, read func(ctx context.Context, db *pgxpool.Pool) (T, error)) (T, error) {
+	if h == nil {
+		return read(ctx, primary)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult[T], 2)
+	start := time.Now()
+	launch := func(db *pgxpool.Pool, hedge bool) {
+		go func() {
+			value, err := read(ctx, db)
+			results <- hedgeResult[T]{value: value, err: err, hedge: hedge}
+		}()
+	}
+	launch(h.primary, false)
+
+	timer := time.NewTimer(h.wait())
+	defer timer.Stop()
+
+	inFlight := 1
+	hedged := false
+	for {
+		select {
+		case <-timer.C:
+			hedged = true
+			inFlight++
+			launch(h.hedgePool(), true)
+		case res := <-results:
+			inFlight--
+			if res.err != nil && inFlight > 0 {
+				// The other copy may still succeed
+				continue
+			}
+			recordHedgeOutcome(ctx, h, name, hedged, res, time.Since(start))
+			return res.value, res.err
+		}
+	}
+}
+
+func recordHedgeOutcome[T any](ctx context.Context, h *ReadHedger, name string, hedged bool, res hedgeResult[T], latency time.Duration) {
+	winner := "primary"
+	if res.hedge {
+		winner = "hedge"
+	}
+	if res.err == nil && !res.hedge {
+		// Only primary latencies feed the p95, so hedges don't lower their own trigger
+		h.observe(latency)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Bool("hedge.sent", hedged),
+		attribute.String("hedge.winner", winner),
+	)
+	hedgedReadsTotal.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("query", name),
+		attribute.Bool("hedged", hedged),
+		attribute.String("winner", winner),
+	))
+}
@@ -0,0 +1,247 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is a ScoreStore and PlayerStore held in memory, for unit testing
+// handlers without Postgres. It follows the Postgres store's semantics:
+// quarantined scores are stored but hidden from boards and ranks, tag filters
+// need every tag, and every score belongs to the current season. Nothing
+// survives a restart.
+type Memory struct {
+	mu     sync.RWMutex
+	nextID int
+	scores []memoryScore
+	// submissions indexes scores by submission ID
+	submissions map[string]int
+	players     map[string]Identity
+}
+
+type memoryScore struct {
+	id            int
+	playerName    string
+	score         int
+	sessionID     string
+	playerID      string
+	tags          []string
+	extras        map[string]json.RawMessage
+	extrasVersion int
+	biome         string
+	hidden        bool
+	createdAt     time.Time
+}
+
+// NewMemory returns an empty store.
+func NewMemory() *Memory {
+	return &Memory{nextID: 1, submissions: map[string]int{}, players: map[string]Identity{}}
+}
+
+// AddAccount registers an account under its bare name, as registration
+// does in Postgres.
+func (s *Memory) AddAccount(playerID, displayName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.players[playerID] = Identity{PlayerID: playerID, DisplayName: displayName, Registered: true}
+}
+
+func (s *Memory) InsertScore(ctx context.Context, submission *Score) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if submission.SubmissionID != "" {
+		if _, ok := s.submissions[submission.SubmissionID]; ok {
+			return 0, time.Time{}, ErrDuplicateSubmission
+		}
+		s.submissions[submission.SubmissionID] = len(s.scores)
+	}
+	score := memoryScore{
+		id:            s.nextID,
+		playerName:    submission.PlayerName,
+		score:         submission.Score,
+		sessionID:     submission.SessionID,
+		playerID:      submission.PlayerID,
+		tags:          append([]string(nil), submission.Tags...),
+		extras:        submission.Extras,
+		extrasVersion: submission.ExtrasVersion,
+		biome:         submission.Biome,
+		hidden:        submission.QuarantineReason != "",
+		createdAt:     time.Now(),
+	}
+	s.nextID++
+	s.scores = append(s.scores, score)
+	return score.id, score.createdAt, nil
+}
+
+func (s *Memory) TopScores(ctx context.Context, limit int, tags []string) ([]LeaderboardEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var visible []memoryScore
+	for _, score := range s.scores {
+		if !score.hidden && hasAllTags(score.tags, tags) {
+			visible = append(visible, score)
+		}
+	}
+	sort.Slice(visible, func(i, j int) bool {
+		if visible[i].score != visible[j].score {
+			return visible[i].score > visible[j].score
+		}
+		return visible[i].id < visible[j].id
+	})
+
+	var leaderboard []LeaderboardEntry
+	for i, score := range visible {
+		if i == limit {
+			break
+		}
+		leaderboard = append(leaderboard, LeaderboardEntry{
+			Rank:          i + 1,
+			ID:            score.id,
+			PlayerName:    score.playerName,
+			Score:         score.score,
+			Tags:          score.tags,
+			ExtrasVersion: score.extrasVersion,
+			Extras:        score.extras,
+			CreatedAt:     score.createdAt,
+		})
+	}
+	return leaderboard, nil
+}
+
+func (s *Memory) PlayerStats(ctx context.Context, playerName string) (*PlayerStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := &PlayerStats{PlayerName: playerName}
+	furthest := -1
+	// Scores are kept oldest first, so walk back for the recent ones
+	for i := len(s.scores) - 1; i >= 0; i-- {
+		score := s.scores[i]
+		if score.playerName != playerName {
+			continue
+		}
+		stats.TotalGames++
+		if len(stats.RecentScores) < 10 {
+			stats.RecentScores = append(stats.RecentScores, LeaderboardEntry{
+				PlayerName: playerName,
+				Score:      score.score,
+				CreatedAt:  score.createdAt,
+			})
+		}
+		if score.hidden {
+			continue
+		}
+		if score.score > stats.BestScore {
+			stats.BestScore = score.score
+		}
+		if score.biome != "" && score.score > furthest {
+			furthest = score.score
+			stats.FurthestBiome = score.biome
+		}
+	}
+	stats.SeasonBest = stats.BestScore
+	return stats, nil
+}
+
+func (s *Memory) Rank(ctx context.Context, score int) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rank := 1
+	for _, stored := range s.scores {
+		if !stored.hidden && stored.score > score {
+			rank++
+		}
+	}
+	return rank, nil
+}
+
+func (s *Memory) LastSubmission(ctx context.Context, sessionID string) (time.Time, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := len(s.scores) - 1; i >= 0; i-- {
+		if s.scores[i].sessionID == sessionID {
+			return s.scores[i].createdAt, true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+func (s *Memory) FindSubmission(ctx context.Context, submissionID string) (*StoredSubmission, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, ok := s.submissions[submissionID]
+	if !ok {
+		return nil, nil
+	}
+	score := s.scores[i]
+	identity := s.players[score.playerID]
+	return &StoredSubmission{
+		ID:            score.id,
+		PlayerName:    score.playerName,
+		Score:         score.score,
+		CreatedAt:     score.createdAt,
+		DisplayName:   identity.DisplayName,
+		Discriminator: identity.Discriminator,
+	}, nil
+}
+
+func (s *Memory) Identity(ctx context.Context, playerID string) (*Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identity, ok := s.players[playerID]
+	if !ok {
+		return nil, nil
+	}
+	return &identity, nil
+}
+
+func (s *Memory) SaveIdentity(ctx context.Context, identity *Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, other := range s.players {
+		if id != identity.PlayerID && other.DisplayName == identity.DisplayName && other.Discriminator == identity.Discriminator {
+			return ErrNameTaken
+		}
+	}
+	s.players[identity.PlayerID] = Identity{
+		PlayerID:      identity.PlayerID,
+		DisplayName:   identity.DisplayName,
+		Discriminator: identity.Discriminator,
+		Registered:    s.players[identity.PlayerID].Registered,
+	}
+	return nil
+}
+
+func (s *Memory) AccountNameTaken(ctx context.Context, displayName string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, identity := range s.players {
+		if identity.Registered && strings.EqualFold(identity.DisplayName, displayName) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hasAllTags reports whether have holds every tag in want.
+func hasAllTags(have, want []string) bool {
+	for _, tag := range want {
+		if !slices.Contains(have, tag) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,292 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// CurrentSeason selects the current season's ID, as most board queries
+// filter on it.
+const CurrentSeason = `(SELECT id FROM seasons WHERE ended_at IS NULL)`
+
+// Postgres unique_violation
+const pgUniqueViolation = "23505"
+
+// Score store queries
+var (
+	insertScoreQuery = NewQuery("insert_score", `
+		INSERT INTO scores (player_name, score, session_id, player_id, tags, extras, extras_version, game_mode, difficulty,
+			season_id, submission_id, trace_parent, quarantined, quarantined_at, quarantine_reason, api_key_id, biome, input_method)
+		VALUES ($1, $2, $3, $4, $5::jsonb, $6::jsonb, $7, $8, $9, `+CurrentSeason+`, $10, $11,
+			$12 <> '', CASE WHEN $12 <> '' THEN NOW() END, NULLIF($12, ''), $13, NULLIF($14, ''), NULLIF($15, ''))
+		ON CONFLICT (submission_id) DO NOTHING
+		RETURNING id, created_at
+	`)
+	selectTopQuery = NewQuery("select_top", `
+		SELECT ROW_NUMBER() OVER (ORDER BY score DESC, id) as rank, id, player_name, score, created_at, tags,
+			extras, extras_version
+		FROM scores
+		WHERE NOT quarantined AND tags @> $2::jsonb AND season_id = `+CurrentSeason+`
+		ORDER BY score DESC, id
+		LIMIT $1
+	`)
+	playerBestQuery = NewQuery("player_best", `
+		SELECT COALESCE(MAX(score), 0),
+		       COALESCE(MAX(score) FILTER (WHERE season_id = `+CurrentSeason+`), 0)
+		FROM scores
+		WHERE player_name = $1 AND NOT quarantined
+	`)
+	playerGamesQuery  = NewQuery("player_games", `SELECT COUNT(*) FROM scores WHERE player_name = $1`)
+	playerRecentQuery = NewQuery("player_recent", `
+		SELECT score, created_at
+		FROM scores
+		WHERE player_name = $1
+		ORDER BY created_at DESC
+		LIMIT 10
+	`)
+	// The furthest biome follows the score: it is the biome of the player's
+	// best visible run that reported one
+	playerBiomeQuery = NewQuery("player_biome", `
+		SELECT COALESCE((SELECT biome FROM scores
+			WHERE player_name = $1 AND NOT quarantined AND biome IS NOT NULL
+			ORDER BY score DESC LIMIT 1), '')
+	`)
+	rankQuery = NewQuery("rank", `
+		SELECT COUNT(*) + 1 FROM scores
+		WHERE score > $1 AND NOT quarantined AND season_id = `+CurrentSeason+`
+	`)
+	lastSubmissionQuery = NewQuery("last_submission",
+		`SELECT created_at FROM scores WHERE session_id = $1 ORDER BY created_at DESC LIMIT 1`)
+	findSubmissionQuery = NewQuery("find_submission", `
+		SELECT s.id, s.player_name, s.score, s.created_at,
+		       COALESCE(p.display_name, ''), COALESCE(p.discriminator, '')
+		FROM scores s
+		LEFT JOIN players p ON p.id = s.player_id
+		WHERE s.submission_id = $1
+	`)
+)
+
+// Player store queries
+var (
+	playerIdentityQuery = NewQuery("player_identity",
+		`SELECT display_name, discriminator, password_hash IS NOT NULL FROM players WHERE id = $1`)
+	savePlayerQuery = NewQuery("save_player", `
+		INSERT INTO players (id, display_name, discriminator)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE
+		SET display_name = EXCLUDED.display_name, discriminator = EXCLUDED.discriminator, updated_at = NOW()
+	`)
+	// Matches idx_players_account_name
+	accountNameTakenQuery = NewQuery("account_name_taken", `
+		SELECT EXISTS (SELECT 1 FROM players WHERE LOWER(display_name) = LOWER($1) AND password_hash IS NOT NULL)
+	`)
+)
+
+// Postgres is the ScoreStore backed by the scores table, and the PlayerStore
+// backed by the players table. Top score reads are hedged when a hedger is
+// configured, and reads are retried on transient errors under retry.
+type Postgres struct {
+	db     *pgxpool.Pool
+	hedger *ReadHedger
+	retry  *RetryPolicy
+}
+
+// NewPostgres returns the store for db. hedger and retry may be nil.
+func NewPostgres(db *pgxpool.Pool, hedger *ReadHedger, retry *RetryPolicy) *Postgres {
+	return &Postgres{db: db, hedger: hedger, retry: retry}
+}
+
+func (s *Postgres) InsertScore(ctx context.Context, score *Score) (int, time.Time, error) {
+	ctx, span := tracer.Start(ctx, "insertScore")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation", "INSERT"),
+	)
+
+	var id int
+	var createdAt time.Time
+	var playerID, submissionID *string
+	var apiKeyID *int
+	if score.PlayerID != "" {
+		playerID = &score.PlayerID
+	}
+	if score.APIKeyID != 0 {
+		apiKeyID = &score.APIKeyID
+	}
+	if score.SubmissionID != "" {
+		submissionID = &score.SubmissionID
+	}
+	err := insertScoreQuery.QueryRow(ctx, s.db, score.PlayerName, score.Score, score.SessionID, playerID,
+		TagsJSON(score.Tags), ExtrasJSON(score.Extras), score.ExtrasVersion,
+		score.Mode, score.Difficulty, submissionID, score.TraceParent, score.QuarantineReason,
+		apiKeyID, score.Biome, score.InputMethod).Scan(&id, &createdAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Nothing inserted: the submission ID is taken
+		return 0, time.Time{}, ErrDuplicateSubmission
+	}
+
+	return id, createdAt, Classify(err)
+}
+
+func (s *Postgres) TopScores(ctx context.Context, limit int, tags []string) ([]LeaderboardEntry, error) {
+	return RetryRead(ctx, s.retry, selectTopQuery.name, func(ctx context.Context) ([]LeaderboardEntry, error) {
+		return s.topScores(ctx, limit, tags)
+	})
+}
+
+func (s *Postgres) topScores(ctx context.Context, limit int, tags []string) ([]LeaderboardEntry, error) {
+	return HedgedRead(ctx, s.hedger, s.db, selectTopQuery.name, func(ctx context.Context, db *pgxpool.Pool) ([]LeaderboardEntry, error) {
+		rows, err := selectTopQuery.Query(ctx, db, limit, TagsJSON(tags))
+		if err != nil {
+			return nil, Classify(err)
+		}
+		defer rows.Close()
+		return ScanEntries(rows)
+	})
+}
+
+func (s *Postgres) PlayerStats(ctx context.Context, playerName string) (*PlayerStats, error) {
+	return RetryRead(ctx, s.retry, "player_stats", func(ctx context.Context) (*PlayerStats, error) {
+		return s.playerStats(ctx, playerName)
+	})
+}
+
+func (s *Postgres) playerStats(ctx context.Context, playerName string) (*PlayerStats, error) {
+	// Best score overall and this season; the rank is this season's
+	var bestScore, seasonBest int
+	err := playerBestQuery.QueryRow(ctx, s.db, playerName).Scan(&bestScore, &seasonBest)
+	if err != nil {
+		return nil, Classify(err)
+	}
+
+	var totalGames int
+	if err := playerGamesQuery.QueryRow(ctx, s.db, playerName).Scan(&totalGames); err != nil {
+		totalGames = 0
+	}
+
+	rows, err := playerRecentQuery.Query(ctx, s.db, playerName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recentScores []LeaderboardEntry
+	for rows.Next() {
+		var entry LeaderboardEntry
+		entry.PlayerName = playerName
+		if err := rows.Scan(&entry.Score, &entry.CreatedAt); err != nil {
+			continue
+		}
+		recentScores = append(recentScores, entry)
+	}
+
+	var furthestBiome string
+	if err := playerBiomeQuery.QueryRow(ctx, s.db, playerName).Scan(&furthestBiome); err != nil {
+		return nil, err
+	}
+
+	return &PlayerStats{
+		PlayerName:    playerName,
+		BestScore:     bestScore,
+		SeasonBest:    seasonBest,
+		TotalGames:    totalGames,
+		RecentScores:  recentScores,
+		FurthestBiome: furthestBiome,
+	}, nil
+}
+
+func (s *Postgres) Rank(ctx context.Context, score int) (int, error) {
+	rank, err := RetryRead(ctx, s.retry, rankQuery.name, func(ctx context.Context) (int, error) {
+		var rank int
+		err := rankQuery.QueryRow(ctx, s.db, score).Scan(&rank)
+		return rank, err
+	})
+	return rank, Classify(err)
+}
+
+func (s *Postgres) LastSubmission(ctx context.Context, sessionID string) (time.Time, bool, error) {
+	lastSubmission, err := RetryRead(ctx, s.retry, lastSubmissionQuery.name, func(ctx context.Context) (time.Time, error) {
+		var lastSubmission time.Time
+		err := lastSubmissionQuery.QueryRow(ctx, s.db, sessionID).Scan(&lastSubmission)
+		return lastSubmission, err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	return lastSubmission, err == nil, Classify(err)
+}
+
+func (s *Postgres) FindSubmission(ctx context.Context, submissionID string) (*StoredSubmission, error) {
+	var stored StoredSubmission
+	err := findSubmissionQuery.QueryRow(ctx, s.db, submissionID).Scan(&stored.ID, &stored.PlayerName, &stored.Score,
+		&stored.CreatedAt, &stored.DisplayName, &stored.Discriminator)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, Classify(err)
+	}
+	return &stored, nil
+}
+
+func (s *Postgres) Identity(ctx context.Context, playerID string) (*Identity, error) {
+	identity := &Identity{PlayerID: playerID}
+	err := playerIdentityQuery.QueryRow(ctx, s.db, playerID).
+		Scan(&identity.DisplayName, &identity.Discriminator, &identity.Registered)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, Classify(err)
+	}
+	return identity, nil
+}
+
+func (s *Postgres) SaveIdentity(ctx context.Context, identity *Identity) error {
+	_, err := savePlayerQuery.Exec(ctx, s.db, identity.PlayerID, identity.DisplayName, identity.Discriminator)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return ErrNameTaken
+	}
+	return Classify(err)
+}
+
+func (s *Postgres) AccountNameTaken(ctx context.Context, displayName string) (bool, error) {
+	taken, err := ScanExists(accountNameTakenQuery.QueryRow(ctx, s.db, displayName))
+	return taken, Classify(err)
+}
+
+// ScanEntries reads ranked board rows: rank, id, player_name, score,
+// created_at, tags, extras and extras_version. A row that fails to scan is
+// logged and skipped rather than failing the board.
+func ScanEntries(rows pgx.Rows) ([]LeaderboardEntry, error) {
+	var leaderboard []LeaderboardEntry
+	for rows.Next() {
+		var entry LeaderboardEntry
+		if err := rows.Scan(&entry.Rank, &entry.ID, &entry.PlayerName, &entry.Score, &entry.CreatedAt, &entry.Tags,
+			&entry.Extras, &entry.ExtrasVersion); err != nil {
+			log.Printf("Failed to scan row: %v", err)
+			continue
+		}
+		leaderboard = append(leaderboard, entry)
+	}
+	return leaderboard, rows.Err()
+}
+
+// ScanEntryDetails reads the unranked board columns: id, player_name, score,
+// created_at, tags, extras and extras_version.
+func ScanEntryDetails(row pgx.CollectableRow) (LeaderboardEntry, error) {
+	var entry LeaderboardEntry
+	err := row.Scan(&entry.ID, &entry.PlayerName, &entry.Score, &entry.CreatedAt, &entry.Tags,
+		&entry.Extras, &entry.ExtrasVersion)
+	return entry, err
+}
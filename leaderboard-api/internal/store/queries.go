@@ -0,0 +1,781 @@
+package store
+
+import "github.com/jackc/pgx/v5"
+
+// taggedName matches the identity whose tagged name is $1.
+const taggedName = `
+	(CASE WHEN discriminator = '' THEN display_name ELSE display_name || '#' || discriminator END) = $1
+`
+
+// reignDuration is how long a reign lasted, or has lasted so far. A reign
+// still open when its season ended runs until the season's end.
+const reignDuration = `EXTRACT(EPOCH FROM COALESCE(r.ended_at, s.ended_at, NOW()) - r.started_at)::bigint`
+
+// reignColumns selects reigns with their duration, for a WHERE or ORDER BY to
+// follow.
+const reignColumns = `
+	SELECT r.player_name, r.season_id, r.score, r.started_at, COALESCE(r.ended_at, s.ended_at),
+		` + reignDuration + ` AS seconds
+	FROM board_reigns r JOIN seasons s ON s.id = r.season_id
+`
+
+// Board queries
+var (
+	CountTopQuery = NewQuery("count_top", `
+		SELECT COUNT(*) FROM scores
+		WHERE NOT quarantined AND tags @> $1::jsonb AND season_id = `+CurrentSeason+`
+	`)
+	// One extra row tells the caller whether there is a next page. Ranks
+	// continue from the rows at or ahead of the cursor, counted in the same
+	// snapshot.
+	SelectTopPageQuery = NewQuery("select_top_page", `
+		SELECT (
+			SELECT COUNT(*) FROM scores
+			WHERE NOT quarantined AND tags @> $4::jsonb AND season_id = `+CurrentSeason+`
+			  AND (score > $2 OR (score = $2 AND id <= $3))
+		) + ROW_NUMBER() OVER (ORDER BY score DESC, id) as rank, id, player_name, score, created_at, tags,
+			extras, extras_version
+		FROM scores
+		WHERE NOT quarantined AND tags @> $4::jsonb AND season_id = `+CurrentSeason+`
+		  AND (score < $2 OR (score = $2 AND id > $3))
+		ORDER BY score DESC, id
+		LIMIT $1
+	`)
+	SelectTopByIDQuery = NewQuery("select_top_by_id", `
+		SELECT id, player_name, score, created_at, tags, extras, extras_version
+		FROM scores
+		WHERE id = ANY($1)
+	`)
+	TopIDsQuery = NewQuery("top_ids", `
+		SELECT id FROM scores
+		WHERE NOT quarantined AND season_id = `+CurrentSeason+`
+		ORDER BY score DESC, id
+		LIMIT $1
+	`)
+	// The current season's scores, for rebuilding the ranking
+	RankedScoresQuery = NewQuery("ranked_scores", `
+		SELECT id, score FROM scores
+		WHERE NOT quarantined AND season_id = `+CurrentSeason+`
+		ORDER BY id
+	`)
+	RankedScoresAfterQuery = NewQuery("ranked_scores_after", `
+		SELECT id, score FROM scores
+		WHERE id > $1 AND NOT quarantined AND season_id = `+CurrentSeason+`
+	`)
+	RankedScoresByIDQuery = NewQuery("ranked_scores_by_id", `
+		SELECT id, score FROM scores
+		WHERE id = ANY($1) AND NOT quarantined AND season_id = `+CurrentSeason+`
+	`)
+	// Up to $2 ranked scores from ID $1 on
+	RankedScoreSliceQuery = NewQuery("ranked_score_slice", `
+		SELECT id, score FROM scores
+		WHERE id >= $1 AND NOT quarantined AND season_id = `+CurrentSeason+`
+		ORDER BY id
+		LIMIT $2
+	`)
+	CountRankedQuery = NewQuery("count_ranked", `
+		SELECT COUNT(*) FROM scores
+		WHERE NOT quarantined AND season_id = `+CurrentSeason+`
+	`)
+	ScoresByIDQuery = NewQuery("scores_by_id", `SELECT id, score FROM scores WHERE id = ANY($1)`)
+	MaxScoreIDQuery = NewQuery("max_score_id", `SELECT COALESCE(MAX(id), 0) FROM scores`)
+	PositionQuery   = NewQuery("position", `
+		SELECT COUNT(*) + 1 FROM scores
+		WHERE (score > $1 OR (score = $1 AND id < $2))
+		  AND NOT quarantined AND season_id = `+CurrentSeason+`
+	`)
+	// The unindexed twin of selectTopQuery, for the slow_query demo scenario
+	SelectTopSlowQuery = NewQuery("select_top_slow", `
+		SELECT rank, id, player_name, score, created_at, tags, extras, extras_version FROM (
+			SELECT ROW_NUMBER() OVER (ORDER BY score + 0 DESC, id + 0) as rank, id, player_name, score, created_at,
+				tags, extras, extras_version
+			FROM scores
+			WHERE NOT quarantined AND tags @> $2::jsonb
+				AND season_id + 0 = `+CurrentSeason+`
+		) ranked
+		WHERE rank <= $1
+		ORDER BY rank
+	`)
+	SeasonStandingsQuery = NewQuery("season_standings", `
+		SELECT rank, score_id, player_name, score, created_at, tags
+		FROM season_standings
+		WHERE season_id = $1
+		ORDER BY rank
+		LIMIT $2
+	`)
+	ScoreHistoryQuery = NewQuery("score_history", `
+		SELECT id, score, tags, created_at
+		FROM scores
+		WHERE player_name = $1 AND NOT quarantined
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`)
+	RecordProgressionQuery = NewQuery("record_progression", `
+		SELECT id, player_name, score, created_at FROM (
+			SELECT id, player_name, score, created_at,
+				MAX(score) OVER (ORDER BY created_at, id ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING) AS previous_best
+			FROM scores
+			WHERE NOT quarantined
+		) history
+		WHERE previous_best IS NULL OR score > previous_best
+		ORDER BY created_at, id
+	`)
+	FeaturedCandidatesQuery = NewQuery("featured_candidates", `
+		SELECT player_name, COUNT(*), RANK() OVER (ORDER BY MAX(score) DESC)
+		FROM scores
+		WHERE NOT quarantined AND created_at >= $1 AND season_id = `+CurrentSeason+`
+		GROUP BY player_name
+		ORDER BY MAX(score) DESC
+		LIMIT $2
+	`)
+)
+
+// FilteredTopQueries select the current season's board where a column holds
+// $2, keyed by the column.
+var FilteredTopQueries = map[string]NamedQuery{
+	"biome":        filteredTopQuery("biome"),
+	"input_method": filteredTopQuery("input_method"),
+}
+
+func filteredTopQuery(column string) NamedQuery {
+	return NewQuery("select_"+column+"_top", `
+		SELECT ROW_NUMBER() OVER (ORDER BY score DESC, id) as rank, id, player_name, score, created_at, tags,
+			extras, extras_version
+		FROM scores
+		WHERE NOT quarantined AND `+column+` = $2 AND season_id = `+CurrentSeason+`
+		ORDER BY score DESC, id
+		LIMIT $1
+	`)
+}
+
+// Submission pipeline queries
+var (
+	SessionBanQuery = NewQuery("session_ban",
+		`SELECT EXISTS (SELECT 1 FROM banned_sessions WHERE session_id = $1)`)
+	ShadowBanQuery = NewQuery("shadow_ban", `
+		SELECT EXISTS (
+			SELECT 1 FROM shadow_bans
+			WHERE (kind = 'session' AND value = $1) OR (kind = 'player' AND value = $2)
+		)
+	`)
+	VerifiedRunnerQuery = NewQuery("verified_runner",
+		`SELECT EXISTS (SELECT 1 FROM verified_runners WHERE player_id = $1)`)
+	AddSpiceQuery = NewQuery("add_spice", `
+		INSERT INTO player_spice (player_name, spice, runs) VALUES ($1, $2, 1)
+		ON CONFLICT (player_name) DO UPDATE
+		SET spice = player_spice.spice + EXCLUDED.spice, runs = player_spice.runs + 1, updated_at = NOW()
+	`)
+	AdvanceCommunityGoalsQuery = NewQuery("advance_community_goals", `
+		UPDATE community_counters
+		SET value = value + CASE metric WHEN 'runs' THEN 1 ELSE $1 END, updated_at = NOW()
+		WHERE metric = 'runs' OR (metric = 'spice' AND $1 > 0)
+		RETURNING metric, value
+	`)
+	// The oldest of player $1's scores below its season's retention threshold
+	RetentionNoticeQuery = NewQuery("retention_notice", `
+		SELECT MIN(scores.created_at) FROM scores `+belowRetentionThreshold+`
+		WHERE scores.player_name = $1 AND scores.score < COALESCE(t.score, $4) AND NOT `+pendingModeration+`
+	`)
+)
+
+// pendingModeration matches the scores in the moderation queue: quarantined
+// for review, or reported and not yet resolved.
+const pendingModeration = `(
+	(scores.quarantined AND scores.quarantine_reason IS DISTINCT FROM 'shadow_ban') OR EXISTS (
+		SELECT 1 FROM score_reports r WHERE r.score_id = scores.id AND NOT r.resolved
+	)
+)`
+
+// belowRetentionThreshold joins each score to its season's retention
+// threshold t.score, given as season IDs $2 (0 for scores from before seasons)
+// and thresholds $3. Seasons without one fall back to $4.
+const belowRetentionThreshold = `
+	LEFT JOIN unnest($2::int[], $3::bigint[]) AS t(season_id, score)
+		ON t.season_id = COALESCE(scores.season_id, 0)
+`
+
+// prunableScores selects up to $5 scores from before $1 below their season's
+// threshold, leaving the ones awaiting moderation.
+const prunableScores = `
+	SELECT scores.id FROM scores ` + belowRetentionThreshold + `
+	WHERE scores.created_at < $1 AND scores.score < COALESCE(t.score, $4) AND NOT ` + pendingModeration + `
+	LIMIT $5
+`
+
+// Retention queries
+var (
+	// The $1th best visible score of each season with that many, and whether
+	// the season is the current one
+	RetentionThresholdsQuery = NewQuery("retention_thresholds", `
+		SELECT COALESCE(season_id, 0), score, COALESCE(season_id = `+CurrentSeason+`, FALSE)
+		FROM (
+			SELECT season_id, score, ROW_NUMBER() OVER (PARTITION BY season_id ORDER BY score DESC) AS n
+			FROM scores WHERE NOT quarantined
+		) ranked
+		WHERE n = $1
+	`)
+	DeletePrunedScoresQuery = NewQuery("delete_pruned_scores", `
+		DELETE FROM scores WHERE id IN (`+prunableScores+`)
+	`)
+	ArchivePrunedScoresQuery = NewQuery("archive_pruned_scores", `
+		WITH pruned AS (
+			DELETE FROM scores WHERE id IN (`+prunableScores+`)
+			RETURNING *
+		)
+		INSERT INTO scores_archive (id, player_name, score, created_at, data)
+		SELECT id, player_name, score, created_at, to_jsonb(pruned) FROM pruned
+		ON CONFLICT (id) DO NOTHING
+	`)
+)
+
+// Account queries
+var (
+	LoginQuery = NewQuery("login", `
+		SELECT id, display_name, password_hash FROM players
+		WHERE LOWER(display_name) = LOWER($1) AND discriminator = '' AND password_hash IS NOT NULL
+	`)
+	LookupAPIKeyQuery = NewQuery("lookup_api_key",
+		`SELECT id, name, prefix, rate_limit, created_at FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`)
+	TouchAPIKeyQuery = NewQuery("touch_api_key", `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`)
+	ListAPIKeysQuery = NewQuery("list_api_keys",
+		`SELECT id, name, prefix, rate_limit, created_at, last_used_at, revoked_at FROM api_keys ORDER BY id`)
+	CreateAPIKeyQuery = NewQuery("create_api_key", `
+		INSERT INTO api_keys (name, key_hash, prefix, rate_limit) VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`)
+	RevokeAPIKeyQuery = NewQuery("revoke_api_key", `
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+		RETURNING name, key_hash
+	`)
+	AccountNameQuery = NewQuery("account_name",
+		`SELECT display_name FROM players WHERE id = $1 AND password_hash IS NOT NULL`)
+	LockPlayerQuery = NewQuery("lock_player",
+		`SELECT password_hash IS NOT NULL FROM players WHERE id = $1 FOR UPDATE`)
+	// An anonymous player other than $2 holding the bare name $1
+	NameSquatterQuery = NewQuery("name_squatter", `
+		SELECT id FROM players
+		WHERE display_name = $1 AND discriminator = '' AND password_hash IS NULL AND id <> $2
+		FOR UPDATE
+	`)
+	CreateAccountQuery = NewQuery("create_account", `
+		INSERT INTO players (id, display_name, discriminator, password_hash)
+		VALUES ($1, $2, '', $3)
+		ON CONFLICT (id) DO UPDATE
+		SET display_name = EXCLUDED.display_name, discriminator = '', password_hash = EXCLUDED.password_hash, updated_at = NOW()
+	`)
+	ReassignDiscriminatorQuery = NewQuery("reassign_discriminator",
+		`UPDATE players SET discriminator = $2, updated_at = NOW() WHERE id = $1`)
+)
+
+// ScanExists reads the single boolean of a SELECT EXISTS query.
+func ScanExists(row pgx.Row) (bool, error) {
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+// Webhook queries
+var (
+	EnqueueWebhookDeliveriesQuery = NewQuery("enqueue_webhook_deliveries", `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+		SELECT id, $1, $2, $3::jsonb FROM webhooks
+		WHERE enabled AND (events = '{}' OR $2 = ANY(events))
+	`)
+	// Deliveries of disabled webhooks wait, due, until they're enabled again
+	ClaimWebhookDeliveriesQuery = NewQuery("claim_webhook_deliveries", `
+		UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2)
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= NOW()
+			  AND webhook_id IN (SELECT id FROM webhooks WHERE enabled)
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.event_id, d.event_type, d.payload, d.attempts, w.name, w.url, w.secret
+	`)
+	SettleWebhookDeliveryQuery = NewQuery("settle_webhook_delivery", `
+		UPDATE webhook_deliveries
+		SET last_status = $2, last_error = $3, next_attempt_at = NOW() + make_interval(secs => $4),
+			delivered_at = CASE WHEN $5 THEN NOW() END, failed_at = CASE WHEN $6 THEN NOW() END
+		WHERE id = $1
+	`)
+	PruneWebhookDeliveriesQuery = NewQuery("prune_webhook_deliveries", `
+		DELETE FROM webhook_deliveries
+		WHERE delivered_at < NOW() - make_interval(secs => $1) OR failed_at < NOW() - make_interval(secs => $1)
+	`)
+	ListWebhooksQuery = NewQuery("list_webhooks",
+		`SELECT id, name, url, events, enabled, created_at, updated_at FROM webhooks ORDER BY id`)
+	CreateWebhookQuery = NewQuery("create_webhook", `
+		INSERT INTO webhooks (name, url, secret, events, enabled) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, name, url, events, enabled, created_at, updated_at
+	`)
+	// An empty secret keeps the current one
+	UpdateWebhookQuery = NewQuery("update_webhook", `
+		UPDATE webhooks
+		SET name = $2, url = $3, secret = COALESCE(NULLIF($4, ''), secret), events = $5, enabled = $6, updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, name, url, events, enabled, created_at, updated_at
+	`)
+	DeleteWebhookQuery         = NewQuery("delete_webhook", `DELETE FROM webhooks WHERE id = $1 RETURNING name`)
+	ListWebhookDeliveriesQuery = NewQuery("list_webhook_deliveries", `
+		SELECT id, event_id, event_type, attempts, last_status, last_error, created_at,
+			CASE WHEN delivered_at IS NULL AND failed_at IS NULL THEN next_attempt_at END, delivered_at, failed_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`)
+)
+
+// Top scores view queries
+var (
+	SelectTopViewQuery = NewQuery("select_top_view", `
+		SELECT rank, id, player_name, score, created_at, tags, extras, extras_version
+		FROM top_scores_view
+		WHERE rank <= $1
+		ORDER BY rank
+	`)
+	RefreshTopViewQuery = NewQuery("refresh_top_view", `REFRESH MATERIALIZED VIEW CONCURRENTLY top_scores_view`)
+)
+
+// Data request queries
+var (
+	VerifyPlayerQuery = NewQuery("verify_player",
+		`SELECT id, password_hash IS NOT NULL FROM players WHERE `+taggedName)
+	RecordDataRequestQuery = NewQuery("record_data_request", `
+		INSERT INTO data_requests (kind, subject_hash, verified_by, rows_affected)
+		VALUES ($1, $2, $3, $4)
+	`)
+	DeleteReporterReportsQuery = NewQuery("delete_reporter_reports", `DELETE FROM score_reports WHERE reporter_id = $1`)
+	ForgetMilestonesQuery      = NewQuery("forget_milestones",
+		`UPDATE community_milestones SET reached_by = NULL WHERE reached_by = $1`)
+	RenameStandingsQuery = NewQuery("rename_standings",
+		`UPDATE season_standings SET player_name = $2 WHERE player_name = $1`)
+	// Signed reward artifacts that named $1 are dropped, to be signed again
+	AnonymizeRewardsQuery = NewQuery("anonymize_rewards", `
+		WITH renamed AS (
+			UPDATE season_rewards SET player_name = $2 WHERE player_name = $1 RETURNING season_id
+		)
+		DELETE FROM season_reward_snapshots WHERE season_id IN (SELECT season_id FROM renamed)
+	`)
+	ExportIdentityQuery = NewQuery("export_identity", `
+		SELECT id, display_name, discriminator, password_hash IS NOT NULL, created_at, updated_at
+		FROM players WHERE id = $1
+	`)
+	ExportScoresQuery = NewQuery("export_scores", `
+		SELECT id, score, session_id, player_id, submission_id::text, season_id, game_mode, difficulty,
+		       biome, input_method, tags, extras_version, extras, quarantined, quarantine_reason,
+		       trace_parent, created_at
+		FROM scores WHERE player_name = $1 ORDER BY created_at
+	`)
+	ExportArchivedScoresQuery = NewQuery("export_archived_scores",
+		`SELECT data FROM scores_archive WHERE player_name = $1 ORDER BY created_at`)
+	ExportStandingsQuery = NewQuery("export_standings", `
+		SELECT season_id, rank, score_id, score, created_at FROM season_standings
+		WHERE player_name = $1 ORDER BY season_id, rank
+	`)
+	ExportRewardsQuery = NewQuery("export_rewards", `
+		SELECT season_id, rank, player_name, score, percentile, tier FROM season_rewards
+		WHERE player_name = $1 ORDER BY season_id
+	`)
+	ExportReignsQuery = NewQuery("export_reigns", reignColumns+`
+		WHERE r.player_name = $1 ORDER BY r.started_at
+	`)
+	ExportReportsQuery = NewQuery("export_reports", `
+		SELECT id, score_id, reason, resolved, created_at FROM score_reports
+		WHERE reporter_id = $1 ORDER BY created_at
+	`)
+	ExportMilestonesQuery = NewQuery("export_milestones", `
+		SELECT metric, target, reached_at FROM community_milestones
+		WHERE reached_by = $1 ORDER BY reached_at
+	`)
+)
+
+// Spice queries
+var (
+	SpiceTotalsQuery        = NewQuery("spice_totals", `SELECT COALESCE(SUM(spice), 0), COUNT(*) FROM player_spice`)
+	TopSpiceCollectorsQuery = NewQuery("top_spice_collectors", `
+		SELECT player_name, spice, runs, updated_at FROM player_spice
+		ORDER BY spice DESC, player_name
+		LIMIT $1
+	`)
+	PlayerSpiceQuery = NewQuery("player_spice",
+		`SELECT spice, runs, updated_at FROM player_spice WHERE player_name = $1`)
+)
+
+// Season queries
+var (
+	// The partial unique index allows only one open season across replicas
+	OpenFirstSeasonQuery = NewQuery("open_first_season",
+		`INSERT INTO seasons (started_at) VALUES (NOW()) ON CONFLICT DO NOTHING`)
+	ScheduleSeasonQuery         = NewQuery("schedule_season", `UPDATE seasons SET ends_at = $2 WHERE id = $1`)
+	AssignUnseasonedScoresQuery = NewQuery("assign_unseasoned_scores",
+		`UPDATE scores SET season_id = $1 WHERE season_id IS NULL`)
+	CurrentSeasonQuery = NewQuery("current_season",
+		`SELECT id, started_at, ends_at FROM seasons WHERE ended_at IS NULL`)
+	EndSeasonQuery = NewQuery("end_season",
+		`UPDATE seasons SET ended_at = NOW() WHERE id = $1 AND ended_at IS NULL RETURNING ended_at`)
+	ArchiveStandingsQuery = NewQuery("archive_standings", `
+		INSERT INTO season_standings (season_id, rank, score_id, player_name, score, tags, created_at)
+		SELECT $1, ROW_NUMBER() OVER (ORDER BY score DESC, id), id, player_name, score, tags, created_at
+		FROM scores
+		WHERE season_id = $1 AND NOT quarantined
+		ORDER BY score DESC, id
+		LIMIT $2
+	`)
+	StartSeasonQuery = NewQuery("start_season",
+		`INSERT INTO seasons (started_at, ends_at) VALUES ($1, $2) RETURNING id`)
+	ListSeasonsQuery  = NewQuery("list_seasons", `SELECT id, started_at, ends_at, ended_at FROM seasons ORDER BY id DESC`)
+	SeasonQuery       = NewQuery("season", `SELECT started_at, ends_at, ended_at FROM seasons WHERE id = $1`)
+	SeasonBoundsQuery = NewQuery("season_bounds", `SELECT started_at, ended_at FROM seasons WHERE id = $1`)
+	SeasonExistsQuery = NewQuery("season_exists", `SELECT EXISTS (SELECT 1 FROM seasons WHERE id = $1)`)
+)
+
+// Moderation queries
+var (
+	AnonymousPlayerQuery = NewQuery("anonymous_player",
+		`SELECT EXISTS (SELECT 1 FROM players WHERE id = $1 AND password_hash IS NULL)`)
+	ReportedScoreQuery = NewQuery("reported_score",
+		`SELECT quarantined, player_name, COALESCE(trace_parent, '') FROM scores WHERE id = $1`)
+	InsertReportQuery = NewQuery("insert_report", `
+		INSERT INTO score_reports (score_id, reporter_id, reason)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (score_id, reporter_id) DO NOTHING
+	`)
+	OpenReportsQuery = NewQuery("open_reports",
+		`SELECT COUNT(*) FROM score_reports WHERE score_id = $1 AND NOT resolved`)
+	QuarantineReportedScoreQuery = NewQuery("quarantine_reported_score", `
+		UPDATE scores SET quarantined = TRUE, quarantined_at = NOW(), quarantine_reason = 'reports'
+		WHERE id = $1 AND NOT quarantined
+	`)
+	// Shadow-banned scores are left out unless someone reports them
+	ModerationQueueQuery = NewQuery("moderation_queue", `
+		SELECT s.id, s.player_name, s.score, s.session_id, s.created_at,
+		       s.quarantined, s.quarantined_at, COALESCE(s.quarantine_reason, ''),
+		       COUNT(r.id) FILTER (WHERE NOT r.resolved),
+		       COALESCE(ARRAY_AGG(r.reason) FILTER (WHERE NOT r.resolved AND r.reason <> ''), '{}')
+		FROM scores s
+		LEFT JOIN score_reports r ON r.score_id = s.id
+		WHERE (s.quarantined AND s.quarantine_reason IS DISTINCT FROM 'shadow_ban') OR EXISTS (
+			SELECT 1 FROM score_reports o WHERE o.score_id = s.id AND NOT o.resolved
+		)
+		GROUP BY s.id
+		ORDER BY COUNT(r.id) FILTER (WHERE NOT r.resolved) DESC, s.score DESC
+		LIMIT 200
+	`)
+	ModeratedScoreQuery = NewQuery("moderated_score", `
+		SELECT player_name, score, season_id = `+CurrentSeason+`, COALESCE(trace_parent, '')
+		FROM scores WHERE id = $1
+	`)
+	RestoreScoreQuery = NewQuery("restore_score", `
+		WITH restored AS (
+			UPDATE scores SET quarantined = FALSE, quarantined_at = NULL, quarantine_reason = NULL
+			WHERE id = $1 RETURNING id
+		), resolved AS (
+			UPDATE score_reports SET resolved = TRUE WHERE score_id IN (SELECT id FROM restored)
+		)
+		SELECT id FROM restored
+	`)
+	RemoveScoreQuery = NewQuery("remove_score", `DELETE FROM scores WHERE id = $1 RETURNING id`)
+)
+
+// Player admin queries
+var (
+	DeleteScoreQuery     = NewQuery("delete_score", `DELETE FROM scores WHERE id = $1 RETURNING player_name`)
+	PlayerNameTakenQuery = NewQuery("player_name_taken", `
+		SELECT EXISTS (SELECT 1 FROM scores WHERE player_name = $1)
+			OR EXISTS (SELECT 1 FROM players WHERE `+taggedName+`)
+	`)
+	RenameScoresQuery   = NewQuery("rename_scores", `UPDATE scores SET player_name = $2 WHERE player_name = $1`)
+	RenameIdentityQuery = NewQuery("rename_identity", `
+		UPDATE players SET display_name = $2, discriminator = '', updated_at = NOW()
+		WHERE `+taggedName)
+	RenameSpiceQuery  = NewQuery("rename_spice", `UPDATE player_spice SET player_name = $2 WHERE player_name = $1`)
+	RenameReignsQuery = NewQuery("rename_reigns", `UPDATE board_reigns SET player_name = $2 WHERE player_name = $1`)
+	// Moves scores pruned into scores_archive from $1 to $2
+	RenameArchivedScoresQuery = NewQuery("rename_archived_scores", `
+		UPDATE scores_archive SET player_name = $2, data = jsonb_set(data, '{player_name}', to_jsonb($2::text))
+		WHERE player_name = $1
+	`)
+	MergeSpiceQuery = NewQuery("merge_spice", `
+		WITH moved AS (DELETE FROM player_spice WHERE player_name = $1 RETURNING spice, runs)
+		INSERT INTO player_spice (player_name, spice, runs)
+		SELECT $2, spice, runs FROM moved
+		ON CONFLICT (player_name) DO UPDATE
+		SET spice = player_spice.spice + EXCLUDED.spice, runs = player_spice.runs + EXCLUDED.runs, updated_at = NOW()
+	`)
+	DeletePlayerScoresQuery    = NewQuery("delete_player_scores", `DELETE FROM scores WHERE player_name = $1`)
+	DeleteIdentityQuery        = NewQuery("delete_identity", `DELETE FROM players WHERE `+taggedName)
+	DeleteSpiceQuery           = NewQuery("delete_spice", `DELETE FROM player_spice WHERE player_name = $1`)
+	DeleteArchivedScoresQuery  = NewQuery("delete_archived_scores", `DELETE FROM scores_archive WHERE player_name = $1`)
+	DeletePlayerShadowBanQuery = NewQuery("delete_player_shadow_ban",
+		`DELETE FROM shadow_bans WHERE kind = 'player' AND value = $1`)
+	DeleteReignsQuery = NewQuery("delete_reigns", `DELETE FROM board_reigns WHERE player_name = $1`)
+)
+
+// Ban and rule queries
+var (
+	ListSessionBansQuery = NewQuery("list_session_bans",
+		`SELECT session_id, reason, banned_at FROM banned_sessions ORDER BY banned_at DESC`)
+	BanSessionQuery = NewQuery("ban_session", `
+		INSERT INTO banned_sessions (session_id, reason) VALUES ($1, $2)
+		ON CONFLICT (session_id) DO UPDATE SET reason = EXCLUDED.reason
+		RETURNING banned_at
+	`)
+	UnbanSessionQuery = NewQuery("unban_session", `DELETE FROM banned_sessions WHERE session_id = $1`)
+	// Hides ($3) or restores (not $3) a session's or player's scores. Only
+	// scores hidden by a shadow ban are restored.
+	ShadowBanScoresQuery = NewQuery("shadow_ban_scores", `
+		UPDATE scores
+		SET quarantined = $3,
+		    quarantined_at = CASE WHEN $3 THEN NOW() END,
+		    quarantine_reason = CASE WHEN $3 THEN 'shadow_ban' END
+		WHERE CASE WHEN $1 = 'session' THEN session_id = $2 ELSE player_name = $2 END
+		  AND CASE WHEN $3 THEN NOT quarantined ELSE quarantine_reason = 'shadow_ban' END
+	`)
+	ListShadowBansQuery = NewQuery("list_shadow_bans",
+		`SELECT kind, value, reason, created_at FROM shadow_bans ORDER BY created_at DESC`)
+	AddShadowBanQuery = NewQuery("add_shadow_ban", `
+		INSERT INTO shadow_bans (kind, value, reason) VALUES ($1, $2, $3)
+		ON CONFLICT (kind, value) DO UPDATE SET reason = EXCLUDED.reason
+		RETURNING created_at
+	`)
+	RemoveShadowBanQuery     = NewQuery("remove_shadow_ban", `DELETE FROM shadow_bans WHERE kind = $1 AND value = $2`)
+	ListVerifiedRunnersQuery = NewQuery("list_verified_runners", `
+		SELECT v.player_id,
+		       CASE WHEN p.discriminator = '' THEN p.display_name ELSE p.display_name || '#' || p.discriminator END,
+		       v.note, v.created_at
+		FROM verified_runners v JOIN players p ON p.id = v.player_id
+		ORDER BY v.created_at DESC
+	`)
+	VerifyRunnerQuery = NewQuery("verify_runner", `
+		INSERT INTO verified_runners (player_id, note)
+		SELECT id, $2 FROM players WHERE `+taggedName+`
+		ON CONFLICT (player_id) DO UPDATE SET note = EXCLUDED.note
+		RETURNING player_id, created_at
+	`)
+	UnverifyRunnerQuery = NewQuery("unverify_runner",
+		`DELETE FROM verified_runners WHERE player_id IN (SELECT id FROM players WHERE `+taggedName+`)`)
+	SelectGameRulesQuery = NewQuery("select_game_rules",
+		`SELECT mode, difficulty, max_score, min_interval_ms, updated_at FROM game_rules`)
+	SaveGameRuleQuery = NewQuery("save_game_rule", `
+		INSERT INTO game_rules (mode, difficulty, max_score, min_interval_ms, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (mode, difficulty) DO UPDATE
+		SET max_score = EXCLUDED.max_score, min_interval_ms = EXCLUDED.min_interval_ms, updated_at = NOW()
+		RETURNING updated_at
+	`)
+)
+
+// Reign queries
+var (
+	LockOpenReignQuery = NewQuery("lock_open_reign", `
+		SELECT player_name, season_id = `+CurrentSeason+`
+		FROM board_reigns WHERE ended_at IS NULL FOR UPDATE
+	`)
+	EndReignQuery = NewQuery("end_reign", `
+		UPDATE board_reigns r SET ended_at = COALESCE(s.ended_at, NOW())
+		FROM seasons s WHERE s.id = r.season_id AND r.ended_at IS NULL
+	`)
+	StartReignQuery = NewQuery("start_reign", `
+		INSERT INTO board_reigns (season_id, player_name, score)
+		VALUES (`+CurrentSeason+`, $1, $2)
+		RETURNING season_id, started_at
+	`)
+	CurrentReignQuery = NewQuery("current_reign", reignColumns+`
+		WHERE r.ended_at IS NULL AND s.ended_at IS NULL
+	`)
+	LongestReignQuery = NewQuery("longest_reign", reignColumns+`
+		ORDER BY seconds DESC, r.started_at LIMIT 1
+	`)
+	ReignTotalsQuery = NewQuery("reign_totals", `
+		SELECT r.player_name, COUNT(*), SUM(`+reignDuration+`)::bigint AS seconds
+		FROM board_reigns r JOIN seasons s ON s.id = r.season_id
+		GROUP BY r.player_name
+		ORDER BY seconds DESC, r.player_name
+		LIMIT $1
+	`)
+	PlayerReignSecondsQuery = NewQuery("player_reign_seconds", `
+		SELECT COALESCE(SUM(`+reignDuration+`), 0)::bigint
+		FROM board_reigns r JOIN seasons s ON s.id = r.season_id
+		WHERE r.player_name = $1
+	`)
+)
+
+// Community goal queries
+var (
+	SeedCommunityCountersQuery = NewQuery("seed_community_counters", `
+		INSERT INTO community_counters (metric, value)
+		VALUES ('runs', (SELECT COUNT(*) FROM scores WHERE NOT quarantined)),
+		       ('spice', (SELECT COALESCE(SUM(spice), 0) FROM player_spice))
+		ON CONFLICT (metric) DO NOTHING
+	`)
+	// Records the goals ($1 metrics, $2 targets) the counters already passed
+	RecordPassedGoalsQuery = NewQuery("record_passed_goals", `
+		INSERT INTO community_milestones (metric, target)
+		SELECT c.metric, g.target
+		FROM community_counters c JOIN unnest($1::text[], $2::bigint[]) AS g(metric, target) ON g.metric = c.metric
+		WHERE c.value >= g.target
+		ON CONFLICT (metric, target) DO NOTHING
+	`)
+	ReachCommunityGoalQuery = NewQuery("reach_community_goal", `
+		INSERT INTO community_milestones (metric, target, reached_by) VALUES ($1, $2, $3)
+		ON CONFLICT (metric, target) DO NOTHING
+		RETURNING reached_at
+	`)
+	CommunityCountersQuery   = NewQuery("community_counters", `SELECT metric, value FROM community_counters`)
+	CommunityMilestonesQuery = NewQuery("community_milestones", `SELECT metric, target, reached_at FROM community_milestones`)
+)
+
+// Season reward queries
+var (
+	RewardSnapshotQuery = NewQuery("reward_snapshot",
+		`SELECT payload, signature FROM season_reward_snapshots WHERE season_id = $1`)
+	// Ranks each player by their best score of season $1 and gives them the
+	// narrowest of the tiers ($2 names, $3 top percents) they fall in
+	AssignRewardTiersQuery = NewQuery("assign_reward_tiers", `
+		INSERT INTO season_rewards (season_id, player_name, rank, score, percentile, tier)
+		SELECT $1, player_name, rank, best, percentile,
+		       COALESCE((SELECT t.name FROM unnest($2::text[], $3::float8[]) AS t(name, top_percent)
+		                 WHERE percentile <= t.top_percent ORDER BY t.top_percent LIMIT 1), '')
+		FROM (
+			SELECT player_name, best,
+			       RANK() OVER (ORDER BY best DESC) AS rank,
+			       RANK() OVER (ORDER BY best DESC) * 100.0 / COUNT(*) OVER () AS percentile
+			FROM (
+				SELECT player_name, MAX(score) AS best FROM scores
+				WHERE season_id = $1 AND NOT quarantined
+				GROUP BY player_name
+			) best_scores
+		) ranked
+		ON CONFLICT DO NOTHING
+	`)
+	SeasonRewardsQuery = NewQuery("season_rewards", `
+		SELECT rank, player_name, score, percentile, tier FROM season_rewards
+		WHERE season_id = $1 ORDER BY rank, player_name
+	`)
+	StoreRewardSnapshotQuery = NewQuery("store_reward_snapshot", `
+		INSERT INTO season_reward_snapshots (season_id, payload, signature) VALUES ($1, $2, $3)
+		ON CONFLICT (season_id) DO NOTHING
+	`)
+	PlayerRewardQuery = NewQuery("player_reward",
+		`SELECT rank, score, percentile, tier FROM season_rewards WHERE season_id = $1 AND player_name = $2`)
+)
+
+// Export queries
+var (
+	ExportAllScoresQuery = NewQuery("export_all_scores", `
+		SELECT id, player_name, score, session_id, COALESCE(player_id, ''), game_mode, difficulty,
+			COALESCE(season_id, 0), tags, quarantined, created_at
+		FROM scores
+		ORDER BY id
+	`)
+	StreamTopQuery = NewQuery("stream_top", `
+		SELECT ROW_NUMBER() OVER (ORDER BY score DESC, id) as rank, id, player_name, score, created_at, tags,
+			extras, extras_version
+		FROM scores
+		WHERE NOT quarantined AND tags @> $2::jsonb AND season_id = `+CurrentSeason+`
+		ORDER BY score DESC, id
+		LIMIT $1
+	`)
+	// Optionally only season $2 and scores since $3
+	ExportLeaderboardQuery = NewQuery("export_leaderboard", `
+		SELECT ROW_NUMBER() OVER (ORDER BY score DESC, id) AS rank, id, player_name, score, COALESCE(season_id, 0),
+			tags, extras, extras_version, created_at
+		FROM scores
+		WHERE NOT quarantined AND tags @> $1::jsonb
+			AND ($2::integer IS NULL OR season_id = $2)
+			AND ($3::timestamp IS NULL OR created_at >= $3)
+		ORDER BY score DESC, id
+		LIMIT $4
+	`)
+	// Scoped to the transaction, so the pool's connection gets its settings back
+	SetQueryBudgetQuery = NewQuery("set_query_budget",
+		`SELECT set_config('statement_timeout', $1, true), set_config('work_mem', $2, true)`)
+)
+
+// Client error queries
+var (
+	InsertClientErrorQuery = NewQuery("insert_client_error", `
+		INSERT INTO client_errors (stack_hash, client_version, message, user_agent)
+		VALUES ($1, $2, $3, $4)
+	`)
+	// Errors since $1 grouped by stack and client version, most frequent first
+	GetClientErrorsQuery = NewQuery("get_client_errors", `
+		SELECT stack_hash, client_version, (ARRAY_AGG(message ORDER BY created_at DESC))[1],
+		       COUNT(*), MIN(created_at), MAX(created_at)
+		FROM client_errors
+		WHERE created_at >= $1
+		GROUP BY stack_hash, client_version
+		ORDER BY COUNT(*) DESC, MAX(created_at) DESC
+		LIMIT $2
+	`)
+)
+
+// Table stats queries
+var (
+	TableStatsQuery = NewQuery("table_stats_table", `
+		SELECT pg_total_relation_size(relid), pg_relation_size(relid), pg_indexes_size(relid),
+		       n_live_tup, n_dead_tup, seq_scan, seq_tup_read, COALESCE(idx_scan, 0),
+		       GREATEST(last_vacuum, last_autovacuum)
+		FROM pg_stat_user_tables
+		WHERE relid = to_regclass($1)
+	`)
+	IndexStatsQuery = NewQuery("table_stats_indexes", `
+		SELECT indexrelname, pg_relation_size(indexrelid), idx_scan
+		FROM pg_stat_user_indexes
+		WHERE relid = to_regclass($1)
+		ORDER BY pg_relation_size(indexrelid) DESC
+	`)
+)
+
+// Probe queries
+var (
+	InsertProbeScoreQuery = NewQuery("insert_probe_score",
+		`INSERT INTO probe_scores (probe_id, score) VALUES ($1, $2) RETURNING id`)
+	ProbeScoreQuery = NewQuery("probe_score", `SELECT score FROM probe_scores WHERE id = $1`)
+	// Also clears rows left behind by probes that timed out
+	DeleteProbeScoresQuery = NewQuery("delete_probe_scores",
+		`DELETE FROM probe_scores WHERE id = $1 OR created_at < NOW() - INTERVAL '1 hour'`)
+)
+
+// Diagnostic queries
+var (
+	ServerVersionQuery = NewQuery("server_version", `SHOW server_version`)
+	DatabaseClockQuery = NewQuery("database_clock", `SELECT NOW()`)
+	HasPlayerDataQuery = NewQuery("has_player_data",
+		`SELECT EXISTS (SELECT 1 FROM scores) OR EXISTS (SELECT 1 FROM players)`)
+	HasIDColumnQuery = NewQuery("has_id_column", `
+		SELECT EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = $1 AND column_name = 'id')
+	`)
+	SchemaColumnsQuery = NewQuery("schema_columns", `
+		SELECT table_name, column_name
+		FROM information_schema.columns
+		WHERE table_schema = current_schema()
+	`)
+)
+
+// Migration queries
+var (
+	CreateMigrationsTableQuery = NewQuery("create_migrations_table", `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`)
+	AppliedMigrationsQuery = NewQuery("applied_migrations",
+		`SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	LockMigrationsQuery   = NewQuery("lock_migrations", `SELECT pg_advisory_lock($1)`)
+	UnlockMigrationsQuery = NewQuery("unlock_migrations", `SELECT pg_advisory_unlock($1)`)
+	RecordMigrationQuery  = NewQuery("record_migration",
+		`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`)
+	ForgetMigrationQuery = NewQuery("forget_migration", `DELETE FROM schema_migrations WHERE version = $1`)
+	SchemaVersionQuery   = NewQuery("schema_version", `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+)
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Querier is what named queries run against: the pool, a replica or a
+// transaction.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// NamedQuery is a SQL statement with a name for its metrics and spans. Its
+// text never changes between calls, so each connection plans it once.
+type NamedQuery struct {
+	name string
+	sql  string
+}
+
+// NewQuery names sql.
+func NewQuery(name, sql string) NamedQuery {
+	return NamedQuery{name: name, sql: sql}
+}
+
+// Name is the query's name in metrics and spans.
+func (q NamedQuery) Name() string {
+	return q.name
+}
+
+// ObserveQuery records the time since start as db.query.duration under name.
+// Named queries call it themselves; operations spanning several statements,
+// such as a transaction, call it once for the whole.
+func ObserveQuery(ctx context.Context, name string, start time.Time) {
+	queryDuration.Record(ctx, time.Since(start).Seconds(),
+		metric.WithAttributes(attribute.String("query.name", name)))
+}
+
+func (q NamedQuery) annotate(ctx context.Context) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("db.query.name", q.name))
+}
+
+// Exec runs q for its effect.
+func (q NamedQuery) Exec(ctx context.Context, db Querier, args ...any) (pgconn.CommandTag, error) {
+	q.annotate(ctx)
+	start := time.Now()
+	tag, err := db.Exec(ctx, q.sql, args...)
+	ObserveQuery(ctx, q.name, start)
+	return tag, err
+}
+
+// QueryRow runs q for a single row. The time is recorded once it's scanned.
+func (q NamedQuery) QueryRow(ctx context.Context, db Querier, args ...any) pgx.Row {
+	q.annotate(ctx)
+	return &timedRow{Row: db.QueryRow(ctx, q.sql, args...), ctx: ctx, name: q.name, start: time.Now()}
+}
+
+// Query runs q for its rows. The time is recorded once they've all been read
+// or are closed, so it covers the transfer as well as the plan.
+func (q NamedQuery) Query(ctx context.Context, db Querier, args ...any) (pgx.Rows, error) {
+	q.annotate(ctx)
+	start := time.Now()
+	rows, err := db.Query(ctx, q.sql, args...)
+	if err != nil {
+		ObserveQuery(ctx, q.name, start)
+		return nil, err
+	}
+	return &timedRows{Rows: rows, ctx: ctx, name: q.name, start: start}, nil
+}
+
+type timedRow struct {
+	pgx.Row
+	ctx   context.Context
+	name  string
+	start time.Time
+}
+
+func (r *timedRow) Scan(dest ...any) error {
+	err := r.Row.Scan(dest...)
+	ObserveQuery(r.ctx, r.name, r.start)
+	return err
+}
+
+type timedRows struct {
+	pgx.Rows
+	ctx   context.Context
+	name  string
+	start time.Time
+	once  sync.Once
+}
+
+func (r *timedRows) observe() {
+	r.once.Do(func() { ObserveQuery(r.ctx, r.name, r.start) })
+}
+
+func (r *timedRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.observe()
+	return false
+}
+
+func (r *timedRows) Close() {
+	r.Rows.Close()
+	r.observe()
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Postgres errors besides connection exceptions (class 08) that a retry can
+// get past: serialization failures, deadlocks, and a server shutting down or
+// still starting, as during a failover.
+var retryablePgCodes = []string{"40001", "40P01", "57P01", "57P02", "57P03"}
+
+// RetryPolicy retries idempotent reads that fail on a transient error, such as
+// a connection dropped by a Postgres failover, with exponential backoff and
+// full jitter. Writes are never retried: a lost reply doesn't mean the write
+// didn't happen.
+type RetryPolicy struct {
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+// NewRetryPolicy makes up to attempts tries, waiting between baseDelay and
+// maxDelay before each retry.
+func NewRetryPolicy(attempts int, baseDelay, maxDelay time.Duration) *RetryPolicy {
+	return &RetryPolicy{attempts: attempts, baseDelay: baseDelay, maxDelay: maxDelay}
+}
+
+// backoff is the wait before retry n, counting from 1: a random duration up
+// to baseDelay doubled n-1 times, capped at maxDelay.
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	ceiling := p.maxDelay
+	if shift := n - 1; shift < 32 && p.baseDelay<<shift < p.maxDelay {
+		ceiling = p.baseDelay << shift
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// retryableError reports whether err is one a retry may get past.
+func retryableError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return strings.HasPrefix(pgErr.Code, "08") || slices.Contains(retryablePgCodes, pgErr.Code)
+	}
+	return pgconn.SafeToRetry(err) || errors.Is(Classify(err), ErrUnavailable)
+}
+
+// RetryRead runs read, retrying it under p while it fails with a retryable
+// error. It gives up early rather than wait past ctx's deadline. Each retry and
+// each read abandoned with a retryable error is counted in db.retries.total;
+// without a policy it is a plain read.
+func RetryRead[T any](ctx context.Context, p *RetryPolicy, name string, read func(ctx context.Context) (T, error)) (T, error) {
+	value, err := read(ctx)
+	if p == nil {
+		return value, err
+	}
+	for n := 1; err != nil && retryableError(err); n++ {
+		if n >= p.attempts || ctx.Err() != nil {
+			recordRetry(ctx, name, "abandoned", n)
+			return value, err
+		}
+		wait := p.backoff(n)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			recordRetry(ctx, name, "abandoned", n)
+			return value, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			recordRetry(ctx, name, "abandoned", n)
+			return value, err
+		case <-timer.C:
+		}
+		recordRetry(ctx, name, "retried", n)
+		value, err = read(ctx)
+	}
+	return value, err
+}
+
+func recordRetry(ctx context.Context, name, result string, attempt int) {
+	trace.SpanFromContext(ctx).AddEvent("db.retry", trace.WithAttributes(
+		attribute.String("query.name", name),
+		attribute.String("retry.result", result),
+		attribute.Int("retry.attempt", attempt),
+	))
+	retriesTotal.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("query.name", name),
+		attribute.String("retry.result", result),
+	))
+}
@@ -0,0 +1,226 @@
+// Package store keeps scores: the ScoreStore interface handlers submit and
+// read through, its Postgres and in-memory implementations, and the named
+// queries, hedging and retries the Postgres side runs on.
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+var (
+	// ErrUnavailable means Postgres couldn't be reached or didn't answer in
+	// time; the same request may well succeed later.
+	ErrUnavailable = errors.New("store unavailable")
+	// ErrDuplicateSubmission means a score with the same submission ID is
+	// already stored.
+	ErrDuplicateSubmission = errors.New("duplicate submission")
+	// ErrNameTaken means another identity already has the name and
+	// discriminator.
+	ErrNameTaken = errors.New("name taken")
+)
+
+// ScoreStore is where scores are kept. Submissions and the core reads go
+// through it rather than the pool, so handlers can run against the in-memory
+// store in tests and other backends can be added later. The Redis ranking,
+// caching and the ranking canary stay in the caller, on top of the store. An
+// unreachable backend fails with ErrUnavailable.
+type ScoreStore interface {
+	// InsertScore stores a validated score and returns its ID and creation
+	// time, or ErrDuplicateSubmission if its submission ID is taken.
+	InsertScore(ctx context.Context, score *Score) (int, time.Time, error)
+	// TopScores returns the current season's top limit visible scores
+	// carrying every tag.
+	TopScores(ctx context.Context, limit int, tags []string) ([]LeaderboardEntry, error)
+	// PlayerStats returns a player's stats. The rank is left for the caller,
+	// which may rank from somewhere faster than the store.
+	PlayerStats(ctx context.Context, playerName string) (*PlayerStats, error)
+	// Rank returns the rank score would have on the current season's board.
+	Rank(ctx context.Context, score int) (int, error)
+	// LastSubmission returns when the session last submitted a score, and
+	// false if it never has.
+	LastSubmission(ctx context.Context, sessionID string) (time.Time, bool, error)
+	// FindSubmission returns the score stored with a submission ID, or nil if
+	// none is.
+	FindSubmission(ctx context.Context, submissionID string) (*StoredSubmission, error)
+}
+
+// PlayerStore keeps player identities: the name each player ID submits
+// under, and whether an account owns it. Like ScoreStore, it lets handlers
+// run against the in-memory store in tests.
+type PlayerStore interface {
+	// Identity returns the identity of a player ID, or nil if it has none.
+	Identity(ctx context.Context, playerID string) (*Identity, error)
+	// SaveIdentity names an anonymous identity, creating it if needed, or
+	// returns ErrNameTaken if another identity has the same tagged name.
+	SaveIdentity(ctx context.Context, identity *Identity) error
+	// AccountNameTaken reports whether an account owns the bare name, in any
+	// case.
+	AccountNameTaken(ctx context.Context, displayName string) (bool, error)
+}
+
+// Identity is the name a player ID submits under.
+type Identity struct {
+	PlayerID      string
+	DisplayName   string
+	Discriminator string
+	// Registered is set when an account owns the identity
+	Registered bool
+}
+
+// Score is a validated score to store.
+type Score struct {
+	SubmissionID  string
+	PlayerName    string
+	Score         int
+	SessionID     string
+	PlayerID      string
+	Tags          []string
+	ExtrasVersion int
+	Extras        map[string]json.RawMessage
+	Mode          string
+	Difficulty    string
+	Biome         string
+	InputMethod   string
+	// APIKeyID is the API key the score was sent with, 0 for none
+	APIKeyID int
+	// TraceParent links the score to the trace it was submitted in
+	TraceParent *string
+	// QuarantineReason stores the score hidden when set
+	QuarantineReason string
+}
+
+// StoredSubmission is a score as stored for its submission ID, with the name
+// of the identity it was submitted under, if any.
+type StoredSubmission struct {
+	ID            int
+	PlayerName    string
+	Score         int
+	CreatedAt     time.Time
+	DisplayName   string
+	Discriminator string
+}
+
+// LeaderboardEntry is one score on a board.
+type LeaderboardEntry struct {
+	Rank          int                        `json:"rank"`
+	ID            int                        `json:"id,omitempty"`
+	PlayerName    string                     `json:"playerName"`
+	Score         int                        `json:"score"`
+	Tags          []string                   `json:"tags,omitempty"`
+	ExtrasVersion int                        `json:"extrasVersion,omitempty"`
+	Extras        map[string]json.RawMessage `json:"extras,omitempty"`
+	CreatedAt     time.Time                  `json:"createdAt"`
+	// ExpiresAt is when retention is projected to prune the score, unset
+	// when retention is off or the score is kept
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// PlayerStats is what the store knows about a player.
+type PlayerStats struct {
+	PlayerName   string
+	BestScore    int
+	SeasonBest   int
+	TotalGames   int
+	RecentScores []LeaderboardEntry
+	// FurthestBiome is empty until one of the player's runs reports a biome
+	FurthestBiome string
+}
+
+// unavailableError is an error from a Postgres that couldn't be reached.
+type unavailableError struct {
+	cause error
+}
+
+func (e *unavailableError) Error() string { return "score store unavailable: " + e.cause.Error() }
+
+func (e *unavailableError) Unwrap() []error { return []error{ErrUnavailable, e.cause} }
+
+// Classify marks err as ErrUnavailable when Postgres couldn't be reached or
+// didn't answer in time. Query errors are returned as they are.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || pgconn.Timeout(err) || errors.Is(err, context.DeadlineExceeded) {
+		return &unavailableError{cause: err}
+	}
+	return err
+}
+
+// TagsJSON encodes tags for a jsonb parameter, using [] for none.
+func TagsJSON(tags []string) string {
+	if len(tags) == 0 {
+		return "[]"
+	}
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return "[]"
+	}
+	return string(encoded)
+}
+
+// ExtrasJSON encodes extras for a jsonb parameter, using {} for none.
+func ExtrasJSON(extras map[string]json.RawMessage) string {
+	if len(extras) == 0 {
+		return "{}"
+	}
+	encoded, err := json.Marshal(extras)
+	if err != nil {
+		return "{}"
+	}
+	return string(encoded)
+}
+
+// The store's instruments, no-ops until InitTelemetry.
+var (
+	tracer           trace.Tracer = tracenoop.NewTracerProvider().Tracer("")
+	queryDuration    metric.Float64Histogram
+	hedgedReadsTotal metric.Int64Counter
+	retriesTotal     metric.Int64Counter
+)
+
+func init() {
+	meter := metricnoop.NewMeterProvider().Meter("")
+	queryDuration, _ = meter.Float64Histogram("")
+	hedgedReadsTotal, _ = meter.Int64Counter("")
+	retriesTotal, _ = meter.Int64Counter("")
+}
+
+// InitTelemetry creates the store's spans with t and its metrics with m.
+func InitTelemetry(t trace.Tracer, m metric.Meter) error {
+	tracer = t
+
+	var err error
+	queryDuration, err = m.Float64Histogram(
+		"db.query.duration.seconds",
+		metric.WithDescription("Duration of database queries in seconds"),
+	)
+	if err != nil {
+		return err
+	}
+
+	hedgedReadsTotal, err = m.Int64Counter(
+		"db.hedged_reads.total",
+		metric.WithDescription("Total number of hedge-enabled reads by whether a hedge was sent and which copy won"),
+	)
+	if err != nil {
+		return err
+	}
+
+	retriesTotal, err = m.Int64Counter(
+		"db.retries.total",
+		metric.WithDescription("Total number of idempotent database reads retried or abandoned after a transient error"),
+	)
+	return err
+}
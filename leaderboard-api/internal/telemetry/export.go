@@ -0,0 +1,267 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	otlpProtocolGRPC = "grpc"
+	otlpProtocolHTTP = "http/protobuf"
+
+	// The in-cluster Tempo's OTLP receivers
+	defaultOTLPEndpoint     = "tempo.observability.svc.cluster.local:4317"
+	defaultOTLPHTTPEndpoint = "tempo.observability.svc.cluster.local:4318"
+)
+
+// ExporterConfig is how traces, metrics and logs reach their OTLP
+// endpoints: over gRPC or HTTP, with TLS when the endpoint asks for it, and
+// with extra headers such as a managed backend's API key. The SDK reads the
+// same variables on its own; everything here is passed explicitly so one
+// parser decides.
+type ExporterConfig struct {
+	protocol string
+	headers  map[string]string
+	// tls is nil unless certificates or OTEL_EXPORTER_OTLP_INSECURE=false
+	// ask for TLS; https:// endpoints use it or the system roots
+	tls *tls.Config
+}
+
+// Endpoint is one signal's endpoint, host:port or a URL.
+type Endpoint struct {
+	Host string
+	// path prefixes the signal's /v1/... path over HTTP
+	path   string
+	secure bool
+}
+
+// OTLPProtocol is OTEL_EXPORTER_OTLP_PROTOCOL, gRPC by default.
+func OTLPProtocol(getEnv Env) string {
+	return getEnv("OTEL_EXPORTER_OTLP_PROTOCOL", otlpProtocolGRPC)
+}
+
+// OTLPEndpoint is the trace endpoint, which logs default to as well.
+func OTLPEndpoint(getEnv Env) string {
+	if OTLPProtocol(getEnv) == otlpProtocolHTTP {
+		return getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", defaultOTLPHTTPEndpoint)
+	}
+	return getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", defaultOTLPEndpoint)
+}
+
+// NewExporterConfig reads OTEL_EXPORTER_OTLP_PROTOCOL,
+// OTEL_EXPORTER_OTLP_HEADERS, OTEL_EXPORTER_OTLP_INSECURE and the
+// certificate variables.
+func NewExporterConfig(getEnv Env) (*ExporterConfig, error) {
+	c := &ExporterConfig{protocol: OTLPProtocol(getEnv)}
+	if c.protocol != otlpProtocolGRPC && c.protocol != otlpProtocolHTTP {
+		return nil, fmt.Errorf(`OTEL_EXPORTER_OTLP_PROTOCOL must be "grpc" or "http/protobuf"`)
+	}
+
+	headers, err := parseOTLPHeaders(getEnv("OTEL_EXPORTER_OTLP_HEADERS", ""))
+	if err != nil {
+		return nil, err
+	}
+	c.headers = headers
+
+	caFile := getEnv("OTEL_EXPORTER_OTLP_CERTIFICATE", "")
+	certFile := getEnv("OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE", "")
+	keyFile := getEnv("OTEL_EXPORTER_OTLP_CLIENT_KEY", "")
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE and OTEL_EXPORTER_OTLP_CLIENT_KEY go together")
+	}
+	if caFile == "" && certFile == "" && getEnv("OTEL_EXPORTER_OTLP_INSECURE", "true") != "false" {
+		return c, nil
+	}
+
+	c.tls = &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OTEL_EXPORTER_OTLP_CERTIFICATE: %w", err)
+		}
+		c.tls.RootCAs = x509.NewCertPool()
+		if !c.tls.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_CERTIFICATE holds no PEM certificates")
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load OTLP client certificate: %w", err)
+		}
+		c.tls.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// parseOTLPHeaders parses "key=value,key=value" with percent-encoded values,
+// e.g. "Authorization=Basic%20dXNlcjprZXk=".
+func parseOTLPHeaders(raw string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(raw, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS entries must be key=value")
+		}
+		decoded, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS value for %s: %w", key, err)
+		}
+		headers[key] = decoded
+	}
+	return headers, nil
+}
+
+// Protocol is "grpc" or "http/protobuf".
+func (c *ExporterConfig) Protocol() string {
+	return c.protocol
+}
+
+// Endpoint parses a signal's endpoint. URLs choose TLS by scheme; a bare
+// host:port uses TLS when the config does.
+func (c *ExporterConfig) Endpoint(raw string) (Endpoint, error) {
+	if !strings.Contains(raw, "://") {
+		return Endpoint{Host: raw, secure: c.tls != nil}, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return Endpoint{}, fmt.Errorf("invalid OTLP endpoint %q", raw)
+	}
+	ep := Endpoint{Host: u.Host, path: strings.TrimSuffix(u.Path, "/"), secure: u.Scheme == "https"}
+	if u.Port() == "" {
+		port := "80"
+		if ep.secure {
+			port = "443"
+		}
+		ep.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return ep, nil
+}
+
+// tlsConfig is the TLS config for a secure endpoint, the system roots unless
+// certificates were given.
+func (c *ExporterConfig) tlsConfig() *tls.Config {
+	if c.tls != nil {
+		return c.tls
+	}
+	return &tls.Config{MinVersion: tls.VersionTLS12}
+}
+
+func (c *ExporterConfig) traceExporter(ctx context.Context, raw string) (sdktrace.SpanExporter, error) {
+	ep, err := c.Endpoint(raw)
+	if err != nil {
+		return nil, err
+	}
+	if c.protocol == otlpProtocolHTTP {
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(ep.Host),
+			otlptracehttp.WithURLPath(ep.path + "/v1/traces"),
+			otlptracehttp.WithHeaders(c.headers),
+		}
+		if ep.secure {
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(c.tlsConfig()))
+		} else {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	}
+
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(ep.Host),
+		otlptracegrpc.WithHeaders(c.headers),
+		otlptracegrpc.WithDialOption(grpc.WithBlock()),
+	}
+	if ep.secure {
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(c.tlsConfig())))
+	} else {
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(insecure.NewCredentials()))
+	}
+	return otlptracegrpc.New(ctx, opts...)
+}
+
+func (c *ExporterConfig) metricExporter(ctx context.Context, raw string, selector sdkmetric.TemporalitySelector) (sdkmetric.Exporter, error) {
+	ep, err := c.Endpoint(raw)
+	if err != nil {
+		return nil, err
+	}
+	if c.protocol == otlpProtocolHTTP {
+		opts := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithEndpoint(ep.Host),
+			otlpmetrichttp.WithURLPath(ep.path + "/v1/metrics"),
+			otlpmetrichttp.WithHeaders(c.headers),
+			otlpmetrichttp.WithTemporalitySelector(selector),
+		}
+		if ep.secure {
+			opts = append(opts, otlpmetrichttp.WithTLSClientConfig(c.tlsConfig()))
+		} else {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	}
+
+	opts := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithEndpoint(ep.Host),
+		otlpmetricgrpc.WithHeaders(c.headers),
+		otlpmetricgrpc.WithTemporalitySelector(selector),
+	}
+	if ep.secure {
+		opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(c.tlsConfig())))
+	} else {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+	return otlpmetricgrpc.New(ctx, opts...)
+}
+
+func (c *ExporterConfig) logExporter(ctx context.Context, raw string) (sdklog.Exporter, error) {
+	ep, err := c.Endpoint(raw)
+	if err != nil {
+		return nil, err
+	}
+	if c.protocol == otlpProtocolHTTP {
+		opts := []otlploghttp.Option{
+			otlploghttp.WithEndpoint(ep.Host),
+			otlploghttp.WithURLPath(ep.path + "/v1/logs"),
+			otlploghttp.WithHeaders(c.headers),
+		}
+		if ep.secure {
+			opts = append(opts, otlploghttp.WithTLSClientConfig(c.tlsConfig()))
+		} else {
+			opts = append(opts, otlploghttp.WithInsecure())
+		}
+		return otlploghttp.New(ctx, opts...)
+	}
+
+	opts := []otlploggrpc.Option{
+		otlploggrpc.WithEndpoint(ep.Host),
+		otlploggrpc.WithHeaders(c.headers),
+	}
+	if ep.secure {
+		opts = append(opts, otlploggrpc.WithTLSCredentials(credentials.NewTLS(c.tlsConfig())))
+	} else {
+		opts = append(opts, otlploggrpc.WithInsecure())
+	}
+	return otlploggrpc.New(ctx, opts...)
+}
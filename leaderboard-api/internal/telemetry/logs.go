@@ -0,0 +1,81 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+const (
+	defaultLogsExportInterval = time.Second
+
+	// The standard logger's LstdFlags prefix
+	stdLogTimeLayout = "2006/01/02 15:04:05"
+)
+
+// newOTLPLogProvider returns a logger provider that batches log records
+// to an OTLP collector, by default the one traces go to, with the same
+// resource as traces and metrics. It returns nil when LOGS_OTLP is false.
+func newOTLPLogProvider(ctx context.Context, getEnv Env, res *resource.Resource, c *ExporterConfig) (*sdklog.LoggerProvider, error) {
+	if getEnv("LOGS_OTLP", "true") == "false" {
+		return nil, nil
+	}
+	endpoint := getEnv("LOGS_OTLP_ENDPOINT", OTLPEndpoint(getEnv))
+	interval, err := time.ParseDuration(getEnv("LOGS_OTLP_INTERVAL", defaultLogsExportInterval.String()))
+	if err != nil || interval <= 0 {
+		interval = defaultLogsExportInterval
+	}
+
+	exporter, err := c.logExporter(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP log exporter: %w", err)
+	}
+	return sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter, sdklog.WithExportInterval(interval))),
+	), nil
+}
+
+// otelLogWriter turns every line of the standard logger into a log record, so
+// the existing log.Printf calls are exported without touching them. It is
+// used next to stderr, never instead of it.
+type otelLogWriter struct {
+	logger otellog.Logger
+}
+
+func (w *otelLogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	timestamp := time.Now()
+	if len(line) > len(stdLogTimeLayout) {
+		if parsed, err := time.ParseInLocation(stdLogTimeLayout, line[:len(stdLogTimeLayout)], time.Local); err == nil {
+			timestamp, line = parsed, line[len(stdLogTimeLayout)+1:]
+		}
+	}
+
+	var record otellog.Record
+	record.SetTimestamp(timestamp)
+	record.SetObservedTimestamp(time.Now())
+	severity, severityText := logSeverity(line)
+	record.SetSeverity(severity)
+	record.SetSeverityText(severityText)
+	record.SetBody(otellog.StringValue(line))
+	w.logger.Emit(context.Background(), record)
+	return len(p), nil
+}
+
+// logSeverity guesses a line's severity from the repo's logging habits:
+// warnings start with ⚠️ and errors say what failed.
+func logSeverity(line string) (otellog.Severity, string) {
+	switch {
+	case strings.HasPrefix(line, "⚠️"):
+		return otellog.SeverityWarn, "WARN"
+	case strings.Contains(line, "Failed") || strings.Contains(line, "failed"):
+		return otellog.SeverityError, "ERROR"
+	}
+	return otellog.SeverityInfo, "INFO"
+}
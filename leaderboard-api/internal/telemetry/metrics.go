@@ -0,0 +1,85 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+const defaultMetricsPushInterval = 15 * time.Second
+
+// PrometheusEnabled reports whether metrics are served for scraping on
+// /metrics. Environments with only an OTel collector turn it off with
+// METRICS_PROMETHEUS_ENABLED=false and push instead.
+func PrometheusEnabled(getEnv Env) bool {
+	return getEnv("METRICS_PROMETHEUS_ENABLED", "true") != "false"
+}
+
+// MetricsExport names where metrics go, for the startup report.
+func MetricsExport(getEnv Env) string {
+	var targets []string
+	if PrometheusEnabled(getEnv) {
+		targets = append(targets, "prometheus")
+	}
+	if getEnv("METRICS_OTLP_ENDPOINT", "") != "" {
+		targets = append(targets, "otlp")
+	}
+	return strings.Join(targets, ",")
+}
+
+// newOTLPMetricReader returns a reader that pushes metrics to an OTLP
+// collector such as Grafana Alloy, alongside or instead of the Prometheus
+// endpoint. It returns nil when METRICS_OTLP_ENDPOINT is unset.
+func newOTLPMetricReader(ctx context.Context, getEnv Env, c *ExporterConfig) (sdkmetric.Reader, error) {
+	endpoint := getEnv("METRICS_OTLP_ENDPOINT", "")
+	if endpoint == "" {
+		return nil, nil
+	}
+
+	selector, err := temporalitySelector(getEnv("METRICS_OTLP_TEMPORALITY", "cumulative"))
+	if err != nil {
+		return nil, err
+	}
+	interval, err := time.ParseDuration(getEnv("METRICS_OTLP_INTERVAL", defaultMetricsPushInterval.String()))
+	if err != nil || interval <= 0 {
+		interval = defaultMetricsPushInterval
+	}
+
+	exporter, err := c.metricExporter(ctx, endpoint, selector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP metric exporter: %w", err)
+	}
+	return sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(interval)), nil
+}
+
+// temporalitySelector maps the OTel temporality preferences onto instrument
+// kinds: "delta" reports counters and histograms as deltas, "lowmemory" does so
+// only for synchronous ones, and up-down counters are always cumulative.
+func temporalitySelector(preference string) (sdkmetric.TemporalitySelector, error) {
+	switch preference {
+	case "cumulative":
+		return sdkmetric.DefaultTemporalitySelector, nil
+	case "delta":
+		return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+			switch kind {
+			case sdkmetric.InstrumentKindCounter, sdkmetric.InstrumentKindObservableCounter,
+				sdkmetric.InstrumentKindHistogram:
+				return metricdata.DeltaTemporality
+			}
+			return metricdata.CumulativeTemporality
+		}, nil
+	case "lowmemory":
+		return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+			switch kind {
+			case sdkmetric.InstrumentKindCounter, sdkmetric.InstrumentKindHistogram:
+				return metricdata.DeltaTemporality
+			}
+			return metricdata.CumulativeTemporality
+		}, nil
+	}
+	return nil, fmt.Errorf(`METRICS_OTLP_TEMPORALITY must be "cumulative", "delta" or "lowmemory"`)
+}
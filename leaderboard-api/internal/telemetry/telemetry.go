@@ -0,0 +1,134 @@
+// Package telemetry sets up the OpenTelemetry providers: traces and logs to
+// an OTLP endpoint, metrics for Prometheus to scrape and optionally pushed
+// over OTLP. The instruments themselves are created by their callers.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// Env reads a setting, returning fallback when it is unset.
+type Env func(key, fallback string) string
+
+// Config names the service the providers report as, and where settings such
+// as OTEL_EXPORTER_OTLP_ENDPOINT and METRIC_VIEWS are read from.
+type Config struct {
+	ServiceName    string
+	ServiceVersion string
+	Env            Env
+}
+
+// Setup installs the global tracer, meter and logger providers, returning a
+// function that flushes and shuts them down.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	getEnv := cfg.Env
+
+	// Create resource
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceName(cfg.ServiceName),
+			semconv.ServiceVersion(cfg.ServiceVersion),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	// Setup trace exporter to Tempo via OTLP, or to a managed backend
+	exportConfig, err := NewExporterConfig(getEnv)
+	if err != nil {
+		return nil, err
+	}
+	traceExporter, err := exportConfig.traceExporter(ctx, OTLPEndpoint(getEnv))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	// Setup trace provider
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	// Operator-defined views drop or rename high-cardinality attributes and
+	// set histogram buckets; latency histograms have buckets of their own
+	views, err := parseMetricViews(getEnv("METRIC_VIEWS", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	metricOptions := []sdkmetric.Option{
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(withDefaultBuckets(views)...),
+	}
+
+	// Serve metrics for scraping unless only a collector is available
+	if PrometheusEnabled(getEnv) {
+		metricExporter, err := prometheus.New()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Prometheus exporter: %w", err)
+		}
+		metricOptions = append(metricOptions, sdkmetric.WithReader(metricExporter))
+	}
+
+	// Optionally push metrics over OTLP, for pipelines that don't scrape
+	pushReader, err := newOTLPMetricReader(ctx, getEnv, exportConfig)
+	if err != nil {
+		return nil, err
+	}
+	if pushReader != nil {
+		metricOptions = append(metricOptions, sdkmetric.WithReader(pushReader))
+		log.Printf("✅ Pushing metrics over OTLP to %s", getEnv("METRICS_OTLP_ENDPOINT", ""))
+	} else if !PrometheusEnabled(getEnv) {
+		return nil, fmt.Errorf("METRICS_PROMETHEUS_ENABLED=false needs METRICS_OTLP_ENDPOINT, or metrics go nowhere")
+	}
+
+	// Setup metric provider
+	mp := sdkmetric.NewMeterProvider(metricOptions...)
+	otel.SetMeterProvider(mp)
+
+	// Export logs through the same pipeline, keeping stderr as it was
+	lp, err := newOTLPLogProvider(ctx, getEnv, res, exportConfig)
+	if err != nil {
+		return nil, err
+	}
+	if lp != nil {
+		global.SetLoggerProvider(lp)
+		log.SetOutput(io.MultiWriter(os.Stderr, &otelLogWriter{logger: lp.Logger(cfg.ServiceName)}))
+	}
+
+	log.Println("✅ OpenTelemetry initialized")
+
+	return func(ctx context.Context) error {
+		if err := tp.Shutdown(ctx); err != nil {
+			return err
+		}
+		if err := mp.Shutdown(ctx); err != nil {
+			return err
+		}
+		if lp != nil {
+			// Last, so it flushes whatever the other signals logged on the way out
+			log.SetOutput(os.Stderr)
+			if err := lp.Shutdown(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,131 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// MetricViewRule reshapes the metrics of matching instruments. Instrument is an
+// OTel instrument name (e.g. "http.server.request.duration") and may use * and
+// ? wildcards. Drop removes the listed attributes; Keep removes all others.
+// Rename gives a single instrument a new name. Buckets sets a histogram's
+// bucket boundaries.
+type MetricViewRule struct {
+	Instrument string    `json:"instrument"`
+	Drop       []string  `json:"drop,omitempty"`
+	Keep       []string  `json:"keep,omitempty"`
+	Rename     string    `json:"rename,omitempty"`
+	Buckets    []float64 `json:"buckets,omitempty"`
+}
+
+// defaultHistogramBuckets replaces the SDK's default boundaries, which are
+// too coarse below 5ms and too fine above 1s for our latencies. Redis
+// operations take well under a millisecond, queries a few milliseconds, and
+// requests are judged against the 300ms SLO threshold.
+var defaultHistogramBuckets = map[string][]float64{
+	"redis.operation.duration.seconds":        {0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1},
+	"db.query.duration.seconds":               {0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	"http.server.request.duration.seconds":    {0.005, 0.01, 0.025, 0.05, 0.1, 0.2, 0.3, 0.5, 1, 2.5, 5, 10},
+	"score.validation.duration.seconds":       {0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25},
+	"submission.stage.duration.seconds":       {0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1},
+	"score.submission.phase.duration.seconds": {0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.3, 1},
+}
+
+// parseMetricViews builds SDK views from a JSON array of rules. When several
+// rules match an instrument, each produces its own stream.
+func parseMetricViews(raw string) ([]sdkmetric.View, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var rules []MetricViewRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("invalid METRIC_VIEWS: %w", err)
+	}
+
+	views := make([]sdkmetric.View, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Instrument == "" {
+			return nil, fmt.Errorf("metric view %d: instrument is required", i)
+		}
+		if len(rule.Drop) > 0 && len(rule.Keep) > 0 {
+			return nil, fmt.Errorf("metric view %d: use either drop or keep, not both", i)
+		}
+		if rule.Rename != "" && strings.ContainsAny(rule.Instrument, "*?") {
+			return nil, fmt.Errorf("metric view %d: rename needs an exact instrument name", i)
+		}
+		for j := 1; j < len(rule.Buckets); j++ {
+			if rule.Buckets[j] <= rule.Buckets[j-1] {
+				return nil, fmt.Errorf("metric view %d: buckets must be in increasing order", i)
+			}
+		}
+
+		stream := sdkmetric.Stream{Name: rule.Rename}
+		if len(rule.Buckets) > 0 {
+			stream.Aggregation = sdkmetric.AggregationExplicitBucketHistogram{Boundaries: rule.Buckets}
+		}
+		switch {
+		case len(rule.Drop) > 0:
+			stream.AttributeFilter = attribute.NewDenyKeysFilter(attributeKeys(rule.Drop)...)
+		case len(rule.Keep) > 0:
+			stream.AttributeFilter = attribute.NewAllowKeysFilter(attributeKeys(rule.Keep)...)
+		}
+		views = append(views, sdkmetric.NewView(sdkmetric.Instrument{Name: rule.Instrument}, stream))
+	}
+	return views, nil
+}
+
+// withDefaultBuckets gives the histograms in defaultHistogramBuckets their
+// boundaries, whether or not a rule matches them. Rules that set buckets win.
+func withDefaultBuckets(views []sdkmetric.View) []sdkmetric.View {
+	bucketed := make([]sdkmetric.View, 0, len(views)+1)
+	for _, view := range views {
+		view := view
+		bucketed = append(bucketed, func(inst sdkmetric.Instrument) (sdkmetric.Stream, bool) {
+			stream, ok := view(inst)
+			if buckets, found := defaultHistogramBuckets[inst.Name]; ok && found && stream.Aggregation == nil {
+				stream.Aggregation = sdkmetric.AggregationExplicitBucketHistogram{Boundaries: buckets}
+			}
+			return stream, ok
+		})
+	}
+
+	// Instruments no rule matches get a view of their own; one per rule would
+	// export them twice
+	bucketed = append(bucketed, func(inst sdkmetric.Instrument) (sdkmetric.Stream, bool) {
+		buckets, found := defaultHistogramBuckets[inst.Name]
+		if !found {
+			return sdkmetric.Stream{}, false
+		}
+		for _, view := range views {
+			if _, ok := view(inst); ok {
+				return sdkmetric.Stream{}, false
+			}
+		}
+		return sdkmetric.Stream{
+			Name:        inst.Name,
+			Description: inst.Description,
+			Unit:        inst.Unit,
+			Aggregation: sdkmetric.AggregationExplicitBucketHistogram{Boundaries: buckets},
+		}, true
+	})
+	return bucketed
+}
+
+func attributeKeys(names []string) []attribute.Key {
+	keys := make([]attribute.Key, len(names))
+	for i, name := range names {
+		keys[i] = attribute.Key(name)
+	}
+	return keys
+}
+
+// StatusClass groups an HTTP status code into "2xx", "4xx" and so on, so the
+// exact code can be dropped without losing errors.
+func StatusClass(code int) string {
+	return fmt.Sprintf("%dxx", code/100)
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultTopScoresLimit = handlers.DefaultTopScoresLimit
+
+	// Player stats and rank counts are cached under the player stats
+	// generation, so a bulk change drops them all by bumping it
+	cacheKeyPlayerStats           = "leaderboard:player:%s:%s:stats"
+	cacheKeyRank                  = "leaderboard:rank:%s:%d:%d"
+	cacheKeyPlayerStatsGeneration = "leaderboard:player:generation"
+)
+
+// LeaderboardEntry is one score on a board, as the store reads it.
+type LeaderboardEntry = store.LeaderboardEntry
+
+// PlayerStats is a player's stats as the player stats endpoint serves them.
+type PlayerStats = handlers.PlayerStats
+
+// leaderboardHandlers returns the top scores and player stats endpoints over
+// the API's board.
+func (app *App) leaderboardHandlers() *handlers.Leaderboard {
+	return &handlers.Leaderboard{Board: appBoard{app}, Edge: appEdgeCache{app}}
+}
+
+// appBoard serves the board through the caches, ranking and retention, with
+// the names masked by the current policy.
+type appBoard struct {
+	app *App
+}
+
+func (b appBoard) Tags(tags []string) ([]string, error) {
+	return normalizeTags(tags)
+}
+
+func (b appBoard) TopScores(ctx context.Context, limit int, tags []string) ([]LeaderboardEntry, error) {
+	leaderboard, err := b.app.topScores(ctx, limit, tags)
+	if err != nil {
+		return nil, err
+	}
+	b.app.annotateExpiry(ctx, leaderboard)
+	return maskEntries(b.app.nameMask(), leaderboard), nil
+}
+
+func (b appBoard) ServeTopScoresPage(ctx context.Context, w http.ResponseWriter, r *http.Request, tags []string) {
+	b.app.serveTopScoresPage(ctx, w, r, tags)
+}
+
+func (b appBoard) StreamTopScores(ctx context.Context, w http.ResponseWriter, limit int, tags []string) {
+	b.app.streamTopScores(ctx, w, limit, tags)
+}
+
+func (b appBoard) PlayerStats(ctx context.Context, playerName string) (*PlayerStats, error) {
+	stats, err := b.app.playerStats(ctx, playerName)
+	if err != nil {
+		return nil, err
+	}
+	mask := b.app.nameMask()
+	stats.PlayerName = mask(stats.PlayerName)
+	stats.RecentScores = maskEntries(mask, stats.RecentScores)
+	return stats, nil
+}
+
+// appEdgeCache caches the board for the configured TTLs, behind the CDN
+// when purging is enabled.
+type appEdgeCache struct {
+	app *App
+}
+
+func (e appEdgeCache) SetHeaders(w http.ResponseWriter, keys ...string) {
+	e.app.setEdgeCacheHeaders(w, keys...)
+}
+
+func (e appEdgeCache) BoardTTL() time.Duration       { return e.app.cfg().CacheTTL }
+func (e appEdgeCache) PlayerStatsTTL() time.Duration { return e.app.cfg().CacheTTLs.PlayerStats }
+
+// topScores returns the top limit scores carrying every tag, from the Redis
+// cache when possible. Boards are cached cachedTopScoresLimit deep whatever
+// the limit, so every limit reads the same cached board.
+func (app *App) topScores(ctx context.Context, limit int, tags []string) ([]LeaderboardEntry, error) {
+	span := trace.SpanFromContext(ctx)
+	cacheKey := topScoresCacheKey(tags)
+
+	// Demo scenarios show the uncached path, and leave the cache alone; longer
+	// boards than the cached one are read in full
+	if demoScenario(ctx, demoNoCache) || demoScenario(ctx, demoSlowQuery) || limit > cachedTopScoresLimit {
+		span.SetAttributes(attribute.Bool("cache.hit", false))
+		return app.queryTopScores(ctx, limit, tags)
+	}
+
+	// Try cache first
+	var leaderboard []LeaderboardEntry
+	cachedData, err := app.cache.Get(ctx, cacheKey)
+	if err == nil {
+		cacheHitTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "top_scores")))
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+
+		if err := json.Unmarshal(cachedData, &leaderboard); err == nil {
+			if app.staleWhileRevalidate() {
+				app.revalidateTopScores(ctx, cacheKey, tags)
+			}
+			return truncateEntries(leaderboard, limit), nil
+		}
+	}
+
+	cacheMissTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "top_scores")))
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+
+	// Cache miss - query database, once for every request that missed
+	data, err := coalesce(ctx, app, "top_scores", cacheKey, func(ctx context.Context) ([]byte, error) {
+		return app.cacheTopScores(ctx, cacheKey, tags)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &leaderboard); err != nil {
+		return nil, err
+	}
+	return truncateEntries(leaderboard, limit), nil
+}
+
+// truncateEntries returns the first limit entries of leaderboard.
+func truncateEntries(leaderboard []LeaderboardEntry, limit int) []LeaderboardEntry {
+	if len(leaderboard) > limit {
+		return leaderboard[:limit]
+	}
+	return leaderboard
+}
+
+// queryTopScores reads the top limit scores carrying every tag from the database.
+func (app *App) queryTopScores(ctx context.Context, limit int, tags []string) ([]LeaderboardEntry, error) {
+	if demoScenario(ctx, demoSlowQuery) {
+		return app.slowTopScores(ctx, limit, tags)
+	}
+
+	// The unfiltered board comes from the materialized view when it's enabled
+	if !app.readOnly() && app.topView.serves(ctx, limit, tags) {
+		leaderboard, err := app.viewTopScores(ctx, limit)
+		if err == nil {
+			return leaderboard, nil
+		}
+		log.Printf("Failed to read top_scores_view, falling back: %v", err)
+	}
+
+	// The unfiltered board is ordered by the ranking sorted set when it is ready
+	if len(tags) == 0 && app.rankEngineFor(ctx) == rankEngineZSet {
+		if leaderboard, err := app.rankedTopScores(ctx, limit); err == nil {
+			app.compareTop(ctx, limit, leaderboard)
+			return leaderboard, nil
+		} else if !errors.Is(err, errRankingUnavailable) {
+			log.Printf("Failed to read ranking, falling back to database: %v", err)
+		}
+	}
+
+	leaderboard, err := app.store.TopScores(ctx, limit, tags)
+	if err == nil && len(tags) == 0 && app.rankEngine == rankEnginePostgres {
+		app.compareTop(ctx, limit, leaderboard)
+	}
+	return leaderboard, err
+}
+
+// serveFilteredTopScores writes the board filtered on column = value, with
+// the usual ?limit (default 100, max 1000).
+func (app *App) serveFilteredTopScores(ctx context.Context, w http.ResponseWriter, r *http.Request, column, value string) {
+	span := trace.SpanFromContext(ctx)
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 || parsed > maxJSONLeaderboardLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxJSONLeaderboardLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	span.SetAttributes(attribute.Int("query.limit", limit))
+
+	leaderboard, err := app.filteredTopScores(ctx, column, value, limit)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch leaderboard", http.StatusInternalServerError)
+		return
+	}
+	app.annotateExpiry(ctx, leaderboard)
+
+	app.setEdgeCacheHeaders(w, surrogateKeyLeaderboard)
+	handlers.EncodeCacheableJSON(w, r, maskEntries(app.nameMask(), leaderboard), app.cfg().CacheTTLs.FilteredBoards)
+}
+
+// filteredTopScores returns the current season's top limit scores whose column
+// holds value, such as a biome board. column is a key of
+// store.FilteredTopQueries, never user input.
+func (app *App) filteredTopScores(ctx context.Context, column, value string, limit int) ([]LeaderboardEntry, error) {
+	cacheKey := fmt.Sprintf(cacheKeyFilteredTopScores, column, value, limit)
+	leaderboard := []LeaderboardEntry{}
+	if cached, err := app.cache.Get(ctx, cacheKey); err == nil {
+		if err := json.Unmarshal(cached, &leaderboard); err == nil {
+			cacheHitTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", column+"_top_scores")))
+			return leaderboard, nil
+		}
+	}
+	cacheMissTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", column+"_top_scores")))
+
+	data, err := coalesce(ctx, app, column+"_top_scores", cacheKey, func(ctx context.Context) ([]byte, error) {
+		rows, err := store.FilteredTopQueries[column].Query(ctx, app.db, limit, value)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		entries, err := store.ScanEntries(rows)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(append(leaderboard, entries...))
+		if err != nil {
+			return nil, err
+		}
+		app.cache.Set(ctx, cacheKey, data, app.cfg().CacheTTLs.FilteredBoards)
+		app.cache.SAdd(ctx, cacheKeyTaggedTopKeys, cacheKey)
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &leaderboard); err != nil {
+		return nil, err
+	}
+	return leaderboard, nil
+}
+
+// playerStats returns a player's stats, cached for CacheTTLs.PlayerStats when
+// it is set. The player's own changes drop the cache; their rank may trail
+// other players' scores by up to the TTL.
+func (app *App) playerStats(ctx context.Context, playerName string) (*PlayerStats, error) {
+	ttl := app.cfg().CacheTTLs.PlayerStats
+	if ttl <= 0 {
+		return app.queryPlayerStats(ctx, playerName)
+	}
+
+	cacheKey := fmt.Sprintf(cacheKeyPlayerStats, app.playerStatsGeneration(ctx), playerName)
+	if cached, err := app.cache.Get(ctx, cacheKey); err == nil {
+		var stats PlayerStats
+		if err := json.Unmarshal(cached, &stats); err == nil {
+			cacheHitTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "player_stats")))
+			return &stats, nil
+		}
+	}
+	cacheMissTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "player_stats")))
+
+	stats, err := app.queryPlayerStats(ctx, playerName)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(stats); err == nil {
+		app.cache.Set(ctx, cacheKey, data, ttl)
+	}
+	return stats, nil
+}
+
+// dropCachedPlayerStats drops the cached stats of players whose scores
+// changed. Without names, as after a rollover, restore or bulk moderation,
+// every player's stats and the cached rank counts are dropped.
+func (app *App) dropCachedPlayerStats(ctx context.Context, playerNames ...string) {
+	if len(playerNames) == 0 {
+		generation := strconv.FormatInt(time.Now().UnixNano(), 10)
+		if err := app.cache.Set(ctx, cacheKeyPlayerStatsGeneration, []byte(generation), 0); err != nil {
+			log.Printf("Failed to invalidate player stats: %v", err)
+		}
+		return
+	}
+	generation := app.playerStatsGeneration(ctx)
+	keys := make([]string, len(playerNames))
+	for i, name := range playerNames {
+		keys[i] = fmt.Sprintf(cacheKeyPlayerStats, generation, name)
+	}
+	if err := app.cache.Del(ctx, keys...); err != nil {
+		log.Printf("Failed to invalidate player stats: %v", err)
+	}
+}
+
+// playerStatsGeneration is the generation cached player stats and rank
+// counts are keyed under, "0" until the first bulk change.
+func (app *App) playerStatsGeneration(ctx context.Context) string {
+	if generation, err := app.cache.Get(ctx, cacheKeyPlayerStatsGeneration); err == nil {
+		return string(generation)
+	}
+	return "0"
+}
+
+// queryPlayerStats reads a player's stats from the store, ranked on the
+// current ranking engine, with when retention will prune their runs.
+func (app *App) queryPlayerStats(ctx context.Context, playerName string) (*PlayerStats, error) {
+	stored, err := app.store.PlayerStats(ctx, playerName)
+	if err != nil {
+		return nil, err
+	}
+	stats := &PlayerStats{
+		PlayerName:    stored.PlayerName,
+		BestScore:     stored.BestScore,
+		SeasonBest:    stored.SeasonBest,
+		TotalGames:    stored.TotalGames,
+		RecentScores:  stored.RecentScores,
+		FurthestBiome: stored.FurthestBiome,
+	}
+	stats.CurrentRank, _ = app.calculateRank(ctx, stats.SeasonBest)
+	app.annotateExpiry(ctx, stats.RecentScores)
+	if stats.Retention, err = app.retentionNotice(ctx, playerName); err != nil {
+		log.Printf("Failed to project retention for %s: %v", playerName, err)
+	}
+	if stats.DaysAtNumberOne, err = app.playerDaysAtNumberOne(ctx, playerName); err != nil {
+		log.Printf("Failed to total reigns for %s: %v", playerName, err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+)
+
+// seedScores stores scores straight into the memory store, bypassing the
+// submission pipeline.
+func seedScores(t *testing.T, scores *store.Memory, seeds ...store.Score) {
+	t.Helper()
+	for i := range seeds {
+		if _, _, err := scores.InsertScore(context.Background(), &seeds[i]); err != nil {
+			t.Fatalf("InsertScore: %v", err)
+		}
+	}
+}
+
+func TestGetTopScores(t *testing.T) {
+	app, scores := newTestApp(t)
+	seedScores(t, scores,
+		store.Score{PlayerName: "Paul", Score: 300, SessionID: "s1"},
+		store.Score{PlayerName: "Chani", Score: 900, SessionID: "s2"},
+		store.Score{PlayerName: "Stilgar", Score: 600, SessionID: "s3"},
+	)
+
+	var leaderboard []LeaderboardEntry
+	rec := doJSON(t, testRouter(app), http.MethodGet, "/spice/leaderboard/api/leaderboard/top?limit=2", nil, &leaderboard)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if len(leaderboard) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(leaderboard), leaderboard)
+	}
+	for i, want := range []struct {
+		name  string
+		score int
+	}{{"Chani", 900}, {"Stilgar", 600}} {
+		got := leaderboard[i]
+		if got.Rank != i+1 || got.PlayerName != want.name || got.Score != want.score {
+			t.Errorf("entry %d = %+v, want %s with %d at rank %d", i, got, want.name, want.score, i+1)
+		}
+	}
+}
+
+func TestGetTopScoresCachesEveryLimit(t *testing.T) {
+	app, scores := newTestApp(t)
+	seedScores(t, scores,
+		store.Score{PlayerName: "Paul", Score: 300, SessionID: "s1"},
+		store.Score{PlayerName: "Chani", Score: 900, SessionID: "s2"},
+		store.Score{PlayerName: "Stilgar", Score: 600, SessionID: "s3"},
+	)
+	router := testRouter(app)
+
+	// The first request fills the cache; later ones, longer or shorter, read it
+	for _, limit := range []int{1, 3, 2} {
+		var leaderboard []LeaderboardEntry
+		doJSON(t, router, http.MethodGet, fmt.Sprintf("/spice/leaderboard/api/leaderboard/top?limit=%d", limit), nil, &leaderboard)
+		if len(leaderboard) != limit {
+			t.Errorf("limit %d: got %d entries: %+v", limit, len(leaderboard), leaderboard)
+		}
+	}
+}
+
+func TestGetPlayerStats(t *testing.T) {
+	app, scores := newTestApp(t)
+	seedScores(t, scores,
+		store.Score{PlayerName: "Chani", Score: 900, SessionID: "s1"},
+		store.Score{PlayerName: "Paul", Score: 300, SessionID: "s2"},
+		store.Score{PlayerName: "Paul", Score: 500, SessionID: "s3", Biome: "deep-desert"},
+	)
+
+	var stats PlayerStats
+	rec := doJSON(t, testRouter(app), http.MethodGet, "/spice/leaderboard/api/leaderboard/player/Paul", nil, &stats)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if stats.PlayerName != "Paul" || stats.BestScore != 500 || stats.TotalGames != 2 {
+		t.Errorf("stats = %+v, want Paul's best 500 over 2 games", stats)
+	}
+	if stats.CurrentRank != 2 {
+		t.Errorf("rank = %d, want 2", stats.CurrentRank)
+	}
+	if stats.FurthestBiome != "deep-desert" {
+		t.Errorf("furthest biome = %q, want deep-desert", stats.FurthestBiome)
+	}
+	if len(stats.RecentScores) != 2 || stats.RecentScores[0].Score != 500 {
+		t.Errorf("recent scores = %+v, want 500 then 300", stats.RecentScores)
+	}
+}
+
+func TestQuarantinedScoresAreHidden(t *testing.T) {
+	app, scores := newTestApp(t)
+	seedScores(t, scores,
+		store.Score{PlayerName: "Paul", Score: 400, SessionID: "s1"},
+		store.Score{PlayerName: "Feyd", Score: 9000, SessionID: "s2", QuarantineReason: "shadow_ban"},
+		store.Score{PlayerName: "Paul", Score: 8000, SessionID: "s3", QuarantineReason: quarantineVerifiedReview},
+	)
+	router := testRouter(app)
+
+	var leaderboard []LeaderboardEntry
+	doJSON(t, router, http.MethodGet, "/spice/leaderboard/api/leaderboard/top", nil, &leaderboard)
+	if len(leaderboard) != 1 || leaderboard[0].PlayerName != "Paul" || leaderboard[0].Score != 400 {
+		t.Errorf("leaderboard = %+v, want only Paul's 400", leaderboard)
+	}
+
+	var stats PlayerStats
+	doJSON(t, router, http.MethodGet, "/spice/leaderboard/api/leaderboard/player/Paul", nil, &stats)
+	if stats.BestScore != 400 || stats.CurrentRank != 1 {
+		t.Errorf("stats = %+v, want best 400 at rank 1", stats)
+	}
+	if stats.TotalGames != 2 {
+		t.Errorf("total games = %d, want the held score counted too", stats.TotalGames)
+	}
+}
+
+func TestBulkChangeDropsCachedPlayerStats(t *testing.T) {
+	app, scores := newTestApp(t)
+	cfg := *app.cfg()
+	cfg.CacheTTLs.PlayerStats = time.Minute
+	app.config.Store(&cfg)
+	seedScores(t, scores, store.Score{PlayerName: "Paul", Score: 300, SessionID: "s1"})
+	router := testRouter(app)
+
+	var stats PlayerStats
+	doJSON(t, router, http.MethodGet, "/spice/leaderboard/api/leaderboard/player/Paul", nil, &stats)
+
+	// A change made without naming the players, like a restore
+	seedScores(t, scores, store.Score{PlayerName: "Paul", Score: 700, SessionID: "s2"})
+	doJSON(t, router, http.MethodGet, "/spice/leaderboard/api/leaderboard/player/Paul", nil, &stats)
+	if stats.BestScore != 300 {
+		t.Fatalf("best = %d before the drop, want the cached 300", stats.BestScore)
+	}
+	app.dropCachedPlayerStats(context.Background())
+	doJSON(t, router, http.MethodGet, "/spice/leaderboard/api/leaderboard/player/Paul", nil, &stats)
+	if stats.BestScore != 700 || stats.TotalGames != 2 {
+		t.Errorf("stats = %+v, want best 700 over 2 games", stats)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	defaultShutdownDelay = 10 * time.Second
+
+	// How often drain progress is logged while requests are in flight
+	drainReportInterval = time.Second
+)
+
+// lifecycle coordinates a Kubernetes rolling update: the pod reports not-ready
+// first, then keeps serving for the shutdown delay while endpoints and load
+// balancers stop routing to it, and only then stops the HTTP server.
+type lifecycle struct {
+	delay    time.Duration
+	draining atomic.Bool
+	once     sync.Once
+	server   *http.Server
+
+	// inFlight counts HTTP requests being served, across routes
+	inFlight atomic.Int64
+	// drainStarted is when draining began, in Unix nanoseconds
+	drainStarted atomic.Int64
+	// stopped is set once the HTTP server has shut down
+	stopped atomic.Bool
+
+	// warmed and migrated gate /readyz alongside the dependency checks
+	warmed   atomic.Bool
+	migrated atomic.Bool
+}
+
+func newLifecycle(delay time.Duration) *lifecycle {
+	return &lifecycle{delay: delay}
+}
+
+// drain marks the pod not-ready. It returns true only for the first caller, which
+// is responsible for waiting out the delay.
+func (l *lifecycle) drain(reason string) bool {
+	first := false
+	l.once.Do(func() {
+		first = true
+		l.drainStarted.Store(time.Now().UnixNano())
+		l.draining.Store(true)
+		if l.server != nil {
+			// Stop reusing connections so clients reconnect to other pods
+			l.server.SetKeepAlivesEnabled(false)
+		}
+		log.Printf("🛑 Draining (%s), waiting %v before shutdown", reason, l.delay)
+		go l.reportDrain()
+	})
+	return first
+}
+
+// drainElapsed is how long the pod has been draining, or zero if it isn't.
+func (l *lifecycle) drainElapsed() time.Duration {
+	started := l.drainStarted.Load()
+	if started == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, started))
+}
+
+// reportDrain logs the requests still in flight whenever the number changes,
+// until the server has stopped and the last one finished.
+func (l *lifecycle) reportDrain() {
+	ticker := time.NewTicker(drainReportInterval)
+	defer ticker.Stop()
+	last := int64(-1)
+	for range ticker.C {
+		n := l.inFlight.Load()
+		if n != last {
+			log.Printf("⏳ Draining for %v: %d requests in flight", l.drainElapsed().Round(time.Second), n)
+			last = n
+		}
+		if n == 0 && l.stopped.Load() {
+			return
+		}
+	}
+}
+
+// inFlightMiddleware counts requests while they are served, in total for
+// drain progress and per route for the http.server.active_requests metric.
+func (l *lifecycle) inFlightMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The route template keeps the metric's cardinality bounded
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		attrs := metric.WithAttributes(
+			attribute.String("http.method", r.Method),
+			attribute.String("http.route", route),
+		)
+
+		l.inFlight.Add(1)
+		httpServerActiveRequests.Add(r.Context(), 1, attrs)
+		defer func() {
+			httpServerActiveRequests.Add(context.Background(), -1, attrs)
+			l.inFlight.Add(-1)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// registerMetrics reports whether the pod is draining and for how long.
+func (l *lifecycle) registerMetrics() error {
+	draining, err := meter.Int64ObservableGauge("lifecycle.draining",
+		metric.WithDescription("1 while the pod is draining for shutdown"))
+	if err != nil {
+		return err
+	}
+	elapsed, err := meter.Float64ObservableGauge("lifecycle.drain.elapsed",
+		metric.WithDescription("Time since the pod started draining"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return err
+	}
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		var value int64
+		if l.draining.Load() {
+			value = 1
+		}
+		o.ObserveInt64(draining, value)
+		o.ObserveFloat64(elapsed, l.drainElapsed().Seconds())
+		return nil
+	}, draining, elapsed)
+	return err
+}
+
+// loopbackOnly answers 404 to requests that didn't come from inside the pod,
+// for endpoints such as the preStop hook that share the public port when
+// there's no internal listener.
+func loopbackOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// preStopHandler is called by the pod's preStop hook. It marks the pod not-ready
+// and blocks for the shutdown delay, so SIGTERM arrives after traffic has moved.
+func (app *App) preStopHandler(w http.ResponseWriter, r *http.Request) {
+	if app.lifecycle.drain("preStop") {
+		// The delay may outlast the server's write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(app.lifecycle.delay + 5*time.Second))
+		select {
+		case <-time.After(app.lifecycle.delay):
+		case <-r.Context().Done():
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoopbackOnly(t *testing.T) {
+	handler := loopbackOnly(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	for _, tc := range []struct {
+		remoteAddr string
+		want       int
+	}{
+		{"127.0.0.1:41234", http.StatusNoContent},
+		{"[::1]:41234", http.StatusNoContent},
+		{"10.0.3.7:41234", http.StatusNotFound},
+		{"203.0.113.9:41234", http.StatusNotFound},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/lifecycle/prestop", nil)
+		req.RemoteAddr = tc.remoteAddr
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.remoteAddr, rec.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/telemetry"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+)
+
+// listenerConfig says which surfaces leave the public port. Either port may
+// be empty, leaving that surface on PORT as before.
+type listenerConfig struct {
+	// adminPort serves /admin, with admin auth but none of the public
+	// middleware (CORS, API keys, SLO accounting, shadowing)
+	adminPort string
+	// internalPort serves /metrics and the kubelet's endpoints, for
+	// scrapers and probes inside the cluster
+	internalPort string
+}
+
+// newListenerConfigFromEnv reads ADMIN_PORT and INTERNAL_PORT, which must
+// differ from each other and from the API and gRPC ports.
+func newListenerConfigFromEnv(cfg *Config) (*listenerConfig, error) {
+	c := &listenerConfig{adminPort: getEnv("ADMIN_PORT", ""), internalPort: getEnv("INTERNAL_PORT", "")}
+	taken := map[string]string{cfg.Port: "PORT", cfg.GRPCPort: "GRPC_PORT"}
+	for _, listener := range []struct{ name, port string }{{"ADMIN_PORT", c.adminPort}, {"INTERNAL_PORT", c.internalPort}} {
+		if listener.port == "" {
+			continue
+		}
+		if other, ok := taken[listener.port]; ok {
+			return nil, fmt.Errorf("%s %s is already used by %s", listener.name, listener.port, other)
+		}
+		taken[listener.port] = listener.name
+	}
+	return c, nil
+}
+
+// newAdminRouter returns the root the /admin routes hang off, which is the
+// public router unless ADMIN_PORT is set, and the /admin subrouter.
+func (app *App) newAdminRouter(c *listenerConfig, public *mux.Router) (*mux.Router, *mux.Router) {
+	root := public
+	if c.adminPort != "" {
+		root = mux.NewRouter()
+		root.Use(otelmux.Middleware(serviceName))
+		root.Use(handlers.Metrics)
+		root.Use(app.lifecycle.inFlightMiddleware)
+	}
+	adminRouter := root.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(adminAuthMiddleware)
+	adminRouter.Use(adminAuditMiddleware)
+	return root, adminRouter
+}
+
+// newInternalRouter serves metrics and the kubelet's endpoints without
+// tracing, so scrapes and probes don't fill Tempo.
+func (app *App) newInternalRouter() *mux.Router {
+	router := mux.NewRouter()
+	health := app.healthProbes()
+	if telemetry.PrometheusEnabled(getEnv) {
+		router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	}
+	router.HandleFunc("/health", health.Health).Methods("GET")
+	router.HandleFunc("/ready", health.Readyz).Methods("GET")
+	router.HandleFunc("/livez", health.Livez).Methods("GET")
+	router.HandleFunc("/readyz", health.Readyz).Methods("GET")
+	router.HandleFunc("/probe/full", app.fullProbeHandler).Methods("GET")
+	router.HandleFunc("/lifecycle/prestop", app.preStopHandler).Methods("POST")
+	return router
+}
+
+// newListenerServer returns a server on port with the API's timeouts.
+func newListenerServer(port string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         ":" + port,
+		Handler:      handler,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/cache"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"github.com/redis/go-redis/v9"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// testPipelineStages are the anti-cheat stages that need neither Postgres nor
+// Redis.
+const testPipelineStages = "schema,identity,rate,plausibility"
+
+func TestMain(m *testing.M) {
+	tracer = tracenoop.NewTracerProvider().Tracer(serviceName)
+	meter = metricnoop.NewMeterProvider().Meter(serviceName)
+	if err := initMetrics(); err != nil {
+		panic(err)
+	}
+	// The unreachable Postgres and Redis fail loudly on every request
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestApp returns an App whose scores are kept in a store.Memory and whose
+// responses are cached in memory. Postgres and Redis point at a closed port,
+// so the side effects around a submission fail fast and are only logged, and
+// ranks fall back from the unreachable sorted set to the store.
+func newTestApp(t *testing.T) (*App, *store.Memory) {
+	t.Helper()
+
+	cfg := defaultConfig()
+	cfg.AntiCheat.PipelineStages = testPipelineStages
+
+	db, err := pgxpool.New(context.Background(), "postgres://test@127.0.0.1:1/test?connect_timeout=1")
+	if err != nil {
+		t.Fatalf("failed to configure pool: %v", err)
+	}
+	t.Cleanup(db.Close)
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	scores := store.NewMemory()
+	app := &App{
+		db:              db,
+		store:           scores,
+		players:         scores,
+		redis:           client,
+		cache:           cache.NewMemory(100),
+		changes:         newChangeFeed(),
+		rules:           newGameRules(cfg.builtinGameRule()),
+		lifecycle:       newLifecycle(cfg.ShutdownDelay),
+		scoreStream:     newScoreStream(),
+		tableStatsCache: &tableStatsCache{},
+		accounts:        &accountAuth{anonymous: true},
+		rankEngine:      rankEngineZSet,
+	}
+	app.config.Store(cfg)
+
+	pipeline, err := newSubmissionPipeline(app, strings.Split(testPipelineStages, ","))
+	if err != nil {
+		t.Fatalf("failed to build pipeline: %v", err)
+	}
+	app.pipeline = pipeline
+	return app, scores
+}
+
+// testRouter routes the endpoints under test as main does.
+func testRouter(app *App) http.Handler {
+	router := mux.NewRouter()
+	api := router.PathPrefix("/spice/leaderboard").Subrouter()
+	board := app.leaderboardHandlers()
+	api.HandleFunc("/api/scores", app.submitScoreHandler).Methods("POST")
+	api.HandleFunc("/api/leaderboard/top", board.TopScores).Methods("GET")
+	api.HandleFunc("/api/leaderboard/player/{name}", board.PlayerStats).Methods("GET")
+	return router
+}
+
+// doJSON sends body, encoded as JSON unless nil, and decodes the response
+// into out unless nil.
+func doJSON(t *testing.T, handler http.Handler, method, path string, body, out any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatalf("failed to encode request: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if out != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("failed to decode %s %s response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Name masking modes for PrivacyConfig.NameMasking
+const (
+	nameMaskingOff    = "off"
+	nameMaskingAll    = "all"
+	nameMaskingListed = "listed"
+
+	// maskedNameSuffix replaces all but a name's first letter. It has a fixed
+	// length so a masked name doesn't give away the real one's.
+	maskedNameSuffix = "***"
+)
+
+// PrivacyConfig controls how player names appear on public boards. A
+// deployment serving a region that requires it masks every name; otherwise
+// only listed players' names, such as minors', are masked. Masking happens as
+// responses and webhook events are written: caches, the events channel and the
+// database keep real names, and so do admin endpoints and a player's own
+// submission response.
+type PrivacyConfig struct {
+	// NameMasking is "off", "all" or "listed"
+	NameMasking string `yaml:"nameMasking" env:"NAME_MASKING"`
+	// MaskedPlayers lists the names masked under "listed", comma-separated
+	// and matched case-insensitively
+	MaskedPlayers string `yaml:"maskedPlayers" env:"NAME_MASKED_PLAYERS"`
+}
+
+func (p PrivacyConfig) validate() error {
+	switch p.NameMasking {
+	case nameMaskingOff, nameMaskingAll, nameMaskingListed:
+		return nil
+	}
+	return fmt.Errorf("privacy.nameMasking must be off, all or listed, got %q", p.NameMasking)
+}
+
+// masker returns the function that masks a name under p, built once per
+// response rather than per name.
+func (p PrivacyConfig) masker() func(string) string {
+	switch p.NameMasking {
+	case nameMaskingAll:
+		return maskName
+	case nameMaskingListed:
+		listed := map[string]bool{}
+		for _, name := range strings.Split(p.MaskedPlayers, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				listed[strings.ToLower(name)] = true
+			}
+		}
+		return func(name string) string {
+			if listed[strings.ToLower(name)] {
+				return maskName(name)
+			}
+			return name
+		}
+	}
+	return func(name string) string { return name }
+}
+
+// maskName keeps name's first letter, so "Paul" becomes "P***".
+func maskName(name string) string {
+	first, size := utf8.DecodeRuneInString(name)
+	if size == 0 || first == utf8.RuneError {
+		return maskedNameSuffix
+	}
+	return string(first) + maskedNameSuffix
+}
+
+// nameMask is the masker for the current configuration.
+func (app *App) nameMask() func(string) string {
+	return app.cfg().Privacy.masker()
+}
+
+// maskEntries returns a copy of entries with their names masked, leaving the
+// cached slice untouched.
+func maskEntries(mask func(string) string, entries []LeaderboardEntry) []LeaderboardEntry {
+	masked := make([]LeaderboardEntry, len(entries))
+	for i, entry := range entries {
+		entry.PlayerName = mask(entry.PlayerName)
+		masked[i] = entry
+	}
+	return masked
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestMaskEventMasksWebhookNames(t *testing.T) {
+	mask := PrivacyConfig{NameMasking: nameMaskingAll}.masker()
+
+	subject, data := maskEvent(mask, "Paul", ScoreAcceptedEvent{PlayerName: "Paul", Score: 1200})
+	if score := data.(ScoreAcceptedEvent); subject != "P***" || score.PlayerName != "P***" || score.Score != 1200 {
+		t.Errorf("score.accepted = %q %+v, want Paul masked", subject, score)
+	}
+
+	started := &ReignStartedEvent{PlayerName: "Paul", PreviousHolder: "Jessica"}
+	subject, data = maskEvent(mask, "Paul", started)
+	if reign := data.(*ReignStartedEvent); subject != "P***" || reign.PlayerName != "P***" || reign.PreviousHolder != "J***" {
+		t.Errorf("reign.started = %q %+v, want both holders masked", subject, reign)
+	}
+	if started.PlayerName != "Paul" {
+		t.Errorf("the channel's event was masked too: %+v", started)
+	}
+}
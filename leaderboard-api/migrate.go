@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Schema changes are numbered SQL files in migrations/, applied in order and
+// recorded in schema_migrations. A file must never change once released: add
+// a new one instead. Down files are optional; without one a migration can't
+// be rolled back.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock held while migrating, so replicas
+// starting together apply each migration once.
+const migrationLockID = 0x5350494345
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type migration struct {
+	version  int
+	name     string
+	up       string
+	down     string
+	checksum string
+}
+
+func (m migration) filename() string {
+	return fmt.Sprintf("%04d_%s", m.version, m.name)
+}
+
+// MigrationStatus is one migration as reported by `leaderboard-api migrate
+// status`.
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+	// Modified is set when the file differs from the one that was applied
+	Modified    bool `json:"modified,omitempty"`
+	Reversible  bool `json:"reversible"`
+	Unavailable bool `json:"unavailable,omitempty"`
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// loadMigrations reads the embedded migrations and those of the plugins in
+// this build, oldest first.
+func loadMigrations() ([]migration, error) {
+	byVersion := map[int]*migration{}
+	source := map[int]string{}
+	if err := readMigrations(migrationFiles, "migrations", "core", byVersion, source); err != nil {
+		return nil, err
+	}
+	for _, p := range plugins {
+		if mp, ok := p.(MigrationPlugin); ok {
+			if err := readMigrations(mp.Migrations(), ".", p.Name(), byVersion, source); err != nil {
+				return nil, fmt.Errorf("plugin %s: %w", p.Name(), err)
+			}
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %s has no up file", m.filename())
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// readMigrations adds the migration files in dir of fsys to byVersion. source
+// records who each version belongs to, so two sources can't share one.
+func readMigrations(fsys fs.FS, dir, name string, byVersion map[int]*migration, source map[int]string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return fmt.Errorf("unexpected migration file %q", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		sql, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		if owner, ok := source[version]; ok && owner != name {
+			return fmt.Errorf("migration %d belongs to both %s and %s", version, owner, name)
+		}
+		source[version] = name
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{version: version, name: match[2]}
+			byVersion[version] = m
+		}
+		if m.name != match[2] {
+			return fmt.Errorf("migration %d has two names, %q and %q", version, m.name, match[2])
+		}
+		if match[3] == "up" {
+			m.up = string(sql)
+			sum := sha256.Sum256(sql)
+			m.checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.down = string(sql)
+		}
+	}
+	return nil
+}
+
+// ensureMigrationsTable creates schema_migrations on first use.
+func ensureMigrationsTable(ctx context.Context, conn *pgxpool.Conn) error {
+	_, err := store.CreateMigrationsTableQuery.Exec(ctx, conn)
+	return err
+}
+
+func appliedMigrations(ctx context.Context, conn *pgxpool.Conn) (map[int]appliedMigration, error) {
+	rows, err := store.AppliedMigrationsQuery.Query(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var m appliedMigration
+		if err := rows.Scan(&version, &m.name, &m.checksum, &m.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = m
+	}
+	return applied, rows.Err()
+}
+
+// withMigrationLock runs fn on one connection holding the migration lock.
+func withMigrationLock(ctx context.Context, pool *pgxpool.Pool, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := store.LockMigrationsQuery.Exec(ctx, conn, migrationLockID); err != nil {
+		return err
+	}
+	defer store.UnlockMigrationsQuery.Exec(context.WithoutCancel(ctx), conn, migrationLockID)
+
+	if err := ensureMigrationsTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// migrateUp applies pending migrations up to and including target, or all of
+// them when target is 0, each in its own transaction. It returns how many it
+// applied.
+func migrateUp(ctx context.Context, pool *pgxpool.Pool, target int) (int, error) {
+	ctx, span := tracer.Start(ctx, "migrateUp")
+	defer span.End()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if target > 0 && m.version > target {
+				break
+			}
+			if done, ok := applied[m.version]; ok {
+				if done.checksum != m.checksum {
+					log.Printf("⚠️ Migration %s changed since it was applied", m.filename())
+				}
+				continue
+			}
+
+			start := time.Now()
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, m.up); err != nil {
+					return err
+				}
+				_, err := store.RecordMigrationQuery.Exec(ctx, tx, m.version, m.name, m.checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %s: %w", m.filename(), err)
+			}
+			count++
+			log.Printf("✅ Applied migration %s in %v", m.filename(), time.Since(start).Round(time.Millisecond))
+		}
+		return nil
+	})
+	span.SetAttributes(attribute.Int("migrations.applied", count))
+	if err != nil {
+		span.RecordError(err)
+	}
+	return count, err
+}
+
+// migrateDown rolls back the latest steps applied migrations, newest first.
+// It stops at the first one without a down file.
+func migrateDown(ctx context.Context, pool *pgxpool.Pool, steps int) (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	byVersion := map[int]migration{}
+	for _, m := range migrations {
+		byVersion[m.version] = m
+	}
+
+	count := 0
+	err = withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		for _, version := range versions {
+			if count == steps {
+				break
+			}
+			m, ok := byVersion[version]
+			if !ok {
+				return fmt.Errorf("migration %d (%s) is applied but not in this build", version, applied[version].name)
+			}
+			if m.down == "" {
+				return fmt.Errorf("migration %s can't be rolled back, it has no down file", m.filename())
+			}
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, m.down); err != nil {
+					return err
+				}
+				_, err := store.ForgetMigrationQuery.Exec(ctx, tx, m.version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %s: %w", m.filename(), err)
+			}
+			count++
+			log.Printf("✅ Rolled back migration %s", m.filename())
+		}
+		return nil
+	})
+	return count, err
+}
+
+// migrationStatus lists every migration in this build and every applied one,
+// oldest first.
+func migrationStatus(ctx context.Context, pool *pgxpool.Pool) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	err = withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			status := MigrationStatus{Version: m.version, Name: m.name, Reversible: m.down != ""}
+			if done, ok := applied[m.version]; ok {
+				status.Applied = true
+				status.AppliedAt = &done.appliedAt
+				status.Modified = done.checksum != m.checksum
+				delete(applied, m.version)
+			}
+			statuses = append(statuses, status)
+		}
+		// Applied by a newer build
+		for version, done := range applied {
+			appliedAt := done.appliedAt
+			statuses = append(statuses, MigrationStatus{
+				Version: version, Name: done.name, Applied: true, AppliedAt: &appliedAt, Unavailable: true,
+			})
+		}
+		return nil
+	})
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, err
+}
+
+// pendingMigrations returns the migrations in this build not yet applied.
+func pendingMigrations(ctx context.Context, pool *pgxpool.Pool) ([]migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := migrationStatus(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int]bool{}
+	for _, status := range statuses {
+		applied[status.Version] = status.Applied
+	}
+	var pending []migration
+	for _, m := range migrations {
+		if !applied[m.version] {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// schemaVersion is the newest migration applied to the database, 0 if none.
+func schemaVersion(ctx context.Context, pool *pgxpool.Pool) (int, error) {
+	var version int
+	err := store.SchemaVersionQuery.QueryRow(ctx, pool).Scan(&version)
+	return version, err
+}
+
+// runMigrateCommand runs `leaderboard-api migrate [up [version] | down [steps]
+// | status]` and returns the process exit code.
+func runMigrateCommand(ctx context.Context, args []string) int {
+	usage := func() int {
+		fmt.Fprintln(os.Stderr, "Usage: leaderboard-api migrate [up [version] | down [steps] | status]")
+		return 2
+	}
+	command := "up"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	if len(args) > 1 {
+		return usage()
+	}
+	number := 0
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return usage()
+		}
+		number = n
+	}
+
+	tracer = otel.Tracer(serviceName)
+	pool, err := connectDB(ctx)
+	if err != nil {
+		log.Printf("Failed to connect to database: %v", err)
+		return 1
+	}
+	defer pool.Close()
+
+	switch command {
+	case "up":
+		applied, err := migrateUp(ctx, pool, number)
+		if err != nil {
+			log.Printf("Migration failed: %v", err)
+			return 1
+		}
+		log.Printf("✅ %d migrations applied", applied)
+	case "down":
+		if number == 0 {
+			number = 1
+		}
+		rolledBack, err := migrateDown(ctx, pool, number)
+		if err != nil {
+			log.Printf("Rollback failed after %d migrations: %v", rolledBack, err)
+			return 1
+		}
+	case "status":
+		statuses, err := migrationStatus(ctx, pool)
+		if err != nil {
+			log.Printf("Failed to read migration status: %v", err)
+			return 1
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(statuses)
+		for _, status := range statuses {
+			if !status.Applied {
+				return 1
+			}
+		}
+	default:
+		return usage()
+	}
+	return 0
+}
@@ -0,0 +1,233 @@
+-- Baseline: the schema initDB created before versioned migrations. Every
+-- statement is idempotent, so databases created by initDB adopt it cleanly.
+
+CREATE TABLE IF NOT EXISTS scores (
+	id SERIAL PRIMARY KEY,
+	player_name VARCHAR(100) NOT NULL,
+	score INTEGER NOT NULL,
+	session_id VARCHAR(100) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_scores_score ON scores(score DESC);
+CREATE INDEX IF NOT EXISTS idx_scores_player_name ON scores(player_name);
+CREATE INDEX IF NOT EXISTS idx_scores_created_at ON scores(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_scores_session_id ON scores(session_id);
+
+CREATE TABLE IF NOT EXISTS players (
+	id VARCHAR(100) PRIMARY KEY,
+	display_name VARCHAR(100) NOT NULL,
+	discriminator VARCHAR(4) NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	UNIQUE (display_name, discriminator)
+);
+
+-- Tagged names ("Paul#4821") need room for the discriminator
+ALTER TABLE scores ALTER COLUMN player_name TYPE VARCHAR(105);
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS player_id VARCHAR(100);
+CREATE INDEX IF NOT EXISTS idx_scores_player_id ON scores(player_id);
+
+-- Quarantined scores are hidden from the leaderboard pending moderation
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS quarantined BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS quarantined_at TIMESTAMP;
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS quarantine_reason VARCHAR(50);
+
+CREATE TABLE IF NOT EXISTS score_reports (
+	id SERIAL PRIMARY KEY,
+	score_id INTEGER NOT NULL REFERENCES scores(id) ON DELETE CASCADE,
+	reporter_id VARCHAR(100) NOT NULL,
+	reason VARCHAR(500) NOT NULL DEFAULT '',
+	resolved BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	UNIQUE (score_id, reporter_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_score_reports_open ON score_reports(score_id) WHERE NOT resolved;
+
+-- Community categories ("speedrun", "no-powerups"), filterable with @>
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '[]'::jsonb;
+CREATE INDEX IF NOT EXISTS idx_scores_tags ON scores USING GIN (tags);
+
+-- Allowlisted client fields, interpreted according to extras_version
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS extras JSONB NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS extras_version SMALLINT NOT NULL DEFAULT 0;
+
+-- Anti-cheat ceilings per game mode, editable through /admin/rules
+CREATE TABLE IF NOT EXISTS game_rules (
+	mode VARCHAR(32) NOT NULL,
+	difficulty VARCHAR(32) NOT NULL,
+	max_score INTEGER NOT NULL,
+	min_interval_ms INTEGER NOT NULL,
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (mode, difficulty)
+);
+
+INSERT INTO game_rules (mode, difficulty, max_score, min_interval_ms)
+VALUES ('classic', 'normal', 100000, 10000)
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS game_mode VARCHAR(32) NOT NULL DEFAULT 'classic';
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS difficulty VARCHAR(32) NOT NULL DEFAULT 'normal';
+
+-- Seasons; exactly one is open (ended_at IS NULL) at any time
+CREATE TABLE IF NOT EXISTS seasons (
+	id SERIAL PRIMARY KEY,
+	started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	ends_at TIMESTAMP,
+	ended_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_seasons_current ON seasons ((ended_at IS NULL)) WHERE ended_at IS NULL;
+
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS season_id INTEGER REFERENCES seasons(id);
+CREATE INDEX IF NOT EXISTS idx_scores_season_score ON scores(season_id, score DESC);
+
+-- Final standings written when a season ends, never updated afterwards
+CREATE TABLE IF NOT EXISTS season_standings (
+	season_id INTEGER NOT NULL REFERENCES seasons(id),
+	rank INTEGER NOT NULL,
+	score_id INTEGER NOT NULL,
+	player_name VARCHAR(105) NOT NULL,
+	score INTEGER NOT NULL,
+	tags JSONB NOT NULL DEFAULT '[]'::jsonb,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (season_id, rank)
+);
+
+-- Reward tier of every player in an ended season, by their best score
+CREATE TABLE IF NOT EXISTS season_rewards (
+	season_id INTEGER NOT NULL REFERENCES seasons(id),
+	player_name VARCHAR(105) NOT NULL,
+	rank INTEGER NOT NULL,
+	score INTEGER NOT NULL,
+	percentile DOUBLE PRECISION NOT NULL,
+	tier VARCHAR(50) NOT NULL DEFAULT '',
+	PRIMARY KEY (season_id, player_name)
+);
+
+-- Signed reward artifact of each ended season, stored once
+CREATE TABLE IF NOT EXISTS season_reward_snapshots (
+	season_id INTEGER PRIMARY KEY REFERENCES seasons(id),
+	payload TEXT NOT NULL,
+	signature TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Client-generated UUID; retries of the same submission are stored once
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS submission_id UUID;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scores_submission_id ON scores(submission_id);
+
+-- Submission trace, linked from spans that later quarantine or resolve the score
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS trace_parent VARCHAR(55);
+
+-- Sessions an operator has banned from submitting
+CREATE TABLE IF NOT EXISTS banned_sessions (
+	session_id VARCHAR(100) PRIMARY KEY,
+	reason TEXT NOT NULL DEFAULT '',
+	banned_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Registered players sign in with their bare display name; anonymous
+-- identities have no password
+ALTER TABLE players ADD COLUMN IF NOT EXISTS password_hash TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_players_account_name
+	ON players (LOWER(display_name)) WHERE password_hash IS NOT NULL;
+
+-- Sessions and players whose scores are accepted but stored hidden
+CREATE TABLE IF NOT EXISTS shadow_bans (
+	kind VARCHAR(16) NOT NULL,
+	value VARCHAR(105) NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (kind, value)
+);
+
+-- Spice each player has collected across all runs and seasons
+CREATE TABLE IF NOT EXISTS player_spice (
+	player_name VARCHAR(105) PRIMARY KEY,
+	spice BIGINT NOT NULL DEFAULT 0,
+	runs INTEGER NOT NULL DEFAULT 0,
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_player_spice_spice ON player_spice(spice DESC);
+
+-- Community-wide counters, advanced by every visible run
+CREATE TABLE IF NOT EXISTS community_counters (
+	metric VARCHAR(16) PRIMARY KEY,
+	value BIGINT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Community goals reached, each recorded (and announced) once
+CREATE TABLE IF NOT EXISTS community_milestones (
+	metric VARCHAR(16) NOT NULL,
+	target BIGINT NOT NULL,
+	reached_by VARCHAR(105),
+	reached_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (metric, target)
+);
+
+-- Keys of trusted backends; only the SHA-256 of each key is stored
+CREATE TABLE IF NOT EXISTS api_keys (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(64) NOT NULL UNIQUE,
+	key_hash CHAR(64) NOT NULL UNIQUE,
+	prefix VARCHAR(16) NOT NULL,
+	rate_limit INTEGER NOT NULL DEFAULT 600,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	last_used_at TIMESTAMP,
+	revoked_at TIMESTAMP
+);
+
+-- Backend that submitted the score; NULL for browser clients
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS api_key_id INTEGER REFERENCES api_keys(id);
+
+-- Furthest biome the run reached, when the client reports it
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS biome VARCHAR(32);
+CREATE INDEX IF NOT EXISTS idx_scores_biome_score ON scores(biome, score DESC) WHERE biome IS NOT NULL;
+
+-- Keyboard or touch, when the client reports it; the two get separate boards
+ALTER TABLE scores ADD COLUMN IF NOT EXISTS input_method VARCHAR(16);
+CREATE INDEX IF NOT EXISTS idx_scores_input_method_score ON scores(input_method, score DESC)
+	WHERE input_method IS NOT NULL;
+
+-- Scores pruned by the retention job in archive mode, with the full row
+CREATE TABLE IF NOT EXISTS scores_archive (
+	id INTEGER PRIMARY KEY,
+	player_name VARCHAR(105) NOT NULL,
+	score INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	archived_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	data JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_scores_archive_player_name ON scores_archive(player_name);
+
+-- Erasure and export requests made by players; the name is kept only as a hash
+CREATE TABLE IF NOT EXISTS data_requests (
+	id SERIAL PRIMARY KEY,
+	kind VARCHAR(16) NOT NULL,
+	subject_hash CHAR(64) NOT NULL,
+	verified_by VARCHAR(16) NOT NULL,
+	rows_affected INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Sampled errors reported by game clients
+CREATE TABLE IF NOT EXISTS client_errors (
+	id SERIAL PRIMARY KEY,
+	stack_hash VARCHAR(64) NOT NULL,
+	client_version VARCHAR(32) NOT NULL,
+	message TEXT NOT NULL,
+	user_agent VARCHAR(256) NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_client_errors_created_at ON client_errors(created_at);
+
+-- Written and read back by /probe/full, apart from real scores
+CREATE TABLE IF NOT EXISTS probe_scores (
+	id SERIAL PRIMARY KEY,
+	probe_id VARCHAR(32) NOT NULL,
+	score INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,7 @@
+-- Players whose runs may go past the score ceilings, pending a moderator's
+-- confirmation. Erasing the player removes them from the list.
+CREATE TABLE verified_runners (
+	player_id VARCHAR(100) PRIMARY KEY REFERENCES players (id) ON DELETE CASCADE,
+	note TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
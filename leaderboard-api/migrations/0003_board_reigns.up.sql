@@ -0,0 +1,14 @@
+-- Every spell a player spent at #1 of a season's board. The open reign has
+-- no ended_at; a reign left open when its season ended runs until the
+-- season's ended_at.
+CREATE TABLE board_reigns (
+	id SERIAL PRIMARY KEY,
+	season_id INTEGER NOT NULL REFERENCES seasons (id),
+	player_name VARCHAR(105) NOT NULL,
+	score INTEGER NOT NULL,
+	started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	ended_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_board_reigns_open ON board_reigns ((ended_at IS NULL)) WHERE ended_at IS NULL;
+CREATE INDEX idx_board_reigns_player_name ON board_reigns (player_name);
@@ -0,0 +1,33 @@
+-- Integrations subscribed to leaderboard events. An empty events array
+-- subscribes to every event type.
+CREATE TABLE webhooks (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(64) NOT NULL UNIQUE,
+	url TEXT NOT NULL,
+	secret VARCHAR(128) NOT NULL,
+	events TEXT[] NOT NULL DEFAULT '{}',
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- One row per event per webhook, worked as a queue: a delivery is pending
+-- until delivered_at or failed_at is set.
+CREATE TABLE webhook_deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	webhook_id INTEGER NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+	event_id VARCHAR(32) NOT NULL,
+	event_type VARCHAR(128) NOT NULL,
+	payload JSONB NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	last_status INTEGER,
+	last_error TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	delivered_at TIMESTAMP,
+	failed_at TIMESTAMP
+);
+
+CREATE INDEX idx_webhook_deliveries_pending ON webhook_deliveries (next_attempt_at)
+	WHERE delivered_at IS NULL AND failed_at IS NULL;
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, id DESC);
@@ -0,0 +1 @@
+DROP MATERIALIZED VIEW top_scores_view;
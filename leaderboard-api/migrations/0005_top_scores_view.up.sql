@@ -0,0 +1,13 @@
+-- The current season's top 1000 visible scores, ranked, so the default board
+-- is read without sorting the scores table. The API refreshes it shortly
+-- after the board changes; the unique index lets it refresh concurrently.
+CREATE MATERIALIZED VIEW top_scores_view AS
+SELECT ROW_NUMBER() OVER (ORDER BY score DESC, id) AS rank, id, player_name, score, created_at, tags,
+	extras, extras_version
+FROM scores
+WHERE NOT quarantined AND season_id = (SELECT id FROM seasons WHERE ended_at IS NULL)
+ORDER BY score DESC, id
+LIMIT 1000;
+
+CREATE UNIQUE INDEX idx_top_scores_view_id ON top_scores_view (id);
+CREATE INDEX idx_top_scores_view_rank ON top_scores_view (rank);
@@ -0,0 +1,649 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiOperation documents one public endpoint. Request and response bodies are
+// example values of the Go types the handlers encode, so the schemas follow
+// the code instead of being written by hand.
+type apiOperation struct {
+	Method      string
+	Path        string
+	ID          string
+	Summary     string
+	Tag         string
+	Params      []apiParam
+	RequestBody interface{}
+	Responses   []apiResponse
+}
+
+type apiParam struct {
+	Name        string
+	In          string // "path" or "query"
+	Type        string // "string" or "integer"
+	Description string
+	Repeated    bool
+}
+
+type apiResponse struct {
+	Status      int
+	Description string
+	// Body is nil for plain-text errors and empty responses. oneOf lists the
+	// alternatives when an endpoint answers with more than one shape.
+	Body  interface{}
+	OneOf []interface{}
+}
+
+// apiOperations is the public API. Keep it in step with the routes in main().
+var apiOperations = []apiOperation{
+	{
+		Method: "POST", Path: "/api/scores", ID: "submitScore", Tag: "scores",
+		Summary: "Submit a finished run",
+		Params: []apiParam{
+			{Name: "Idempotency-Key", In: "header", Type: "string", Description: "Retries with the same key get the first response back"},
+			{Name: "debug", In: "query", Type: "string", Description: "timing adds the latency breakdown by phase to the response"},
+		},
+		RequestBody: ScoreSubmission{},
+		Responses: []apiResponse{
+			{Status: http.StatusCreated, Description: "Score stored", Body: ScoreResponse{}},
+			{Status: http.StatusOK, Description: "Retry of a stored submission (Idempotent-Replayed: true)", Body: ScoreResponse{}},
+			{Status: http.StatusBadRequest, Description: "Invalid or rejected submission"},
+			{Status: http.StatusUnauthorized, Description: "Invalid token, or the player needs to sign in"},
+			{Status: http.StatusConflict, Description: "A request with the same Idempotency-Key is still running"},
+			{Status: http.StatusUnprocessableEntity, Description: "Idempotency-Key was used with a different body"},
+			{Status: http.StatusRequestEntityTooLarge, Description: "Body over SUBMISSION_MAX_BODY_BYTES, not counting the event log"},
+			{Status: http.StatusUnsupportedMediaType, Description: "Unknown or retired schema version"},
+		},
+	},
+	{
+		Method: "POST", Path: "/api/accounts/register", ID: "register", Tag: "accounts",
+		Summary: "Register a player account and get a token",
+		Params: []apiParam{
+			{Name: "X-Player-Id", In: "header", Type: "string", Description: "The playerId being adopted, when the body has one"},
+		},
+		RequestBody: AccountRequest{},
+		Responses: []apiResponse{
+			{Status: http.StatusCreated, Description: "Account created", Body: AccountToken{}},
+			{Status: http.StatusBadRequest, Description: "Invalid username or password"},
+			{Status: http.StatusUnauthorized, Description: "playerId given without the same ID in X-Player-Id"},
+			{Status: http.StatusNotFound, Description: "No anonymous player has the playerId"},
+			{Status: http.StatusConflict, Description: "Username taken, or player ID already registered"},
+			{Status: http.StatusServiceUnavailable, Description: "Accounts are not enabled"},
+		},
+	},
+	{
+		Method: "POST", Path: "/api/accounts/login", ID: "login", Tag: "accounts",
+		Summary:     "Sign in and get a token",
+		RequestBody: AccountRequest{},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Signed in", Body: AccountToken{}},
+			{Status: http.StatusUnauthorized, Description: "Wrong username or password"},
+			{Status: http.StatusServiceUnavailable, Description: "Accounts are not enabled"},
+		},
+	},
+	{
+		Method: "POST", Path: "/api/accounts/refresh", ID: "refreshToken", Tag: "accounts",
+		Summary: "Swap a valid token for a fresh one",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "New token", Body: AccountToken{}},
+			{Status: http.StatusUnauthorized, Description: "Missing, invalid or expired token"},
+			{Status: http.StatusServiceUnavailable, Description: "Accounts are not enabled"},
+		},
+	},
+	{
+		Method: "DELETE", Path: "/api/players/{name}", ID: "erasePlayer", Tag: "accounts",
+		Summary: "Erase your scores and identity",
+		Params: []apiParam{
+			{Name: "name", In: "path", Type: "string"},
+			{Name: "X-Player-Id", In: "header", Type: "string", Description: "The identity's playerId, for players without an account"},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Player erased", Body: PlayerChange{}},
+			{Status: http.StatusUnauthorized, Description: "Missing token or playerId, or it belongs to someone else"},
+			{Status: http.StatusForbidden, Description: "The name has no identity to verify against"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/players/{name}/export", ID: "exportPlayer", Tag: "accounts",
+		Summary: "Download everything stored about you",
+		Params: []apiParam{
+			{Name: "name", In: "path", Type: "string"},
+			{Name: "X-Player-Id", In: "header", Type: "string", Description: "The identity's playerId, for players without an account"},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Stored data", Body: PlayerDataExport{}},
+			{Status: http.StatusUnauthorized, Description: "Missing token or playerId, or it belongs to someone else"},
+			{Status: http.StatusForbidden, Description: "The name has no identity to verify against"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/leaderboard/checksum", ID: "getLeaderboardChecksum", Tag: "leaderboard",
+		Summary: "A rolling hash over the top scores, to compare replicas and mirrors",
+		Params: []apiParam{
+			{Name: "limit", In: "query", Type: "integer", Description: "Number of entries hashed (default 100, max 1000)"},
+			{Name: "tag", In: "query", Type: "string", Description: "Only scores carrying every given tag", Repeated: true},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Checksum with a checkpoint every 10 entries", Body: LeaderboardChecksum{}},
+			{Status: http.StatusBadRequest, Description: "Invalid limit or tag"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/leaderboard/records", ID: "getRecords", Tag: "leaderboard",
+		Summary: "The world record's progression: who held it, from when and for how long",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Records, oldest first", Body: RecordProgression{}},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/leaderboard/reigns", ID: "getReigns", Tag: "leaderboard",
+		Summary: "Time at #1: the current and longest reigns and the players with the most time there",
+		Params: []apiParam{
+			{Name: "limit", In: "query", Type: "integer", Description: "Players to return (default 25, max 100)"},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Reigns and per-player totals", Body: ReignStats{}},
+			{Status: http.StatusBadRequest, Description: "Invalid limit"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/leaderboard/top", ID: "getTopScores", Tag: "leaderboard",
+		Summary: "The current season's top scores",
+		Params: []apiParam{
+			{Name: "limit", In: "query", Type: "integer", Description: "Number of entries (default 100); above 1000 the response is NDJSON"},
+			{Name: "tag", In: "query", Type: "string", Description: "Only scores carrying every given tag", Repeated: true},
+			{Name: "pageSize", In: "query", Type: "integer", Description: "Ask for a page instead of a bare array"},
+			{Name: "cursor", In: "query", Type: "string", Description: "nextCursor of the previous page"},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Entries, or a page when pageSize or cursor is set",
+				OneOf: []interface{}{[]LeaderboardEntry{}, LeaderboardPage{}}},
+			{Status: http.StatusNotModified, Description: "Unchanged since the If-None-Match ETag"},
+			{Status: http.StatusBadRequest, Description: "Invalid tag or cursor"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/leaderboard/global", ID: "getGlobalLeaderboard", Tag: "leaderboard",
+		Summary: "Top scores across every federated deployment",
+		Params: []apiParam{
+			{Name: "limit", In: "query", Type: "integer", Description: "Number of entries (default 100, at most 1000)"},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Merged entries and each source's freshness", Body: GlobalLeaderboard{}},
+			{Status: http.StatusBadRequest, Description: "Invalid limit"},
+			{Status: http.StatusServiceUnavailable, Description: "Federation is not enabled"},
+		},
+	},
+	{
+		Method: "POST", Path: "/api/leaderboard/federation/{source}", ID: "pushFederation", Tag: "leaderboard",
+		Summary:     "Push a peer deployment's top scores (requires X-Federation-Token)",
+		Params:      []apiParam{{Name: "source", In: "path", Type: "string"}},
+		RequestBody: FederationPush{},
+		Responses: []apiResponse{
+			{Status: http.StatusNoContent, Description: "Stored"},
+			{Status: http.StatusBadRequest, Description: "Invalid source name or body"},
+			{Status: http.StatusUnauthorized, Description: "Invalid federation token"},
+			{Status: http.StatusServiceUnavailable, Description: "Federation pushes are not enabled"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/leaderboard/player/{name}", ID: "getPlayerStats", Tag: "leaderboard",
+		Summary: "A player's best scores, rank and recent runs",
+		Params:  []apiParam{{Name: "name", In: "path", Type: "string"}},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Player stats", Body: PlayerStats{}},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/leaderboard/export", ID: "exportLeaderboard", Tag: "leaderboard",
+		Summary: "Stream a whole leaderboard as CSV or NDJSON",
+		Params: []apiParam{
+			{Name: "format", In: "query", Type: "string", Description: "csv (default) or ndjson"},
+			{Name: "season", In: "query", Type: "string", Description: "Season ID, current (default) or all"},
+			{Name: "window", In: "query", Type: "string", Description: "Only scores from this long ago onwards, e.g. 24h"},
+			{Name: "tag", In: "query", Type: "string", Description: "Only scores carrying every given tag", Repeated: true},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "One entry per row (CSV) or line (NDJSON), best first", Body: LeaderboardExportEntry{}},
+			{Status: http.StatusBadRequest, Description: "Invalid format, season, window or tag"},
+			{Status: http.StatusNotFound, Description: "Season not found"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/leaderboard/changes", ID: "getChanges", Tag: "leaderboard",
+		Summary: "Long-poll until the leaderboard changes",
+		Params: []apiParam{
+			{Name: "since", In: "query", Type: "integer", Description: "cursor of the previous response"},
+			{Name: "wait", In: "query", Type: "string", Description: "How long to wait, e.g. 30s (max 60s)"},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Whether the board changed since the cursor", Body: ChangesResponse{}},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/leaderboard/biomes/{biome}", ID: "getBiomeLeaderboard", Tag: "leaderboard",
+		Summary: "The current season's top runs that ended in a biome",
+		Params: []apiParam{
+			{Name: "biome", In: "path", Type: "string"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Number of entries (default 100, max 1000)"},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Entries", Body: []LeaderboardEntry{}},
+			{Status: http.StatusBadRequest, Description: "Invalid limit"},
+			{Status: http.StatusNotFound, Description: "Unknown biome"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/biomes", ID: "getBiomes", Tag: "leaderboard",
+		Summary: "Configured biomes in the order runs reach them",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Biomes", Body: []Biome{}},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/leaderboard/input/{input}", ID: "getInputLeaderboard", Tag: "leaderboard",
+		Summary: "The current season's top runs played with one input method",
+		Params: []apiParam{
+			{Name: "input", In: "path", Type: "string", Description: "Input method, e.g. keyboard or touch"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Number of entries (default 100, max 1000)"},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Entries", Body: []LeaderboardEntry{}},
+			{Status: http.StatusBadRequest, Description: "Invalid limit"},
+			{Status: http.StatusNotFound, Description: "Unknown input method"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/inputs", ID: "getInputMethods", Tag: "leaderboard",
+		Summary: "Configured input methods and the share of the score ceiling each is held to",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Input methods", Body: []InputMethod{}},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/schemas", ID: "getSchemas", Tag: "scores",
+		Summary: "Published versions of the submission payload schema",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Versions, oldest first"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/schemas/{version}", ID: "getSchema", Tag: "scores",
+		Summary: "JSON Schema of one submission payload version",
+		Params:  []apiParam{{Name: "version", In: "path", Type: "integer"}},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "JSON Schema document (application/schema+json)"},
+			{Status: http.StatusNotFound, Description: "Unknown schema version"},
+		},
+	},
+	{
+		Method: "POST", Path: "/api/reports", ID: "submitReport", Tag: "scores",
+		Summary: "Report a suspicious score",
+		Params: []apiParam{
+			{Name: "X-Player-Id", In: "header", Type: "string", Description: "The reporter's playerId, for players without an account"},
+		},
+		RequestBody: ReportSubmission{},
+		Responses: []apiResponse{
+			{Status: http.StatusAccepted, Description: "Report recorded", Body: ReportResponse{}},
+			{Status: http.StatusUnauthorized, Description: "Missing token or playerId"},
+			{Status: http.StatusNotFound, Description: "Score not found"},
+			{Status: http.StatusTooManyRequests, Description: "Too many reports from this player or address"},
+		},
+	},
+	{
+		Method: "POST", Path: "/api/telemetry/client-errors", ID: "submitClientErrors", Tag: "health",
+		Summary:     "Report errors caught by the game",
+		RequestBody: ClientErrorBatch{},
+		Responses: []apiResponse{
+			{Status: http.StatusAccepted, Description: "Errors counted; the first of each and a sample of repeats are stored", Body: ClientErrorResponse{}},
+			{Status: http.StatusBadRequest, Description: "Empty or oversized batch, or an invalid stack hash or client version"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/seasons", ID: "getSeasons", Tag: "seasons",
+		Summary: "All seasons, newest first",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Seasons", Body: []Season{}},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/seasons/current", ID: "getCurrentSeason", Tag: "seasons",
+		Summary: "The current season",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Current season", Body: Season{}},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/seasons/{id}/leaderboard", ID: "getSeasonLeaderboard", Tag: "seasons",
+		Summary: "A season's top scores",
+		Params: []apiParam{
+			{Name: "id", In: "path", Type: "integer"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Number of entries (default 100, max 1000)"},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Season standings", Body: SeasonLeaderboard{}},
+			{Status: http.StatusNotFound, Description: "Season not found"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/seasons/{id}/rewards", ID: "getSeasonRewards", Tag: "seasons",
+		Summary: "Signed reward artifact of an ended season (base64 SeasonRewards payload)",
+		Params: []apiParam{
+			{Name: "id", In: "path", Type: "integer"},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Signed reward artifact", Body: SignedSeasonRewards{}},
+			{Status: http.StatusNotFound, Description: "Season not found"},
+			{Status: http.StatusConflict, Description: "Season has not ended"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/seasons/{id}/rewards/player/{name}", ID: "getPlayerReward", Tag: "seasons",
+		Summary: "A player's final standing and reward tier in an ended season",
+		Params: []apiParam{
+			{Name: "id", In: "path", Type: "integer"},
+			{Name: "name", In: "path", Type: "string"},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Player reward", Body: PlayerReward{}},
+			{Status: http.StatusNotFound, Description: "Season not found, or player has no standing"},
+			{Status: http.StatusConflict, Description: "Season has not ended"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/seasons/rewards/key", ID: "getRewardsKey", Tag: "seasons",
+		Summary: "Public key reward artifacts are signed with",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Ed25519 public key", Body: RewardsKey{}},
+			{Status: http.StatusNotFound, Description: "Artifacts are not signed"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/stats/spice", ID: "getSpiceStats", Tag: "stats",
+		Summary: "Spice collected by everyone, progress towards the community milestone and the top collectors",
+		Params: []apiParam{
+			{Name: "limit", In: "query", Type: "integer", Description: "Number of top collectors (default 10, max 100)"},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Spice stats", Body: SpiceStats{}},
+			{Status: http.StatusBadRequest, Description: "Invalid limit"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/stats/spice/player/{name}", ID: "getPlayerSpice", Tag: "stats",
+		Summary: "Spice a player has collected across all runs",
+		Params: []apiParam{
+			{Name: "name", In: "path", Type: "string", Description: "Player name, including any discriminator"},
+		},
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Spice total", Body: SpiceTotal{}},
+			{Status: http.StatusNotFound, Description: "Player has collected no spice"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/community/goals", ID: "getCommunityGoals", Tag: "stats",
+		Summary: "Progress towards every community goal",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Goals, by metric and target", Body: []CommunityGoalProgress{}},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/featured", ID: "getFeatured", Tag: "stats",
+		Summary: "The runner spotlighted on the menu screen, drawn again each rotation",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Featured runner", Body: FeaturedRunner{}},
+			{Status: http.StatusNotFound, Description: "No runner was active in the last week"},
+		},
+	},
+	{
+		Method: "GET", Path: "/api/slo", ID: "getSLO", Tag: "health",
+		Summary: "Availability and latency SLIs with 1h and 6h burn rates",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "SLO status", Body: SLOResponse{}},
+		},
+	},
+	{
+		Method: "GET", Path: "/probe/full", ID: "fullProbe", Tag: "health",
+		Summary: "End-to-end write, read and invalidate probe with per-step latency",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Every step passed", Body: ProbeReport{}},
+			{Status: http.StatusServiceUnavailable, Description: "A step failed", Body: ProbeReport{}},
+		},
+	},
+	{
+		Method: "GET", Path: "/health", ID: "health", Tag: "health",
+		Summary: "Health check",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Healthy", Body: HealthStatus{}},
+			{Status: http.StatusServiceUnavailable, Description: "Database unreachable", Body: HealthStatus{}},
+		},
+	},
+	{
+		Method: "GET", Path: "/livez", ID: "livez", Tag: "health",
+		Summary: "Liveness probe; passes while the process serves requests",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Alive", Body: HealthStatus{}},
+		},
+	},
+	{
+		Method: "GET", Path: "/readyz", ID: "readyz", Tag: "health",
+		Summary: "Readiness probe; checks the database, migrations and cache warm-up, and fails while the pod drains",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Ready", Body: HealthStatus{}},
+			{Status: http.StatusServiceUnavailable, Description: "Not ready or draining", Body: HealthStatus{}},
+		},
+	},
+	{
+		Method: "GET", Path: "/ready", ID: "ready", Tag: "health",
+		Summary: "Alias of /readyz",
+		Responses: []apiResponse{
+			{Status: http.StatusOK, Description: "Ready", Body: HealthStatus{}},
+			{Status: http.StatusServiceUnavailable, Description: "Not ready or draining", Body: HealthStatus{}},
+		},
+	},
+}
+
+// openAPISpec is the encoded document, built on first request.
+var openAPISpec = sync.OnceValues(func() ([]byte, error) {
+	return json.MarshalIndent(buildOpenAPISpec(apiOperations), "", "  ")
+})
+
+// buildOpenAPISpec renders operations as an OpenAPI 3.0 document. Every struct
+// reached from a body becomes a named component schema.
+func buildOpenAPISpec(operations []apiOperation) map[string]interface{} {
+	schemas := openAPISchemas{}
+	paths := map[string]map[string]interface{}{}
+
+	for _, op := range operations {
+		operation := map[string]interface{}{
+			"operationId": op.ID,
+			"summary":     op.Summary,
+			"tags":        []string{op.Tag},
+		}
+
+		var params []map[string]interface{}
+		for _, p := range op.Params {
+			schema := map[string]interface{}{"type": p.Type}
+			if p.Repeated {
+				schema = map[string]interface{}{"type": "array", "items": schema}
+			}
+			param := map[string]interface{}{"name": p.Name, "in": p.In, "schema": schema}
+			if p.In == "path" {
+				param["required"] = true
+			}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			params = append(params, param)
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		if op.RequestBody != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemas.of(reflect.TypeOf(op.RequestBody))},
+				},
+			}
+		}
+
+		responses := map[string]interface{}{}
+		for _, resp := range op.Responses {
+			response := map[string]interface{}{"description": resp.Description}
+			var schema map[string]interface{}
+			switch {
+			case resp.Body != nil:
+				schema = schemas.of(reflect.TypeOf(resp.Body))
+			case len(resp.OneOf) > 0:
+				var alternatives []map[string]interface{}
+				for _, body := range resp.OneOf {
+					alternatives = append(alternatives, schemas.of(reflect.TypeOf(body)))
+				}
+				schema = map[string]interface{}{"oneOf": alternatives}
+			}
+			if schema != nil {
+				response["content"] = map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schema},
+				}
+			}
+			responses[strconv.Itoa(resp.Status)] = response
+		}
+		operation["responses"] = responses
+
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]interface{}{}
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Spice Runner Leaderboard API",
+			"version": serviceVersion,
+		},
+		// Relative, so "Try it out" works behind the /spice/leaderboard prefix too
+		"servers":    []map[string]string{{"url": "."}},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+// openAPISchemas collects component schemas by Go type name.
+type openAPISchemas map[string]map[string]interface{}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// of returns the schema for t, adding struct types to the components.
+func (s openAPISchemas) of(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.of(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := s[name]; !ok {
+			// Reserve the name first so self-referencing types terminate
+			s[name] = map[string]interface{}{}
+			s[name] = s.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema describes a struct's JSON encoding. Fields without omitempty
+// are always present, so they are listed as required.
+func (s openAPISchemas) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.of(field.Type)
+		if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (app *App) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	spec, err := openAPISpec()
+	if err != nil {
+		http.Error(w, "Failed to build OpenAPI document", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec)
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at openapi.json,
+// relative so it also resolves under the /spice/leaderboard prefix.
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Spice Runner Leaderboard API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
+
+func (app *App) swaggerUIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	tracer trace.Tracer
+	meter  metric.Meter
+
+	// Custom metrics
+	scoreSubmissionsTotal        metric.Int64Counter
+	scoreSubmissionErrors        metric.Int64Counter
+	cacheHitTotal                metric.Int64Counter
+	cacheMissTotal               metric.Int64Counter
+	scoreValidationDuration      metric.Float64Histogram
+	redisOpDuration              metric.Float64Histogram
+	submissionStageDuration      metric.Float64Histogram
+	submissionPhaseDuration      metric.Float64Histogram
+	submissionStageRejections    metric.Int64Counter
+	experimentVerdictsTotal      metric.Int64Counter
+	staticPublishTotal           metric.Int64Counter
+	staticPublishDuration        metric.Float64Histogram
+	cdnPurgeTotal                metric.Int64Counter
+	abuseReportsTotal            metric.Int64Counter
+	duplicateSubmissionsTotal    metric.Int64Counter
+	scoreStreamClients           metric.Int64UpDownCounter
+	httpServerActiveRequests     metric.Int64UpDownCounter
+	probeStepDuration            metric.Float64Histogram
+	shadowRequestsTotal          metric.Int64Counter
+	shadowRequestDuration        metric.Float64Histogram
+	canaryComparisonsTotal       metric.Int64Counter
+	canaryCandidateDuration      metric.Float64Histogram
+	shadowBannedSubmissionsTotal metric.Int64Counter
+	accountRegistrationsTotal    metric.Int64Counter
+	accountLoginFailuresTotal    metric.Int64Counter
+	spiceCollectedTotal          metric.Int64Counter
+	apiKeyRequestsTotal          metric.Int64Counter
+	communityMilestonesTotal     metric.Int64Counter
+	scoresPrunedTotal            metric.Int64Counter
+	clientErrorsTotal            metric.Int64Counter
+	rumBeaconsTotal              metric.Int64Counter
+	rumWebVitalValue             metric.Float64Histogram
+	rankingDriftTotal            metric.Int64Counter
+	replayUploadsTotal           metric.Int64Counter
+	configReloadsTotal           metric.Int64Counter
+	queryTruncationsTotal        metric.Int64Counter
+	cacheSwitchesTotal           metric.Int64Counter
+	webhookDeliveriesTotal       metric.Int64Counter
+	scenarioStepsTotal           metric.Int64Counter
+	federationPullsTotal         metric.Int64Counter
+	requestBodyOversizedTotal    metric.Int64Counter
+	cacheCoalescedTotal          metric.Int64Counter
+	cacheRevalidationsTotal      metric.Int64Counter
+)
+
+func initMetrics() error {
+	var err error
+
+	scoreSubmissionsTotal, err = meter.Int64Counter(
+		"score.submissions.total",
+		metric.WithDescription("Total number of score submissions"),
+	)
+	if err != nil {
+		return err
+	}
+
+	scoreSubmissionErrors, err = meter.Int64Counter(
+		"score.submission.errors.total",
+		metric.WithDescription("Total number of score submission errors"),
+	)
+	if err != nil {
+		return err
+	}
+
+	cacheHitTotal, err = meter.Int64Counter(
+		"cache.hits.total",
+		metric.WithDescription("Total number of cache hits"),
+	)
+	if err != nil {
+		return err
+	}
+
+	cacheMissTotal, err = meter.Int64Counter(
+		"cache.misses.total",
+		metric.WithDescription("Total number of cache misses"),
+	)
+	if err != nil {
+		return err
+	}
+
+	scoreValidationDuration, err = meter.Float64Histogram(
+		"score.validation.duration.seconds",
+		metric.WithDescription("Duration of score validation in seconds"),
+	)
+	if err != nil {
+		return err
+	}
+
+	redisOpDuration, err = meter.Float64Histogram(
+		"redis.operation.duration.seconds",
+		metric.WithDescription("Duration of Redis operations in seconds"),
+	)
+	if err != nil {
+		return err
+	}
+
+	submissionStageDuration, err = meter.Float64Histogram(
+		"submission.stage.duration.seconds",
+		metric.WithDescription("Duration of each submission pipeline stage in seconds"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	submissionPhaseDuration, err = meter.Float64Histogram(
+		"score.submission.phase.duration.seconds",
+		metric.WithDescription("Duration of each phase of a score submission (decode, validate, insert, cache, rank) in seconds"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	submissionStageRejections, err = meter.Int64Counter(
+		"submission.stage.rejections.total",
+		metric.WithDescription("Total number of submissions rejected per pipeline stage"),
+	)
+	if err != nil {
+		return err
+	}
+
+	experimentVerdictsTotal, err = meter.Int64Counter(
+		"anticheat.experiment.verdicts.total",
+		metric.WithDescription("Total number of would-be verdicts from log-only anti-cheat experiments"),
+	)
+	if err != nil {
+		return err
+	}
+
+	staticPublishTotal, err = meter.Int64Counter(
+		"leaderboard.static_publish.total",
+		metric.WithDescription("Total number of static leaderboard publish attempts"),
+	)
+	if err != nil {
+		return err
+	}
+
+	staticPublishDuration, err = meter.Float64Histogram(
+		"leaderboard.static_publish.duration.seconds",
+		metric.WithDescription("Duration of static leaderboard publishing in seconds"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	cdnPurgeTotal, err = meter.Int64Counter(
+		"cdn.purge.total",
+		metric.WithDescription("Total number of CDN purge requests"),
+	)
+	if err != nil {
+		return err
+	}
+
+	abuseReportsTotal, err = meter.Int64Counter(
+		"abuse.reports.total",
+		metric.WithDescription("Total number of abuse reports submitted"),
+	)
+	if err != nil {
+		return err
+	}
+
+	duplicateSubmissionsTotal, err = meter.Int64Counter(
+		"score.submissions.duplicate.total",
+		metric.WithDescription("Total number of retried submissions answered with the stored result"),
+	)
+	if err != nil {
+		return err
+	}
+
+	scoreStreamClients, err = meter.Int64UpDownCounter(
+		"score.stream.clients",
+		metric.WithDescription("Number of connected score stream clients"),
+	)
+	if err != nil {
+		return err
+	}
+
+	httpServerActiveRequests, err = meter.Int64UpDownCounter(
+		"http.server.active_requests",
+		metric.WithDescription("Number of HTTP requests being served"),
+	)
+	if err != nil {
+		return err
+	}
+
+	probeStepDuration, err = meter.Float64Histogram(
+		"probe.step.duration.seconds",
+		metric.WithDescription("Duration of each step of the full synthetic probe in seconds"),
+	)
+	if err != nil {
+		return err
+	}
+
+	shadowRequestsTotal, err = meter.Int64Counter(
+		"shadow.requests.total",
+		metric.WithDescription("Total number of requests mirrored to the shadow by how its status compared"),
+	)
+	if err != nil {
+		return err
+	}
+
+	shadowRequestDuration, err = meter.Float64Histogram(
+		"shadow.request.duration.seconds",
+		metric.WithDescription("Duration of mirrored requests on the primary and on the shadow in seconds"),
+	)
+	if err != nil {
+		return err
+	}
+
+	canaryComparisonsTotal, err = meter.Int64Counter(
+		"canary.comparisons.total",
+		metric.WithDescription("Total number of enforced results compared with a candidate implementation by outcome"),
+	)
+	if err != nil {
+		return err
+	}
+
+	canaryCandidateDuration, err = meter.Float64Histogram(
+		"canary.candidate.duration.seconds",
+		metric.WithDescription("Duration of candidate implementations run for canary comparisons in seconds"),
+	)
+	if err != nil {
+		return err
+	}
+
+	shadowBannedSubmissionsTotal, err = meter.Int64Counter(
+		"score.submissions.shadow_banned.total",
+		metric.WithDescription("Total number of submissions from shadow-banned players stored hidden"),
+	)
+	if err != nil {
+		return err
+	}
+
+	accountRegistrationsTotal, err = meter.Int64Counter(
+		"account.registrations.total",
+		metric.WithDescription("Total number of player accounts registered"),
+	)
+	if err != nil {
+		return err
+	}
+
+	accountLoginFailuresTotal, err = meter.Int64Counter(
+		"account.login.failures.total",
+		metric.WithDescription("Total number of sign-ins rejected for a wrong username or password"),
+	)
+	if err != nil {
+		return err
+	}
+
+	spiceCollectedTotal, err = meter.Int64Counter(
+		"spice.collected.total",
+		metric.WithDescription("Total spice collected by players across all runs"),
+	)
+	if err != nil {
+		return err
+	}
+
+	apiKeyRequestsTotal, err = meter.Int64Counter(
+		"apikey.requests.total",
+		metric.WithDescription("Total number of requests made with an API key, by key and result"),
+	)
+	if err != nil {
+		return err
+	}
+
+	communityMilestonesTotal, err = meter.Int64Counter(
+		"community.milestones.total",
+		metric.WithDescription("Total number of community goals reached"),
+	)
+	if err != nil {
+		return err
+	}
+
+	rankingDriftTotal, err = meter.Int64Counter(
+		"leaderboard.cache.drift",
+		metric.WithDescription("Mismatches found between the ranking sorted set and Postgres by the drift check"),
+	)
+	if err != nil {
+		return err
+	}
+
+	configReloadsTotal, err = meter.Int64Counter(
+		"config.reloads.total",
+		metric.WithDescription("Total number of configuration reloads"),
+	)
+	if err != nil {
+		return err
+	}
+
+	replayUploadsTotal, err = meter.Int64Counter(
+		"replay.uploads.total",
+		metric.WithDescription("Total number of sampled run replays uploaded to object storage"),
+	)
+	if err != nil {
+		return err
+	}
+
+	queryTruncationsTotal, err = meter.Int64Counter(
+		"query.truncations.total",
+		metric.WithDescription("Total number of budgeted reads cut short by their row cap or statement timeout"),
+	)
+	if err != nil {
+		return err
+	}
+
+	cacheSwitchesTotal, err = meter.Int64Counter(
+		"cache.switches.total",
+		metric.WithDescription("Total number of switches between Redis and the fallback response cache"),
+	)
+	if err != nil {
+		return err
+	}
+
+	webhookDeliveriesTotal, err = meter.Int64Counter(
+		"webhook.deliveries.total",
+		metric.WithDescription("Total number of webhook delivery attempts by result"),
+	)
+	if err != nil {
+		return err
+	}
+
+	scenarioStepsTotal, err = meter.Int64Counter(
+		"scenario.steps.total",
+		metric.WithDescription("Total number of demo scenario steps run"),
+	)
+	if err != nil {
+		return err
+	}
+
+	federationPullsTotal, err = meter.Int64Counter(
+		"federation.pulls.total",
+		metric.WithDescription("Total number of peer leaderboards pulled or pushed, by source and result"),
+	)
+	if err != nil {
+		return err
+	}
+
+	requestBodyOversizedTotal, err = meter.Int64Counter(
+		"request.body.oversized",
+		metric.WithDescription("Total number of requests rejected for a body over the size limit"),
+	)
+	if err != nil {
+		return err
+	}
+
+	cacheCoalescedTotal, err = meter.Int64Counter(
+		"cache.coalesced.total",
+		metric.WithDescription("Total number of cache misses served by a query shared with concurrent requests"),
+	)
+	if err != nil {
+		return err
+	}
+
+	cacheRevalidationsTotal, err = meter.Int64Counter(
+		"cache.revalidations.total",
+		metric.WithDescription("Total number of stale boards refreshed in the background"),
+	)
+	if err != nil {
+		return err
+	}
+
+	scoresPrunedTotal, err = meter.Int64Counter(
+		"scores.pruned.total",
+		metric.WithDescription("Total number of scores archived or deleted by the retention job"),
+	)
+	if err != nil {
+		return err
+	}
+
+	clientErrorsTotal, err = meter.Int64Counter(
+		"client.errors.total",
+		metric.WithDescription("Total number of errors reported by game clients, by client version and whether the report was stored"),
+	)
+	if err != nil {
+		return err
+	}
+
+	rumBeaconsTotal, err = meter.Int64Counter(
+		"rum.beacons.total",
+		metric.WithDescription("Total number of Faro beacons relayed to the RUM collector, by result"),
+	)
+	if err != nil {
+		return err
+	}
+
+	rumWebVitalValue, err = meter.Float64Histogram(
+		"rum.web_vital.value",
+		metric.WithDescription("Web vitals measured by game clients, in milliseconds except cls, by vital, country and platform"),
+		metric.WithExplicitBucketBoundaries(0.01, 0.05, 0.1, 0.25, 50, 100, 200, 500, 1000, 2500, 4000, 8000),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// leaderboardCursor marks the last entry of a page in (score DESC, id) order.
+// Clients treat the encoded form as opaque. It carries no rank: ranks are
+// counted from the board as it is when the next page is read, so a forged or
+// stale cursor can't skew them.
+type leaderboardCursor struct {
+	Score int `json:"s"`
+	ID    int `json:"i"`
+}
+
+func (c leaderboardCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeLeaderboardCursor(raw string) (*leaderboardCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cursor leaderboardCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID <= 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// LeaderboardPage is the paginated form of the top leaderboard.
+type LeaderboardPage struct {
+	Entries    []LeaderboardEntry `json:"entries"`
+	PageSize   int                `json:"pageSize"`
+	Total      int                `json:"total"`
+	NextCursor string             `json:"nextCursor,omitempty"`
+}
+
+// serveTopScoresPage walks the whole leaderboard one page at a time. Pages are
+// read straight from the database with keyset pagination rather than cached.
+func (app *App) serveTopScoresPage(ctx context.Context, w http.ResponseWriter, r *http.Request, tags []string) {
+	span := trace.SpanFromContext(ctx)
+
+	pageSize := defaultPageSize
+	if raw := r.URL.Query().Get("pageSize"); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size <= 0 || size > maxPageSize {
+			http.Error(w, fmt.Sprintf("pageSize must be between 1 and %d", maxPageSize), http.StatusBadRequest)
+			return
+		}
+		pageSize = size
+	}
+
+	var cursor *leaderboardCursor
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		c, err := decodeLeaderboardCursor(raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cursor = c
+	}
+	span.SetAttributes(
+		attribute.Int("query.page_size", pageSize),
+		attribute.Bool("query.has_cursor", cursor != nil),
+	)
+
+	page, err := app.queryTopScoresPage(ctx, cursor, pageSize, tags)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	page.Entries = maskEntries(app.nameMask(), page.Entries)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (app *App) queryTopScoresPage(ctx context.Context, cursor *leaderboardCursor, pageSize int, tags []string) (LeaderboardPage, error) {
+	page := LeaderboardPage{Entries: []LeaderboardEntry{}, PageSize: pageSize}
+
+	if err := store.CountTopQuery.QueryRow(ctx, app.db, store.TagsJSON(tags)).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	// Start after the cursor; the first page starts before the highest score
+	after := leaderboardCursor{Score: math.MaxInt32}
+	if cursor != nil {
+		after = *cursor
+	}
+
+	rows, err := store.SelectTopPageQuery.Query(ctx, app.db, pageSize+1, after.Score, after.ID, store.TagsJSON(tags))
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	entries, err := store.ScanEntries(rows)
+	if err != nil {
+		return page, err
+	}
+	if len(entries) > pageSize {
+		entries = entries[:pageSize]
+		last := entries[len(entries)-1]
+		page.NextCursor = leaderboardCursor{Score: last.Score, ID: last.ID}.encode()
+	}
+	if entries != nil {
+		page.Entries = entries
+	}
+	return page, nil
+}
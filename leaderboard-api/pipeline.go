@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/anticheat"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// Default stage order, overridable with SUBMISSION_PIPELINE_STAGES
+	defaultPipelineStages = "schema,identity,ban,rate,plausibility,runlog,reputation"
+
+	// Reputation: sessions with repeated suspicious rejections are blocked for a while
+	cacheKeySessionReputation = "anticheat:reputation:session:%s"
+	reputationWindow          = 1 * time.Hour
+	maxSuspiciousRejections   = 5
+)
+
+// SubmissionStage is a single step of the score submission pipeline.
+type SubmissionStage = anticheat.Stage[*ScoreSubmission]
+
+// StageFunc adapts a plain function to the SubmissionStage interface.
+type StageFunc = anticheat.StageFunc[*ScoreSubmission]
+
+// stageFactories holds every stage that can be named in the pipeline configuration.
+var (
+	stageFactoriesMu sync.Mutex
+	stageFactories   = map[string]func(app *App) SubmissionStage{}
+)
+
+// RegisterStage makes a stage available to the pipeline configuration by name.
+func RegisterStage(name string, factory func(app *App) SubmissionStage) {
+	stageFactoriesMu.Lock()
+	defer stageFactoriesMu.Unlock()
+	if _, exists := stageFactories[name]; exists {
+		panic(fmt.Sprintf("submission stage %q registered twice", name))
+	}
+	stageFactories[name] = factory
+}
+
+func init() {
+	RegisterStage("schema", func(app *App) SubmissionStage {
+		return StageFunc{StageName: "schema", Fn: app.checkSchema}
+	})
+	RegisterStage("identity", func(app *App) SubmissionStage {
+		return StageFunc{StageName: "identity", Fn: checkIdentity}
+	})
+	RegisterStage("rate", func(app *App) SubmissionStage {
+		return StageFunc{StageName: "rate", Fn: app.gameRateCheck}
+	})
+	RegisterStage("plausibility", func(app *App) SubmissionStage {
+		return StageFunc{StageName: "plausibility", Fn: app.gamePlausibilityCheck}
+	})
+	RegisterStage("reputation", func(app *App) SubmissionStage {
+		return StageFunc{StageName: "reputation", Fn: app.reputationCheck(maxSuspiciousRejections)}
+	})
+}
+
+// submissionPipeline runs the configured stages in order, stopping at the first rejection.
+type submissionPipeline struct {
+	app    *App
+	stages []SubmissionStage
+}
+
+// newSubmissionPipeline builds the named stages in order. The schema stage
+// always runs first, wherever it is listed and even when it is left out: the
+// later stages and the scores table rely on the bounds it checks.
+func newSubmissionPipeline(app *App, names []string) (*submissionPipeline, error) {
+	stageFactoriesMu.Lock()
+	defer stageFactoriesMu.Unlock()
+
+	pipeline := &submissionPipeline{app: app}
+	for _, name := range append([]string{"schema"}, names...) {
+		name = strings.TrimSpace(name)
+		if name == "" || (name == "schema" && len(pipeline.stages) > 0) {
+			continue
+		}
+		factory, ok := stageFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown submission stage %q", name)
+		}
+		pipeline.stages = append(pipeline.stages, factory(app))
+	}
+	return pipeline, nil
+}
+
+func (p *submissionPipeline) names() []string {
+	names := make([]string, len(p.stages))
+	for i, stage := range p.stages {
+		names[i] = stage.Name()
+	}
+	return names
+}
+
+// has reports whether the pipeline runs the stage called name.
+func (p *submissionPipeline) has(name string) bool {
+	for _, stage := range p.stages {
+		if stage.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// run returns the names of the stages it ran, the last of them the one that
+// rejected the submission if any did.
+func (p *submissionPipeline) run(ctx context.Context, submission *ScoreSubmission) ([]string, error) {
+	outcomes := make([]stageOutcome, 0, len(p.stages)+2)
+	defer func() {
+		p.app.recordAnticheatOutcomes(ctx, outcomes)
+	}()
+
+	ran := make([]string, 0, len(p.stages))
+	for _, stage := range p.stages {
+		ran = append(ran, stage.Name())
+		outcomes = append(outcomes, stageOutcome{stage: stage.Name(), outcome: outcomeEvaluated})
+		if err := p.runStage(ctx, stage, submission); err != nil {
+			outcomes = append(outcomes, stageOutcome{stage: stage.Name(), outcome: outcomeRejected})
+			if anticheat.IsSuspicious(err) {
+				outcomes = append(outcomes, stageOutcome{stage: stage.Name(), outcome: outcomeFlagged})
+				p.app.recordSuspicious(ctx, submission.SessionID)
+			}
+			return ran, err
+		}
+	}
+	return ran, nil
+}
+
+func (p *submissionPipeline) runStage(ctx context.Context, stage SubmissionStage, submission *ScoreSubmission) error {
+	ctx, span := tracer.Start(ctx, "stage."+stage.Name())
+	defer span.End()
+
+	start := time.Now()
+	err := stage.Check(ctx, submission)
+
+	outcome := "passed"
+	if err != nil {
+		outcome = "rejected"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		submissionStageRejections.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("stage", stage.Name()),
+			attribute.Bool("suspicious", anticheat.IsSuspicious(err)),
+		))
+	}
+	span.SetAttributes(attribute.String("stage.outcome", outcome))
+	submissionStageDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("stage", stage.Name()),
+		attribute.String("outcome", outcome),
+	))
+
+	return err
+}
+
+func (app *App) validateScore(ctx context.Context, submission *ScoreSubmission) error {
+	ctx, span := tracer.Start(ctx, "validateScore")
+	defer span.End()
+
+	start := time.Now()
+	defer func() {
+		scoreValidationDuration.Record(ctx, time.Since(start).Seconds())
+	}()
+
+	ran, err := app.pipeline.run(ctx, submission)
+	app.runExperiments(ctx, submission, ran, err)
+	app.compareCandidatePipeline(ctx, submission, err)
+	if err != nil {
+		if anticheat.IsSuspicious(err) {
+			span.SetAttributes(attribute.Bool("validation.suspicious", true))
+		}
+		// Stages return plain errors for bad runs; those with a kind keep it
+		var domainErr *handlers.DomainError
+		if !errors.As(err, &domainErr) {
+			err = handlers.NewError(handlers.ErrValidation, err.Error(), err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (app *App) checkSchema(ctx context.Context, submission *ScoreSubmission) error {
+	if submission.PlayerName == "" {
+		submission.PlayerName = "Anonymous"
+	}
+	if len(submission.PlayerName) > 100 {
+		return fmt.Errorf("player name too long (max 100 characters)")
+	}
+	if submission.Score < 0 {
+		return anticheat.Suspicious(fmt.Errorf("invalid score: negative value"))
+	}
+	if submission.SpiceCollected < 0 || submission.SpiceCollected > maxSpicePerRun {
+		return anticheat.Suspicious(fmt.Errorf("invalid spice collected (0-%d)", maxSpicePerRun))
+	}
+	if submission.SessionID == "" {
+		return fmt.Errorf("session ID required")
+	}
+	if len(submission.SessionID) > 100 {
+		return fmt.Errorf("session ID too long (max 100 characters)")
+	}
+	if err := checkTags(ctx, submission); err != nil {
+		return err
+	}
+	if err := checkExtras(ctx, submission); err != nil {
+		return err
+	}
+	if err := app.checkBiome(ctx, submission); err != nil {
+		return err
+	}
+	if err := app.checkInputMethod(ctx, submission); err != nil {
+		return err
+	}
+	return app.checkGameMode(ctx, submission)
+}
+
+func checkIdentity(ctx context.Context, submission *ScoreSubmission) error {
+	submission.PlayerName = strings.TrimSpace(submission.PlayerName)
+	if submission.PlayerName == "" {
+		submission.PlayerName = "Anonymous"
+	}
+	for _, r := range submission.PlayerName {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("player name contains control characters")
+		}
+	}
+	// '#' is reserved for discriminators, so "Paul#4821" cannot be typed in
+	if strings.ContainsRune(submission.PlayerName, '#') {
+		return fmt.Errorf("player name must not contain '#'")
+	}
+	if len(submission.PlayerID) > 100 {
+		return fmt.Errorf("player ID too long (max 100 characters)")
+	}
+	return nil
+}
+
+// plausibilityCheck rejects scores above the given ceiling.
+func plausibilityCheck(maxScore int) func(ctx context.Context, submission *ScoreSubmission) error {
+	return func(ctx context.Context, submission *ScoreSubmission) error {
+		// Anti-cheat: Check for unrealistic scores
+		if submission.Score > maxScore {
+			return anticheat.Suspicious(fmt.Errorf("score too high (max %d)", maxScore))
+		}
+		return nil
+	}
+}
+
+// gamePlausibilityCheck applies the score ceiling of the submission's game mode,
+// scaled to its input method. Verified runners may go past it.
+func (app *App) gamePlausibilityCheck(ctx context.Context, submission *ScoreSubmission) error {
+	rule, _ := app.rules.lookup(submission.Mode, submission.Difficulty)
+	err := plausibilityCheck(app.inputScoreCeiling(rule.MaxScore, submission.InputMethod))(ctx, submission)
+	return app.bypassCeiling(ctx, submission, err)
+}
+
+// gameRateCheck applies the submission interval of the submission's game mode.
+func (app *App) gameRateCheck(ctx context.Context, submission *ScoreSubmission) error {
+	rule, _ := app.rules.lookup(submission.Mode, submission.Difficulty)
+	return app.checkSubmissionRate(ctx, submission.SessionID, rule.minInterval())
+}
+
+// submissionRateCheck rejects sessions submitting more often than minInterval.
+func (app *App) submissionRateCheck(minInterval time.Duration) func(ctx context.Context, submission *ScoreSubmission) error {
+	return func(ctx context.Context, submission *ScoreSubmission) error {
+		return app.checkSubmissionRate(ctx, submission.SessionID, minInterval)
+	}
+}
+
+func (app *App) checkSubmissionRate(ctx context.Context, sessionID string, minInterval time.Duration) error {
+	ctx, span := tracer.Start(ctx, "checkSubmissionRate")
+	defer span.End()
+
+	lastSubmission, found, err := app.store.LastSubmission(ctx, sessionID)
+	if err != nil || !found {
+		// No previous submission found, allow this one
+		return nil
+	}
+
+	timeSinceLastSubmission := time.Since(lastSubmission)
+	if timeSinceLastSubmission < minInterval {
+		span.SetAttributes(
+			attribute.String("anti_cheat.reason", "submission_rate_exceeded"),
+			attribute.Float64("time_since_last_submission_seconds", timeSinceLastSubmission.Seconds()),
+		)
+		// Not suspicious: a player retrying on a flaky network trips it too, and
+		// shouldn't end up blocked by reputationCheck for it
+		return handlers.NewError(handlers.ErrRateLimited,
+			fmt.Sprintf("please wait %v between submissions", minInterval-timeSinceLastSubmission), nil)
+	}
+
+	return nil
+}
+
+// reputationCheck blocks sessions with maxRejections or more recent suspicious rejections.
+func (app *App) reputationCheck(maxRejections int) func(ctx context.Context, submission *ScoreSubmission) error {
+	return func(ctx context.Context, submission *ScoreSubmission) error {
+		key := fmt.Sprintf(cacheKeySessionReputation, submission.SessionID)
+		count, err := app.redis.Get(ctx, key).Int()
+		if err != nil {
+			// No history (or Redis unavailable), nothing to hold against the session
+			return nil
+		}
+		if count >= maxRejections {
+			return fmt.Errorf("session temporarily blocked after repeated suspicious submissions")
+		}
+		return nil
+	}
+}
+
+// recordSuspicious counts a suspicious rejection against the session's reputation.
+func (app *App) recordSuspicious(ctx context.Context, sessionID string) {
+	if sessionID == "" {
+		return
+	}
+	key := fmt.Sprintf(cacheKeySessionReputation, sessionID)
+	pipe := app.redis.TxPipeline()
+	pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, reputationWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to record suspicious submission: %v", err)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// PlayerRename is the body of POST /admin/players/{name}/rename.
+type PlayerRename struct {
+	Name string `json:"name"`
+}
+
+// PlayerMerge is the body of POST /admin/players/{name}/merge.
+type PlayerMerge struct {
+	Into string `json:"into"`
+}
+
+// PlayerChange reports how much history an admin player action touched.
+type PlayerChange struct {
+	PlayerName string `json:"playerName"`
+	Scores     int64  `json:"scores"`
+}
+
+var (
+	// errPlayerNotFound means no score or identity uses the name.
+	errPlayerNotFound = handlers.NewError(handlers.ErrNotFound, "Player not found", nil)
+	// errPlayerNameTaken means a rename target already has scores or an identity.
+	errPlayerNameTaken = handlers.NewError(handlers.ErrConflict, "Name is taken; merge the players instead", nil)
+)
+
+// validAdminPlayerName applies the submission name rules to names set by
+// operators.
+func validAdminPlayerName(name string) error {
+	if name == "" || name == anonymousPlayerName {
+		return fmt.Errorf("name must not be empty or %q", anonymousPlayerName)
+	}
+	if len(name) > 100 {
+		return fmt.Errorf("name too long (max 100 characters)")
+	}
+	if strings.ContainsRune(name, '#') {
+		return fmt.Errorf("name must not contain '#'")
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("name contains control characters")
+		}
+	}
+	return nil
+}
+
+// deleteScoreHandler removes a score for good, whatever its state.
+func (app *App) deleteScoreHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "deleteScore")
+	defer span.End()
+
+	scoreID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid score ID", http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.Int("score.id", scoreID))
+
+	var playerName string
+	err = store.DeleteScoreQuery.QueryRow(ctx, app.db, scoreID).Scan(&playerName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Score not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to delete score", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🛡️ Score %d deleted", scoreID)
+
+	app.rankingRemove(ctx, scoreID)
+	app.invalidateCache(ctx)
+	app.invalidateRecords(ctx)
+	app.dropCachedPlayerStats(ctx, playerName)
+	app.markSurrogateKeys(ctx, surrogateKeyLeaderboard, surrogateKeyPlayer(playerName))
+	app.publishChange(ctx)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// renamePlayerHandler renames a player's scores, spice total and identity.
+// The new name must be unused; merge players to combine histories.
+func (app *App) renamePlayerHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "renamePlayer")
+	defer span.End()
+
+	oldName := mux.Vars(r)["name"]
+	var req PlayerRename
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if err := validAdminPlayerName(req.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.String("player.name", oldName), attribute.String("player.new_name", req.Name))
+
+	change, err := app.renamePlayer(ctx, oldName, req.Name)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		err = errPlayerNameTaken
+	}
+	if err != nil {
+		span.RecordError(err)
+		handlers.WriteError(w, err, "Failed to rename player")
+		return
+	}
+	log.Printf("🛡️ Player %s renamed to %s", oldName, req.Name)
+
+	app.refreshLeaderboard(ctx, oldName, req.Name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(change)
+}
+
+func (app *App) renamePlayer(ctx context.Context, oldName, newName string) (*PlayerChange, error) {
+	tx, err := app.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	taken, err := store.ScanExists(store.PlayerNameTakenQuery.QueryRow(ctx, tx, newName))
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, errPlayerNameTaken
+	}
+
+	scores, err := store.RenameScoresQuery.Exec(ctx, tx, oldName, newName)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := store.RenameIdentityQuery.Exec(ctx, tx, oldName, newName)
+	if err != nil {
+		return nil, err
+	}
+	if scores.RowsAffected() == 0 && identity.RowsAffected() == 0 {
+		return nil, errPlayerNotFound
+	}
+	if _, err := store.RenameSpiceQuery.Exec(ctx, tx, oldName, newName); err != nil {
+		return nil, err
+	}
+	if _, err := store.RenameReignsQuery.Exec(ctx, tx, oldName, newName); err != nil {
+		return nil, err
+	}
+	if _, err := store.RenameArchivedScoresQuery.Exec(ctx, tx, oldName, newName); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &PlayerChange{PlayerName: newName, Scores: scores.RowsAffected()}, nil
+}
+
+// mergePlayerHandler moves every score and the spice total of one player to
+// another, for players who ended up with two names.
+func (app *App) mergePlayerHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "mergePlayer")
+	defer span.End()
+
+	from := mux.Vars(r)["name"]
+	var req PlayerMerge
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Into == "" || req.Into == from {
+		http.Error(w, "into must name another player", http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.String("player.name", from), attribute.String("player.merged_into", req.Into))
+
+	change, err := app.mergePlayer(ctx, from, req.Into)
+	if err != nil {
+		span.RecordError(err)
+		handlers.WriteError(w, err, "Failed to merge players")
+		return
+	}
+	log.Printf("🛡️ Player %s merged into %s (%d scores)", from, req.Into, change.Scores)
+
+	app.refreshLeaderboard(ctx, from, req.Into)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(change)
+}
+
+func (app *App) mergePlayer(ctx context.Context, from, into string) (*PlayerChange, error) {
+	tx, err := app.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	scores, err := store.RenameScoresQuery.Exec(ctx, tx, from, into)
+	if err != nil {
+		return nil, err
+	}
+	if scores.RowsAffected() == 0 {
+		return nil, errPlayerNotFound
+	}
+	if _, err := store.MergeSpiceQuery.Exec(ctx, tx, from, into); err != nil {
+		return nil, err
+	}
+	if _, err := store.RenameReignsQuery.Exec(ctx, tx, from, into); err != nil {
+		return nil, err
+	}
+	if _, err := store.RenameArchivedScoresQuery.Exec(ctx, tx, from, into); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &PlayerChange{PlayerName: into, Scores: scores.RowsAffected()}, nil
+}
+
+// purgePlayerHandler deletes a player's scores (archived ones too), reports,
+// spice total, identity and shadow ban. Ended seasons' standings and reward artifacts are left as
+// they were published.
+func (app *App) purgePlayerHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "purgePlayer")
+	defer span.End()
+
+	playerName := mux.Vars(r)["name"]
+	span.SetAttributes(attribute.String("player.name", playerName))
+
+	change, err := app.purgePlayer(ctx, playerName)
+	if err != nil {
+		span.RecordError(err)
+		handlers.WriteError(w, err, "Failed to purge player")
+		return
+	}
+	log.Printf("🛡️ Player %s purged (%d scores)", playerName, change.Scores)
+
+	app.refreshLeaderboard(ctx, playerName)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(change)
+}
+
+func (app *App) purgePlayer(ctx context.Context, playerName string) (*PlayerChange, error) {
+	tx, err := app.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	change, err := purgePlayerTx(ctx, tx, playerName)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// purgePlayerTx deletes a player's rows within tx.
+func purgePlayerTx(ctx context.Context, tx pgx.Tx, playerName string) (*PlayerChange, error) {
+	// Reports go with their scores (ON DELETE CASCADE)
+	scores, err := store.DeletePlayerScoresQuery.Exec(ctx, tx, playerName)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := store.DeleteIdentityQuery.Exec(ctx, tx, playerName)
+	if err != nil {
+		return nil, err
+	}
+	spice, err := store.DeleteSpiceQuery.Exec(ctx, tx, playerName)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := store.DeleteArchivedScoresQuery.Exec(ctx, tx, playerName)
+	if err != nil {
+		return nil, err
+	}
+	if scores.RowsAffected() == 0 && identity.RowsAffected() == 0 && spice.RowsAffected() == 0 &&
+		archived.RowsAffected() == 0 {
+		return nil, errPlayerNotFound
+	}
+	if _, err := store.DeletePlayerShadowBanQuery.Exec(ctx, tx, playerName); err != nil {
+		return nil, err
+	}
+	if _, err := store.DeleteReignsQuery.Exec(ctx, tx, playerName); err != nil {
+		return nil, err
+	}
+	return &PlayerChange{PlayerName: playerName, Scores: scores.RowsAffected() + archived.RowsAffected()}, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	anonymousPlayerName = "Anonymous"
+
+	// Attempts at finding a free discriminator before giving up
+	maxDiscriminatorAttempts = 10
+
+	// Postgres unique_violation
+	pgUniqueViolation = "23505"
+)
+
+// Player is a stable identity that owns a display name. The first identity to
+// use a name gets it bare; later ones get a four-digit discriminator.
+type Player struct {
+	ID            string
+	DisplayName   string
+	Discriminator string
+}
+
+// TaggedName is the name shown on the leaderboard, e.g. "Paul#4821".
+func (p *Player) TaggedName() string {
+	if p.Discriminator == "" {
+		return p.DisplayName
+	}
+	return p.DisplayName + "#" + p.Discriminator
+}
+
+func randomDiscriminator() string {
+	return fmt.Sprintf("%04d", rand.Intn(10000))
+}
+
+// resolvePlayer binds the submission's display name to its player identity and
+// rewrites PlayerName to the tagged name. Anonymous submissions keep their
+// name as-is, as do those without a player ID unless an account owns it.
+func (app *App) resolvePlayer(ctx context.Context, submission *ScoreSubmission) (*Player, error) {
+	if submission.PlayerName == anonymousPlayerName {
+		return nil, nil
+	}
+
+	ctx, span := tracer.Start(ctx, "resolvePlayer")
+	defer span.End()
+
+	start := time.Now()
+	defer func() {
+		store.ObserveQuery(ctx, "resolve_player", start)
+	}()
+
+	// Account names are only bare for their owners: with no identity to tag,
+	// a submission can't use one at all
+	accountName, err := app.players.AccountNameTaken(ctx, submission.PlayerName)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to look up account name: %w", err)
+	}
+	if submission.PlayerID == "" {
+		if accountName {
+			return nil, errAccountRequired
+		}
+		return nil, nil
+	}
+
+	identity, err := app.players.Identity(ctx, submission.PlayerID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to look up player: %w", err)
+	}
+	player := &Player{ID: submission.PlayerID}
+	if identity != nil {
+		player.DisplayName = identity.DisplayName
+		player.Discriminator = identity.Discriminator
+	}
+
+	// Only the account's owner submits as it, and always under its own name
+	if identity != nil && identity.Registered {
+		if submission.accountID != player.ID {
+			return nil, errAccountRequired
+		}
+		submission.PlayerName = player.TaggedName()
+		span.SetAttributes(attribute.String("player.tagged_name", submission.PlayerName))
+		return player, nil
+	}
+
+	if identity != nil && player.DisplayName == submission.PlayerName {
+		submission.PlayerName = player.TaggedName()
+		span.SetAttributes(attribute.String("player.tagged_name", submission.PlayerName))
+		return player, nil
+	}
+
+	// New identity or renamed player: claim the bare name if it is free,
+	// otherwise pick a random discriminator. An account's name, in any case,
+	// is never free.
+	player.DisplayName = submission.PlayerName
+	for attempt := 0; attempt < maxDiscriminatorAttempts; attempt++ {
+		player.Discriminator = ""
+		if attempt > 0 || accountName {
+			player.Discriminator = randomDiscriminator()
+		}
+
+		err := app.players.SaveIdentity(ctx, &store.Identity{
+			PlayerID:      player.ID,
+			DisplayName:   player.DisplayName,
+			Discriminator: player.Discriminator,
+		})
+		if err == nil {
+			submission.PlayerName = player.TaggedName()
+			span.SetAttributes(
+				attribute.String("player.tagged_name", submission.PlayerName),
+				attribute.Int("player.discriminator_attempts", attempt+1),
+			)
+			return player, nil
+		}
+		if !errors.Is(err, store.ErrNameTaken) {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to save player: %w", err)
+		}
+	}
+
+	return nil, fmt.Errorf("no free discriminator for %q", submission.PlayerName)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Plugin is an optional module, such as tournaments or ghosts, compiled in
+// with a build tag. Its file registers it from init:
+//
+//	//go:build tournaments
+//
+//	func init() { registerPlugin(&tournamentsPlugin{}) }
+//
+// Plugins live in package main, so they use App, the tracer and the stores
+// like any other file. A plugin adds migrations and metrics by also
+// implementing MigrationPlugin and MetricsPlugin.
+type Plugin interface {
+	// Name identifies the plugin in logs and the startup report.
+	Name() string
+	// Init runs once the App is configured, before any routes are served.
+	// Background jobs should stop when ctx is done. An error stops startup.
+	Init(ctx context.Context, app *App) error
+	// RegisterRoutes adds the plugin's routes.
+	RegisterRoutes(routes *PluginRoutes)
+}
+
+// MigrationPlugin is a plugin with tables of its own.
+type MigrationPlugin interface {
+	Plugin
+	// Migrations holds the plugin's migrations at its root, named like
+	// those in migrations/; fs.Sub of an embed.FS fits. They share one
+	// sequence with the core ones, so each plugin numbers its own from a
+	// block of 1000 (1000-1999, 2000-2999, ...).
+	Migrations() fs.FS
+}
+
+// MetricsPlugin is a plugin with instruments of its own.
+type MetricsPlugin interface {
+	Plugin
+	// RegisterMetrics creates the plugin's instruments, right after the
+	// core ones in initMetrics.
+	RegisterMetrics(meter metric.Meter) error
+}
+
+var plugins []Plugin
+
+// registerPlugin adds a plugin to the build. It is only called from init.
+func registerPlugin(p Plugin) {
+	for _, registered := range plugins {
+		if registered.Name() == p.Name() {
+			panic(fmt.Sprintf("plugin %q registered twice", p.Name()))
+		}
+	}
+	plugins = append(plugins, p)
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name() < plugins[j].Name() })
+}
+
+// pluginNames lists the plugins in this build.
+func pluginNames() []string {
+	names := make([]string, len(plugins))
+	for i, p := range plugins {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// PluginRoutes is where a plugin adds its routes. Core routes are registered
+// first and win over a plugin's route for the same path.
+type PluginRoutes struct {
+	public []*mux.Router
+	admin  *mux.Router
+}
+
+// HandlePublic serves a public route both at the root and under the ingress
+// prefix, like the core API routes.
+func (r *PluginRoutes) HandlePublic(path string, handler http.HandlerFunc, methods ...string) {
+	for _, router := range r.public {
+		router.HandleFunc(path, handler).Methods(methods...)
+	}
+}
+
+// HandleAdmin serves a route under /admin, behind admin auth and auditing.
+func (r *PluginRoutes) HandleAdmin(path string, handler http.HandlerFunc, methods ...string) {
+	r.admin.HandleFunc(path, handler).Methods(methods...)
+}
+
+// registerPluginMetrics creates every plugin's instruments.
+func registerPluginMetrics() error {
+	for _, p := range plugins {
+		if mp, ok := p.(MetricsPlugin); ok {
+			if err := mp.RegisterMetrics(meter); err != nil {
+				return fmt.Errorf("plugin %s: %w", p.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// initPlugins initializes every plugin, in name order.
+func (app *App) initPlugins(ctx context.Context) error {
+	for _, p := range plugins {
+		if err := p.Init(ctx, app); err != nil {
+			return fmt.Errorf("plugin %s: %w", p.Name(), err)
+		}
+		log.Printf("✅ Plugin %s enabled", p.Name())
+	}
+	return nil
+}
+
+// registerPluginRoutes lets every plugin add its routes.
+func registerPluginRoutes(apiRouter, router, adminRouter *mux.Router) {
+	routes := &PluginRoutes{public: []*mux.Router{apiRouter, router}, admin: adminRouter}
+	for _, p := range plugins {
+		p.RegisterRoutes(routes)
+	}
+}
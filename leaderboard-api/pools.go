@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Both pools size themselves from runtime.NumCPU by default, which counts the
+// node's cores rather than the pod's CPU limit, so on a large node every
+// replica opens far more connections than its limit can use. The settings
+// below pin them instead.
+
+// configurePool sizes the Postgres pool from DB_MAX_CONNS, DB_MIN_CONNS,
+// DB_MAX_CONN_LIFETIME and DB_MAX_CONN_IDLE_TIME. Unset, the pool keeps pgx's
+// defaults or the pool_* parameters of DATABASE_URL.
+func configurePool(config *pgxpool.Config) error {
+	if raw := getEnv("DB_MAX_CONNS", ""); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("DB_MAX_CONNS must be a positive number")
+		}
+		config.MaxConns = int32(n)
+	}
+	if raw := getEnv("DB_MIN_CONNS", ""); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return fmt.Errorf("DB_MIN_CONNS must be a non-negative number")
+		}
+		config.MinConns = int32(n)
+	}
+	if config.MinConns > config.MaxConns {
+		return fmt.Errorf("DB_MIN_CONNS (%d) must not exceed DB_MAX_CONNS (%d)", config.MinConns, config.MaxConns)
+	}
+	if raw := getEnv("DB_MAX_CONN_LIFETIME", ""); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("DB_MAX_CONN_LIFETIME must be a positive duration")
+		}
+		config.MaxConnLifetime = d
+	}
+	if raw := getEnv("DB_MAX_CONN_IDLE_TIME", ""); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("DB_MAX_CONN_IDLE_TIME must be a positive duration")
+		}
+		config.MaxConnIdleTime = d
+	}
+	return nil
+}
+
+// configureRedisPool sizes the Redis pool from REDIS_POOL_SIZE,
+// REDIS_MIN_IDLE_CONNS, REDIS_CONN_MAX_LIFETIME and REDIS_POOL_TIMEOUT.
+// Unset, go-redis's defaults are kept.
+func configureRedisPool(opts *redis.Options) error {
+	if raw := getEnv("REDIS_POOL_SIZE", ""); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("REDIS_POOL_SIZE must be a positive number")
+		}
+		opts.PoolSize = n
+	}
+	if raw := getEnv("REDIS_MIN_IDLE_CONNS", ""); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return fmt.Errorf("REDIS_MIN_IDLE_CONNS must be a non-negative number")
+		}
+		opts.MinIdleConns = n
+	}
+	if opts.PoolSize > 0 && opts.MinIdleConns > opts.PoolSize {
+		return fmt.Errorf("REDIS_MIN_IDLE_CONNS (%d) must not exceed REDIS_POOL_SIZE (%d)", opts.MinIdleConns, opts.PoolSize)
+	}
+	if raw := getEnv("REDIS_CONN_MAX_LIFETIME", ""); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("REDIS_CONN_MAX_LIFETIME must be a positive duration")
+		}
+		opts.ConnMaxLifetime = d
+	}
+	if raw := getEnv("REDIS_POOL_TIMEOUT", ""); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("REDIS_POOL_TIMEOUT must be a positive duration")
+		}
+		opts.PoolTimeout = d
+	}
+	return nil
+}
+
+// registerPoolMetrics reports the Postgres pools' (the primary's, and the
+// replica's when hedging uses one) and the Redis pool's stats at every
+// collection.
+func (app *App) registerPoolMetrics() error {
+	dbConns, err := meter.Int64ObservableGauge("db.pool.connections",
+		metric.WithDescription("Postgres pool connections, by state (acquired, idle or constructing)"))
+	if err != nil {
+		return err
+	}
+	dbMaxConns, err := meter.Int64ObservableGauge("db.pool.max_connections",
+		metric.WithDescription("Largest number of connections the Postgres pool opens"))
+	if err != nil {
+		return err
+	}
+	dbAcquires, err := meter.Int64ObservableCounter("db.pool.acquires",
+		metric.WithDescription("Postgres connections acquired from the pool, by whether the acquire waited for one"))
+	if err != nil {
+		return err
+	}
+	dbCanceledAcquires, err := meter.Int64ObservableCounter("db.pool.canceled_acquires",
+		metric.WithDescription("Postgres connection acquires cancelled before a connection was free"))
+	if err != nil {
+		return err
+	}
+	dbAcquireWait, err := meter.Float64ObservableCounter("db.pool.acquire.wait",
+		metric.WithDescription("Total time spent acquiring Postgres connections from the pool"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return err
+	}
+	redisConns, err := meter.Int64ObservableGauge("redis.pool.connections",
+		metric.WithDescription("Redis pool connections, by state (total, idle or stale)"))
+	if err != nil {
+		return err
+	}
+	redisAcquires, err := meter.Int64ObservableCounter("redis.pool.acquires",
+		metric.WithDescription("Redis connections taken from the pool, by result (hit, miss or timeout)"))
+	if err != nil {
+		return err
+	}
+
+	pools := map[string]*pgxpool.Pool{"primary": app.db}
+	if app.hedger != nil && app.hedger.Replica() != nil {
+		pools["replica"] = app.hedger.Replica()
+	}
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for name, pool := range pools {
+			stat := pool.Stat()
+			attr := attribute.String("db.pool.name", name)
+			state := func(s string) metric.ObserveOption {
+				return metric.WithAttributes(attr, attribute.String("db.pool.state", s))
+			}
+			o.ObserveInt64(dbConns, int64(stat.AcquiredConns()), state("acquired"))
+			o.ObserveInt64(dbConns, int64(stat.IdleConns()), state("idle"))
+			o.ObserveInt64(dbConns, int64(stat.ConstructingConns()), state("constructing"))
+			o.ObserveInt64(dbMaxConns, int64(stat.MaxConns()), metric.WithAttributes(attr))
+			waited := stat.EmptyAcquireCount()
+			o.ObserveInt64(dbAcquires, stat.AcquireCount()-waited,
+				metric.WithAttributes(attr, attribute.Bool("db.pool.waited", false)))
+			o.ObserveInt64(dbAcquires, waited,
+				metric.WithAttributes(attr, attribute.Bool("db.pool.waited", true)))
+			o.ObserveInt64(dbCanceledAcquires, stat.CanceledAcquireCount(), metric.WithAttributes(attr))
+			o.ObserveFloat64(dbAcquireWait, stat.AcquireDuration().Seconds(), metric.WithAttributes(attr))
+		}
+
+		stats := app.redis.PoolStats()
+		o.ObserveInt64(redisConns, int64(stats.TotalConns), metric.WithAttributes(attribute.String("redis.pool.state", "total")))
+		o.ObserveInt64(redisConns, int64(stats.IdleConns), metric.WithAttributes(attribute.String("redis.pool.state", "idle")))
+		o.ObserveInt64(redisConns, int64(stats.StaleConns), metric.WithAttributes(attribute.String("redis.pool.state", "stale")))
+		o.ObserveInt64(redisAcquires, int64(stats.Hits), metric.WithAttributes(attribute.String("redis.pool.result", "hit")))
+		o.ObserveInt64(redisAcquires, int64(stats.Misses), metric.WithAttributes(attribute.String("redis.pool.result", "miss")))
+		o.ObserveInt64(redisAcquires, int64(stats.Timeouts), metric.WithAttributes(attribute.String("redis.pool.result", "timeout")))
+		return nil
+	}, dbConns, dbMaxConns, dbAcquires, dbCanceledAcquires, dbAcquireWait, redisConns, redisAcquires)
+	return err
+}
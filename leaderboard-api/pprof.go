@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// defaultPprofAddr keeps profiles on the pod's loopback, reachable only
+// through kubectl port-forward
+const defaultPprofAddr = "127.0.0.1:6060"
+
+// newPprofServerFromEnv returns a server for the net/http/pprof handlers on
+// PPROF_ADDR when PPROF_ENABLED is true, or nil. It has its own listener and
+// mux, so no profile is ever reachable through the ingress or the API port.
+func newPprofServerFromEnv() *http.Server {
+	if getEnv("PPROF_ENABLED", "false") != "true" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return &http.Server{
+		Addr:              getEnv("PPROF_ADDR", defaultPprofAddr),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		// No write timeout: CPU profiles and traces stream for ?seconds
+	}
+}
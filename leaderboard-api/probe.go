@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	probeTimeout  = 5 * time.Second
+	cacheKeyProbe = "probe:%s"
+	probeCacheTTL = time.Minute
+)
+
+// ProbeStep is the result of one step of the full probe.
+type ProbeStep struct {
+	Name       string  `json:"name"`
+	OK         bool    `json:"ok"`
+	DurationMs float64 `json:"durationMs"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// ProbeReport is the response of /probe/full.
+type ProbeReport struct {
+	OK         bool        `json:"ok"`
+	ProbeID    string      `json:"probeId"`
+	DurationMs float64     `json:"durationMs"`
+	Steps      []ProbeStep `json:"steps"`
+	CheckedAt  time.Time   `json:"checkedAt"`
+}
+
+// fullProbeHandler runs a write, read and invalidate cycle through Postgres
+// and Redis, like a score submission does, and reports each step's latency.
+// Probe data lives in probe_scores and probe:* keys, so it never reaches the
+// leaderboard. Steps stop at the first failure; cleanup always runs.
+func (app *App) fullProbeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+	defer cancel()
+	ctx, span := tracer.Start(ctx, "fullProbe")
+	defer span.End()
+
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to start probe", http.StatusInternalServerError)
+		return
+	}
+	probeID := hex.EncodeToString(idBytes)
+	value := int(time.Now().UnixNano() % 1_000_000)
+
+	report := ProbeReport{OK: true, ProbeID: probeID, CheckedAt: time.Now().UTC()}
+	started := time.Now()
+	run := func(name string, step func(ctx context.Context) error) {
+		if !report.OK && name != "cleanup" {
+			return
+		}
+		stepCtx, stepSpan := tracer.Start(ctx, "probe."+name)
+		start := time.Now()
+		err := step(stepCtx)
+		duration := time.Since(start)
+
+		result := ProbeStep{Name: name, OK: err == nil, DurationMs: float64(duration.Microseconds()) / 1000}
+		if err != nil {
+			stepSpan.RecordError(err)
+			result.Error = err.Error()
+			report.OK = false
+		}
+		stepSpan.End()
+		report.Steps = append(report.Steps, result)
+		probeStepDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(
+			attribute.String("probe.step", name),
+			attribute.Bool("probe.ok", err == nil),
+		))
+	}
+
+	var scoreID int
+	cacheKey := fmt.Sprintf(cacheKeyProbe, probeID)
+
+	run("db_write", func(ctx context.Context) error {
+		return store.InsertProbeScoreQuery.QueryRow(ctx, app.db, probeID, value).Scan(&scoreID)
+	})
+	run("db_read", func(ctx context.Context) error {
+		var got int
+		if err := store.ProbeScoreQuery.QueryRow(ctx, app.db, scoreID).Scan(&got); err != nil {
+			return err
+		}
+		if got != value {
+			return fmt.Errorf("read back %d, wrote %d", got, value)
+		}
+		return nil
+	})
+	run("cache_write", func(ctx context.Context) error {
+		return app.redis.Set(ctx, cacheKey, strconv.Itoa(value), probeCacheTTL).Err()
+	})
+	run("cache_read", func(ctx context.Context) error {
+		got, err := app.redis.Get(ctx, cacheKey).Result()
+		if err != nil {
+			return err
+		}
+		if got != strconv.Itoa(value) {
+			return fmt.Errorf("read back %q, wrote %d", got, value)
+		}
+		return nil
+	})
+	run("cache_invalidate", func(ctx context.Context) error {
+		if err := app.redis.Del(ctx, cacheKey).Err(); err != nil {
+			return err
+		}
+		n, err := app.redis.Exists(ctx, cacheKey).Result()
+		if err != nil {
+			return err
+		}
+		if n != 0 {
+			return fmt.Errorf("key still cached after delete")
+		}
+		return nil
+	})
+	// Also clears rows left behind by probes that timed out
+	run("cleanup", func(ctx context.Context) error {
+		app.redis.Del(ctx, cacheKey)
+		_, err := store.DeleteProbeScoresQuery.Exec(ctx, app.db, scoreID)
+		return err
+	})
+
+	report.DurationMs = float64(time.Since(started).Microseconds()) / 1000
+	span.SetAttributes(attribute.Bool("probe.ok", report.OK), attribute.String("probe.id", probeID))
+	if !report.OK {
+		log.Printf("⚠️ Full probe %s failed", probeID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !report.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// Only one replica publishes per debounce window
+	cacheKeyPublishLock = "leaderboard:publish:lock"
+)
+
+// StaticLeaderboard is the document written to object storage for CDN fallback.
+type StaticLeaderboard struct {
+	GeneratedAt time.Time          `json:"generatedAt"`
+	Entries     []LeaderboardEntry `json:"entries"`
+}
+
+// s3Publisher writes objects to any S3-compatible store (AWS S3, GCS interop
+// with HMAC keys, MinIO) using path-style URLs and SigV4 signing.
+type s3Publisher struct {
+	endpoint     string
+	bucket       string
+	key          string
+	region       string
+	accessKey    string
+	secretKey    string
+	cacheControl string
+	topN         int
+	debounce     time.Duration
+	client       *http.Client
+}
+
+// newS3PublisherFromEnv returns nil when static publishing is not configured.
+func newS3PublisherFromEnv() *s3Publisher {
+	bucket := getEnv("PUBLISH_S3_BUCKET", "")
+	if bucket == "" {
+		return nil
+	}
+
+	topN, err := strconv.Atoi(getEnv("PUBLISH_TOP_N", "100"))
+	if err != nil || topN <= 0 {
+		topN = 100
+	}
+	debounce, err := time.ParseDuration(getEnv("PUBLISH_DEBOUNCE", "5s"))
+	if err != nil || debounce <= 0 {
+		debounce = 5 * time.Second
+	}
+
+	return &s3Publisher{
+		endpoint:     strings.TrimSuffix(getEnv("PUBLISH_S3_ENDPOINT", "https://s3.amazonaws.com"), "/"),
+		bucket:       bucket,
+		key:          strings.TrimPrefix(getEnv("PUBLISH_S3_KEY", "leaderboard/top.json"), "/"),
+		region:       getEnv("PUBLISH_S3_REGION", "us-east-1"),
+		accessKey:    getEnv("PUBLISH_S3_ACCESS_KEY_ID", ""),
+		secretKey:    getEnv("PUBLISH_S3_SECRET_ACCESS_KEY", ""),
+		cacheControl: getEnv("PUBLISH_CACHE_CONTROL", "public, max-age=30"),
+		topN:         topN,
+		debounce:     debounce,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// runPublisher republishes the static leaderboard after each burst of changes.
+func (app *App) runPublisher(ctx context.Context, p *s3Publisher) {
+	log.Printf("✅ Static leaderboard publishing to %s/%s/%s", p.endpoint, p.bucket, p.key)
+
+	// Publish once at startup so the CDN copy exists before the first change
+	app.publishStatic(ctx, p)
+
+	app.followChanges(ctx, cacheKeyPublishLock, p.debounce, func(ctx context.Context) {
+		app.publishStatic(ctx, p)
+	})
+}
+
+func (app *App) publishStatic(ctx context.Context, p *s3Publisher) {
+	ctx, span := tracer.Start(ctx, "publishStaticLeaderboard")
+	defer span.End()
+
+	start := time.Now()
+	result := "success"
+	defer func() {
+		staticPublishTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("result", result)))
+		staticPublishDuration.Record(ctx, time.Since(start).Seconds())
+	}()
+
+	entries, err := app.queryTopScores(ctx, p.topN, nil)
+	if err != nil {
+		result = "query_failed"
+		span.RecordError(err)
+		log.Printf("Failed to query leaderboard for publishing: %v", err)
+		return
+	}
+	if entries == nil {
+		entries = []LeaderboardEntry{}
+	}
+
+	// The object is public, so it is masked like the board it mirrors
+	entries = maskEntries(app.nameMask(), entries)
+	body, err := json.Marshal(StaticLeaderboard{GeneratedAt: time.Now().UTC(), Entries: entries})
+	if err != nil {
+		result = "encode_failed"
+		span.RecordError(err)
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("publish.entries", len(entries)),
+		attribute.Int("publish.bytes", len(body)),
+	)
+
+	if err := p.put(ctx, body); err != nil {
+		result = "upload_failed"
+		span.RecordError(err)
+		log.Printf("Failed to publish static leaderboard: %v", err)
+	}
+}
+
+// put uploads body to the configured object.
+func (p *s3Publisher) put(ctx context.Context, body []byte) error {
+	return p.putObject(ctx, p.key, "application/json", body)
+}
+
+// putObject uploads body to key in the bucket with a SigV4-signed PUT.
+func (p *s3Publisher) putObject(ctx context.Context, key, contentType string, body []byte) error {
+	objectURL, err := url.Parse(p.endpoint + "/" + p.bucket + "/" + key)
+	if err != nil {
+		return fmt.Errorf("invalid object URL: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if p.cacheControl != "" {
+		req.Header.Set("Cache-Control", p.cacheControl)
+	}
+	p.sign(req, body, time.Now().UTC())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("object store returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// sign adds AWS Signature Version 4 headers for the s3 service.
+func (p *s3Publisher) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if p.accessKey == "" {
+		return
+	}
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	if cacheControl := req.Header.Get("Cache-Control"); cacheControl != "" {
+		signedHeaders = "cache-control;" + signedHeaders
+		canonicalHeaders = "cache-control:" + cacheControl + "\n" + canonicalHeaders
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + p.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+p.secretKey), date)
+	key = hmacSHA256(key, p.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		p.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
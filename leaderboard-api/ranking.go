@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// Sorted set of every visible score this season. Postgres stays the source
+	// of truth; the set is rebuilt from it whenever the ready marker is missing.
+	cacheKeyRanking        = "leaderboard:ranking"
+	cacheKeyRankingReady   = "leaderboard:ranking:ready"
+	cacheKeyRankingRebuild = "leaderboard:ranking:rebuild"
+	cacheKeyRankingLock    = "leaderboard:ranking:lock"
+
+	rankingRebuildBatch = 1000
+	rankingLockTTL      = 5 * time.Minute
+)
+
+// errRankingUnavailable means the sorted set can't be trusted right now and the
+// caller should fall back to Postgres.
+var errRankingUnavailable = handlers.NewError(handlers.ErrStoreUnavailable, "ranking unavailable", nil)
+
+// rankingMember encodes a score ID so that, among equal scores, ZREVRANGE
+// returns older (lower) IDs first, matching ORDER BY score DESC, id.
+func rankingMember(scoreID int) string {
+	return fmt.Sprintf("%010d", math.MaxInt32-scoreID)
+}
+
+func rankingScoreID(member string) (int, error) {
+	n, err := strconv.Atoi(member)
+	if err != nil {
+		return 0, err
+	}
+	return math.MaxInt32 - n, nil
+}
+
+// rankingReady reports whether the sorted set is complete. If it isn't, a
+// rebuild is started in the background.
+func (app *App) rankingReady(ctx context.Context) bool {
+	ready, err := app.redis.Exists(ctx, cacheKeyRankingReady).Result()
+	if err != nil {
+		return false
+	}
+	if ready == 0 {
+		go app.rebuildRanking(context.WithoutCancel(ctx))
+		return false
+	}
+	return true
+}
+
+// rankingAdd records a visible score. It is safe to call while a rebuild is in
+// progress; the rebuild picks up anything added after its snapshot.
+func (app *App) rankingAdd(ctx context.Context, scoreID, score int) {
+	start := time.Now()
+	defer func() {
+		redisOpDuration.Record(ctx, time.Since(start).Seconds(),
+			metric.WithAttributes(attribute.String("operation", "zadd")))
+	}()
+
+	err := app.redis.ZAdd(ctx, cacheKeyRanking, redis.Z{Score: float64(score), Member: rankingMember(scoreID)}).Err()
+	if err != nil {
+		log.Printf("Failed to add score %d to ranking: %v", scoreID, err)
+	}
+}
+
+// rankingRemove drops a quarantined or deleted score.
+func (app *App) rankingRemove(ctx context.Context, scoreID int) {
+	if err := app.redis.ZRem(ctx, cacheKeyRanking, rankingMember(scoreID)).Err(); err != nil {
+		log.Printf("Failed to remove score %d from ranking: %v", scoreID, err)
+	}
+}
+
+// rankingPosition returns the 1-based position of a score on the board.
+func (app *App) rankingPosition(ctx context.Context, scoreID int) (int, error) {
+	if !app.rankingReady(ctx) {
+		return 0, errRankingUnavailable
+	}
+	rank, err := app.redis.ZRevRank(ctx, cacheKeyRanking, rankingMember(scoreID)).Result()
+	if err != nil {
+		return 0, err
+	}
+	return int(rank) + 1, nil
+}
+
+// rankingRankOf returns the rank a score value would have: one more than the
+// number of strictly higher scores.
+func (app *App) rankingRankOf(ctx context.Context, score int) (int, error) {
+	if !app.rankingReady(ctx) {
+		return 0, errRankingUnavailable
+	}
+	higher, err := app.redis.ZCount(ctx, cacheKeyRanking, "("+strconv.Itoa(score), "+inf").Result()
+	if err != nil {
+		return 0, err
+	}
+	return int(higher) + 1, nil
+}
+
+// rankingTop returns the IDs of the top limit scores, best first.
+func (app *App) rankingTop(ctx context.Context, limit int) ([]int, error) {
+	if !app.rankingReady(ctx) {
+		return nil, errRankingUnavailable
+	}
+
+	start := time.Now()
+	members, err := app.redis.ZRevRange(ctx, cacheKeyRanking, 0, int64(limit-1)).Result()
+	redisOpDuration.Record(ctx, time.Since(start).Seconds(),
+		metric.WithAttributes(attribute.String("operation", "zrevrange")))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(members))
+	for _, member := range members {
+		id, err := rankingScoreID(member)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// rebuildRanking reloads the sorted set from Postgres into a temporary key and
+// swaps it in atomically. Only one replica rebuilds at a time.
+func (app *App) rebuildRanking(ctx context.Context) {
+	acquired, err := app.redis.SetNX(ctx, cacheKeyRankingLock, 1, rankingLockTTL).Result()
+	if err != nil || !acquired {
+		return
+	}
+	defer app.redis.Del(ctx, cacheKeyRankingLock)
+
+	ctx, span := tracer.Start(ctx, "rebuildRanking")
+	defer span.End()
+	start := time.Now()
+
+	rows, err := store.RankedScoresQuery.Query(ctx, app.db)
+	if err != nil {
+		span.RecordError(err)
+		log.Printf("Failed to rebuild ranking: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	app.redis.Del(ctx, cacheKeyRankingRebuild)
+	batch := make([]redis.Z, 0, rankingRebuildBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := app.redis.ZAdd(ctx, cacheKeyRankingRebuild, batch...).Err()
+		batch = batch[:0]
+		return err
+	}
+
+	count, lastID := 0, 0
+	for rows.Next() {
+		var id, score int
+		if err := rows.Scan(&id, &score); err != nil {
+			span.RecordError(err)
+			log.Printf("Failed to rebuild ranking: %v", err)
+			return
+		}
+		batch = append(batch, redis.Z{Score: float64(score), Member: rankingMember(id)})
+		count++
+		lastID = id
+		if len(batch) == rankingRebuildBatch {
+			if err := flush(); err != nil {
+				span.RecordError(err)
+				log.Printf("Failed to rebuild ranking: %v", err)
+				return
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		log.Printf("Failed to rebuild ranking: %v", err)
+		return
+	}
+	if err := flush(); err != nil {
+		span.RecordError(err)
+		log.Printf("Failed to rebuild ranking: %v", err)
+		return
+	}
+
+	// An empty board has nothing to rename; clear any partial set instead
+	pipe := app.redis.TxPipeline()
+	if count > 0 {
+		pipe.Rename(ctx, cacheKeyRankingRebuild, cacheKeyRanking)
+	} else {
+		pipe.Del(ctx, cacheKeyRanking)
+	}
+	pipe.Set(ctx, cacheKeyRankingReady, time.Now().UTC().Format(time.RFC3339), 0)
+	if _, err := pipe.Exec(ctx); err != nil {
+		span.RecordError(err)
+		log.Printf("Failed to swap in rebuilt ranking: %v", err)
+		return
+	}
+
+	// Scores submitted while we were reading went into the old set; add them again
+	app.catchUpRanking(ctx, lastID)
+
+	span.SetAttributes(attribute.Int("ranking.entries", count))
+	log.Printf("✅ Rebuilt ranking with %d scores in %v", count, time.Since(start).Round(time.Millisecond))
+}
+
+func (app *App) catchUpRanking(ctx context.Context, afterID int) {
+	rows, err := store.RankedScoresAfterQuery.Query(ctx, app.db, afterID)
+	if err != nil {
+		log.Printf("Failed to catch up ranking: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, score int
+		if err := rows.Scan(&id, &score); err != nil {
+			log.Printf("Failed to catch up ranking: %v", err)
+			return
+		}
+		app.rankingAdd(ctx, id, score)
+	}
+}
+
+// rankedTopScores reads the top limit scores using the sorted set for ordering
+// and Postgres for the entry details.
+func (app *App) rankedTopScores(ctx context.Context, limit int) ([]LeaderboardEntry, error) {
+	ids, err := app.rankingTop(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	rows, err := store.SelectTopByIDQuery.Query(ctx, app.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := pgx.CollectRows(rows, store.ScanEntryDetails)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]LeaderboardEntry, len(entries))
+	for _, entry := range entries {
+		byID[entry.ID] = entry
+	}
+
+	leaderboard := make([]LeaderboardEntry, 0, len(ids))
+	for _, id := range ids {
+		entry, ok := byID[id]
+		if !ok {
+			// Deleted since it was ranked
+			continue
+		}
+		entry.Rank = len(leaderboard) + 1
+		leaderboard = append(leaderboard, entry)
+	}
+	return leaderboard, nil
+}
+
+// postgresPosition is rankingPosition answered by Postgres: equal scores are
+// ordered by ID, like the board.
+func (app *App) postgresPosition(ctx context.Context, scoreID, score int) (int, error) {
+	var rank int
+	err := store.PositionQuery.QueryRow(ctx, app.db, score, scoreID).Scan(&rank)
+	return rank, err
+}
+
+// postgresTopIDs is rankingTop answered by Postgres.
+func (app *App) postgresTopIDs(ctx context.Context, limit int) ([]int, error) {
+	rows, err := store.TopIDsQuery.Query(ctx, app.db, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0, limit)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/cache"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	cacheKeyRecords    = "leaderboard:records"
+	cacheKeyRecordBest = "leaderboard:records:best"
+
+	// The standing record's reign grows while cached, so the cache expires
+	// even when no record is broken
+	defaultRecordsCacheTTL = 10 * time.Minute
+)
+
+// WorldRecord is one score that beat every visible score before it.
+type WorldRecord struct {
+	ID         int       `json:"id"`
+	PlayerName string    `json:"playerName"`
+	Score      int       `json:"score"`
+	SetAt      time.Time `json:"setAt"`
+	// BrokenAt is unset for the standing record
+	BrokenAt *time.Time `json:"brokenAt,omitempty"`
+	// HeldForSeconds runs until BrokenAt, or ComputedAt for the standing record
+	HeldForSeconds int64 `json:"heldForSeconds"`
+}
+
+type RecordProgression struct {
+	Records    []WorldRecord `json:"records"`
+	ComputedAt time.Time     `json:"computedAt"`
+}
+
+// getRecordsHandler returns the world record's progression, oldest first.
+func (app *App) getRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getRecords")
+	defer span.End()
+
+	ttl := app.cfg().CacheTTLs.Records
+
+	var progression *RecordProgression
+	if cached, err := app.cache.Get(ctx, cacheKeyRecords); err == nil && json.Unmarshal(cached, &progression) == nil {
+		cacheHitTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "records")))
+	} else {
+		cacheMissTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "records")))
+
+		progression, err = app.recordProgression(ctx)
+		if err != nil {
+			span.RecordError(err)
+			http.Error(w, "Failed to fetch records", http.StatusInternalServerError)
+			return
+		}
+		if data, err := json.Marshal(progression); err == nil {
+			app.cache.Set(ctx, cacheKeyRecords, data, ttl)
+			if n := len(progression.Records); n > 0 {
+				cache.SetInt64(ctx, app.cache, cacheKeyRecordBest, int64(progression.Records[n-1].Score), ttl)
+			}
+		}
+	}
+	span.SetAttributes(attribute.Int("records.count", len(progression.Records)))
+
+	mask := app.nameMask()
+	for i := range progression.Records {
+		progression.Records[i].PlayerName = mask(progression.Records[i].PlayerName)
+	}
+	app.setEdgeCacheHeaders(w, surrogateKeyLeaderboard)
+	handlers.EncodeCacheableJSON(w, r, progression, ttl)
+}
+
+// recordProgression derives the records from score history across every
+// season. A score that only ties the record doesn't take it.
+func (app *App) recordProgression(ctx context.Context) (*RecordProgression, error) {
+	rows, err := store.RecordProgressionQuery.Query(ctx, app.db)
+	if err != nil {
+		return nil, err
+	}
+	records, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (WorldRecord, error) {
+		var record WorldRecord
+		err := row.Scan(&record.ID, &record.PlayerName, &record.Score, &record.SetAt)
+		return record, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	progression := &RecordProgression{Records: []WorldRecord{}, ComputedAt: time.Now().UTC()}
+	progression.Records = append(progression.Records, records...)
+
+	for i := range progression.Records {
+		until := progression.ComputedAt
+		if i+1 < len(progression.Records) {
+			brokenAt := progression.Records[i+1].SetAt
+			progression.Records[i].BrokenAt = &brokenAt
+			until = brokenAt
+		}
+		progression.Records[i].HeldForSeconds = int64(until.Sub(progression.Records[i].SetAt).Seconds())
+	}
+	return progression, nil
+}
+
+// checkRecordBroken drops the cached records when score beats the cached
+// record. Without a cached record there is nothing to drop.
+func (app *App) checkRecordBroken(ctx context.Context, score int) {
+	best, err := cache.GetInt64(ctx, app.cache, cacheKeyRecordBest)
+	if err == nil && int64(score) > best {
+		app.invalidateRecords(ctx)
+	}
+}
+
+// invalidateRecords drops the cached records, for changes to scores already
+// on the board: deletions, moderation, renames, restores.
+func (app *App) invalidateRecords(ctx context.Context) {
+	if err := app.cache.Del(ctx, cacheKeyRecords, cacheKeyRecordBest); err != nil {
+		log.Printf("Failed to invalidate records: %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	cacheKeyReigns = "leaderboard:reigns"
+	// Only one replica checks for a new #1 per debounce window
+	cacheKeyReignLock = "leaderboard:reigns:lock"
+
+	// Reigns grow while cached, like the records
+	defaultReignsCacheTTL = 10 * time.Minute
+	reignSyncDebounce     = 5 * time.Second
+	defaultReignsLimit    = 25
+	maxReignsLimit        = 100
+)
+
+// Reign is one spell at #1 of a season's board.
+type Reign struct {
+	PlayerName string    `json:"playerName"`
+	SeasonID   int       `json:"seasonId"`
+	Score      int       `json:"score"`
+	StartedAt  time.Time `json:"startedAt"`
+	// EndedAt is unset for the current reign
+	EndedAt *time.Time `json:"endedAt,omitempty"`
+	Seconds int64      `json:"seconds"`
+}
+
+// ReignTotal is a player's time at #1 across every season.
+type ReignTotal struct {
+	PlayerName      string  `json:"playerName"`
+	Reigns          int     `json:"reigns"`
+	Seconds         int64   `json:"seconds"`
+	DaysAtNumberOne float64 `json:"daysAtNumberOne"`
+}
+
+type ReignStats struct {
+	// Current is unset while the current season's board is empty
+	Current    *Reign       `json:"current,omitempty"`
+	Longest    *Reign       `json:"longest,omitempty"`
+	Players    []ReignTotal `json:"players"`
+	ComputedAt time.Time    `json:"computedAt"`
+}
+
+// maskNames masks the holders' names.
+func (s *ReignStats) maskNames(mask func(string) string) {
+	for _, reign := range []*Reign{s.Current, s.Longest} {
+		if reign != nil {
+			reign.PlayerName = mask(reign.PlayerName)
+		}
+	}
+	for i := range s.Players {
+		s.Players[i].PlayerName = mask(s.Players[i].PlayerName)
+	}
+}
+
+// ReignStartedEvent announces a new #1. PreviousHolder is empty when the
+// board was empty or a new season began.
+type ReignStartedEvent struct {
+	PlayerName     string    `json:"playerName"`
+	PreviousHolder string    `json:"previousHolder,omitempty"`
+	SeasonID       int       `json:"seasonId"`
+	Score          int       `json:"score"`
+	StartedAt      time.Time `json:"startedAt"`
+}
+
+// runReignTracker records who holds #1 after each burst of changes, on one
+// replica at a time.
+func (app *App) runReignTracker(ctx context.Context) {
+	// The #1 may have changed while no replica was running
+	app.syncReign(ctx)
+
+	app.followChanges(ctx, cacheKeyReignLock, reignSyncDebounce, app.syncReign)
+}
+
+// syncReign ends the open reign and starts one for the current #1 when the
+// two differ. Beating your own score at #1 continues the same reign.
+func (app *App) syncReign(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "syncReign")
+	defer span.End()
+
+	top, err := app.queryTopScores(ctx, 1, nil)
+	if err != nil {
+		span.RecordError(err)
+		log.Printf("Failed to read #1 for reigns: %v", err)
+		return
+	}
+
+	started, err := app.startReign(ctx, top)
+	if err != nil {
+		span.RecordError(err)
+		log.Printf("Failed to record reign: %v", err)
+		return
+	}
+	if started == nil {
+		return
+	}
+	span.SetAttributes(attribute.String("reign.player", started.PlayerName))
+	app.invalidateReigns(ctx)
+	if started.PlayerName != "" {
+		log.Printf("👑 %s is #1 with %d", started.PlayerName, started.Score)
+		app.emitEvent(ctx, eventTypeReignStarted, started.PlayerName, started)
+	}
+}
+
+// startReign returns the reign it started, an event with no player when it
+// only ended one, or nil when #1 is unchanged.
+func (app *App) startReign(ctx context.Context, top []LeaderboardEntry) (*ReignStartedEvent, error) {
+	start := time.Now()
+	defer func() {
+		store.ObserveQuery(ctx, "sync_reign", start)
+	}()
+
+	tx, err := app.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var holder string
+	var sameSeason bool
+	err = store.LockOpenReignQuery.QueryRow(ctx, tx).Scan(&holder, &sameSeason)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	open := err == nil
+	if !open && len(top) == 0 {
+		return nil, nil
+	}
+	if open && sameSeason && len(top) > 0 && top[0].PlayerName == holder {
+		return nil, nil
+	}
+
+	event := &ReignStartedEvent{}
+	if open {
+		if _, err := store.EndReignQuery.Exec(ctx, tx); err != nil {
+			return nil, err
+		}
+		if sameSeason {
+			event.PreviousHolder = holder
+		}
+	}
+	if len(top) > 0 {
+		event.PlayerName, event.Score = top[0].PlayerName, top[0].Score
+		err := store.StartReignQuery.QueryRow(ctx, tx, event.PlayerName, event.Score).Scan(&event.SeasonID, &event.StartedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return event, tx.Commit(ctx)
+}
+
+// getReignsHandler returns the current and longest reigns at #1 and the
+// players with the most time there (?limit, default 25, max 100).
+func (app *App) getReignsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getReigns")
+	defer span.End()
+
+	limit := defaultReignsLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 || parsed > maxReignsLimit {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	field := strconv.Itoa(limit)
+	ttl := app.cfg().CacheTTLs.Reigns
+
+	var stats *ReignStats
+	if cached, err := app.cache.HGet(ctx, cacheKeyReigns, field); err == nil && json.Unmarshal(cached, &stats) == nil {
+		cacheHitTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "reigns")))
+	} else {
+		cacheMissTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "reigns")))
+
+		stats, err = app.reignStats(ctx, limit)
+		if err != nil {
+			span.RecordError(err)
+			http.Error(w, "Failed to fetch reigns", http.StatusInternalServerError)
+			return
+		}
+		if data, err := json.Marshal(stats); err == nil {
+			app.cache.HSet(ctx, cacheKeyReigns, field, data, ttl)
+		}
+	}
+
+	stats.maskNames(app.nameMask())
+	app.setEdgeCacheHeaders(w, surrogateKeyLeaderboard)
+	handlers.EncodeCacheableJSON(w, r, stats, ttl)
+}
+
+func (app *App) reignStats(ctx context.Context, limit int) (*ReignStats, error) {
+	start := time.Now()
+	stats := &ReignStats{Players: []ReignTotal{}, ComputedAt: time.Now().UTC()}
+
+	var err error
+	if stats.Current, err = app.queryReign(ctx, store.CurrentReignQuery); err != nil {
+		return nil, err
+	}
+	if stats.Longest, err = app.queryReign(ctx, store.LongestReignQuery); err != nil {
+		return nil, err
+	}
+
+	rows, err := store.ReignTotalsQuery.Query(ctx, app.db, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var total ReignTotal
+		if err := rows.Scan(&total.PlayerName, &total.Reigns, &total.Seconds); err != nil {
+			return nil, err
+		}
+		total.DaysAtNumberOne = daysAtNumberOne(total.Seconds)
+		stats.Players = append(stats.Players, total)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	store.ObserveQuery(ctx, "reign_stats", start)
+	return stats, nil
+}
+
+// queryReign returns the reign query selects, or nil.
+func (app *App) queryReign(ctx context.Context, query store.NamedQuery) (*Reign, error) {
+	var reign Reign
+	err := query.QueryRow(ctx, app.db).Scan(&reign.PlayerName, &reign.SeasonID, &reign.Score, &reign.StartedAt, &reign.EndedAt, &reign.Seconds)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reign, nil
+}
+
+// playerDaysAtNumberOne is a player's total time at #1 across every season.
+func (app *App) playerDaysAtNumberOne(ctx context.Context, playerName string) (float64, error) {
+	var seconds int64
+	err := store.PlayerReignSecondsQuery.QueryRow(ctx, app.db, playerName).Scan(&seconds)
+	return daysAtNumberOne(seconds), err
+}
+
+// daysAtNumberOne rounds seconds to hundredths of a day.
+func daysAtNumberOne(seconds int64) float64 {
+	return math.Round(float64(seconds)/86400*100) / 100
+}
+
+// invalidateReigns drops the cached reigns, for renames, merges and erasures
+// that change who held #1 without a new #1.
+func (app *App) invalidateReigns(ctx context.Context) {
+	if err := app.cache.Del(ctx, cacheKeyReigns); err != nil {
+		log.Printf("Failed to invalidate reigns: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// reloadableSettings are the Config keys a reload applies. Everything else
+// is read once at startup and keeps its value until a restart.
+var reloadableSettings = map[string]bool{
+	"cacheTTL":                        true,
+	"cacheMode":                       true,
+	"cacheStaleTTL":                   true,
+	"cacheTTLs.filteredBoards":        true,
+	"cacheTTLs.records":               true,
+	"cacheTTLs.reigns":                true,
+	"cacheTTLs.spiceStats":            true,
+	"cacheTTLs.playerStats":           true,
+	"cacheTTLs.playerRank":            true,
+	"featuredRotation":                true,
+	"antiCheat.maxScore":              true,
+	"antiCheat.minSubmissionInterval": true,
+	"submissions.schemaMinVersion":    true,
+	"submissions.idempotencyTTL":      true,
+	"submissions.maxBodyBytes":        true,
+	"privacy.nameMasking":             true,
+	"privacy.maskedPlayers":           true,
+}
+
+// cfg is the current configuration, which a reload may replace at any time.
+func (app *App) cfg() *Config {
+	return app.config.Load()
+}
+
+// watchConfigReloads reloads the configuration on SIGHUP, and when
+// CONFIG_RELOAD_INTERVAL is set, whenever CONFIG_FILE's contents change, as
+// they do when Kubernetes updates a mounted ConfigMap.
+func (app *App) watchConfigReloads(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var poll <-chan time.Time
+	path := getEnv("CONFIG_FILE", "")
+	if interval, err := time.ParseDuration(getEnv("CONFIG_RELOAD_INTERVAL", "0s")); err == nil && interval > 0 && path != "" {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	lastSum := configFileSum(path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			lastSum = configFileSum(path)
+			app.reloadConfig(ctx, "signal")
+		case <-poll:
+			if sum := configFileSum(path); sum != lastSum {
+				lastSum = sum
+				app.reloadConfig(ctx, "file")
+			}
+		}
+	}
+}
+
+// configFileSum hashes the config file, or returns zero when it can't be read.
+func configFileSum(path string) [sha256.Size]byte {
+	if path == "" {
+		return [sha256.Size]byte{}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}
+	}
+	return sha256.Sum256(data)
+}
+
+// reloadConfig loads the configuration again and applies its reloadable
+// settings. An invalid configuration is rejected whole, keeping the current
+// one.
+func (app *App) reloadConfig(ctx context.Context, trigger string) {
+	ctx, span := tracer.Start(ctx, "reloadConfig")
+	defer span.End()
+
+	result := "applied"
+	defer func() {
+		configReloadsTotal.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("reload_trigger", trigger),
+			attribute.String("reload_result", result),
+		))
+	}()
+
+	next, err := loadConfig()
+	if err != nil {
+		result = "invalid"
+		span.RecordError(err)
+		log.Printf("⚠️ Config reload (%s) rejected, keeping the current config: %v", trigger, err)
+		return
+	}
+
+	current := app.cfg()
+	var applied, ignored []string
+	for _, key := range configChanges(reflect.ValueOf(*current), reflect.ValueOf(*next), "") {
+		if reloadableSettings[key] {
+			applied = append(applied, key)
+		} else {
+			ignored = append(ignored, key)
+		}
+	}
+	if len(ignored) > 0 {
+		log.Printf("⚠️ Config reload (%s): %s need a restart to change", trigger, strings.Join(ignored, ", "))
+	}
+	if len(applied) == 0 {
+		result = "unchanged"
+		log.Printf("🔄 Config reload (%s): nothing to apply", trigger)
+		return
+	}
+
+	updated := *current
+	updated.CacheTTL = next.CacheTTL
+	updated.CacheMode = next.CacheMode
+	updated.CacheStaleTTL = next.CacheStaleTTL
+	updated.CacheTTLs = next.CacheTTLs
+	updated.FeaturedRotation = next.FeaturedRotation
+	updated.AntiCheat.MaxScore = next.AntiCheat.MaxScore
+	updated.AntiCheat.MinSubmissionInterval = next.AntiCheat.MinSubmissionInterval
+	updated.Submissions.SchemaMinVersion = next.Submissions.SchemaMinVersion
+	updated.Submissions.IdempotencyTTL = next.Submissions.IdempotencyTTL
+	updated.Submissions.MaxBodyBytes = next.Submissions.MaxBodyBytes
+	updated.Privacy = next.Privacy
+	app.config.Store(&updated)
+	app.rules.setBuiltin(updated.builtinGameRule())
+	if updated.Privacy != current.Privacy {
+		// Caches keep real names, but the CDN and the published board hold
+		// responses masked under the old policy
+		app.markSurrogateKeys(ctx, surrogateKeyLeaderboard)
+		app.publishChange(ctx)
+	}
+
+	span.SetAttributes(attribute.StringSlice("config.changed", applied))
+	log.Printf("🔄 Config reload (%s) applied: %s", trigger, strings.Join(applied, ", "))
+}
+
+// configChanges returns the yaml keys, dotted, whose values differ between
+// two configs.
+func configChanges(a, b reflect.Value, prefix string) []string {
+	var changed []string
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := prefix + strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if field.Type.Kind() == reflect.Struct {
+			changed = append(changed, configChanges(a.Field(i), b.Field(i), key+".")...)
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changed = append(changed, key)
+		}
+	}
+	return changed
+}
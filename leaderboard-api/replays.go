@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/anticheat"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// replaySampler stores the event logs of a sample of accepted runs, so
+// anti-cheat analysts can look at real play when tuning the rules.
+type replaySampler struct {
+	rate   float64
+	prefix string
+	store  *s3Publisher
+}
+
+// SessionReplay is the object stored for a sampled run, as gzip-compressed
+// JSON under <prefix>/<scoreId>.json.gz.
+type SessionReplay struct {
+	ScoreID        int    `json:"scoreId"`
+	PlayerName     string `json:"playerName"`
+	SessionID      string `json:"sessionId"`
+	Score          int    `json:"score"`
+	SpiceCollected int    `json:"spiceCollected"`
+	Mode           string `json:"mode,omitempty"`
+	Difficulty     string `json:"difficulty,omitempty"`
+	Biome          string `json:"biome,omitempty"`
+	InputMethod    string `json:"inputMethod,omitempty"`
+	// QuarantineReason is set when the score was stored hidden
+	QuarantineReason string               `json:"quarantineReason,omitempty"`
+	CreatedAt        time.Time            `json:"createdAt"`
+	Events           []anticheat.RunEvent `json:"events"`
+}
+
+// newReplaySamplerFromEnv returns nil unless REPLAY_SAMPLE_RATE is above 0.
+// The object store settings default to the static publisher's, apart from
+// the bucket.
+func newReplaySamplerFromEnv() (*replaySampler, error) {
+	rate, err := strconv.ParseFloat(getEnv("REPLAY_SAMPLE_RATE", "0"), 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("REPLAY_SAMPLE_RATE must be between 0 and 1")
+	}
+	if rate == 0 {
+		return nil, nil
+	}
+	bucket := getEnv("REPLAY_S3_BUCKET", "")
+	if bucket == "" {
+		return nil, fmt.Errorf("REPLAY_SAMPLE_RATE needs REPLAY_S3_BUCKET")
+	}
+
+	return &replaySampler{
+		rate:   rate,
+		prefix: strings.Trim(getEnv("REPLAY_S3_PREFIX", "replays"), "/"),
+		store: &s3Publisher{
+			endpoint:  strings.TrimSuffix(getEnv("REPLAY_S3_ENDPOINT", getEnv("PUBLISH_S3_ENDPOINT", "https://s3.amazonaws.com")), "/"),
+			bucket:    bucket,
+			region:    getEnv("REPLAY_S3_REGION", getEnv("PUBLISH_S3_REGION", "us-east-1")),
+			accessKey: getEnv("REPLAY_S3_ACCESS_KEY_ID", getEnv("PUBLISH_S3_ACCESS_KEY_ID", "")),
+			secretKey: getEnv("REPLAY_S3_SECRET_ACCESS_KEY", getEnv("PUBLISH_S3_SECRET_ACCESS_KEY", "")),
+			client:    &http.Client{Timeout: 30 * time.Second},
+		},
+	}, nil
+}
+
+// sampleReplay uploads the run's event log in the background when the run is
+// sampled. Runs without an event log are never sampled.
+func (app *App) sampleReplay(ctx context.Context, scoreID int, createdAt time.Time, submission *ScoreSubmission) {
+	if app.replays == nil || submission.EventLog == "" || rand.Float64() >= app.replays.rate {
+		return
+	}
+	replay := SessionReplay{
+		ScoreID:          scoreID,
+		PlayerName:       submission.PlayerName,
+		SessionID:        submission.SessionID,
+		Score:            submission.Score,
+		SpiceCollected:   submission.SpiceCollected,
+		Mode:             submission.Mode,
+		Difficulty:       submission.Difficulty,
+		Biome:            submission.Biome,
+		InputMethod:      submission.InputMethod,
+		QuarantineReason: submission.quarantineReason(),
+		CreatedAt:        createdAt,
+	}
+	go app.uploadReplay(context.WithoutCancel(ctx), replay, submission.EventLog)
+}
+
+func (app *App) uploadReplay(ctx context.Context, replay SessionReplay, eventLog string) {
+	ctx, span := tracer.Start(ctx, "uploadReplay")
+	defer span.End()
+
+	result := "success"
+	defer func() {
+		replayUploadsTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("replay_result", result)))
+	}()
+
+	// The runlog stage has usually decoded it already, but may be disabled
+	events, err := anticheat.DecodeRunLog(eventLog)
+	if err != nil {
+		result = "invalid_log"
+		return
+	}
+	replay.Events = events
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	if err := json.NewEncoder(zw).Encode(replay); err != nil {
+		result = "encode_failed"
+		span.RecordError(err)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		result = "encode_failed"
+		span.RecordError(err)
+		return
+	}
+
+	key := fmt.Sprintf("%s/%d.json.gz", app.replays.prefix, replay.ScoreID)
+	span.SetAttributes(
+		attribute.String("replay.key", key),
+		attribute.Int("replay.events", len(events)),
+		attribute.Int("replay.bytes", body.Len()),
+	)
+	if err := app.replays.store.putObject(ctx, key, "application/gzip", body.Bytes()); err != nil {
+		result = "upload_failed"
+		span.RecordError(err)
+		log.Printf("Failed to upload replay of score %d: %v", replay.ScoreID, err)
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	defaultReportQuarantineThreshold = 3
+	maxReportReasonLength            = 500
+
+	// Reports each reporter, and each client address, may file per hour
+	defaultReportRateLimit = 10
+	cacheKeyReportRate     = "reports:rate:%s:%d"
+)
+
+// ReportSubmission is a report against a score. The reporter is the player
+// the request proves to be, never a field of the body: with a made-up ID per
+// report anyone could reach the quarantine threshold alone.
+type ReportSubmission struct {
+	ScoreID int    `json:"scoreId"`
+	Reason  string `json:"reason"`
+}
+
+type ReportResponse struct {
+	ScoreID     int  `json:"scoreId"`
+	Reports     int  `json:"reports"`
+	Quarantined bool `json:"quarantined"`
+}
+
+type ModerationItem struct {
+	ScoreID          int        `json:"scoreId"`
+	PlayerName       string     `json:"playerName"`
+	Score            int        `json:"score"`
+	SessionID        string     `json:"sessionId"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	Quarantined      bool       `json:"quarantined"`
+	QuarantinedAt    *time.Time `json:"quarantinedAt,omitempty"`
+	QuarantineReason string     `json:"quarantineReason,omitempty"`
+	OpenReports      int        `json:"openReports"`
+	Reasons          []string   `json:"reasons"`
+}
+
+type ModerationResolution struct {
+	Action string `json:"action"`
+}
+
+func reportQuarantineThreshold() int {
+	threshold, err := strconv.Atoi(getEnv("REPORT_QUARANTINE_THRESHOLD", strconv.Itoa(defaultReportQuarantineThreshold)))
+	if err != nil || threshold <= 0 {
+		return defaultReportQuarantineThreshold
+	}
+	return threshold
+}
+
+func reportRateLimit() int {
+	limit, err := strconv.Atoi(getEnv("REPORT_RATE_LIMIT", strconv.Itoa(defaultReportRateLimit)))
+	if err != nil || limit <= 0 {
+		return defaultReportRateLimit
+	}
+	return limit
+}
+
+// reportingPlayer returns the ID of the player filing a report: the account's
+// from its bearer token, or an anonymous identity's from X-Player-Id when it
+// names a player without a password.
+func (app *App) reportingPlayer(ctx context.Context, r *http.Request) (string, error) {
+	claims, err := app.accounts.authenticate(r.Header.Get("Authorization"))
+	if err != nil {
+		return "", err
+	}
+	if claims != nil {
+		return claims.Subject, nil
+	}
+
+	playerID := r.Header.Get(playerIDHeader)
+	if playerID == "" || len(playerID) > 100 {
+		return "", errPlayerNotVerified
+	}
+	var anonymous bool
+	if err := store.AnonymousPlayerQuery.QueryRow(ctx, app.db, playerID).Scan(&anonymous); err != nil {
+		return "", err
+	}
+	if !anonymous {
+		return "", errPlayerNotVerified
+	}
+	return playerID, nil
+}
+
+// clientAddress is the address a request came from, as seen by the proxy in
+// front of the API when there is one.
+func clientAddress(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		return strings.TrimSpace(hops[len(hops)-1])
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// allowReport counts a report against its reporter's and its address's
+// hourly limit. It fails open when Redis is unavailable, and returns how long
+// to wait otherwise.
+func (app *App) allowReport(ctx context.Context, reporterID, address string) (bool, time.Duration) {
+	now := time.Now()
+	window := now.Unix() / 3600
+	pipe := app.redis.TxPipeline()
+	var counts []*redis.IntCmd
+	for _, subject := range []string{"player:" + reporterID, "addr:" + address} {
+		counterKey := fmt.Sprintf(cacheKeyReportRate, subject, window)
+		counts = append(counts, pipe.Incr(ctx, counterKey))
+		pipe.Expire(ctx, counterKey, 2*time.Hour)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to rate limit report: %v", err)
+		return true, 0
+	}
+	limit := int64(reportRateLimit())
+	for _, count := range counts {
+		if count.Val() > limit {
+			return false, time.Unix((window+1)*3600, 0).Sub(now)
+		}
+	}
+	return true, 0
+}
+
+func (app *App) submitReportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "submitReport")
+	defer span.End()
+
+	var report ReportSubmission
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	report.Reason = strings.TrimSpace(report.Reason)
+	if report.ScoreID <= 0 {
+		http.Error(w, "score ID required", http.StatusBadRequest)
+		return
+	}
+	if len(report.Reason) > maxReportReasonLength {
+		http.Error(w, fmt.Sprintf("reason too long (max %d characters)", maxReportReasonLength), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.Int("report.score_id", report.ScoreID))
+
+	reporterID, err := app.reportingPlayer(ctx, r)
+	if errors.Is(err, errPlayerNotVerified) || errors.Is(err, errInvalidToken) {
+		http.Error(w, "Sign in, or send your player ID in "+playerIDHeader+", to report scores", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to save report", http.StatusInternalServerError)
+		return
+	}
+	if ok, retryAfter := app.allowReport(ctx, reporterID, clientAddress(r)); !ok {
+		span.SetAttributes(attribute.Bool("report.rate_limited", true))
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		http.Error(w, "Too many reports; try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	start := time.Now()
+	defer func() {
+		store.ObserveQuery(ctx, "submit_report", start)
+	}()
+
+	var quarantined bool
+	var playerName, submissionTrace string
+	err = store.ReportedScoreQuery.QueryRow(ctx, app.db, report.ScoreID).Scan(&quarantined, &playerName, &submissionTrace)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Score not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to save report", http.StatusInternalServerError)
+		return
+	}
+
+	// One report per reporter per score; repeats are accepted but not counted
+	if _, err := store.InsertReportQuery.Exec(ctx, app.db, report.ScoreID, reporterID, report.Reason); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to save report", http.StatusInternalServerError)
+		return
+	}
+	abuseReportsTotal.Add(ctx, 1)
+
+	var openReports int
+	if err := store.OpenReportsQuery.QueryRow(ctx, app.db, report.ScoreID).Scan(&openReports); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to save report", http.StatusInternalServerError)
+		return
+	}
+	span.SetAttributes(attribute.Int("report.open_reports", openReports))
+
+	// Auto-quarantine: hide the score until a moderator resolves it
+	if !quarantined && openReports >= reportQuarantineThreshold() {
+		qctx, qspan := startScoreSpan(ctx, "quarantineScore", report.ScoreID, submissionTrace)
+		tag, err := store.QuarantineReportedScoreQuery.Exec(qctx, app.db, report.ScoreID)
+		if err != nil {
+			qspan.RecordError(err)
+			qspan.End()
+			http.Error(w, "Failed to save report", http.StatusInternalServerError)
+			return
+		}
+		if tag.RowsAffected() > 0 {
+			quarantined = true
+			span.SetAttributes(attribute.Bool("report.quarantined", true))
+			log.Printf("🚩 Score %d quarantined after %d reports", report.ScoreID, openReports)
+			app.recordQuarantine(qctx, "reports")
+			app.rankingRemove(qctx, report.ScoreID)
+			app.invalidateCache(qctx)
+			app.dropCachedPlayerStats(qctx, playerName)
+			app.markSurrogateKeys(qctx, surrogateKeyLeaderboard, surrogateKeyPlayer(playerName))
+			app.publishChange(qctx)
+		}
+		qspan.End()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(ReportResponse{
+		ScoreID:     report.ScoreID,
+		Reports:     openReports,
+		Quarantined: quarantined,
+	})
+}
+
+// getModerationQueueHandler lists quarantined and reported scores, most reported
+// first. Shadow-banned scores are left out unless someone reports them.
+func (app *App) getModerationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getModerationQueue")
+	defer span.End()
+
+	rows, err := store.ModerationQueueQuery.Query(ctx, app.db)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch moderation queue", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	queue := []ModerationItem{}
+	for rows.Next() {
+		var item ModerationItem
+		if err := rows.Scan(&item.ScoreID, &item.PlayerName, &item.Score, &item.SessionID, &item.CreatedAt,
+			&item.Quarantined, &item.QuarantinedAt, &item.QuarantineReason, &item.OpenReports, &item.Reasons); err != nil {
+			log.Printf("Failed to scan row: %v", err)
+			continue
+		}
+		queue = append(queue, item)
+	}
+	span.SetAttributes(attribute.Int("moderation.queue_size", len(queue)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(queue)
+}
+
+// resolveModerationHandler restores a reported score or removes it for good.
+func (app *App) resolveModerationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "resolveModeration")
+	defer span.End()
+
+	scoreID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid score ID", http.StatusBadRequest)
+		return
+	}
+
+	var resolution ModerationResolution
+	if err := json.NewDecoder(r.Body).Decode(&resolution); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("moderation.score_id", scoreID),
+		attribute.String("moderation.action", resolution.Action),
+	)
+
+	var playerName, submissionTrace string
+	var score int
+	var currentSeason bool
+	err = store.ModeratedScoreQuery.QueryRow(ctx, app.db, scoreID).Scan(&playerName, &score, &currentSeason, &submissionTrace)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Score not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to resolve score", http.StatusInternalServerError)
+		return
+	}
+
+	// Both return the score's ID, so a score deleted since the lookup is a 404
+	var query store.NamedQuery
+	switch resolution.Action {
+	case "restore":
+		query = store.RestoreScoreQuery
+	case "remove":
+		query = store.RemoveScoreQuery
+	default:
+		http.Error(w, `action must be "restore" or "remove"`, http.StatusBadRequest)
+		return
+	}
+
+	// The resolution itself is linked to the trace that submitted the score
+	ctx, resolveSpan := startScoreSpan(ctx, "resolveScore", scoreID, submissionTrace)
+	defer resolveSpan.End()
+	resolveSpan.SetAttributes(attribute.String("moderation.action", resolution.Action))
+
+	err = query.QueryRow(ctx, app.db, scoreID).Scan(&scoreID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Score not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		resolveSpan.RecordError(err)
+		http.Error(w, "Failed to resolve score", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🛡️ Moderation: score %d %sd", scoreID, resolution.Action)
+
+	// Scores from past seasons are only in the archive, not the ranking
+	if resolution.Action == "restore" {
+		if currentSeason {
+			app.rankingAdd(ctx, scoreID, score)
+		}
+	} else {
+		app.rankingRemove(ctx, scoreID)
+	}
+
+	app.invalidateCache(ctx)
+	app.invalidateRecords(ctx)
+	app.dropCachedPlayerStats(ctx, playerName)
+	app.markSurrogateKeys(ctx, surrogateKeyLeaderboard, surrogateKeyPlayer(playerName))
+	app.publishChange(ctx)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	retentionModeArchive = "archive"
+	retentionModeDelete  = "delete"
+
+	// Only one replica prunes per interval
+	cacheKeyRetentionLock = "leaderboard:retention:lock"
+
+	// The lowest scores the policy keeps whatever their age, shared so expiry
+	// previews don't each look them up
+	cacheKeyRetentionThresholds = "leaderboard:retention:thresholds"
+	retentionThresholdTTL       = 10 * time.Minute
+)
+
+// RetentionNotice tells a player how the retention policy treats their runs.
+type RetentionNotice = handlers.RetentionNotice
+
+// retentionPolicy decides which scores are kept. A score is pruned once it is
+// older than maxAge and below the keepTop best visible scores of its season;
+// ties with the last of those are kept. Scores awaiting moderation are left
+// for the moderators.
+type retentionPolicy struct {
+	mode      string
+	maxAge    time.Duration
+	keepTop   int
+	batchSize int
+	interval  time.Duration
+}
+
+// newRetentionPolicyFromEnv returns nil unless RETENTION_ENABLED is true.
+func newRetentionPolicyFromEnv() (*retentionPolicy, error) {
+	if getEnv("RETENTION_ENABLED", "false") != "true" {
+		return nil, nil
+	}
+
+	mode := getEnv("RETENTION_MODE", retentionModeArchive)
+	if mode != retentionModeArchive && mode != retentionModeDelete {
+		return nil, fmt.Errorf(`RETENTION_MODE must be "archive" or "delete"`)
+	}
+	maxAge, err := time.ParseDuration(getEnv("RETENTION_MAX_AGE", "2160h"))
+	if err != nil || maxAge <= 0 {
+		return nil, fmt.Errorf("invalid RETENTION_MAX_AGE")
+	}
+	keepTop, err := strconv.Atoi(getEnv("RETENTION_KEEP_TOP", "10000"))
+	if err != nil || keepTop < 0 {
+		return nil, fmt.Errorf("invalid RETENTION_KEEP_TOP")
+	}
+	batchSize, err := strconv.Atoi(getEnv("RETENTION_BATCH_SIZE", "5000"))
+	if err != nil || batchSize <= 0 {
+		return nil, fmt.Errorf("invalid RETENTION_BATCH_SIZE")
+	}
+	interval, err := time.ParseDuration(getEnv("RETENTION_INTERVAL", "24h"))
+	if err != nil || interval < time.Minute {
+		return nil, fmt.Errorf("RETENTION_INTERVAL must be a duration of at least 1m")
+	}
+
+	return &retentionPolicy{mode: mode, maxAge: maxAge, keepTop: keepTop, batchSize: batchSize, interval: interval}, nil
+}
+
+// runRetention prunes scores on the policy's schedule.
+func (app *App) runRetention(ctx context.Context, p *retentionPolicy) {
+	log.Printf("✅ Score retention enabled (%s scores older than %v outside the top %d, every %v)",
+		p.mode, p.maxAge, p.keepTop, p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			acquired, err := app.redis.SetNX(ctx, cacheKeyRetentionLock, 1, p.interval/2).Result()
+			if err == nil && !acquired {
+				// Another replica prunes this interval
+				continue
+			}
+			pruned, err := app.pruneScores(ctx, p)
+			if err != nil {
+				log.Printf("Failed to prune scores: %v", err)
+			}
+			if pruned > 0 {
+				log.Printf("🧹 Pruned %d scores (%s)", pruned, p.mode)
+				app.refreshLeaderboard(ctx)
+			}
+		}
+	}
+}
+
+// pruneScores archives or deletes the scores the policy no longer keeps, in
+// batches so no transaction holds locks on scores for long. It returns how
+// many were pruned, including by batches before a failed one.
+func (app *App) pruneScores(ctx context.Context, p *retentionPolicy) (int64, error) {
+	ctx, span := tracer.Start(ctx, "pruneScores")
+	defer span.End()
+	span.SetAttributes(attribute.String("retention.mode", p.mode), attribute.Int("retention.keep_top", p.keepTop))
+
+	start := time.Now()
+	defer func() {
+		store.ObserveQuery(ctx, "prune_scores", start)
+	}()
+
+	thresholds, err := app.queryRetentionThresholds(ctx, p)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+	if thresholds.keepAll() {
+		// No season has more scores than are kept anyway
+		return 0, nil
+	}
+	span.SetAttributes(attribute.Int("retention.seasons_over_limit", len(thresholds.Seasons)))
+	cutoff := time.Now().Add(-p.maxAge)
+	seasons, scores := thresholds.args()
+
+	batch := store.DeletePrunedScoresQuery
+	if p.mode == retentionModeArchive {
+		batch = store.ArchivePrunedScoresQuery
+	}
+
+	var total int64
+	for {
+		result, err := batch.Exec(ctx, app.db, cutoff, seasons, scores, thresholds.Other, p.batchSize)
+		if err != nil {
+			span.RecordError(err)
+			span.SetAttributes(attribute.Int64("retention.pruned", total))
+			return total, err
+		}
+		pruned := result.RowsAffected()
+		total += pruned
+		scoresPrunedTotal.Add(ctx, pruned, metric.WithAttributes(attribute.String("retention.mode", p.mode)))
+		if pruned < int64(p.batchSize) || ctx.Err() != nil {
+			break
+		}
+	}
+	span.SetAttributes(attribute.Int64("retention.pruned", total))
+	return total, nil
+}
+
+// retentionThresholds are the lowest scores pruning may not touch, one per
+// season since each season has its own board: scores at or above a season's
+// keepTop-th best are kept whatever their age. A threshold of 0 keeps every
+// score.
+type retentionThresholds struct {
+	// Seasons holds the seasons with more scores than are kept, by ID; scores
+	// from before seasons are under 0
+	Seasons map[int]int64 `json:"seasons"`
+	// Other applies to the remaining seasons: all their old scores go when
+	// keepTop is 0, and none otherwise
+	Other int64 `json:"other"`
+	// Current is the current season's threshold, which its boards are
+	// annotated with
+	Current int64 `json:"current"`
+}
+
+// keepAll reports whether no season has scores to prune.
+func (t *retentionThresholds) keepAll() bool {
+	return len(t.Seasons) == 0 && t.Other == 0
+}
+
+// args returns the season IDs and their thresholds as query parameters.
+func (t *retentionThresholds) args() ([]int, []int64) {
+	seasons := make([]int, 0, len(t.Seasons))
+	scores := make([]int64, 0, len(t.Seasons))
+	for season, score := range t.Seasons {
+		seasons = append(seasons, season)
+		scores = append(scores, score)
+	}
+	return seasons, scores
+}
+
+// queryRetentionThresholds reads each season's threshold and shares them with
+// the other replicas.
+func (app *App) queryRetentionThresholds(ctx context.Context, p *retentionPolicy) (*retentionThresholds, error) {
+	thresholds := &retentionThresholds{Seasons: map[int]int64{}}
+	if p.keepTop == 0 {
+		thresholds.Other = int64(math.MaxInt32) + 1
+		thresholds.Current = thresholds.Other
+	} else {
+		rows, err := store.RetentionThresholdsQuery.Query(ctx, app.db, p.keepTop)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var season int
+			var score int64
+			var current bool
+			if err := rows.Scan(&season, &score, &current); err != nil {
+				return nil, err
+			}
+			thresholds.Seasons[season] = score
+			if current {
+				thresholds.Current = score
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if data, err := json.Marshal(thresholds); err == nil {
+		app.cache.Set(ctx, cacheKeyRetentionThresholds, data, retentionThresholdTTL)
+	}
+	return thresholds, nil
+}
+
+// retentionThresholds is queryRetentionThresholds, from the shared copy when
+// there is one.
+func (app *App) retentionThresholds(ctx context.Context, p *retentionPolicy) (*retentionThresholds, error) {
+	if data, err := app.cache.Get(ctx, cacheKeyRetentionThresholds); err == nil {
+		var thresholds retentionThresholds
+		if err := json.Unmarshal(data, &thresholds); err == nil {
+			return &thresholds, nil
+		}
+	}
+	return app.queryRetentionThresholds(ctx, p)
+}
+
+// retentionExpiry projects when a score will be pruned: the first run after
+// it turns maxAge, unless it is good enough to be kept. It returns nil for
+// scores that are kept.
+func retentionExpiry(p *retentionPolicy, threshold int64, score int, createdAt time.Time) *time.Time {
+	if threshold == 0 || int64(score) >= threshold {
+		return nil
+	}
+	expiresAt := createdAt.Add(p.maxAge).UTC()
+	return &expiresAt
+}
+
+// annotateExpiry sets ExpiresAt on the entries the retention policy will
+// prune, judged against the current season's threshold as the boards are. An
+// entry awaiting moderation may still be shown as due. Entries are left alone
+// when retention is off or the thresholds can't be read.
+func (app *App) annotateExpiry(ctx context.Context, entries []LeaderboardEntry) {
+	if app.retention == nil {
+		return
+	}
+	thresholds, err := app.retentionThresholds(ctx, app.retention)
+	if err != nil {
+		log.Printf("Failed to read retention thresholds: %v", err)
+		return
+	}
+	for i := range entries {
+		entries[i].ExpiresAt = retentionExpiry(app.retention, thresholds.Current, entries[i].Score, entries[i].CreatedAt)
+	}
+}
+
+// retentionNotice describes the retention policy for a player, with when
+// their next run goes. It returns nil when retention is off.
+func (app *App) retentionNotice(ctx context.Context, playerName string) (*RetentionNotice, error) {
+	p := app.retention
+	if p == nil {
+		return nil, nil
+	}
+	notice := &RetentionNotice{Mode: p.mode, MaxAge: p.maxAge.String(), KeepTop: p.keepTop}
+	thresholds, err := app.retentionThresholds(ctx, p)
+	if err != nil || thresholds.keepAll() {
+		return notice, err
+	}
+
+	var oldest *time.Time
+	seasons, scores := thresholds.args()
+	err = store.RetentionNoticeQuery.QueryRow(ctx, app.db, playerName, seasons, scores, thresholds.Other).Scan(&oldest)
+	if err != nil {
+		return notice, err
+	}
+	if oldest != nil {
+		expiresAt := oldest.Add(p.maxAge).UTC()
+		notice.NextExpiresAt = &expiresAt
+	}
+	return notice, nil
+}
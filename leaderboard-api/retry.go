@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+)
+
+const (
+	defaultDBRetryAttempts  = 3
+	defaultDBRetryBaseDelay = 50 * time.Millisecond
+	defaultDBRetryMaxDelay  = time.Second
+)
+
+// newRetryPolicyFromEnv reads DB_RETRY_ATTEMPTS, DB_RETRY_BASE_DELAY and
+// DB_RETRY_MAX_DELAY. DB_RETRY_ATTEMPTS=1 turns retries off.
+func newRetryPolicyFromEnv() (*store.RetryPolicy, error) {
+	attempts, err := strconv.Atoi(getEnv("DB_RETRY_ATTEMPTS", strconv.Itoa(defaultDBRetryAttempts)))
+	if err != nil || attempts < 1 {
+		return nil, fmt.Errorf("DB_RETRY_ATTEMPTS must be at least 1")
+	}
+	baseDelay, err := time.ParseDuration(getEnv("DB_RETRY_BASE_DELAY", defaultDBRetryBaseDelay.String()))
+	if err != nil || baseDelay <= 0 {
+		return nil, fmt.Errorf("DB_RETRY_BASE_DELAY must be a positive duration")
+	}
+	maxDelay, err := time.ParseDuration(getEnv("DB_RETRY_MAX_DELAY", defaultDBRetryMaxDelay.String()))
+	if err != nil || maxDelay < baseDelay {
+		return nil, fmt.Errorf("DB_RETRY_MAX_DELAY must be a duration no shorter than DB_RETRY_BASE_DELAY")
+	}
+	return store.NewRetryPolicy(attempts, baseDelay, maxDelay), nil
+}
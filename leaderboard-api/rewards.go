@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Default reward tiers: each is the top N percent of a season's players
+const defaultRewardTiers = "legendary:1,epic:10,rare:25,participant:100"
+
+// RewardTier is awarded to players in the top TopPercent of a season.
+type RewardTier struct {
+	Name       string  `json:"name"`
+	TopPercent float64 `json:"topPercent"`
+}
+
+// PlayerReward is a player's final standing in a season. Percentile is the
+// share of players ranked at or above them; Tier is empty for players outside
+// every tier.
+type PlayerReward struct {
+	SeasonID   int     `json:"seasonId"`
+	Rank       int     `json:"rank"`
+	PlayerName string  `json:"playerName"`
+	Score      int     `json:"score"`
+	Percentile float64 `json:"percentile"`
+	Tier       string  `json:"tier,omitempty"`
+}
+
+// SeasonRewards is the reward artifact for an ended season.
+type SeasonRewards struct {
+	SeasonID     int            `json:"seasonId"`
+	StartedAt    time.Time      `json:"startedAt"`
+	EndedAt      time.Time      `json:"endedAt"`
+	GeneratedAt  time.Time      `json:"generatedAt"`
+	TotalPlayers int            `json:"totalPlayers"`
+	Tiers        []RewardTier   `json:"tiers"`
+	Standings    []PlayerReward `json:"standings"`
+}
+
+// SignedSeasonRewards carries a SeasonRewards artifact as base64 JSON with an
+// Ed25519 signature over the decoded bytes. Signature is empty when no signing
+// key was configured when the season ended.
+type SignedSeasonRewards struct {
+	Payload   string `json:"payload"`
+	Signature string `json:"signature,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+}
+
+type RewardsKey struct {
+	Algorithm string `json:"alg"`
+	PublicKey string `json:"publicKey"`
+}
+
+// parseRewardTiers reads SEASON_REWARD_TIERS, e.g. "gold:1,silver:10", and
+// returns the tiers from most to least exclusive.
+func parseRewardTiers(raw string) ([]RewardTier, error) {
+	var tiers []RewardTier
+	for _, part := range strings.Split(raw, ",") {
+		name, percent, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid reward tier %q (want name:percent)", part)
+		}
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("reward tier %q: percent must be above 0 and at most 100", name)
+		}
+		tiers = append(tiers, RewardTier{Name: name, TopPercent: p})
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].TopPercent < tiers[j].TopPercent })
+	return tiers, nil
+}
+
+// parseRewardsSigningKey reads REWARDS_SIGNING_KEY, a base64 Ed25519 seed.
+// Artifacts are stored unsigned when it is unset.
+func parseRewardsSigningKey(raw string) (ed25519.PrivateKey, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	seed, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("REWARDS_SIGNING_KEY must be a base64 %d-byte Ed25519 seed", ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// snapshotSeasonRewards assigns reward tiers for an ended season and stores its
+// signed artifact. It is safe to call more than once, from any replica: the
+// first stored result wins and is returned.
+func (app *App) snapshotSeasonRewards(ctx context.Context, seasonID int) (SignedSeasonRewards, error) {
+	ctx, span := tracer.Start(ctx, "snapshotSeasonRewards")
+	defer span.End()
+	span.SetAttributes(attribute.Int("season.id", seasonID))
+
+	var snapshot SignedSeasonRewards
+	err := store.RewardSnapshotQuery.QueryRow(ctx, app.db, seasonID).Scan(&snapshot.Payload, &snapshot.Signature)
+	if err == nil {
+		return withAlgorithm(snapshot), nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return snapshot, err
+	}
+
+	start := time.Now()
+	defer func() {
+		store.ObserveQuery(ctx, "snapshot_season_rewards", start)
+	}()
+
+	rewards := SeasonRewards{SeasonID: seasonID, Tiers: app.rewardTiers, GeneratedAt: time.Now().UTC()}
+	var endedAt *time.Time
+	err = store.SeasonBoundsQuery.QueryRow(ctx, app.db, seasonID).Scan(&rewards.StartedAt, &endedAt)
+	if err != nil {
+		return snapshot, err
+	}
+	if endedAt == nil {
+		return snapshot, errSeasonNotEnded
+	}
+	rewards.EndedAt = *endedAt
+
+	// Each player is ranked by their best score of the season
+	names := make([]string, len(app.rewardTiers))
+	percents := make([]float64, len(app.rewardTiers))
+	for i, tier := range app.rewardTiers {
+		names[i], percents[i] = tier.Name, tier.TopPercent
+	}
+	if _, err := store.AssignRewardTiersQuery.Exec(ctx, app.db, seasonID, names, percents); err != nil {
+		return snapshot, err
+	}
+
+	rows, err := store.SeasonRewardsQuery.Query(ctx, app.db, seasonID)
+	if err != nil {
+		return snapshot, err
+	}
+	defer rows.Close()
+	rewards.Standings = []PlayerReward{}
+	for rows.Next() {
+		reward := PlayerReward{SeasonID: seasonID}
+		if err := rows.Scan(&reward.Rank, &reward.PlayerName, &reward.Score, &reward.Percentile, &reward.Tier); err != nil {
+			return snapshot, err
+		}
+		rewards.Standings = append(rewards.Standings, reward)
+	}
+	if err := rows.Err(); err != nil {
+		return snapshot, err
+	}
+	rewards.TotalPlayers = len(rewards.Standings)
+
+	payload, err := json.Marshal(rewards)
+	if err != nil {
+		return snapshot, err
+	}
+	snapshot.Payload = base64.StdEncoding.EncodeToString(payload)
+	if app.rewardsKey != nil {
+		snapshot.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(app.rewardsKey, payload))
+	}
+
+	// Another replica may have stored one in the meantime; serve whichever is stored
+	if _, err := store.StoreRewardSnapshotQuery.Exec(ctx, app.db, seasonID, snapshot.Payload, snapshot.Signature); err != nil {
+		return snapshot, err
+	}
+	if err := store.RewardSnapshotQuery.QueryRow(ctx, app.db, seasonID).Scan(&snapshot.Payload, &snapshot.Signature); err != nil {
+		return snapshot, err
+	}
+
+	span.SetAttributes(attribute.Int("season.players", rewards.TotalPlayers))
+	log.Printf("🏁 Season %d rewards: %d players across %d tiers", seasonID, rewards.TotalPlayers, len(app.rewardTiers))
+	return withAlgorithm(snapshot), nil
+}
+
+var errSeasonNotEnded = handlers.NewError(handlers.ErrConflict, "Season has not ended", nil)
+
+func withAlgorithm(snapshot SignedSeasonRewards) SignedSeasonRewards {
+	if snapshot.Signature != "" {
+		snapshot.Algorithm = "Ed25519"
+	}
+	return snapshot
+}
+
+// maskRewards masks the names in a reward artifact. An artifact the policy
+// changes is signed again, so it still verifies against the rewards key.
+func (app *App) maskRewards(snapshot SignedSeasonRewards) (SignedSeasonRewards, error) {
+	payload, err := base64.StdEncoding.DecodeString(snapshot.Payload)
+	if err != nil {
+		return snapshot, err
+	}
+	var rewards SeasonRewards
+	if err := json.Unmarshal(payload, &rewards); err != nil {
+		return snapshot, err
+	}
+	mask := app.nameMask()
+	masked := false
+	for i := range rewards.Standings {
+		name := mask(rewards.Standings[i].PlayerName)
+		masked = masked || name != rewards.Standings[i].PlayerName
+		rewards.Standings[i].PlayerName = name
+	}
+	if !masked {
+		return snapshot, nil
+	}
+
+	if payload, err = json.Marshal(rewards); err != nil {
+		return snapshot, err
+	}
+	snapshot = SignedSeasonRewards{Payload: base64.StdEncoding.EncodeToString(payload)}
+	if app.rewardsKey != nil {
+		snapshot.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(app.rewardsKey, payload))
+	}
+	return withAlgorithm(snapshot), nil
+}
+
+// getSeasonRewardsHandler returns the signed reward artifact of an ended season.
+func (app *App) getSeasonRewardsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getSeasonRewards")
+	defer span.End()
+
+	seasonID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid season ID", http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.Int("season.id", seasonID))
+
+	snapshot, err := app.snapshotSeasonRewards(ctx, seasonID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "Season not found", http.StatusNotFound)
+		return
+	case err != nil:
+		span.RecordError(err)
+		handlers.WriteError(w, err, "Failed to fetch season rewards")
+		return
+	}
+	if snapshot, err = app.maskRewards(snapshot); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch season rewards", http.StatusInternalServerError)
+		return
+	}
+
+	// The stored artifact never changes; only a new masking policy changes
+	// what is served
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// getPlayerRewardHandler returns one player's standing and tier in an ended season.
+func (app *App) getPlayerRewardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getPlayerReward")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	seasonID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid season ID", http.StatusBadRequest)
+		return
+	}
+	playerName := vars["name"]
+	span.SetAttributes(attribute.Int("season.id", seasonID), attribute.String("player.name", playerName))
+
+	// Make sure tiers have been assigned, e.g. for seasons that ended on an older version
+	if _, err := app.snapshotSeasonRewards(ctx, seasonID); err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			http.Error(w, "Season not found", http.StatusNotFound)
+		default:
+			span.RecordError(err)
+			handlers.WriteError(w, err, "Failed to fetch season rewards")
+		}
+		return
+	}
+
+	reward := PlayerReward{SeasonID: seasonID, PlayerName: playerName}
+	err = store.PlayerRewardQuery.QueryRow(ctx, app.db, seasonID, playerName).
+		Scan(&reward.Rank, &reward.Score, &reward.Percentile, &reward.Tier)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Player has no standing this season", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch player reward", http.StatusInternalServerError)
+		return
+	}
+	reward.PlayerName = app.nameMask()(reward.PlayerName)
+
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reward)
+}
+
+// getRewardsKeyHandler returns the public key reward artifacts are signed with.
+func (app *App) getRewardsKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if app.rewardsKey == nil {
+		http.Error(w, "Reward artifacts are not signed", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RewardsKey{
+		Algorithm: "Ed25519",
+		PublicKey: base64.StdEncoding.EncodeToString(app.rewardsKey.Public().(ed25519.PublicKey)),
+	})
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// Submissions without a mode are classic runs on normal difficulty
+	defaultGameMode       = "classic"
+	defaultGameDifficulty = "normal"
+	maxGameModeLength     = 32
+
+	defaultGameRulesRefresh = 30 * time.Second
+)
+
+// GameRule holds the anti-cheat ceilings for one mode and difficulty.
+type GameRule struct {
+	Mode          string    `json:"mode"`
+	Difficulty    string    `json:"difficulty"`
+	MaxScore      int       `json:"maxScore"`
+	MinIntervalMs int       `json:"minIntervalMs"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+func (r GameRule) minInterval() time.Duration {
+	return time.Duration(r.MinIntervalMs) * time.Millisecond
+}
+
+// gameRules is the in-memory copy of the game_rules table.
+type gameRules struct {
+	mu    sync.RWMutex
+	rules map[string]GameRule
+	// builtin applies when a mode has no row in game_rules
+	builtin GameRule
+}
+
+func newGameRules(builtin GameRule) *gameRules {
+	return &gameRules{rules: make(map[string]GameRule), builtin: builtin}
+}
+
+func gameRuleKey(mode, difficulty string) string {
+	return mode + "/" + difficulty
+}
+
+// lookup returns the rule for mode and difficulty, and whether one is configured.
+func (g *gameRules) lookup(mode, difficulty string) (GameRule, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	rule, ok := g.rules[gameRuleKey(mode, difficulty)]
+	if !ok {
+		return g.builtin, false
+	}
+	return rule, true
+}
+
+func (g *gameRules) replace(rules []GameRule) {
+	byKey := make(map[string]GameRule, len(rules))
+	for _, rule := range rules {
+		byKey[gameRuleKey(rule.Mode, rule.Difficulty)] = rule
+	}
+	g.mu.Lock()
+	g.rules = byKey
+	g.mu.Unlock()
+}
+
+func (g *gameRules) setBuiltin(rule GameRule) {
+	g.mu.Lock()
+	g.builtin = rule
+	g.mu.Unlock()
+}
+
+func (g *gameRules) all() []GameRule {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	rules := make([]GameRule, 0, len(g.rules))
+	for _, rule := range g.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return gameRuleKey(rules[i].Mode, rules[i].Difficulty) < gameRuleKey(rules[j].Mode, rules[j].Difficulty)
+	})
+	return rules
+}
+
+// loadGameRules replaces the in-memory rules with the game_rules table.
+func (app *App) loadGameRules(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "loadGameRules")
+	defer span.End()
+
+	rows, err := store.SelectGameRulesQuery.Query(ctx, app.db)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	defer rows.Close()
+
+	var rules []GameRule
+	for rows.Next() {
+		var rule GameRule
+		if err := rows.Scan(&rule.Mode, &rule.Difficulty, &rule.MaxScore, &rule.MinIntervalMs, &rule.UpdatedAt); err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	app.rules.replace(rules)
+	span.SetAttributes(attribute.Int("game_rules.count", len(rules)))
+	return nil
+}
+
+// refreshGameRules reloads the rules periodically so edits made through another
+// replica take effect everywhere.
+func (app *App) refreshGameRules(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := app.loadGameRules(ctx); err != nil {
+				log.Printf("Failed to refresh game rules: %v", err)
+			}
+		}
+	}
+}
+
+// checkGameMode defaults and normalizes the mode and difficulty, rejecting
+// combinations that have no rules.
+func (app *App) checkGameMode(ctx context.Context, submission *ScoreSubmission) error {
+	submission.Mode = strings.ToLower(strings.TrimSpace(submission.Mode))
+	submission.Difficulty = strings.ToLower(strings.TrimSpace(submission.Difficulty))
+	if submission.Mode == "" {
+		submission.Mode = defaultGameMode
+	}
+	if submission.Difficulty == "" {
+		submission.Difficulty = defaultGameDifficulty
+	}
+	if len(submission.Mode) > maxGameModeLength || len(submission.Difficulty) > maxGameModeLength {
+		return fmt.Errorf("game mode too long (max %d characters)", maxGameModeLength)
+	}
+
+	if _, ok := app.rules.lookup(submission.Mode, submission.Difficulty); !ok &&
+		(submission.Mode != defaultGameMode || submission.Difficulty != defaultGameDifficulty) {
+		return fmt.Errorf("unknown game mode %s/%s", submission.Mode, submission.Difficulty)
+	}
+	return nil
+}
+
+// getGameRulesHandler lists the rules currently enforced by this replica.
+func (app *App) getGameRulesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(app.rules.all())
+}
+
+// putGameRuleHandler creates or updates the rule for a mode and difficulty.
+func (app *App) putGameRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "putGameRule")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	mode := strings.ToLower(vars["mode"])
+	difficulty := strings.ToLower(vars["difficulty"])
+	if len(mode) > maxGameModeLength || len(difficulty) > maxGameModeLength {
+		http.Error(w, fmt.Sprintf("game mode too long (max %d characters)", maxGameModeLength), http.StatusBadRequest)
+		return
+	}
+
+	var rule GameRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if rule.MaxScore <= 0 {
+		http.Error(w, "maxScore must be positive", http.StatusBadRequest)
+		return
+	}
+	if rule.MinIntervalMs < 0 {
+		http.Error(w, "minIntervalMs must not be negative", http.StatusBadRequest)
+		return
+	}
+	rule.Mode = mode
+	rule.Difficulty = difficulty
+	span.SetAttributes(
+		attribute.String("game_rules.mode", mode),
+		attribute.String("game_rules.difficulty", difficulty),
+	)
+
+	if err := store.SaveGameRuleQuery.QueryRow(ctx, app.db, mode, difficulty, rule.MaxScore, rule.MinIntervalMs).Scan(&rule.UpdatedAt); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to save game rule", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🛡️ Game rule %s/%s: max score %d, min interval %dms", mode, difficulty, rule.MaxScore, rule.MinIntervalMs)
+
+	if err := app.loadGameRules(ctx); err != nil {
+		log.Printf("Failed to reload game rules: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
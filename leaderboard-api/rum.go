@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	rumMaxBody     = 1 << 20
+	rumMaxInFlight = 64
+)
+
+// rumWebVitals are the web-vitals measurements recorded as metrics. cls has
+// no unit; the others are milliseconds.
+var rumWebVitals = map[string]bool{"lcp": true, "fcp": true, "cls": true, "inp": true, "fid": true, "ttfb": true}
+
+// rumProxy relays Faro beacons from the game to the collector, so browsers
+// post to the API's own origin and never see the collector's URL or key.
+type rumProxy struct {
+	target        string
+	apiKey        string
+	countryHeader string
+	regionHeader  string
+	client        *http.Client
+	slots         chan struct{}
+}
+
+// newRUMProxyFromEnv returns nil when RUM_COLLECTOR_URL is not set.
+func newRUMProxyFromEnv() *rumProxy {
+	target := getEnv("RUM_COLLECTOR_URL", "")
+	if target == "" {
+		return nil
+	}
+	timeout, err := time.ParseDuration(getEnv("RUM_COLLECTOR_TIMEOUT", "5s"))
+	if err != nil || timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &rumProxy{
+		target:        target,
+		apiKey:        getEnv("RUM_COLLECTOR_API_KEY", ""),
+		countryHeader: getEnv("RUM_COUNTRY_HEADER", "CF-IPCountry"),
+		regionHeader:  getEnv("RUM_REGION_HEADER", "X-Client-Region"),
+		client:        &http.Client{Timeout: timeout},
+		slots:         make(chan struct{}, rumMaxInFlight),
+	}
+}
+
+// FaroBeacon is the part of a Faro payload the proxy reads or enriches. The
+// rest is forwarded untouched.
+type FaroBeacon struct {
+	Meta         FaroMeta          `json:"meta"`
+	Measurements []FaroMeasurement `json:"measurements,omitempty"`
+}
+
+type FaroMeta struct {
+	App     *FaroApp     `json:"app,omitempty"`
+	Session *FaroSession `json:"session,omitempty"`
+}
+
+type FaroApp struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+type FaroSession struct {
+	ID         string            `json:"id,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+type FaroMeasurement struct {
+	Type   string             `json:"type"`
+	Values map[string]float64 `json:"values"`
+}
+
+// rumPlatform derives a coarse OS and device class from a user agent, enough
+// to split web vitals without storing the full string.
+func rumPlatform(userAgent string) (os, device string) {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(ua, "android"):
+		os = "android"
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		os = "ios"
+	case strings.Contains(ua, "windows"):
+		os = "windows"
+	case strings.Contains(ua, "mac os"), strings.Contains(ua, "macintosh"):
+		os = "macos"
+	case strings.Contains(ua, "cros"):
+		os = "chromeos"
+	case strings.Contains(ua, "linux"):
+		os = "linux"
+	default:
+		os = "other"
+	}
+	switch {
+	case strings.Contains(ua, "ipad"), strings.Contains(ua, "tablet"):
+		device = "tablet"
+	case strings.Contains(ua, "mobi"), os == "android", os == "ios":
+		device = "mobile"
+	default:
+		device = "desktop"
+	}
+	return os, device
+}
+
+// rumCollectHandler accepts a Faro beacon, adds geo and platform attributes
+// to its session, records its web vitals and forwards it to the collector.
+// The beacon is answered before it is forwarded, so a slow collector never
+// holds the browser up.
+func (app *App) rumCollectHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "rumCollect")
+	defer span.End()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, rumMaxBody))
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var payload map[string]json.RawMessage
+	var beacon FaroBeacon
+	if err := json.Unmarshal(body, &payload); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &beacon); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	osName, device := rumPlatform(r.UserAgent())
+	country := strings.ToUpper(strings.TrimSpace(r.Header.Get(app.rum.countryHeader)))
+	if len(country) != 2 {
+		country = "unknown"
+	}
+	region := truncateRunes(strings.TrimSpace(r.Header.Get(app.rum.regionHeader)), 64)
+	span.SetAttributes(
+		attribute.String("rum.geo.country", country),
+		attribute.String("rum.platform.os", osName),
+		attribute.String("rum.platform.device", device),
+	)
+
+	// Faro carries custom session attributes through to Loki and Tempo
+	if beacon.Meta.Session == nil {
+		beacon.Meta.Session = &FaroSession{}
+	}
+	if beacon.Meta.Session.Attributes == nil {
+		beacon.Meta.Session.Attributes = map[string]string{}
+	}
+	beacon.Meta.Session.Attributes["geo_country"] = country
+	if region != "" {
+		beacon.Meta.Session.Attributes["geo_region"] = region
+	}
+	beacon.Meta.Session.Attributes["platform_os"] = osName
+	beacon.Meta.Session.Attributes["platform_device"] = device
+	if err := mergeFaroMeta(payload, beacon.Meta); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	vitals := 0
+	for _, measurement := range beacon.Measurements {
+		if measurement.Type != "web-vitals" {
+			continue
+		}
+		for name, value := range measurement.Values {
+			if !rumWebVitals[name] || value < 0 {
+				continue
+			}
+			rumWebVitalValue.Record(ctx, value, metric.WithAttributes(
+				attribute.String("rum.web_vital", name),
+				attribute.String("rum.geo.country", country),
+				attribute.String("rum.platform.os", osName),
+				attribute.String("rum.platform.device", device),
+			))
+			vitals++
+		}
+	}
+	span.SetAttributes(attribute.Int("rum.web_vitals", vitals))
+
+	enriched, err := json.Marshal(payload)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Drop the beacon rather than queue it when the collector falls behind
+	select {
+	case app.rum.slots <- struct{}{}:
+	default:
+		rumBeaconsTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("rum.result", "dropped")))
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	forwardCtx := trace.ContextWithSpanContext(context.Background(), span.SpanContext())
+	clientIP := r.RemoteAddr
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		clientIP = forwarded
+	}
+	go func() {
+		defer func() { <-app.rum.slots }()
+		app.rum.forward(forwardCtx, enriched, r.UserAgent(), clientIP)
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// mergeFaroMeta writes the enriched session back into the raw payload,
+// keeping every meta field the proxy doesn't model.
+func mergeFaroMeta(payload map[string]json.RawMessage, meta FaroMeta) error {
+	rawMeta := map[string]json.RawMessage{}
+	if existing, ok := payload["meta"]; ok {
+		if err := json.Unmarshal(existing, &rawMeta); err != nil {
+			return err
+		}
+	}
+	session, err := json.Marshal(meta.Session)
+	if err != nil {
+		return err
+	}
+	rawMeta["session"] = session
+	merged, err := json.Marshal(rawMeta)
+	if err != nil {
+		return err
+	}
+	payload["meta"] = merged
+	return nil
+}
+
+// forward posts an enriched beacon to the collector, with the browser's user
+// agent and address so the collector's own enrichment still works.
+func (p *rumProxy) forward(ctx context.Context, body []byte, userAgent, clientIP string) {
+	ctx, span := tracer.Start(ctx, "rumForward", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	result := "forwarded"
+	defer func() {
+		rumBeaconsTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("rum.result", result)))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.target, bytes.NewReader(body))
+	if err != nil {
+		span.RecordError(err)
+		result = "error"
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("X-Forwarded-For", clientIP)
+	if p.apiKey != "" {
+		req.Header.Set("X-API-Key", p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		result = "error"
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 300 {
+		result = "rejected"
+	}
+}
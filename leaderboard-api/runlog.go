@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/anticheat"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func init() {
+	RegisterStage("runlog", func(app *App) SubmissionStage {
+		return StageFunc{StageName: "runlog", Fn: app.checkRunLog}
+	})
+}
+
+// checkRunLog replays the submission's event log against the game's physics
+// and rejects scores the run could not have produced. Submissions without a
+// log pass unless RUN_LOG_REQUIRED is set.
+func (app *App) checkRunLog(ctx context.Context, submission *ScoreSubmission) error {
+	if submission.EventLog == "" {
+		if getEnv("RUN_LOG_REQUIRED", "false") == "true" {
+			return fmt.Errorf("event log required")
+		}
+		return nil
+	}
+
+	events, err := anticheat.DecodeRunLog(submission.EventLog)
+	if err != nil {
+		return fmt.Errorf("invalid event log: %w", err)
+	}
+	distance, err := anticheat.VerifyRunLog(events, submission.Score)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("runlog.events", len(events)),
+		attribute.Float64("runlog.distance", distance),
+	)
+	if err != nil {
+		return anticheat.Suspicious(fmt.Errorf("event log does not match score: %w", err))
+	}
+
+	// Every unit of spice is a logged pickup
+	pickups := 0
+	for _, event := range events {
+		if event.Type == anticheat.EventPickup {
+			pickups++
+		}
+	}
+	if submission.SpiceCollected > pickups {
+		return anticheat.Suspicious(fmt.Errorf("collected %d spice with %d pickups", submission.SpiceCollected, pickups))
+	}
+	return nil
+}
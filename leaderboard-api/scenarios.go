@@ -0,0 +1,613 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	mrand "math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/cache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Scenario step actions
+const (
+	// scenarioSpike sends RPS requests a second to Path on this replica for
+	// Duration
+	scenarioSpike = "spike"
+	// scenarioKillCache switches the response cache to its fallback as if
+	// Redis were down, until restore-cache or recover
+	scenarioKillCache    = "kill-cache"
+	scenarioRestoreCache = "restore-cache"
+	// scenarioInjectErrors fails Rate of public API requests with a 500
+	scenarioInjectErrors = "inject-errors"
+	// scenarioInjectLatency delays every public API request by Latency
+	scenarioInjectLatency = "inject-latency"
+	// scenarioRecover undoes every fault; spikes already started run their
+	// course. A run always ends with it, finished or aborted.
+	scenarioRecover = "recover"
+	// scenarioAnnotate only emits its Note as an annotation
+	scenarioAnnotate = "annotate"
+)
+
+const (
+	scenarioUserAgent = "spice-runner-scenario"
+
+	// Spike requests in flight at once; beyond it requests are skipped
+	scenarioSpikeMaxInFlight = 200
+	scenarioMaxSteps         = 50
+	scenarioMaxLength        = time.Hour
+)
+
+var scenarioActions = []string{scenarioSpike, scenarioKillCache, scenarioRestoreCache, scenarioInjectErrors,
+	scenarioInjectLatency, scenarioRecover, scenarioAnnotate}
+
+var errScenarioRunning = errors.New("a scenario is already running")
+
+// ScenarioStep is one action on a scenario's timeline. At is its offset from
+// the start, such as "30s"; the other fields depend on the action.
+type ScenarioStep struct {
+	At       string  `json:"at"`
+	Action   string  `json:"action"`
+	Note     string  `json:"note,omitempty"`
+	RPS      int     `json:"rps,omitempty"`
+	Duration string  `json:"duration,omitempty"`
+	Path     string  `json:"path,omitempty"`
+	Rate     float64 `json:"rate,omitempty"`
+	Latency  string  `json:"latency,omitempty"`
+
+	at       time.Duration
+	duration time.Duration
+	latency  time.Duration
+}
+
+// Scenario is a scripted demo: faults and traffic on a timeline, so a talk
+// can be replayed the same way every time.
+type Scenario struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Steps       []ScenarioStep `json:"steps"`
+}
+
+// builtinScenarios are the scenarios runnable by name.
+var builtinScenarios = []Scenario{
+	{
+		Name:        "cache-outage",
+		Description: "Read traffic rises, then Redis goes away for a minute and comes back",
+		Steps: []ScenarioStep{
+			{At: "0s", Action: scenarioSpike, RPS: 50, Duration: "150s", Path: "/api/leaderboard/top"},
+			{At: "30s", Action: scenarioKillCache},
+			{At: "90s", Action: scenarioRestoreCache},
+			{At: "150s", Action: scenarioRecover},
+		},
+	},
+	{
+		Name:        "error-burst",
+		Description: "A fifth of API requests fail for a minute under steady traffic",
+		Steps: []ScenarioStep{
+			{At: "0s", Action: scenarioSpike, RPS: 30, Duration: "120s", Path: "/api/leaderboard/top"},
+			{At: "20s", Action: scenarioInjectErrors, Rate: 0.2},
+			{At: "80s", Action: scenarioRecover},
+			{At: "80s", Action: scenarioSpike, RPS: 30, Duration: "40s", Path: "/api/leaderboard/top"},
+		},
+	},
+	{
+		Name:        "full-demo",
+		Description: "Spike, lose the cache, slow down, fail, then recover",
+		Steps: []ScenarioStep{
+			{At: "0s", Action: scenarioAnnotate, Note: "Baseline"},
+			{At: "0s", Action: scenarioSpike, RPS: 20, Duration: "60s", Path: "/api/leaderboard/top"},
+			{At: "60s", Action: scenarioSpike, RPS: 100, Duration: "60s", Path: "/api/leaderboard/top"},
+			{At: "120s", Action: scenarioKillCache},
+			{At: "120s", Action: scenarioSpike, RPS: 50, Duration: "180s", Path: "/api/leaderboard/top"},
+			{At: "180s", Action: scenarioInjectLatency, Latency: "300ms"},
+			{At: "240s", Action: scenarioInjectErrors, Rate: 0.1},
+			{At: "300s", Action: scenarioRecover},
+			{At: "300s", Action: scenarioSpike, RPS: 20, Duration: "60s", Path: "/api/leaderboard/top"},
+		},
+	},
+}
+
+func (s *Scenario) validate() error {
+	if !apiKeyNamePattern.MatchString(s.Name) {
+		return fmt.Errorf("name must be 1-64 lowercase letters, digits, '_' or '-'")
+	}
+	if len(s.Steps) == 0 || len(s.Steps) > scenarioMaxSteps {
+		return fmt.Errorf("a scenario needs 1-%d steps", scenarioMaxSteps)
+	}
+	for i := range s.Steps {
+		if err := s.Steps[i].parse(); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+		if i > 0 && s.Steps[i].at < s.Steps[i-1].at {
+			return fmt.Errorf("step %d: steps must be in order of at", i+1)
+		}
+	}
+	return nil
+}
+
+func (s *ScenarioStep) parse() error {
+	var err error
+	if s.at, err = time.ParseDuration(s.At); err != nil || s.at < 0 || s.at > scenarioMaxLength {
+		return fmt.Errorf("at must be a duration up to %s", scenarioMaxLength)
+	}
+	switch s.Action {
+	case scenarioSpike:
+		if s.RPS <= 0 || s.RPS > 1000 {
+			return fmt.Errorf("rps must be 1-1000")
+		}
+		if s.duration, err = time.ParseDuration(s.Duration); err != nil || s.duration <= 0 || s.duration > scenarioMaxLength {
+			return fmt.Errorf("duration must be a positive duration up to %s", scenarioMaxLength)
+		}
+		if s.Path == "" {
+			s.Path = "/api/leaderboard/top"
+		}
+		if !strings.HasPrefix(s.Path, "/api/") {
+			return fmt.Errorf("path must be under /api/")
+		}
+	case scenarioInjectErrors:
+		if s.Rate <= 0 || s.Rate > 1 {
+			return fmt.Errorf("rate must be above 0 and at most 1")
+		}
+	case scenarioInjectLatency:
+		if s.latency, err = time.ParseDuration(s.Latency); err != nil || s.latency <= 0 || s.latency > 30*time.Second {
+			return fmt.Errorf("latency must be a positive duration up to 30s")
+		}
+	case scenarioAnnotate:
+		if s.Note == "" {
+			return fmt.Errorf("annotate needs a note")
+		}
+	case scenarioKillCache, scenarioRestoreCache, scenarioRecover:
+	default:
+		return fmt.Errorf("unknown action %q (want one of %s)", s.Action, strings.Join(scenarioActions, ", "))
+	}
+	return nil
+}
+
+// describe is the step as annotation text.
+func (s *ScenarioStep) describe() string {
+	var text string
+	switch s.Action {
+	case scenarioSpike:
+		text = fmt.Sprintf("spike: %d rps to %s for %s", s.RPS, s.Path, s.duration)
+	case scenarioInjectErrors:
+		text = fmt.Sprintf("inject-errors: %g of requests", s.Rate)
+	case scenarioInjectLatency:
+		text = fmt.Sprintf("inject-latency: %s", s.latency)
+	default:
+		text = s.Action
+	}
+	if s.Note != "" && s.Action != scenarioAnnotate {
+		text += " (" + s.Note + ")"
+	} else if s.Action == scenarioAnnotate {
+		text = s.Note
+	}
+	return text
+}
+
+// ScenarioStepResult is a step of a run as it happened.
+type ScenarioStepResult struct {
+	ScenarioStep
+	RanAt *time.Time `json:"ranAt,omitempty"`
+	Error string     `json:"error,omitempty"`
+}
+
+// ScenarioRun is a scenario being run or the last one run.
+type ScenarioRun struct {
+	ID        string               `json:"id"`
+	Scenario  string               `json:"scenario"`
+	State     string               `json:"state"`
+	StartedAt time.Time            `json:"startedAt"`
+	EndedAt   *time.Time           `json:"endedAt,omitempty"`
+	TraceID   string               `json:"traceId,omitempty"`
+	Steps     []ScenarioStepResult `json:"steps"`
+}
+
+// faultInjector fails or slows public API requests while a scenario asks it
+// to.
+type faultInjector struct {
+	errorRate atomic.Uint64 // math.Float64bits
+	latency   atomic.Int64
+}
+
+func (f *faultInjector) reset() {
+	f.errorRate.Store(0)
+	f.latency.Store(0)
+}
+
+// middleware applies the faults to /api requests; health checks and admin
+// endpoints are left alone so the API isn't restarted or locked out mid-demo.
+func (f *faultInjector) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if latency := time.Duration(f.latency.Load()); latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if rate := math.Float64frombits(f.errorRate.Load()); rate > 0 && mrand.Float64() < rate {
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.Bool("scenario.injected_error", true))
+			http.Error(w, "Injected fault", http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// scenarioRunner runs one scenario at a time on this replica. Faults and
+// spikes apply to this replica only, so send runs to the replica the demo
+// watches, or to each replica.
+type scenarioRunner struct {
+	faults    *faultInjector
+	client    *http.Client
+	baseURL   string
+	annotator *grafanaAnnotator
+
+	mu      sync.Mutex
+	current *ScenarioRun
+	cancel  context.CancelFunc
+	spikes  sync.WaitGroup
+}
+
+// newScenarioRunnerFromEnv returns nil unless SCENARIOS_ENABLED is true.
+// Annotations also go to Grafana when SCENARIO_GRAFANA_URL is set.
+func newScenarioRunnerFromEnv(cfg *Config) *scenarioRunner {
+	if getEnv("SCENARIOS_ENABLED", "false") != "true" {
+		return nil
+	}
+	r := &scenarioRunner{
+		faults:  &faultInjector{},
+		client:  &http.Client{Timeout: 10 * time.Second},
+		baseURL: "http://127.0.0.1:" + cfg.Port,
+	}
+	if grafanaURL := getEnv("SCENARIO_GRAFANA_URL", ""); grafanaURL != "" {
+		r.annotator = &grafanaAnnotator{
+			url:          strings.TrimSuffix(grafanaURL, "/") + "/api/annotations",
+			token:        getEnv("SCENARIO_GRAFANA_TOKEN", ""),
+			dashboardUID: getEnv("SCENARIO_GRAFANA_DASHBOARD_UID", ""),
+			client:       &http.Client{Timeout: 5 * time.Second},
+		}
+	}
+	return r
+}
+
+// startScenario runs scenario in the background and returns its run. The run
+// gets a trace of its own, linked from the request that started it.
+func (app *App) startScenario(ctx context.Context, scenario Scenario) (*ScenarioRun, error) {
+	r := app.scenarios
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current != nil && r.current.State == "running" {
+		return nil, errScenarioRunning
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate run ID: %w", err)
+	}
+	run := &ScenarioRun{
+		ID:        hex.EncodeToString(id),
+		Scenario:  scenario.Name,
+		State:     "running",
+		StartedAt: time.Now().UTC(),
+		Steps:     make([]ScenarioStepResult, len(scenario.Steps)),
+	}
+	for i, step := range scenario.Steps {
+		run.Steps[i] = ScenarioStepResult{ScenarioStep: step}
+	}
+
+	// The run outlives the request that started it
+	link := trace.LinkFromContext(ctx)
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, span := tracer.Start(ctx, "scenario "+scenario.Name, trace.WithNewRoot(), trace.WithLinks(link))
+	span.SetAttributes(attribute.String("scenario.name", scenario.Name), attribute.String("scenario.run_id", run.ID))
+	run.TraceID = span.SpanContext().TraceID().String()
+	r.current = run
+	r.cancel = cancel
+
+	go app.runScenario(ctx, span, scenario, run)
+	return run, nil
+}
+
+// runScenario steps through the timeline, annotating each step, and always
+// ends by recovering, whether the timeline finished or was aborted.
+func (app *App) runScenario(ctx context.Context, span trace.Span, scenario Scenario, run *ScenarioRun) {
+	r := app.scenarios
+	defer span.End()
+	r.annotate(ctx, scenario.Name, "start", fmt.Sprintf("Scenario %s started", scenario.Name))
+
+	state := "completed"
+steps:
+	for i, step := range scenario.Steps {
+		if wait := time.Until(run.StartedAt.Add(step.at)); wait > 0 {
+			select {
+			case <-ctx.Done():
+				state = "aborted"
+				break steps
+			case <-time.After(wait):
+			}
+		}
+		err := app.runScenarioStep(ctx, step)
+		ranAt := time.Now().UTC()
+		r.mu.Lock()
+		run.Steps[i].RanAt = &ranAt
+		if err != nil {
+			run.Steps[i].Error = err.Error()
+		}
+		r.mu.Unlock()
+		if err != nil {
+			span.RecordError(err)
+		}
+		scenarioStepsTotal.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("scenario.name", scenario.Name),
+			attribute.String("scenario.action", step.Action),
+		))
+		r.annotate(ctx, scenario.Name, step.Action, step.describe())
+	}
+
+	// Spikes run on past the last step; an abort cuts them short
+	if state == "completed" {
+		r.spikes.Wait()
+	}
+	app.recoverFromScenario()
+	r.spikes.Wait()
+	if ctx.Err() != nil {
+		state = "aborted"
+	}
+	endedAt := time.Now().UTC()
+	r.mu.Lock()
+	run.State = state
+	run.EndedAt = &endedAt
+	r.cancel()
+	r.mu.Unlock()
+	span.SetAttributes(attribute.String("scenario.state", state))
+	r.annotate(context.WithoutCancel(ctx), scenario.Name, "end", fmt.Sprintf("Scenario %s %s", scenario.Name, state))
+}
+
+func (app *App) runScenarioStep(ctx context.Context, step ScenarioStep) error {
+	r := app.scenarios
+	switch step.Action {
+	case scenarioSpike:
+		r.spikes.Add(1)
+		go func() {
+			defer r.spikes.Done()
+			r.spike(ctx, step.RPS, step.duration, step.Path)
+		}()
+	case scenarioKillCache, scenarioRestoreCache:
+		failover, ok := app.cache.(*cache.Failover)
+		if !ok {
+			return fmt.Errorf("the response cache has no fallback to switch to")
+		}
+		failover.Force(step.Action == scenarioKillCache)
+	case scenarioInjectErrors:
+		r.faults.errorRate.Store(math.Float64bits(step.Rate))
+	case scenarioInjectLatency:
+		r.faults.latency.Store(int64(step.latency))
+	case scenarioRecover:
+		app.recoverFromScenario()
+	}
+	return nil
+}
+
+// recoverFromScenario clears injected faults and gives the cache back. Spikes
+// stop when the run's context is cancelled.
+func (app *App) recoverFromScenario() {
+	app.scenarios.faults.reset()
+	if failover, ok := app.cache.(*cache.Failover); ok {
+		failover.Force(false)
+	}
+}
+
+// spike sends rps GET requests a second to path on this replica for
+// duration, through the public middleware like any client's. Requests carry a
+// load-test User-Agent, so they count as load_test traffic.
+func (r *scenarioRunner) spike(ctx context.Context, rps int, duration time.Duration, path string) {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	ticker := time.NewTicker(time.Second / time.Duration(rps))
+	defer ticker.Stop()
+	inFlight := make(chan struct{}, scenarioSpikeMaxInFlight)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			// The API is falling behind; don't pile on more than a client would
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.baseURL+path, nil)
+			if err != nil {
+				return
+			}
+			req.Header.Set("User-Agent", scenarioUserAgent)
+			if resp, err := r.client.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+}
+
+// annotate marks a moment of a run in the logs, on the run's span and, when
+// configured, as a Grafana annotation tagged with the scenario and action.
+func (r *scenarioRunner) annotate(ctx context.Context, scenario, action, text string) {
+	log.Printf("🎬 [%s] %s", scenario, text)
+	trace.SpanFromContext(ctx).AddEvent("scenario."+action, trace.WithAttributes(attribute.String("scenario.note", text)))
+	if r.annotator == nil {
+		return
+	}
+	if err := r.annotator.annotate(ctx, text, []string{"spice-runner", "scenario", "scenario:" + scenario, action}); err != nil {
+		log.Printf("Failed to send scenario annotation to Grafana: %v", err)
+	}
+}
+
+// grafanaAnnotator posts annotations through the Grafana HTTP API. Without a
+// dashboard UID they are organization-wide, shown by any dashboard with an
+// annotation query on the "scenario" tag.
+type grafanaAnnotator struct {
+	url          string
+	token        string
+	dashboardUID string
+	client       *http.Client
+}
+
+func (g *grafanaAnnotator) annotate(ctx context.Context, text string, tags []string) error {
+	annotation := map[string]interface{}{
+		"time": time.Now().UnixMilli(),
+		"tags": tags,
+		"text": text,
+	}
+	if g.dashboardUID != "" {
+		annotation["dashboardUID"] = g.dashboardUID
+	}
+	body, err := json.Marshal(annotation)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("grafana answered %s", resp.Status)
+	}
+	return nil
+}
+
+type ScenariosResponse struct {
+	Scenarios []Scenario   `json:"scenarios"`
+	Run       *ScenarioRun `json:"run,omitempty"`
+}
+
+// getScenariosHandler lists the built-in scenarios and the current or last
+// run.
+func (app *App) getScenariosHandler(w http.ResponseWriter, r *http.Request) {
+	if app.scenarios == nil {
+		http.Error(w, "Scenarios are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	app.scenarios.mu.Lock()
+	response := ScenariosResponse{Scenarios: builtinScenarios}
+	if current := app.scenarios.current; current != nil {
+		run := *current
+		run.Steps = append([]ScenarioStepResult(nil), current.Steps...)
+		response.Run = &run
+	}
+	app.scenarios.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// runScenarioHandler starts a built-in scenario by name, or the scenario in
+// the body when the name is "custom".
+func (app *App) runScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "runScenario")
+	defer span.End()
+
+	if app.scenarios == nil {
+		http.Error(w, "Scenarios are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	var scenario Scenario
+	name := mux.Vars(r)["name"]
+	if name == "custom" {
+		if err := json.NewDecoder(r.Body).Decode(&scenario); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	} else {
+		found := false
+		for _, builtin := range builtinScenarios {
+			if builtin.Name == name {
+				scenario = builtin
+				scenario.Steps = append([]ScenarioStep(nil), builtin.Steps...)
+				found = true
+			}
+		}
+		if !found {
+			http.Error(w, fmt.Sprintf("Unknown scenario %q", name), http.StatusNotFound)
+			return
+		}
+	}
+	if err := scenario.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.String("scenario.name", scenario.Name))
+
+	run, err := app.startScenario(ctx, scenario)
+	if errors.Is(err, errScenarioRunning) {
+		http.Error(w, "A scenario is already running; abort it first", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to start scenario", http.StatusInternalServerError)
+		return
+	}
+	span.SetAttributes(attribute.String("scenario.run_id", run.ID), attribute.String("scenario.trace_id", run.TraceID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(run)
+}
+
+// abortScenarioHandler stops the running scenario, which recovers from its
+// faults on the way out.
+func (app *App) abortScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	if app.scenarios == nil {
+		http.Error(w, "Scenarios are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	app.scenarios.mu.Lock()
+	running := app.scenarios.current != nil && app.scenarios.current.State == "running"
+	if running {
+		app.scenarios.cancel()
+	}
+	app.scenarios.mu.Unlock()
+	if !running {
+		http.Error(w, "No scenario is running", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
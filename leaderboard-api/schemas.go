@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/anticheat"
+)
+
+const (
+	// Requests that don't name a schema version are validated against v1, the
+	// payload clients sent before versions existed
+	defaultSubmissionSchemaVersion = 1
+)
+
+// jsonSchema is the subset of JSON Schema (draft 2020-12) the submission
+// schemas use. It marshals to the published document and validates decoded
+// payloads.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	ID                   string                 `json:"$id,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Minimum              *int64                 `json:"minimum,omitempty"`
+	Maximum              *int64                 `json:"maximum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+func intPtr(v int) *int       { return &v }
+func int64Ptr(v int64) *int64 { return &v }
+func boolPtr(v bool) *bool    { return &v }
+
+// submissionSchemas are the published versions of the POST /api/scores body.
+// Versions are never changed once published; add a new one instead.
+var submissionSchemas = map[int]*jsonSchema{
+	1: {
+		Title:       "Score submission v1",
+		Description: "The original payload. Unknown fields are ignored.",
+		Type:        "object",
+		Properties: map[string]*jsonSchema{
+			"submissionId":   {Type: "string"},
+			"playerName":     {Type: "string"},
+			"score":          {Type: "integer"},
+			"sessionId":      {Type: "string"},
+			"playerId":       {Type: "string"},
+			"tags":           {Type: "array", Items: &jsonSchema{Type: "string"}},
+			"extrasVersion":  {Type: "integer"},
+			"extras":         {Type: "object"},
+			"mode":           {Type: "string"},
+			"difficulty":     {Type: "string"},
+			"eventLog":       {Type: "string"},
+			"spiceCollected": {Type: "integer"},
+			"biome":          {Type: "string"},
+			"inputMethod":    {Type: "string"},
+		},
+		Required: []string{"sessionId"},
+	},
+	2: {
+		Title:       "Score submission v2",
+		Description: "Strict payload: unknown fields and out-of-range values are rejected before anti-cheat runs.",
+		Type:        "object",
+		Properties: map[string]*jsonSchema{
+			"submissionId": {Type: "string", Pattern: "^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$"},
+			"playerName":   {Type: "string", MaxLength: intPtr(100)},
+			"score":        {Type: "integer", Minimum: int64Ptr(0)},
+			"sessionId":    {Type: "string", MinLength: intPtr(1), MaxLength: intPtr(100)},
+			"playerId":     {Type: "string", MaxLength: intPtr(100)},
+			"tags": {Type: "array", MaxItems: intPtr(maxScoreTags),
+				Items: &jsonSchema{Type: "string", MinLength: intPtr(1)}},
+			"extrasVersion":  {Type: "integer", Minimum: int64Ptr(0)},
+			"extras":         {Type: "object"},
+			"mode":           {Type: "string", MaxLength: intPtr(maxGameModeLength)},
+			"difficulty":     {Type: "string", MaxLength: intPtr(maxGameModeLength)},
+			"eventLog":       {Type: "string", MaxLength: intPtr(anticheat.MaxEncodedRunLog)},
+			"spiceCollected": {Type: "integer", Minimum: int64Ptr(0), Maximum: int64Ptr(maxSpicePerRun)},
+			"biome":          {Type: "string", MaxLength: intPtr(maxBiomeNameLen)},
+			"inputMethod":    {Type: "string", MaxLength: intPtr(maxInputMethodLen)},
+		},
+		Required:             []string{"score", "sessionId"},
+		AdditionalProperties: boolPtr(false),
+	},
+}
+
+func init() {
+	for version, schema := range submissionSchemas {
+		schema.Schema = "https://json-schema.org/draft/2020-12/schema"
+		schema.ID = fmt.Sprintf("/api/schemas/%d", version)
+		schema.compile()
+	}
+}
+
+func (s *jsonSchema) compile() {
+	if s.Pattern != "" {
+		s.pattern = regexp.MustCompile(s.Pattern)
+	}
+	for _, property := range s.Properties {
+		property.compile()
+	}
+	if s.Items != nil {
+		s.Items.compile()
+	}
+}
+
+func submissionSchemaVersions() []int {
+	versions := make([]int, 0, len(submissionSchemas))
+	for version := range submissionSchemas {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// negotiateSubmissionSchema reads the schema version from the Content-Type's
+// version parameter, e.g. "application/json; version=2".
+func (app *App) negotiateSubmissionSchema(r *http.Request) (int, *jsonSchema, error) {
+	version := defaultSubmissionSchemaVersion
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		_, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid Content-Type")
+		}
+		if v, ok := params["version"]; ok {
+			if version, err = strconv.Atoi(v); err != nil {
+				return 0, nil, fmt.Errorf("invalid schema version %q", v)
+			}
+		}
+	}
+	schema, ok := submissionSchemas[version]
+	if !ok || version < app.cfg().Submissions.SchemaMinVersion {
+		supported := []string{}
+		for _, v := range submissionSchemaVersions() {
+			if v >= app.cfg().Submissions.SchemaMinVersion {
+				supported = append(supported, strconv.Itoa(v))
+			}
+		}
+		return 0, nil, fmt.Errorf("unsupported schema version %d (supported: %s)", version, strings.Join(supported, ", "))
+	}
+	return version, schema, nil
+}
+
+// validatePayload checks a request body against schema.
+func validatePayload(schema *jsonSchema, body []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	return schema.validate(value, "")
+}
+
+func (s *jsonSchema) validate(value interface{}, path string) error {
+	at := func(format string, args ...interface{}) error {
+		if path == "" {
+			return fmt.Errorf(format, args...)
+		}
+		return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+	}
+
+	// null reads as absent, as it does when decoding into ScoreSubmission
+	if value == nil && path != "" {
+		return nil
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return at("must be an object")
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return at("%s is required", name)
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return at("unknown field %s", name)
+				}
+				continue
+			}
+			if err := property.validate(object[name], strings.TrimPrefix(path+"."+name, ".")); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return at("must be an array")
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			return at("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return at("must be a string")
+		}
+		length := utf8.RuneCountInString(str)
+		if s.MinLength != nil && length < *s.MinLength {
+			return at("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return at("must be at most %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(str) {
+			return at("must match %s", s.Pattern)
+		}
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return at("must be an integer")
+		}
+		n, err := number.Int64()
+		if err != nil {
+			return at("must be an integer")
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			return at("must be at least %d", *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			return at("must be at most %d", *s.Maximum)
+		}
+	}
+	return nil
+}
+
+// getSchemasHandler lists the published submission schema versions.
+func (app *App) getSchemasHandler(w http.ResponseWriter, r *http.Request) {
+	type schemaVersion struct {
+		Version int    `json:"version"`
+		URL     string `json:"url"`
+		Title   string `json:"title"`
+		Retired bool   `json:"retired,omitempty"`
+	}
+	versions := []schemaVersion{}
+	for _, version := range submissionSchemaVersions() {
+		versions = append(versions, schemaVersion{
+			Version: version,
+			URL:     submissionSchemas[version].ID,
+			Title:   submissionSchemas[version].Title,
+			Retired: version < app.cfg().Submissions.SchemaMinVersion,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// getSchemaHandler serves one submission schema version.
+func (app *App) getSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	version, _ := strconv.Atoi(mux.Vars(r)["version"])
+	schema, ok := submissionSchemas[version]
+	if !ok {
+		http.Error(w, "Unknown schema version", http.StatusNotFound)
+		return
+	}
+	// Published versions never change
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("Content-Type", "application/schema+json")
+	json.NewEncoder(w).Encode(schema)
+}
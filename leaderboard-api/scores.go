@@ -0,0 +1,510 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/anticheat"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/cache"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultSubmissionMaxBodyBytes leaves room for a full set of tags and extras.
+const defaultSubmissionMaxBodyBytes = 8 << 10
+
+type ScoreSubmission struct {
+	SubmissionID   string                     `json:"submissionId,omitempty"`
+	PlayerName     string                     `json:"playerName"`
+	Score          int                        `json:"score"`
+	SessionID      string                     `json:"sessionId"`
+	PlayerID       string                     `json:"playerId,omitempty"`
+	Tags           []string                   `json:"tags,omitempty"`
+	ExtrasVersion  int                        `json:"extrasVersion,omitempty"`
+	Extras         map[string]json.RawMessage `json:"extras,omitempty"`
+	Mode           string                     `json:"mode,omitempty"`
+	Difficulty     string                     `json:"difficulty,omitempty"`
+	EventLog       string                     `json:"eventLog,omitempty"`
+	SpiceCollected int                        `json:"spiceCollected,omitempty"`
+	Biome          string                     `json:"biome,omitempty"`
+	InputMethod    string                     `json:"inputMethod,omitempty"`
+
+	// accountID is the signed-in player, if any
+	accountID string
+	// apiKey is the trusted backend that sent the submission, if any
+	apiKey *APIKey
+	// source is what classifySource made of the request
+	source string
+	// shadowBanned stores the score hidden, as if quarantined
+	shadowBanned bool
+	// pendingReview holds a verified runner's score above the ceiling for a
+	// moderator to confirm
+	pendingReview bool
+}
+
+// idempotencyScope is who an Idempotency-Key belongs to: the signed-in
+// account, else the API key, else the game session.
+func (s *ScoreSubmission) idempotencyScope() string {
+	switch {
+	case s.accountID != "":
+		return "account:" + s.accountID
+	case s.apiKey != nil:
+		return "api-key:" + strconv.Itoa(s.apiKey.ID)
+	}
+	return "session:" + s.SessionID
+}
+
+// quarantineReason is why the score is stored hidden, or "" if it isn't.
+func (s *ScoreSubmission) quarantineReason() string {
+	switch {
+	case s.shadowBanned:
+		return "shadow_ban"
+	case s.pendingReview:
+		return quarantineVerifiedReview
+	}
+	return ""
+}
+
+// storeScore is the score to store for the submission.
+func (s *ScoreSubmission) storeScore(ctx context.Context) *store.Score {
+	score := &store.Score{
+		SubmissionID:     s.SubmissionID,
+		PlayerName:       s.PlayerName,
+		Score:            s.Score,
+		SessionID:        s.SessionID,
+		PlayerID:         s.PlayerID,
+		Tags:             s.Tags,
+		ExtrasVersion:    s.ExtrasVersion,
+		Extras:           s.Extras,
+		Mode:             s.Mode,
+		Difficulty:       s.Difficulty,
+		Biome:            s.Biome,
+		InputMethod:      s.InputMethod,
+		TraceParent:      traceParent(ctx),
+		QuarantineReason: s.quarantineReason(),
+	}
+	if s.apiKey != nil {
+		score.APIKeyID = s.apiKey.ID
+	}
+	return score
+}
+
+type ScoreResponse struct {
+	ID            int       `json:"id"`
+	PlayerName    string    `json:"playerName"`
+	DisplayName   string    `json:"displayName,omitempty"`
+	Discriminator string    `json:"discriminator,omitempty"`
+	Score         int       `json:"score"`
+	Rank          int       `json:"rank"`
+	CreatedAt     time.Time `json:"createdAt"`
+	// PendingReview is set when a verified runner's score awaits confirmation
+	PendingReview bool `json:"pendingReview,omitempty"`
+	// Timing is the latency breakdown, only sent with ?debug=timing
+	Timing []PhaseTiming `json:"timing,omitempty"`
+}
+
+// acceptsEventLogs reports whether submissions may carry an event log, which
+// only the runlog stage reads.
+func (app *App) acceptsEventLogs() bool {
+	return app.pipeline.has("runlog") || (app.candidatePipeline != nil && app.candidatePipeline.has("runlog"))
+}
+
+// rejectOversizedBody answers 413 for a body over limit bytes.
+func rejectOversizedBody(ctx context.Context, w http.ResponseWriter, route string, limit int) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("http.request.body.oversized", true))
+	requestBodyOversizedTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("http.route", route)))
+	http.Error(w, fmt.Sprintf("Request body too large (max %d bytes)", limit), http.StatusRequestEntityTooLarge)
+}
+
+func (app *App) submitScoreHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "submitScore")
+	defer span.End()
+	timer := newPhaseTimer(time.Now())
+	ctx = withPhaseTimer(ctx, timer)
+
+	// The event log is limited on its own, so it gets room on top when a
+	// pipeline stage replays it; otherwise nothing may pass the body limit
+	maxBody := app.cfg().Submissions.MaxBodyBytes
+	readLimit := maxBody
+	if app.acceptsEventLogs() {
+		readLimit += anticheat.MaxEncodedRunLog
+	}
+	var submission ScoreSubmission
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(readLimit)))
+	if err == nil {
+		err = json.Unmarshal(body, &submission)
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || (err == nil && len(body)-len(submission.EventLog) > maxBody) {
+		scoreSubmissionErrors.Add(ctx, 1, metric.WithAttributes(attribute.String("error", "body_too_large")))
+		rejectOversizedBody(ctx, w, "/api/scores", maxBody)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		scoreSubmissionErrors.Add(ctx, 1, metric.WithAttributes(attribute.String("error", "invalid_json")))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the body against the schema version the client speaks
+	schemaVersion, schema, err := app.negotiateSubmissionSchema(r)
+	if err != nil {
+		scoreSubmissionErrors.Add(ctx, 1, metric.WithAttributes(attribute.String("error", "unsupported_schema")))
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	span.SetAttributes(attribute.Int("submission.schema_version", schemaVersion))
+	if err := validatePayload(schema, body); err != nil {
+		scoreSubmissionErrors.Add(ctx, 1, metric.WithAttributes(attribute.String("error", "schema_mismatch")))
+		http.Error(w, fmt.Sprintf("payload does not match schema v%d: %v", schemaVersion, err), http.StatusBadRequest)
+		return
+	}
+	timer.lap(ctx, phaseDecode)
+
+	// Refuse unauthenticated requests before they claim an Idempotency-Key,
+	// which would block their retries until the claim expired
+	submission.apiKey = apiKeyFromContext(ctx)
+	submission.source = classifySource(r.Header.Get, submission.apiKey != nil)
+	if err := app.bindAccount(&submission, r.Header.Get("Authorization")); err != nil {
+		scoreSubmissionErrors.Add(ctx, 1, metric.WithAttributes(attribute.String("error", "unauthenticated")))
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	span.SetAttributes(attribute.Bool("player.signed_in", submission.accountID != ""))
+
+	// A retry with the same Idempotency-Key gets the first response back
+	idempotency := app.idempotency()
+	idempotencyScope := submission.idempotencyScope()
+	idempotencyKey := r.Header.Get(handlers.IdempotencyKeyHeader)
+	if idempotencyKey != "" {
+		if err := handlers.CheckIdempotencyKey(idempotencyKey); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		stored, err := idempotency.Begin(ctx, idempotencyScope, idempotencyKey, body)
+		switch {
+		case errors.Is(err, handlers.ErrIdempotencyKeyReused):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		case errors.Is(err, handlers.ErrConflict):
+			handlers.WriteError(w, err, "")
+			return
+		case err != nil:
+			span.RecordError(err)
+		case stored != nil:
+			span.SetAttributes(attribute.Bool("submission.duplicate", true))
+			duplicateSubmissionsTotal.Add(ctx, 1)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+		if submission.SubmissionID == "" {
+			submission.SubmissionID = handlers.IdempotencySubmissionID(idempotencyScope, idempotencyKey, body)
+		}
+	}
+
+	response, replayed, err := app.submitScore(ctx, &submission)
+	if err != nil {
+		if idempotencyKey != "" {
+			idempotency.Abort(ctx, idempotencyScope, idempotencyKey)
+		}
+		handlers.WriteError(w, err, "Failed to save score")
+		return
+	}
+
+	if r.URL.Query().Get("debug") == debugTimingParam {
+		response.Timing = timer.breakdown()
+	}
+	status := http.StatusCreated
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+		status = http.StatusOK
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		if idempotencyKey != "" {
+			idempotency.Abort(ctx, idempotencyScope, idempotencyKey)
+		}
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	if idempotencyKey != "" {
+		idempotency.Finish(ctx, idempotencyScope, idempotencyKey, body, status, data)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// submitScore validates, stores and announces a submission. A retried
+// submission returns the result stored the first time, with replayed set.
+// Errors carry a domain kind for errorStatus.
+func (app *App) submitScore(ctx context.Context, submission *ScoreSubmission) (*ScoreResponse, bool, error) {
+	span := trace.SpanFromContext(ctx)
+	timer := phaseTimerFromContext(ctx)
+	if submission.source == "" {
+		submission.source = sourceUnknown
+	}
+	fail := func(label string, err error) (*ScoreResponse, bool, error) {
+		span.RecordError(err)
+		scoreSubmissionErrors.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("error", label),
+			attribute.String("submission.source", submission.source),
+		))
+		app.recordSubmissionSource(ctx, submission.source, sourceRejected)
+		return nil, false, err
+	}
+
+	span.SetAttributes(
+		attribute.String("submission.source", submission.source),
+		attribute.String("player.name", submission.PlayerName),
+		attribute.Int("game.score", submission.Score),
+		attribute.String("game.session_id", submission.SessionID),
+		attribute.String("game.input_method", submission.InputMethod),
+	)
+
+	// Without Postgres there's nowhere to store the score; say so straight away
+	if app.readOnly() {
+		return fail("read_only", errReadOnly)
+	}
+
+	// A retried submission gets the result stored the first time
+	if submission.SubmissionID != "" {
+		submissionID, err := normalizeSubmissionID(submission.SubmissionID)
+		if err != nil {
+			return fail("invalid_submission_id", handlers.NewError(handlers.ErrValidation, err.Error(), nil))
+		}
+		submission.SubmissionID = submissionID
+		span.SetAttributes(attribute.String("submission.id", submissionID))
+
+		existing, err := app.findSubmission(ctx, submissionID)
+		if err != nil {
+			return fail("db_lookup_failed", store.Classify(err))
+		}
+		if existing != nil {
+			app.replaySubmission(ctx, existing)
+			return existing, true, nil
+		}
+	}
+
+	// Validate score
+	if err := app.validateScore(ctx, submission); err != nil {
+		span.SetAttributes(attribute.Bool("validation.passed", false))
+		label := "validation_failed"
+		switch {
+		case errors.Is(err, handlers.ErrRateLimited):
+			label = "rate_limited"
+		case errors.Is(err, handlers.ErrBanned):
+			label = "banned"
+		}
+		return fail(label, err)
+	}
+	span.SetAttributes(attribute.Bool("validation.passed", true))
+
+	// Bind the display name to the player identity, tagging duplicates
+	player, err := app.resolvePlayer(ctx, submission)
+	if errors.Is(err, errAccountRequired) {
+		return fail("account_required", handlers.NewError(handlers.ErrUnauthenticated, "Sign in to submit as this player", err))
+	}
+	if err != nil {
+		return fail("player_resolution_failed", handlers.InternalError("Failed to resolve player", err))
+	}
+
+	// Shadow-banned players get the usual response, but the score stays hidden
+	submission.shadowBanned = app.isShadowBanned(ctx, submission)
+	timer.lap(ctx, phaseValidate)
+
+	// Insert score into database
+	scoreID, createdAt, err := app.store.InsertScore(ctx, submission.storeScore(ctx))
+	if errors.Is(err, store.ErrDuplicateSubmission) {
+		// A concurrent retry stored it first
+		existing, lookupErr := app.findSubmission(ctx, submission.SubmissionID)
+		if lookupErr == nil && existing != nil {
+			app.replaySubmission(ctx, existing)
+			return existing, true, nil
+		}
+		err = errDuplicateSubmission
+	}
+	if err != nil {
+		return fail("db_insert_failed", err)
+	}
+	timer.lap(ctx, phaseInsert)
+
+	// Rank the score, invalidate cache and wake long-poll clients
+	if submission.quarantineReason() == "" {
+		app.rankingAdd(ctx, scoreID, submission.Score)
+		app.staleCachedTopScores(ctx)
+		app.checkRecordBroken(ctx, submission.Score)
+		app.dropCachedPlayerStats(ctx, submission.PlayerName)
+		app.markSurrogateKeys(ctx, surrogateKeyLeaderboard, surrogateKeyPlayer(submission.PlayerName))
+		app.publishChange(ctx)
+		app.addSpice(ctx, submission)
+		app.advanceCommunityGoals(ctx, submission)
+	}
+	timer.lap(ctx, phaseCache)
+	app.sampleReplay(ctx, scoreID, createdAt, submission)
+
+	// Calculate rank
+	rank, err := app.scoreRank(ctx, scoreID, submission.Score)
+	if err != nil {
+		log.Printf("Failed to calculate rank: %v", err)
+		rank = -1
+	}
+	span.SetAttributes(attribute.Int("rank.calculated", rank))
+	timer.lap(ctx, phaseRank)
+
+	scoreSubmissionsTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("submission.source", submission.source)))
+	app.recordSubmissionSource(ctx, submission.source, sourceAccepted)
+
+	response := &ScoreResponse{
+		ID:         scoreID,
+		PlayerName: submission.PlayerName,
+		Score:      submission.Score,
+		Rank:       rank,
+		CreatedAt:  createdAt,
+	}
+	if player != nil {
+		response.DisplayName = player.DisplayName
+		response.Discriminator = player.Discriminator
+	}
+
+	if submission.shadowBanned {
+		// Hidden scores are never announced
+		shadowBannedSubmissionsTotal.Add(ctx, 1)
+		return response, false, nil
+	}
+	if submission.pendingReview {
+		// Announced, if at all, once a moderator restores it
+		response.PendingReview = true
+		log.Printf("🚩 Score %d by verified runner %s held for review", scoreID, submission.PlayerName)
+		app.recordQuarantine(ctx, quarantineVerifiedReview)
+		return response, false, nil
+	}
+	app.emitEvent(ctx, eventTypeScoreAccepted, response.PlayerName, ScoreAcceptedEvent{
+		ID:         response.ID,
+		PlayerName: response.PlayerName,
+		Score:      response.Score,
+		Rank:       response.Rank,
+		CreatedAt:  response.CreatedAt,
+	})
+
+	return response, false, nil
+}
+
+// invalidateCache drops the cached boards after a change to the scores, and
+// has top_scores_view refreshed.
+func (app *App) invalidateCache(ctx context.Context) {
+	if app.topView != nil {
+		app.topView.markDirty()
+	}
+	app.dropCachedTopScores(ctx)
+}
+
+func (app *App) dropCachedTopScores(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "invalidateCache")
+	defer span.End()
+
+	start := time.Now()
+	defer func() {
+		redisOpDuration.Record(ctx, time.Since(start).Seconds(),
+			metric.WithAttributes(attribute.String("operation", "delete")))
+	}()
+
+	// Delete top scores cache, including every tag-filtered board
+	keys := []string{cacheKeyTopScores, cacheKeyTaggedTopKeys}
+	if tagged, err := app.cache.SMembers(ctx, cacheKeyTaggedTopKeys); err == nil {
+		keys = append(keys, tagged...)
+	}
+	if err := app.cache.Del(ctx, keys...); err != nil {
+		log.Printf("Failed to invalidate cache: %v", err)
+	}
+}
+
+func (app *App) calculateRank(ctx context.Context, score int) (int, error) {
+	ctx, span := tracer.Start(ctx, "calculateRank")
+	defer span.End()
+
+	// Try the ranking sorted set first
+	if app.rankEngineFor(ctx) == rankEngineZSet {
+		rank, err := app.rankingRankOf(ctx, score)
+		if err == nil {
+			cacheHitTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "ranking")))
+			span.SetAttributes(attribute.Bool("cache.hit", true))
+			app.compareRankOf(ctx, score, rank)
+			return rank, nil
+		}
+
+		cacheMissTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "ranking")))
+		span.SetAttributes(attribute.Bool("cache.hit", false))
+	}
+
+	// Ranking unavailable - query database, once for concurrent equal scores
+	rank, err := coalesce(ctx, app, "rank", strconv.Itoa(score), func(ctx context.Context) (int, error) {
+		return app.cachedRank(ctx, score)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if app.rankEngine == rankEnginePostgres {
+		app.compareRankOf(ctx, score, rank)
+	}
+	return rank, nil
+}
+
+// cachedRank counts the scores above score, cached for CacheTTLs.PlayerRank
+// when it is set. The cache key carries the leaderboard version this replica
+// last saw, so a rank only outlives a change until the replica hears of it,
+// and the player stats generation, so bulk changes drop it at once.
+func (app *App) cachedRank(ctx context.Context, score int) (int, error) {
+	ttl := app.cfg().CacheTTLs.PlayerRank
+	if ttl <= 0 {
+		return app.store.Rank(ctx, score)
+	}
+
+	version, _ := app.changes.current()
+	cacheKey := fmt.Sprintf(cacheKeyRank, app.playerStatsGeneration(ctx), version, score)
+	if rank, err := cache.GetInt64(ctx, app.cache, cacheKey); err == nil {
+		cacheHitTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "player_rank")))
+		return int(rank), nil
+	}
+	cacheMissTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "player_rank")))
+
+	rank, err := app.store.Rank(ctx, score)
+	if err != nil {
+		return 0, err
+	}
+	cache.SetInt64(ctx, app.cache, cacheKey, int64(rank), ttl)
+	return rank, nil
+}
+
+// scoreRank returns the board position of a stored score, falling back to the
+// rank of its value when the ranking is unavailable.
+func (app *App) scoreRank(ctx context.Context, scoreID, score int) (int, error) {
+	if app.rankEngine == rankEnginePostgres {
+		rank, err := app.postgresPosition(ctx, scoreID, score)
+		if err == nil {
+			app.comparePosition(ctx, scoreID, score, rank)
+		}
+		return rank, err
+	}
+	if rank, err := app.rankingPosition(ctx, scoreID); err == nil {
+		app.comparePosition(ctx, scoreID, score, rank)
+		return rank, nil
+	}
+	return app.calculateRank(ctx, score)
+}
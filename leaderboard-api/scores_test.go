@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+)
+
+func TestSubmitScore(t *testing.T) {
+	app, scores := newTestApp(t)
+	router := testRouter(app)
+
+	var response ScoreResponse
+	rec := doJSON(t, router, http.MethodPost, "/spice/leaderboard/api/scores",
+		ScoreSubmission{PlayerName: "Paul", Score: 1200, SessionID: "session-1"}, &response)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	if response.ID == 0 || response.PlayerName != "Paul" || response.Score != 1200 || response.Rank != 1 {
+		t.Errorf("response = %+v, want Paul's 1200 ranked 1 with an ID", response)
+	}
+
+	stored, err := scores.TopScores(context.Background(), 10, nil)
+	if err != nil {
+		t.Fatalf("TopScores: %v", err)
+	}
+	if len(stored) != 1 || stored[0].ID != response.ID {
+		t.Errorf("stored = %+v, want only score %d", stored, response.ID)
+	}
+}
+
+func TestSubmitScoreRejectsInvalidBody(t *testing.T) {
+	app, scores := newTestApp(t)
+	router := testRouter(app)
+
+	rec := doJSON(t, router, http.MethodPost, "/spice/leaderboard/api/scores",
+		map[string]any{"playerName": "Paul", "score": "lots", "sessionId": "session-1"}, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+	if stored, _ := scores.TopScores(context.Background(), 10, nil); len(stored) != 0 {
+		t.Errorf("stored = %+v, want nothing", stored)
+	}
+}
+
+func TestSubmitScoreChecksSchemaWhenStagesLeaveItOut(t *testing.T) {
+	app, scores := newTestApp(t)
+	pipeline, err := newSubmissionPipeline(app, []string{"identity", "rate", "schema"})
+	if err != nil {
+		t.Fatalf("failed to build pipeline: %v", err)
+	}
+	if names := strings.Join(pipeline.names(), ","); names != "schema,identity,rate" {
+		t.Errorf("stages = %s, want schema moved first", names)
+	}
+	if app.pipeline, err = newSubmissionPipeline(app, []string{"identity", "rate"}); err != nil {
+		t.Fatalf("failed to build pipeline: %v", err)
+	}
+	router := testRouter(app)
+
+	rec := doJSON(t, router, http.MethodPost, "/spice/leaderboard/api/scores",
+		ScoreSubmission{PlayerName: strings.Repeat("a", 101), Score: 1200, SessionID: "session-1"}, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+	if stored, _ := scores.TopScores(context.Background(), 10, nil); len(stored) != 0 {
+		t.Errorf("stored = %+v, want nothing", stored)
+	}
+}
+
+func TestSubmitScoreLimitsBodyWithoutRunLogStage(t *testing.T) {
+	app, scores := newTestApp(t)
+	router := testRouter(app)
+
+	// Without the runlog stage an event log gets no room of its own
+	eventLog := strings.Repeat("A", app.cfg().Submissions.MaxBodyBytes)
+	rec := doJSON(t, router, http.MethodPost, "/spice/leaderboard/api/scores",
+		ScoreSubmission{PlayerName: "Paul", Score: 1200, SessionID: "session-1", EventLog: eventLog}, nil)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusRequestEntityTooLarge, rec.Body.String())
+	}
+	if stored, _ := scores.TopScores(context.Background(), 10, nil); len(stored) != 0 {
+		t.Errorf("stored = %+v, want nothing", stored)
+	}
+}
+
+func TestSubmitScoreRejectsAccountNameWithoutToken(t *testing.T) {
+	app, scores := newTestApp(t)
+	router := testRouter(app)
+	scores.AddAccount("paul-account", "Paul")
+
+	// Neither the bare name nor another case of it may be used without an identity
+	for _, name := range []string{"Paul", "paul"} {
+		rec := doJSON(t, router, http.MethodPost, "/spice/leaderboard/api/scores",
+			ScoreSubmission{PlayerName: name, Score: 1200, SessionID: "session-" + name}, nil)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want %d: %s", name, rec.Code, http.StatusUnauthorized, rec.Body.String())
+		}
+	}
+	if stored, _ := scores.TopScores(context.Background(), 10, nil); len(stored) != 0 {
+		t.Errorf("stored = %+v, want nothing", stored)
+	}
+}
+
+func TestSubmitScoreTagsAccountNameForOtherPlayers(t *testing.T) {
+	app, scores := newTestApp(t)
+	router := testRouter(app)
+	scores.AddAccount("paul-account", "Paul")
+
+	var response ScoreResponse
+	rec := doJSON(t, router, http.MethodPost, "/spice/leaderboard/api/scores",
+		ScoreSubmission{PlayerName: "Paul", PlayerID: "someone-else", Score: 1200, SessionID: "session-1"}, &response)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	if response.DisplayName != "Paul" || response.Discriminator == "" || response.PlayerName == "Paul" {
+		t.Errorf("response = %+v, want Paul with a discriminator", response)
+	}
+}
+
+func TestSubmitScoreUnauthenticatedKeepsIdempotencyKeyFree(t *testing.T) {
+	app, scores := newTestApp(t)
+	app.accounts = &accountAuth{secret: []byte("test-secret"), anonymous: true}
+	router := testRouter(app)
+
+	const key = "retry-me"
+	body, err := json.Marshal(ScoreSubmission{PlayerName: "Paul", Score: 1200, SessionID: "session-1"})
+	if err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+	submit := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/spice/leaderboard/api/scores", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(handlers.IdempotencyKeyHeader, key)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := submit("Bearer not-a-token"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body.String())
+	}
+	idempotency := app.idempotency()
+	scope := (&ScoreSubmission{SessionID: "session-1"}).idempotencyScope()
+	if stored, err := idempotency.Begin(context.Background(), scope, key, body); stored != nil || err != nil {
+		t.Errorf("idempotency key held after a 401 (%+v, %v), want it free", stored, err)
+	}
+	idempotency.Abort(context.Background(), scope, key)
+
+	// The retry isn't turned away as in progress
+	if rec := submit(""); rec.Code != http.StatusCreated {
+		t.Fatalf("retry status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	if stored, _ := scores.TopScores(context.Background(), 10, nil); len(stored) != 1 {
+		t.Errorf("stored = %+v, want the retried score", stored)
+	}
+}
+
+func TestSubmitScoreIdempotencyKeyIsPerCaller(t *testing.T) {
+	app, scores := newTestApp(t)
+	router := testRouter(app)
+
+	submit := func(submission ScoreSubmission) *httptest.ResponseRecorder {
+		body, err := json.Marshal(submission)
+		if err != nil {
+			t.Fatalf("failed to encode request: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/spice/leaderboard/api/scores", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(handlers.IdempotencyKeyHeader, "1")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Two players who both count their runs from 1
+	for _, submission := range []ScoreSubmission{
+		{PlayerName: "Paul", Score: 1200, SessionID: "session-1"},
+		{PlayerName: "Jessica", Score: 900, SessionID: "session-2"},
+	} {
+		if rec := submit(submission); rec.Code != http.StatusCreated {
+			t.Fatalf("%s: status = %d, want %d: %s", submission.PlayerName, rec.Code, http.StatusCreated, rec.Body.String())
+		}
+	}
+	if stored, _ := scores.TopScores(context.Background(), 10, nil); len(stored) != 2 {
+		t.Errorf("stored = %+v, want both runs", stored)
+	}
+}
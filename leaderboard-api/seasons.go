@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// Each season keeps its top scores in season_standings when it ends
+	defaultSeasonArchiveSize = 1000
+	seasonCheckInterval      = time.Minute
+)
+
+// Season is one leaderboard season. The current season has no EndedAt; EndsAt
+// is when it is scheduled to roll over, if ever.
+type Season struct {
+	ID        int        `json:"id"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndsAt    *time.Time `json:"endsAt,omitempty"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+	Current   bool       `json:"current"`
+}
+
+type SeasonLeaderboard struct {
+	Season  Season             `json:"season"`
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+// seasonSchedule decides when a season starting at a given time ends: "weekly"
+// (Monday 00:00 UTC), "monthly" (the 1st, 00:00 UTC) or a fixed duration.
+// The zero schedule never ends a season.
+type seasonSchedule struct {
+	spec  string
+	every time.Duration
+}
+
+func parseSeasonSchedule(spec string) (seasonSchedule, error) {
+	switch spec {
+	case "", "weekly", "monthly":
+		return seasonSchedule{spec: spec}, nil
+	}
+	every, err := time.ParseDuration(spec)
+	if err != nil || every < time.Hour {
+		return seasonSchedule{}, fmt.Errorf(`SEASON_SCHEDULE must be "weekly", "monthly" or a duration of at least 1h`)
+	}
+	return seasonSchedule{spec: spec, every: every}, nil
+}
+
+// endOf returns when a season started at start ends, or nil if it doesn't.
+func (s seasonSchedule) endOf(start time.Time) *time.Time {
+	start = start.UTC()
+	var end time.Time
+	switch {
+	case s.every > 0:
+		end = start.Add(s.every)
+	case s.spec == "weekly":
+		midnight := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+		days := (8 - int(midnight.Weekday())) % 7
+		if days == 0 {
+			days = 7
+		}
+		end = midnight.AddDate(0, 0, days)
+	case s.spec == "monthly":
+		end = time.Date(start.Year(), start.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return nil
+	}
+	return &end
+}
+
+// ensureSeason opens the first season if there is none, aligns the current
+// season's end with the configured schedule, and assigns scores from before
+// seasons existed to it.
+func (app *App) ensureSeason(ctx context.Context) (Season, error) {
+	ctx, span := tracer.Start(ctx, "ensureSeason")
+	defer span.End()
+
+	// The partial unique index allows only one open season across replicas
+	if _, err := store.OpenFirstSeasonQuery.Exec(ctx, app.db); err != nil {
+		return Season{}, err
+	}
+
+	season, err := app.currentSeason(ctx)
+	if err != nil {
+		return Season{}, err
+	}
+	season.EndsAt = app.seasonSchedule.endOf(season.StartedAt)
+	if _, err := store.ScheduleSeasonQuery.Exec(ctx, app.db, season.ID, season.EndsAt); err != nil {
+		return Season{}, err
+	}
+
+	tag, err := store.AssignUnseasonedScoresQuery.Exec(ctx, app.db, season.ID)
+	if err != nil {
+		return Season{}, err
+	}
+	if tag.RowsAffected() > 0 {
+		log.Printf("✅ Assigned %d existing scores to season %d", tag.RowsAffected(), season.ID)
+	}
+
+	span.SetAttributes(attribute.Int("season.id", season.ID))
+	return season, nil
+}
+
+func (app *App) currentSeason(ctx context.Context) (Season, error) {
+	season := Season{Current: true}
+	err := store.CurrentSeasonQuery.QueryRow(ctx, app.db).Scan(&season.ID, &season.StartedAt, &season.EndsAt)
+	return season, err
+}
+
+// runSeasonRollover ends the current season once its end time passes. Every
+// replica checks; the row lock on the season lets only one of them roll over.
+func (app *App) runSeasonRollover(ctx context.Context) {
+	ticker := time.NewTicker(seasonCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			season, err := app.currentSeason(ctx)
+			if err != nil {
+				log.Printf("Failed to check current season: %v", err)
+				continue
+			}
+			if season.EndsAt == nil || time.Now().Before(*season.EndsAt) {
+				continue
+			}
+			if err := app.rolloverSeason(ctx, season); err != nil {
+				log.Printf("Failed to roll over season %d: %v", season.ID, err)
+			}
+		}
+	}
+}
+
+// rolloverSeason closes season, archives its standings and opens the next
+// season, all in one transaction.
+func (app *App) rolloverSeason(ctx context.Context, season Season) error {
+	ctx, span := tracer.Start(ctx, "rolloverSeason")
+	defer span.End()
+	span.SetAttributes(attribute.Int("season.id", season.ID))
+
+	start := time.Now()
+	defer func() {
+		store.ObserveQuery(ctx, "rollover_season", start)
+	}()
+
+	tx, err := app.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var endedAt time.Time
+	err = store.EndSeasonQuery.QueryRow(ctx, tx, season.ID).Scan(&endedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Another replica got there first
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	archived, err := store.ArchiveStandingsQuery.Exec(ctx, tx, season.ID, seasonArchiveSize())
+	if err != nil {
+		return err
+	}
+
+	var next int
+	err = store.StartSeasonQuery.QueryRow(ctx, tx, endedAt, app.seasonSchedule.endOf(endedAt)).Scan(&next)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	span.SetAttributes(attribute.Int64("season.archived", archived.RowsAffected()))
+	log.Printf("🏁 Season %d ended with %d archived scores; season %d started",
+		season.ID, archived.RowsAffected(), next)
+
+	// The board starts empty: rebuild the ranking for the new season
+	if err := app.redis.Del(ctx, cacheKeyRankingReady).Err(); err != nil {
+		log.Printf("Failed to reset ranking: %v", err)
+	}
+	app.rankingReady(ctx)
+	app.invalidateCache(ctx)
+	app.dropCachedPlayerStats(ctx)
+	app.markSurrogateKeys(ctx, surrogateKeyLeaderboard)
+	app.publishChange(ctx)
+
+	// Failures are retried the first time the rewards are requested
+	if _, err := app.snapshotSeasonRewards(ctx, season.ID); err != nil {
+		log.Printf("Failed to snapshot season %d rewards: %v", season.ID, err)
+	}
+	return nil
+}
+
+// rolloverSeasonHandler ends the current season now, whatever the schedule,
+// and returns the season that replaced it.
+func (app *App) rolloverSeasonHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "rolloverSeasonNow")
+	defer span.End()
+
+	season, err := app.currentSeason(ctx)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch current season", http.StatusInternalServerError)
+		return
+	}
+	if err := app.rolloverSeason(ctx, season); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to roll over season", http.StatusInternalServerError)
+		return
+	}
+	next, err := app.currentSeason(ctx)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch current season", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(next)
+}
+
+func seasonArchiveSize() int {
+	size, err := strconv.Atoi(getEnv("SEASON_ARCHIVE_SIZE", strconv.Itoa(defaultSeasonArchiveSize)))
+	if err != nil || size <= 0 {
+		return defaultSeasonArchiveSize
+	}
+	return size
+}
+
+// getSeasonsHandler lists every season, newest first.
+func (app *App) getSeasonsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getSeasons")
+	defer span.End()
+
+	rows, err := store.ListSeasonsQuery.Query(ctx, app.db)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch seasons", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	seasons := []Season{}
+	for rows.Next() {
+		var season Season
+		if err := rows.Scan(&season.ID, &season.StartedAt, &season.EndsAt, &season.EndedAt); err != nil {
+			log.Printf("Failed to scan row: %v", err)
+			continue
+		}
+		season.Current = season.EndedAt == nil
+		seasons = append(seasons, season)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(seasons)
+}
+
+// getCurrentSeasonHandler returns the season new scores count towards.
+func (app *App) getCurrentSeasonHandler(w http.ResponseWriter, r *http.Request) {
+	season, err := app.currentSeason(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to fetch current season", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(season)
+}
+
+// getSeasonLeaderboardHandler returns a season's top scores: the archived
+// standings for a past season, or the live board for the current one.
+func (app *App) getSeasonLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getSeasonLeaderboard")
+	defer span.End()
+
+	seasonID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid season ID", http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= maxJSONLeaderboardLimit {
+		limit = l
+	}
+	span.SetAttributes(attribute.Int("season.id", seasonID), attribute.Int("query.limit", limit))
+
+	season := Season{ID: seasonID}
+	err = store.SeasonQuery.QueryRow(ctx, app.db, seasonID).Scan(&season.StartedAt, &season.EndsAt, &season.EndedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Season not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch season", http.StatusInternalServerError)
+		return
+	}
+	season.Current = season.EndedAt == nil
+
+	var entries []LeaderboardEntry
+	if season.Current {
+		entries, err = app.queryTopScores(ctx, limit, nil)
+	} else {
+		entries, err = app.querySeasonStandings(ctx, seasonID, limit)
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch leaderboard", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []LeaderboardEntry{}
+	}
+
+	// Archived standings never change, so they can be cached without purging
+	if !season.Current {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SeasonLeaderboard{Season: season, Entries: maskEntries(app.nameMask(), entries)})
+}
+
+func (app *App) querySeasonStandings(ctx context.Context, seasonID, limit int) ([]LeaderboardEntry, error) {
+	rows, err := store.SeasonStandingsQuery.Query(ctx, app.db, seasonID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []LeaderboardEntry
+	for rows.Next() {
+		var entry LeaderboardEntry
+		if err := rows.Scan(&entry.Rank, &entry.ID, &entry.PlayerName, &entry.Score, &entry.CreatedAt, &entry.Tags); err != nil {
+			log.Printf("Failed to scan row: %v", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
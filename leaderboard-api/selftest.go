@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/telemetry"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	selftestTimeout      = 5 * time.Second
+	defaultMaxClockSkew  = 2 * time.Second
+	cacheKeySelftestPing = "selftest:%s"
+)
+
+// selftestSchema lists the tables and columns the migrations are expected to
+// have created. Keep it in step with migrations/.
+var selftestSchema = map[string][]string{
+	"scores": {
+		"id", "player_name", "score", "session_id", "created_at", "player_id",
+		"quarantined", "tags", "extras", "extras_version", "game_mode", "difficulty", "season_id",
+		"submission_id", "trace_parent", "api_key_id", "biome", "input_method",
+	},
+	"players":                 {"id", "display_name", "discriminator", "password_hash"},
+	"score_reports":           {"id", "score_id", "reporter_id", "resolved"},
+	"game_rules":              {"mode", "difficulty", "max_score", "min_interval_ms"},
+	"seasons":                 {"id", "started_at", "ends_at", "ended_at"},
+	"season_standings":        {"season_id", "rank", "score_id", "player_name", "score"},
+	"season_rewards":          {"season_id", "player_name", "rank", "score", "percentile", "tier"},
+	"season_reward_snapshots": {"season_id", "payload", "signature"},
+	"probe_scores":            {"id", "probe_id", "score", "created_at"},
+	"banned_sessions":         {"session_id", "reason", "banned_at"},
+	"player_spice":            {"player_name", "spice", "runs", "updated_at"},
+	"api_keys":                {"id", "name", "key_hash", "prefix", "rate_limit", "revoked_at"},
+	"community_counters":      {"metric", "value", "updated_at"},
+	"community_milestones":    {"metric", "target", "reached_by", "reached_at"},
+	"shadow_bans":             {"kind", "value", "reason", "created_at"},
+	"scores_archive":          {"id", "player_name", "score", "created_at", "archived_at", "data"},
+	"data_requests":           {"id", "kind", "subject_hash", "verified_by", "rows_affected", "created_at"},
+	"client_errors":           {"id", "stack_hash", "client_version", "message", "user_agent", "created_at"},
+	"verified_runners":        {"player_id", "note", "created_at"},
+	"board_reigns":            {"id", "season_id", "player_name", "score", "started_at", "ended_at"},
+}
+
+// SelftestCheck is the result of a single startup check.
+type SelftestCheck struct {
+	Name       string  `json:"name"`
+	OK         bool    `json:"ok"`
+	DurationMs float64 `json:"durationMs"`
+	Detail     string  `json:"detail,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// SelftestReport is printed to stdout as JSON by `leaderboard-api selftest`.
+type SelftestReport struct {
+	OK        bool            `json:"ok"`
+	Service   string          `json:"service"`
+	Version   string          `json:"version"`
+	CheckedAt time.Time       `json:"checkedAt"`
+	Checks    []SelftestCheck `json:"checks"`
+}
+
+// runSelftest checks every dependency once, without retries, prints the report
+// and returns the process exit code.
+func runSelftest(ctx context.Context) int {
+	report := SelftestReport{
+		OK:        true,
+		Service:   serviceName,
+		Version:   serviceVersion,
+		CheckedAt: time.Now().UTC(),
+	}
+	run := func(name string, check func(ctx context.Context) (string, error)) {
+		ctx, cancel := context.WithTimeout(ctx, selftestTimeout)
+		defer cancel()
+
+		start := time.Now()
+		detail, err := check(ctx)
+		result := SelftestCheck{
+			Name:       name,
+			OK:         err == nil,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			Detail:     detail,
+		}
+		if err != nil {
+			result.Error = err.Error()
+			report.OK = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	maxSkew, err := time.ParseDuration(getEnv("SELFTEST_MAX_CLOCK_SKEW", defaultMaxClockSkew.String()))
+	if err != nil || maxSkew <= 0 {
+		maxSkew = defaultMaxClockSkew
+	}
+
+	var pool *pgxpool.Pool
+	run("database", func(ctx context.Context) (string, error) {
+		p, err := pgxpool.New(ctx, getEnv("DATABASE_URL", defaultDatabaseURL))
+		if err != nil {
+			return "", err
+		}
+		if err := p.Ping(ctx); err != nil {
+			p.Close()
+			return "", err
+		}
+		pool = p
+		return "connected", nil
+	})
+	if pool != nil {
+		defer pool.Close()
+		run("migrations", func(ctx context.Context) (string, error) {
+			return checkSelftestSchema(ctx, pool)
+		})
+		run("database_clock", func(ctx context.Context) (string, error) {
+			var dbNow time.Time
+			if err := store.DatabaseClockQuery.QueryRow(ctx, pool).Scan(&dbNow); err != nil {
+				return "", err
+			}
+			return checkClockSkew(dbNow, maxSkew)
+		})
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: getEnv("REDIS_URL", "localhost:6379")})
+	defer client.Close()
+	run("redis", func(ctx context.Context) (string, error) {
+		key := fmt.Sprintf(cacheKeySelftestPing, strconv.FormatInt(time.Now().UnixNano(), 36))
+		value := strconv.Itoa(os.Getpid())
+		if err := client.Set(ctx, key, value, time.Minute).Err(); err != nil {
+			return "", err
+		}
+		defer client.Del(ctx, key)
+		got, err := client.Get(ctx, key).Result()
+		if err != nil {
+			return "", err
+		}
+		if got != value {
+			return "", fmt.Errorf("read back %q, wrote %q", got, value)
+		}
+		return "round trip ok", nil
+	})
+	run("redis_clock", func(ctx context.Context) (string, error) {
+		redisNow, err := client.Time(ctx).Result()
+		if err != nil {
+			return "", err
+		}
+		return checkClockSkew(redisNow, maxSkew)
+	})
+
+	run("otlp_exporter", func(ctx context.Context) (string, error) {
+		config, err := telemetry.NewExporterConfig(getEnv)
+		if err != nil {
+			return "", err
+		}
+		endpoint, err := config.Endpoint(telemetry.OTLPEndpoint(getEnv))
+		if err != nil {
+			return "", err
+		}
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", endpoint.Host)
+		if err != nil {
+			return "", err
+		}
+		conn.Close()
+		return fmt.Sprintf("reachable at %s (%s)", endpoint.Host, config.Protocol()), nil
+	})
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	if !report.OK {
+		return 1
+	}
+	return 0
+}
+
+// checkSelftestSchema reports tables or columns that the migrations have not
+// created yet.
+func checkSelftestSchema(ctx context.Context, pool *pgxpool.Pool) (string, error) {
+	rows, err := store.SchemaColumnsQuery.Query(ctx, pool)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	present := make(map[string]bool)
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return "", err
+		}
+		present[table+"."+column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	var missing []string
+	for table, columns := range selftestSchema {
+		for _, column := range columns {
+			if !present[table+"."+column] {
+				missing = append(missing, table+"."+column)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return "", fmt.Errorf("schema not migrated, missing %s", strings.Join(missing, ", "))
+	}
+	return "schema up to date", nil
+}
+
+// checkClockSkew compares a remote clock with ours.
+func checkClockSkew(remote time.Time, maxSkew time.Duration) (string, error) {
+	skew := time.Since(remote)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxSkew {
+		return "", fmt.Errorf("clock skew %v exceeds %v", skew.Round(time.Millisecond), maxSkew)
+	}
+	return fmt.Sprintf("skew %v", skew.Round(time.Millisecond)), nil
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	mrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	shadowMaxInFlight = 32
+	shadowMaxBody     = 1 << 20
+	shadowHeader      = "X-Shadow-Request"
+)
+
+// shadowScrubbedFields are replaced with pseudonyms before a body leaves the
+// cluster. The same value always maps to the same pseudonym in a process, so
+// rate limits and idempotency behave the same on the shadow. Account
+// credentials are among them: a mirrored login is expected to fail.
+var shadowScrubbedFields = []string{"playerName", "playerId", "sessionId", "submissionId", "username", "password"}
+
+// shadowRoutes are the routes mirrored, by method and route template. Nothing
+// else is: erasures and other writes would act on the shadow's players, and
+// player pages carry a name in the path.
+var shadowRoutes = map[string]bool{
+	"POST /api/scores":                         true,
+	"POST /api/accounts/register":              true,
+	"POST /api/accounts/login":                 true,
+	"GET /api/leaderboard/top":                 true,
+	"GET /api/leaderboard/global":              true,
+	"GET /api/leaderboard/checksum":            true,
+	"GET /api/leaderboard/records":             true,
+	"GET /api/leaderboard/reigns":              true,
+	"GET /api/leaderboard/biomes/{biome}":      true,
+	"GET /api/biomes":                          true,
+	"GET /api/leaderboard/input/{input}":       true,
+	"GET /api/inputs":                          true,
+	"GET /api/seasons":                         true,
+	"GET /api/seasons/current":                 true,
+	"GET /api/seasons/{id:[0-9]+}/leaderboard": true,
+	"GET /api/seasons/{id:[0-9]+}/rewards":     true,
+	"GET /api/stats/spice":                     true,
+	"GET /api/community/goals":                 true,
+	"GET /api/featured":                        true,
+}
+
+// shadowQueryParams are the query parameters passed on to the shadow; none
+// names a player.
+var shadowQueryParams = []string{"limit", "tag", "cursor", "pageSize", "format", "minScore", "window"}
+
+// shadowStrippedHeaders are credentials that never leave the cluster.
+var shadowStrippedHeaders = []string{
+	"Authorization", "Cookie", "X-Api-Key", "X-Player-Id", "X-Demo-Token", "X-Federation-Token",
+	"Traceparent", "Tracestate",
+}
+
+// shadower mirrors a sample of requests to a second deployment, such as a
+// canary build, and compares its status codes and latency with ours. Shadow
+// requests are sent after the primary has answered, so they never slow it down.
+type shadower struct {
+	target  string
+	percent float64
+	client  *http.Client
+	slots   chan struct{}
+	salt    []byte
+}
+
+// newShadowerFromEnv returns nil when shadowing is not configured, or can't
+// be salted.
+func newShadowerFromEnv() *shadower {
+	target := getEnv("SHADOW_URL", "")
+	if target == "" {
+		return nil
+	}
+	percent, err := strconv.ParseFloat(getEnv("SHADOW_PERCENT", "1"), 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		percent = 1
+	}
+	timeout, err := time.ParseDuration(getEnv("SHADOW_TIMEOUT", "5s"))
+	if err != nil || timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		log.Printf("⚠️ Shadow traffic disabled: failed to generate sampling salt: %v", err)
+		return nil
+	}
+	return &shadower{
+		target:  strings.TrimSuffix(target, "/"),
+		percent: percent,
+		client:  &http.Client{Timeout: timeout},
+		slots:   make(chan struct{}, shadowMaxInFlight),
+		salt:    salt,
+	}
+}
+
+// sampled reports whether to mirror a request to route, a route template
+// without the ingress prefix.
+func (s *shadower) sampled(r *http.Request, route string) bool {
+	if r.Header.Get(shadowHeader) != "" || !shadowRoutes[r.Method+" "+route] {
+		return false
+	}
+	return mrand.Float64()*100 < s.percent
+}
+
+// shadowRoute returns the template of the route r matched, without the
+// ingress prefix, or "" when it matched none.
+func shadowRoute(r *http.Request) string {
+	current := mux.CurrentRoute(r)
+	if current == nil {
+		return ""
+	}
+	template, err := current.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(template, "/spice/leaderboard")
+}
+
+// shadowQuery keeps the query parameters in shadowQueryParams.
+func shadowQuery(query url.Values) string {
+	kept := url.Values{}
+	for _, name := range shadowQueryParams {
+		if values, ok := query[name]; ok {
+			kept[name] = values
+		}
+	}
+	return kept.Encode()
+}
+
+func (s *shadower) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := shadowRoute(r)
+		if !s.sampled(r, route) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, shadowMaxBody))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				rejectOversizedBody(r.Context(), w, route, shadowMaxBody)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		start := time.Now()
+		wrapped := &handlers.ResponseWriter{ResponseWriter: w, StatusCode: http.StatusOK}
+		next.ServeHTTP(wrapped, r)
+		primaryDuration := time.Since(start)
+
+		// Drop the mirror rather than queue it when the shadow falls behind
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			shadowRequestsTotal.Add(r.Context(), 1, metric.WithAttributes(
+				attribute.String("http.route", route),
+				attribute.String("shadow.result", "dropped"),
+			))
+			return
+		}
+		shadowReq := r.Clone(context.WithoutCancel(r.Context()))
+		go func() {
+			defer func() { <-s.slots }()
+			s.mirror(shadowReq, route, s.scrub(body), wrapped.StatusCode, primaryDuration)
+		}()
+	})
+}
+
+// mirror sends the request to the shadow in a new trace linked to the
+// primary's, and records how the two compare.
+func (s *shadower) mirror(r *http.Request, route string, body []byte, primaryStatus int, primaryDuration time.Duration) {
+	ctx, span := tracer.Start(r.Context(), "shadowRequest",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(r.Context())),
+		trace.WithSpanKind(trace.SpanKindClient),
+	)
+	defer span.End()
+
+	target := s.target + r.URL.EscapedPath()
+	if query := shadowQuery(r.URL.Query()); query != "" {
+		target += "?" + query
+	}
+	req, err := http.NewRequestWithContext(ctx, r.Method, target, bytes.NewReader(body))
+	if err != nil {
+		span.RecordError(err)
+		return
+	}
+	req.Header = r.Header.Clone()
+	for _, name := range shadowStrippedHeaders {
+		req.Header.Del(name)
+	}
+	req.Header.Set(shadowHeader, "1")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	shadowDuration := time.Since(start)
+
+	result := "match"
+	shadowStatus := 0
+	if err != nil {
+		span.RecordError(err)
+		result = "error"
+	} else {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		shadowStatus = resp.StatusCode
+		if shadowStatus != primaryStatus {
+			result = "status_mismatch"
+			log.Printf("⚠️ Shadow mismatch on %s %s: primary %d, shadow %d", r.Method, route, primaryStatus, shadowStatus)
+		}
+	}
+
+	span.SetAttributes(
+		attribute.String("http.route", route),
+		attribute.String("shadow.result", result),
+		attribute.Int("shadow.primary_status", primaryStatus),
+		attribute.Int("shadow.status", shadowStatus),
+	)
+	attrs := metric.WithAttributes(
+		attribute.String("http.route", route),
+		attribute.String("shadow.result", result),
+	)
+	shadowRequestsTotal.Add(ctx, 1, attrs)
+	if err == nil {
+		// Both sides of the same requests, so their percentiles compare directly
+		shadowRequestDuration.Record(ctx, primaryDuration.Seconds(), metric.WithAttributes(
+			attribute.String("http.route", route), attribute.String("shadow.side", "primary")))
+		shadowRequestDuration.Record(ctx, shadowDuration.Seconds(), metric.WithAttributes(
+			attribute.String("http.route", route), attribute.String("shadow.side", "shadow")))
+	}
+}
+
+// scrub pseudonymizes shadowScrubbedFields in a JSON object body. Anything
+// else is passed through unchanged.
+func (s *shadower) scrub(body []byte) []byte {
+	var fields map[string]json.RawMessage
+	if len(body) == 0 || json.Unmarshal(body, &fields) != nil {
+		return body
+	}
+	for _, name := range shadowScrubbedFields {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		var value string
+		if json.Unmarshal(raw, &value) != nil || value == "" {
+			continue
+		}
+		sum := sha256.Sum256(append(append([]byte{}, s.salt...), value...))
+		fields[name], _ = json.Marshal("shadow-" + hex.EncodeToString(sum[:6]))
+	}
+	scrubbed, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return scrubbed
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// newShadowTest returns a router mirroring every sampled request to a test
+// shadow, and the requests the shadow receives.
+func newShadowTest(t *testing.T) (http.Handler, chan *http.Request) {
+	t.Helper()
+
+	mirrored := make(chan *http.Request, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		mirrored <- r
+	}))
+	t.Cleanup(target.Close)
+
+	s := &shadower{
+		target:  target.URL,
+		percent: 100,
+		client:  target.Client(),
+		slots:   make(chan struct{}, 1),
+		salt:    []byte("test-salt"),
+	}
+	drain := func(w http.ResponseWriter, r *http.Request) { io.ReadAll(r.Body) }
+	router := mux.NewRouter()
+	router.Use(s.middleware)
+	api := router.PathPrefix("/spice/leaderboard").Subrouter()
+	api.HandleFunc("/api/scores", drain).Methods("POST")
+	api.HandleFunc("/api/players/{name}", drain).Methods("DELETE")
+	router.HandleFunc("/api/accounts/login", drain).Methods("POST")
+	router.HandleFunc("/api/leaderboard/top", drain).Methods("GET")
+	return router, mirrored
+}
+
+// received returns the next mirrored request, or nil if none arrives.
+func received(mirrored chan *http.Request, wait time.Duration) *http.Request {
+	select {
+	case r := <-mirrored:
+		return r
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+func TestShadowScrubsLoginCredentials(t *testing.T) {
+	router, mirrored := newShadowTest(t)
+
+	body := `{"username":"Paul","password":"correct horse battery staple"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/accounts/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := received(mirrored, 5*time.Second)
+	if got == nil {
+		t.Fatal("login was not mirrored")
+	}
+	mirroredBody, _ := io.ReadAll(got.Body)
+	for _, secret := range []string{"Paul", "correct horse battery staple"} {
+		if strings.Contains(string(mirroredBody), secret) {
+			t.Errorf("mirrored body %s contains %q", mirroredBody, secret)
+		}
+	}
+}
+
+func TestShadowStripsPlayerCredentials(t *testing.T) {
+	router, mirrored := newShadowTest(t)
+
+	body := `{"playerName":"Paul","playerId":"c0ffee00-0000-4000-8000-000000000001","score":1200}`
+	req := httptest.NewRequest(http.MethodPost, "/spice/leaderboard/api/scores", strings.NewReader(body))
+	for _, header := range []string{"X-Player-Id", "X-Demo-Token", "X-Federation-Token", "Authorization"} {
+		req.Header.Set(header, "secret")
+	}
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := received(mirrored, 5*time.Second)
+	if got == nil {
+		t.Fatal("submission was not mirrored")
+	}
+	for _, header := range []string{"X-Player-Id", "X-Demo-Token", "X-Federation-Token", "Authorization"} {
+		if got.Header.Get(header) != "" {
+			t.Errorf("%s forwarded to the shadow", header)
+		}
+	}
+	mirroredBody, _ := io.ReadAll(got.Body)
+	if strings.Contains(string(mirroredBody), "c0ffee00") {
+		t.Errorf("mirrored body %s contains the player ID", mirroredBody)
+	}
+}
+
+func TestShadowMirrorsOnlyAllowedRoutes(t *testing.T) {
+	router, mirrored := newShadowTest(t)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/spice/leaderboard/api/players/Paul", nil))
+	if got := received(mirrored, 200*time.Millisecond); got != nil {
+		t.Errorf("erasure mirrored as %s %s", got.Method, got.URL)
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/leaderboard/top?limit=10&player=Paul", nil))
+	got := received(mirrored, 5*time.Second)
+	if got == nil {
+		t.Fatal("board read was not mirrored")
+	}
+	if got.URL.Query().Has("player") || got.URL.Query().Get("limit") != "10" {
+		t.Errorf("mirrored query = %q, want only limit", got.URL.RawQuery)
+	}
+}
+
+func TestShadowRejectsOversizedBody(t *testing.T) {
+	router, mirrored := newShadowTest(t)
+
+	body := `{"playerName":"` + strings.Repeat("a", shadowMaxBody) + `"}`
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/spice/leaderboard/api/scores", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+	if got := received(mirrored, 200*time.Millisecond); got != nil {
+		t.Error("oversized body mirrored")
+	}
+}
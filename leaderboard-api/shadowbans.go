@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Shadow bans match a submission's session ID or its stored player name
+// (including any discriminator).
+const (
+	shadowBanSession = "session"
+	shadowBanPlayer  = "player"
+)
+
+// ShadowBan hides every score from a session or player while still answering
+// their submissions normally, so cheaters don't learn to retry.
+type ShadowBan struct {
+	Kind      string    `json:"kind"`
+	Value     string    `json:"value"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ShadowBanRequest struct {
+	Reason       string `json:"reason"`
+	HideExisting bool   `json:"hideExisting"`
+}
+
+// isShadowBanned reports whether the submission's session or player is shadow
+// banned. Lookup failures count as not banned.
+func (app *App) isShadowBanned(ctx context.Context, submission *ScoreSubmission) bool {
+	banned, err := store.ScanExists(store.ShadowBanQuery.QueryRow(ctx, app.db, submission.SessionID, submission.PlayerName))
+	if err != nil {
+		log.Printf("Failed to check shadow ban: %v", err)
+		return false
+	}
+	return banned
+}
+
+// applyShadowBanToScores hides or restores existing scores and rebuilds the
+// ranking and caches if any changed.
+func (app *App) applyShadowBanToScores(ctx context.Context, kind, value string, hide bool) (int64, error) {
+	tag, err := store.ShadowBanScoresQuery.Exec(ctx, app.db, kind, value, hide)
+	if err != nil {
+		return 0, err
+	}
+	if tag.RowsAffected() > 0 {
+		app.refreshLeaderboard(ctx)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func shadowBanTarget(r *http.Request) (string, string, error) {
+	vars := mux.Vars(r)
+	kind, value := vars["kind"], vars["value"]
+	if kind != shadowBanSession && kind != shadowBanPlayer {
+		return "", "", fmt.Errorf("kind must be %q or %q", shadowBanSession, shadowBanPlayer)
+	}
+	if len(value) > 105 {
+		return "", "", fmt.Errorf("value too long (max 105 characters)")
+	}
+	if kind == shadowBanPlayer && value == "Anonymous" {
+		return "", "", fmt.Errorf("Anonymous can't be shadow banned; ban the session instead")
+	}
+	return kind, value, nil
+}
+
+func (app *App) getShadowBansHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getShadowBans")
+	defer span.End()
+
+	rows, err := store.ListShadowBansQuery.Query(ctx, app.db)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch shadow bans", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	bans := []ShadowBan{}
+	for rows.Next() {
+		var ban ShadowBan
+		if err := rows.Scan(&ban.Kind, &ban.Value, &ban.Reason, &ban.CreatedAt); err != nil {
+			log.Printf("Failed to scan row: %v", err)
+			continue
+		}
+		bans = append(bans, ban)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bans)
+}
+
+// putShadowBanHandler adds a shadow ban. With hideExisting, scores already
+// stored for the session or player are hidden too.
+func (app *App) putShadowBanHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "putShadowBan")
+	defer span.End()
+
+	kind, value, err := shadowBanTarget(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req ShadowBanRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > maxReportReasonLength {
+		http.Error(w, fmt.Sprintf("reason too long (max %d characters)", maxReportReasonLength), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.String("shadow_ban.kind", kind), attribute.Bool("shadow_ban.hide_existing", req.HideExisting))
+
+	ban := ShadowBan{Kind: kind, Value: value, Reason: req.Reason}
+	if err := store.AddShadowBanQuery.QueryRow(ctx, app.db, kind, value, req.Reason).Scan(&ban.CreatedAt); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to add shadow ban", http.StatusInternalServerError)
+		return
+	}
+
+	if req.HideExisting {
+		hidden, err := app.applyShadowBanToScores(ctx, kind, value, true)
+		if err != nil {
+			span.RecordError(err)
+			http.Error(w, "Shadow ban added, but failed to hide existing scores", http.StatusInternalServerError)
+			return
+		}
+		span.SetAttributes(attribute.Int64("shadow_ban.scores", hidden))
+	}
+	log.Printf("🛡️ Shadow ban added for %s %s", kind, value)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ban)
+}
+
+// deleteShadowBanHandler lifts a shadow ban. With ?restore=true, scores it hid
+// are put back on the board.
+func (app *App) deleteShadowBanHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "deleteShadowBan")
+	defer span.End()
+
+	kind, value, err := shadowBanTarget(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	restore := r.URL.Query().Get("restore") == "true"
+	span.SetAttributes(attribute.String("shadow_ban.kind", kind), attribute.Bool("shadow_ban.restore", restore))
+
+	tag, err := store.RemoveShadowBanQuery.Exec(ctx, app.db, kind, value)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to lift shadow ban", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "Not shadow banned", http.StatusNotFound)
+		return
+	}
+
+	if restore {
+		restored, err := app.applyShadowBanToScores(ctx, kind, value, false)
+		if err != nil {
+			span.RecordError(err)
+			http.Error(w, "Shadow ban lifted, but failed to restore scores", http.StatusInternalServerError)
+			return
+		}
+		span.SetAttributes(attribute.Int64("shadow_ban.scores", restored))
+	}
+	log.Printf("🛡️ Shadow ban lifted for %s %s", kind, value)
+	w.WriteHeader(http.StatusNoContent)
+}
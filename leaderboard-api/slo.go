@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/handlers"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// SLI counters, bucketed per minute and shared by every replica
+	sloMinuteKey     = "slo:m:%d"
+	sloMinuteTTL     = 7 * time.Hour
+	sloFlushInterval = 15 * time.Second
+
+	defaultAvailabilityTarget = 0.999
+	defaultLatencyTarget      = 0.99
+	defaultLatencyThreshold   = 300 * time.Millisecond
+)
+
+// sloWindows are the windows burn rates are reported over.
+var sloWindows = []struct {
+	name   string
+	length time.Duration
+}{
+	{name: "1h", length: time.Hour},
+	{name: "6h", length: 6 * time.Hour},
+}
+
+// sloExcludedPaths are left out of the SLIs: probes and metrics scrapes, and
+// streams and long polls that are slow on purpose.
+var sloExcludedPaths = []string{
+	"/health", "/ready", "/livez", "/readyz", "/lifecycle/prestop", "/metrics", "/probe/full",
+	"/api/scores/stream", "/api/leaderboard/changes",
+}
+
+// sloObjectives are the targets burn rates are measured against. A request is
+// good for availability unless it fails with a 5xx, and good for latency if it
+// is served within LatencyThreshold.
+type sloObjectives struct {
+	AvailabilityTarget float64
+	LatencyTarget      float64
+	LatencyThreshold   time.Duration
+}
+
+func sloObjectivesFromEnv() (sloObjectives, error) {
+	objectives := sloObjectives{
+		AvailabilityTarget: defaultAvailabilityTarget,
+		LatencyTarget:      defaultLatencyTarget,
+		LatencyThreshold:   defaultLatencyThreshold,
+	}
+	for _, target := range []struct {
+		env   string
+		value *float64
+	}{
+		{"SLO_AVAILABILITY_TARGET", &objectives.AvailabilityTarget},
+		{"SLO_LATENCY_TARGET", &objectives.LatencyTarget},
+	} {
+		raw := getEnv(target.env, "")
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v <= 0 || v >= 1 {
+			return objectives, fmt.Errorf("%s must be between 0 and 1, exclusive", target.env)
+		}
+		*target.value = v
+	}
+	if raw := getEnv("SLO_LATENCY_THRESHOLD", ""); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return objectives, fmt.Errorf("invalid SLO_LATENCY_THRESHOLD %q", raw)
+		}
+		objectives.LatencyThreshold = d
+	}
+	return objectives, nil
+}
+
+type sloCounts struct {
+	total  int64
+	errors int64
+	slow   int64
+}
+
+// sloRecorder counts requests in memory and periodically adds them to the
+// shared minute buckets, so requests don't each pay for a Redis round trip.
+type sloRecorder struct {
+	objectives sloObjectives
+	mu         sync.Mutex
+	pending    map[int64]*sloCounts
+}
+
+func newSLORecorder(objectives sloObjectives) *sloRecorder {
+	return &sloRecorder{objectives: objectives, pending: make(map[int64]*sloCounts)}
+}
+
+func (s *sloRecorder) record(status int, duration time.Duration) {
+	minute := time.Now().Unix() / 60
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.pending[minute]
+	if !ok {
+		c = &sloCounts{}
+		s.pending[minute] = c
+	}
+	c.total++
+	if status >= 500 {
+		c.errors++
+	}
+	if duration > s.objectives.LatencyThreshold {
+		c.slow++
+	}
+}
+
+// flush adds the pending counts to Redis. Counts that fail to write are dropped.
+func (s *sloRecorder) flush(ctx context.Context, rdb *redis.Client) {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[int64]*sloCounts)
+	s.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	pipe := rdb.Pipeline()
+	for minute, c := range pending {
+		key := fmt.Sprintf(sloMinuteKey, minute)
+		pipe.HIncrBy(ctx, key, "total", c.total)
+		pipe.HIncrBy(ctx, key, "errors", c.errors)
+		pipe.HIncrBy(ctx, key, "slow", c.slow)
+		pipe.Expire(ctx, key, sloMinuteTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to record SLI counts: %v", err)
+	}
+}
+
+func (app *App) runSLOFlusher(ctx context.Context) {
+	ticker := time.NewTicker(sloFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.slo.flush(ctx, app.redis)
+		}
+	}
+}
+
+// sloMiddleware counts every request outside sloExcludedPaths towards the SLIs.
+func (app *App) sloMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, path := range sloExcludedPaths {
+			if strings.HasSuffix(r.URL.Path, path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		start := time.Now()
+		wrapped := &handlers.ResponseWriter{ResponseWriter: w, StatusCode: http.StatusOK}
+		next.ServeHTTP(wrapped, r)
+		app.slo.record(wrapped.StatusCode, time.Since(start))
+	})
+}
+
+// SLIWindow is one SLI over one window. BurnRate is how fast the error budget
+// is being spent: 1 spends exactly the budget over the SLO period, 14.4 over
+// an hour spends 2% of a 30-day budget.
+type SLIWindow struct {
+	Total     int64   `json:"total"`
+	Bad       int64   `json:"bad"`
+	SLI       float64 `json:"sli"`
+	BurnRate  float64 `json:"burnRate"`
+	Compliant bool    `json:"compliant"`
+}
+
+type SLOObjective struct {
+	Target      float64 `json:"target"`
+	ThresholdMs int64   `json:"thresholdMs,omitempty"`
+}
+
+type SLOResponse struct {
+	Objectives  map[string]SLOObjective         `json:"objectives"`
+	Windows     map[string]map[string]SLIWindow `json:"windows"`
+	GeneratedAt time.Time                       `json:"generatedAt"`
+}
+
+func sliWindow(total, bad int64, target float64) SLIWindow {
+	w := SLIWindow{Total: total, Bad: bad, SLI: 1, Compliant: true}
+	if total > 0 {
+		errorRate := float64(bad) / float64(total)
+		w.SLI = 1 - errorRate
+		w.BurnRate = errorRate / (1 - target)
+		w.Compliant = w.SLI >= target
+	}
+	return w
+}
+
+// sloCountsSince sums the shared minute buckets over the last length.
+func (app *App) sloCountsSince(ctx context.Context, length time.Duration, now time.Time) (sloCounts, error) {
+	current := now.Unix() / 60
+	buckets := int64(length / time.Minute)
+
+	pipe := app.redis.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, 0, buckets)
+	for i := int64(0); i < buckets; i++ {
+		cmds = append(cmds, pipe.HGetAll(ctx, fmt.Sprintf(sloMinuteKey, current-i)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return sloCounts{}, err
+	}
+
+	var counts sloCounts
+	for _, cmd := range cmds {
+		for field, value := range cmd.Val() {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch field {
+			case "total":
+				counts.total += n
+			case "errors":
+				counts.errors += n
+			case "slow":
+				counts.slow += n
+			}
+		}
+	}
+	return counts, nil
+}
+
+// getSLOHandler reports availability and latency SLIs with their burn rates
+// over the last hour and six hours. Counts lag by up to the flush interval.
+func (app *App) getSLOHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getSLO")
+	defer span.End()
+
+	objectives := app.slo.objectives
+	now := time.Now()
+	response := SLOResponse{
+		Objectives: map[string]SLOObjective{
+			"availability": {Target: objectives.AvailabilityTarget},
+			"latency":      {Target: objectives.LatencyTarget, ThresholdMs: objectives.LatencyThreshold.Milliseconds()},
+		},
+		Windows:     make(map[string]map[string]SLIWindow),
+		GeneratedAt: now.UTC(),
+	}
+
+	for _, window := range sloWindows {
+		counts, err := app.sloCountsSince(ctx, window.length, now)
+		if err != nil {
+			span.RecordError(err)
+			http.Error(w, "Failed to fetch SLO data", http.StatusInternalServerError)
+			return
+		}
+		response.Windows[window.name] = map[string]SLIWindow{
+			"availability": sliWindow(counts.total, counts.errors, objectives.AvailabilityTarget),
+			"latency":      sliWindow(counts.total, counts.slow, objectives.LatencyTarget),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
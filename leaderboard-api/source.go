@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Submission sources, kept few so they can label metrics
+const (
+	sourceGame     = "game"
+	sourceBackend  = "backend"
+	sourceLoadTest = "load_test"
+	sourceScript   = "script"
+	sourceUnknown  = "unknown"
+)
+
+const (
+	// Submission counters per source, bucketed like the anti-cheat stats
+	sourceMinuteKey = "submissions:sources:m:%d"
+	sourceHourKey   = "submissions:sources:h:%d"
+
+	sourceAccepted = "accepted"
+	sourceRejected = "rejected"
+)
+
+// submissionSources lists every source, for a breakdown with zeroes filled in.
+var submissionSources = []string{sourceGame, sourceBackend, sourceLoadTest, sourceScript, sourceUnknown}
+
+// User-Agent fragments, lowercased, of load generators and of HTTP libraries
+// and tools that aren't a browser.
+var (
+	loadTestAgents = []string{scenarioUserAgent, "k6/", "locust", "apache-jmeter", "gatling", "vegeta", "hey/", "artillery", "wrk"}
+	scriptAgents   = []string{"curl/", "wget/", "python-", "python/", "aiohttp", "go-http-client", "node-fetch",
+		"undici", "axios/", "httpie/", "postmanruntime", "okhttp", "java/", "ruby", "libwww-perl", "powershell", "grpc-"}
+)
+
+// classifySource guesses what sent a submission from its headers, read with
+// header. It is a guess: any of it can be forged, so it is for watching
+// traffic, not for deciding what to accept. Backends are known by their API
+// key, load tests by their tool or a demo scenario, and the game by a browser
+// User-Agent with the Sec-Fetch or Origin headers browsers add to fetches.
+func classifySource(header func(string) string, apiKey bool) string {
+	if apiKey {
+		return sourceBackend
+	}
+	if header("X-Demo-Scenario") != "" {
+		return sourceLoadTest
+	}
+	ua := strings.ToLower(header("User-Agent"))
+	switch {
+	case containsAny(ua, loadTestAgents):
+		return sourceLoadTest
+	case ua == "" || containsAny(ua, scriptAgents):
+		return sourceScript
+	case strings.HasPrefix(ua, "mozilla/") && (header("Sec-Fetch-Mode") != "" || header("Origin") != ""):
+		return sourceGame
+	}
+	return sourceUnknown
+}
+
+func containsAny(s string, fragments []string) bool {
+	for _, f := range fragments {
+		if strings.Contains(s, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordSubmissionSource bumps the minute and hour buckets for a submission
+// from source. Like the anti-cheat stats, it is best-effort.
+func (app *App) recordSubmissionSource(ctx context.Context, source, outcome string) {
+	now := time.Now()
+	minuteKey := fmt.Sprintf(sourceMinuteKey, now.Unix()/60)
+	hourKey := fmt.Sprintf(sourceHourKey, now.Unix()/3600)
+	field := source + "|" + outcome
+
+	pipe := app.redis.Pipeline()
+	pipe.HIncrBy(ctx, minuteKey, field, 1)
+	pipe.HIncrBy(ctx, hourKey, field, 1)
+	pipe.Expire(ctx, minuteKey, anticheatMinuteTTL)
+	pipe.Expire(ctx, hourKey, anticheatHourTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to record submission source: %v", err)
+	}
+}
+
+type SourceStats struct {
+	Accepted int64   `json:"accepted"`
+	Rejected int64   `json:"rejected"`
+	Share    float64 `json:"share"`
+}
+
+type SourceStatsResponse struct {
+	Windows     map[string]map[string]*SourceStats `json:"windows"`
+	GeneratedAt time.Time                          `json:"generatedAt"`
+}
+
+func (app *App) sourceStats(ctx context.Context, window anticheatWindow, now time.Time) (map[string]*SourceStats, error) {
+	keyFormat := sourceMinuteKey
+	if window.resolution == time.Hour {
+		keyFormat = sourceHourKey
+	}
+	step := int64(window.resolution / time.Second)
+	current := now.Unix() / step
+	buckets := int64(window.length / window.resolution)
+
+	pipe := app.redis.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, 0, buckets)
+	for i := int64(0); i < buckets; i++ {
+		cmds = append(cmds, pipe.HGetAll(ctx, fmt.Sprintf(keyFormat, current-i)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	stats := make(map[string]*SourceStats, len(submissionSources))
+	for _, source := range submissionSources {
+		stats[source] = &SourceStats{}
+	}
+	var total int64
+	for _, cmd := range cmds {
+		for field, value := range cmd.Val() {
+			source, outcome, ok := strings.Cut(field, "|")
+			s, known := stats[source]
+			if !ok || !known {
+				continue
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch outcome {
+			case sourceAccepted:
+				s.Accepted += n
+			case sourceRejected:
+				s.Rejected += n
+			default:
+				continue
+			}
+			total += n
+		}
+	}
+
+	if total > 0 {
+		for _, s := range stats {
+			s.Share = float64(s.Accepted+s.Rejected) / float64(total)
+		}
+	}
+	return stats, nil
+}
+
+// getSourceStatsHandler returns submissions per source over the anti-cheat
+// windows, to spot a wave of scripted submissions at a glance.
+func (app *App) getSourceStatsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getSourceStats")
+	defer span.End()
+
+	now := time.Now()
+	response := SourceStatsResponse{
+		Windows:     make(map[string]map[string]*SourceStats),
+		GeneratedAt: now.UTC(),
+	}
+
+	for _, window := range anticheatWindows {
+		stats, err := app.sourceStats(ctx, window, now)
+		if err != nil {
+			span.RecordError(err)
+			http.Error(w, "Failed to fetch submission sources", http.StatusInternalServerError)
+			return
+		}
+		response.Windows[window.name] = stats
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
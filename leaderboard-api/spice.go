@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// The community goal shown as a progress bar
+	defaultSpiceMilestone = 1_000_000_000
+
+	// Far more than a run can pick up; anything above is forged
+	maxSpicePerRun = 100_000
+
+	cacheKeySpiceStats        = "stats:spice:%d"
+	defaultSpiceStatsCacheTTL = 15 * time.Second
+
+	defaultSpiceCollectors = 10
+	maxSpiceCollectors     = 100
+)
+
+// SpiceTotal is the spice a player has collected across all their runs.
+type SpiceTotal struct {
+	PlayerName string    `json:"playerName"`
+	Spice      int64     `json:"spice"`
+	Runs       int       `json:"runs"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// SpiceMilestone is the community's progress towards the spice goal.
+type SpiceMilestone struct {
+	Target   int64   `json:"target"`
+	Progress float64 `json:"progress"`
+	Reached  bool    `json:"reached"`
+}
+
+// SpiceStats is the response of /api/stats/spice.
+type SpiceStats struct {
+	TotalSpice    int64          `json:"totalSpice"`
+	Players       int            `json:"players"`
+	Milestone     SpiceMilestone `json:"milestone"`
+	TopCollectors []SpiceTotal   `json:"topCollectors"`
+}
+
+func parseSpiceMilestone(value string) (int64, error) {
+	target, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || target <= 0 {
+		return 0, fmt.Errorf("invalid spice milestone %q", value)
+	}
+	return target, nil
+}
+
+// addSpice adds a run's spice to the player's running total. Totals are kept
+// apart from scores, so they survive season rollovers and score removals.
+func (app *App) addSpice(ctx context.Context, submission *ScoreSubmission) {
+	if submission.SpiceCollected <= 0 {
+		return
+	}
+
+	_, err := store.AddSpiceQuery.Exec(ctx, app.db, submission.PlayerName, submission.SpiceCollected)
+	if err != nil {
+		// The score is already stored; a missed total isn't worth failing it
+		log.Printf("Failed to add spice for %s: %v", submission.PlayerName, err)
+		return
+	}
+	spiceCollectedTotal.Add(ctx, int64(submission.SpiceCollected))
+}
+
+// getSpiceStatsHandler returns the global spice total, the milestone progress
+// and the top collectors.
+func (app *App) getSpiceStatsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getSpiceStats")
+	defer span.End()
+
+	limit := defaultSpiceCollectors
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 0 || parsed > maxSpiceCollectors {
+			http.Error(w, fmt.Sprintf("limit must be between 0 and %d", maxSpiceCollectors), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	// The totals change with nearly every run; a short cache absorbs page refreshes
+	cacheKey := fmt.Sprintf(cacheKeySpiceStats, limit)
+	var stats *SpiceStats
+	if cached, err := app.cache.Get(ctx, cacheKey); err == nil && json.Unmarshal(cached, &stats) == nil {
+		cacheHitTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "spice_stats")))
+	} else {
+		cacheMissTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.key", "spice_stats")))
+
+		stats, err = app.spiceStats(ctx, limit)
+		if err != nil {
+			span.RecordError(err)
+			http.Error(w, "Failed to fetch spice stats", http.StatusInternalServerError)
+			return
+		}
+		if data, err := json.Marshal(stats); err == nil {
+			app.cache.Set(ctx, cacheKey, data, app.cfg().CacheTTLs.SpiceStats)
+		}
+	}
+	span.SetAttributes(attribute.Int64("spice.total", stats.TotalSpice))
+
+	mask := app.nameMask()
+	for i := range stats.TopCollectors {
+		stats.TopCollectors[i].PlayerName = mask(stats.TopCollectors[i].PlayerName)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func (app *App) spiceStats(ctx context.Context, limit int) (*SpiceStats, error) {
+	start := time.Now()
+	defer func() {
+		store.ObserveQuery(ctx, "spice_stats", start)
+	}()
+
+	stats := &SpiceStats{TopCollectors: []SpiceTotal{}}
+	err := store.SpiceTotalsQuery.QueryRow(ctx, app.db).Scan(&stats.TotalSpice, &stats.Players)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Milestone = SpiceMilestone{Target: app.spiceMilestone, Progress: 1, Reached: true}
+	if stats.TotalSpice < app.spiceMilestone {
+		stats.Milestone.Progress = float64(stats.TotalSpice) / float64(app.spiceMilestone)
+		stats.Milestone.Reached = false
+	}
+
+	if limit == 0 {
+		return stats, nil
+	}
+	rows, err := store.TopSpiceCollectorsQuery.Query(ctx, app.db, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var total SpiceTotal
+		if err := rows.Scan(&total.PlayerName, &total.Spice, &total.Runs, &total.UpdatedAt); err != nil {
+			log.Printf("Failed to scan row: %v", err)
+			continue
+		}
+		stats.TopCollectors = append(stats.TopCollectors, total)
+	}
+	return stats, rows.Err()
+}
+
+// getPlayerSpiceHandler returns one player's spice total.
+func (app *App) getPlayerSpiceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getPlayerSpice")
+	defer span.End()
+
+	playerName := mux.Vars(r)["name"]
+	span.SetAttributes(attribute.String("player.name", playerName))
+
+	total := SpiceTotal{PlayerName: playerName}
+	err := store.PlayerSpiceQuery.QueryRow(ctx, app.db, playerName).Scan(&total.Spice, &total.Runs, &total.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Player has collected no spice", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch spice total", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(total)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/telemetry"
+)
+
+// startupReportTimeout bounds the version queries, so a slow dependency
+// doesn't hold up serving.
+const startupReportTimeout = 5 * time.Second
+
+// StartupReport describes a replica as it starts serving: what it resolved its
+// configuration to, what it is talking to and which optional features are on.
+// It is logged once as a single JSON line, so the fleet can be inventoried
+// from Loki with `| json | msg="startup"`.
+type StartupReport struct {
+	Msg          string            `json:"msg"`
+	Service      string            `json:"service"`
+	Version      string            `json:"version"`
+	GoVersion    string            `json:"goVersion"`
+	Hostname     string            `json:"hostname"`
+	StartedAt    time.Time         `json:"startedAt"`
+	Config       map[string]string `json:"config"`
+	Dependencies map[string]string `json:"dependencies"`
+	Schema       StartupSchema     `json:"schema"`
+	Features     map[string]bool   `json:"features"`
+}
+
+// StartupSchema is the database schema level: the newest migration applied
+// and the newest this build has, and whether the database has every table and
+// column this build expects.
+type StartupSchema struct {
+	Version int    `json:"version"`
+	Latest  int    `json:"latest"`
+	Tables  int    `json:"tables"`
+	Status  string `json:"status"`
+}
+
+// newStartupReport gathers the report. Config holds resolved settings only,
+// never secrets; a dependency that can't be asked for its version reports
+// "unknown".
+func (app *App) newStartupReport(ctx context.Context, config map[string]string, features map[string]bool) StartupReport {
+	ctx, cancel := context.WithTimeout(ctx, startupReportTimeout)
+	defer cancel()
+
+	hostname, _ := os.Hostname()
+	report := StartupReport{
+		Msg:          "startup",
+		Service:      serviceName,
+		Version:      serviceVersion,
+		GoVersion:    runtime.Version(),
+		Hostname:     hostname,
+		StartedAt:    time.Now().UTC(),
+		Config:       config,
+		Dependencies: map[string]string{"postgres": "unknown", "redis": "unknown"},
+		Schema:       StartupSchema{Tables: len(selftestSchema)},
+		Features:     features,
+	}
+
+	var postgres string
+	if err := store.ServerVersionQuery.QueryRow(ctx, app.db).Scan(&postgres); err == nil {
+		report.Dependencies["postgres"] = postgres
+	}
+	if info, err := app.redis.Info(ctx, "server").Result(); err == nil {
+		scanner := bufio.NewScanner(strings.NewReader(info))
+		for scanner.Scan() {
+			if version, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "redis_version:"); ok {
+				report.Dependencies["redis"] = version
+			}
+		}
+	}
+
+	if version, err := schemaVersion(ctx, app.db); err == nil {
+		report.Schema.Version = version
+	}
+	if migrations, err := loadMigrations(); err == nil && len(migrations) > 0 {
+		report.Schema.Latest = migrations[len(migrations)-1].version
+	}
+	status, err := checkSelftestSchema(ctx, app.db)
+	if err != nil {
+		status = err.Error()
+	}
+	report.Schema.Status = status
+	return report
+}
+
+// logStartupReport writes the report as one JSON line.
+func logStartupReport(report StartupReport) {
+	line, err := json.Marshal(report)
+	if err != nil {
+		log.Printf("Failed to encode startup report: %v", err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, string(line))
+}
+
+// startupConfig is the configuration resolved from the environment and its
+// defaults.
+func (app *App) startupConfig() map[string]string {
+	dbConfig := app.db.Config().ConnConfig
+	tiers := make([]string, len(app.rewardTiers))
+	for i, tier := range app.rewardTiers {
+		tiers[i] = tier.Name
+	}
+	biomes := make([]string, len(app.biomes))
+	for i, biome := range app.biomes {
+		biomes[i] = biome.Name
+	}
+	inputs := make([]string, 0, len(app.inputMethods))
+	for name, factor := range app.inputMethods {
+		inputs = append(inputs, fmt.Sprintf("%s:%g", name, factor))
+	}
+	sort.Strings(inputs)
+	tags := make([]string, 0, len(allowedScoreTags))
+	for tag := range allowedScoreTags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	config := map[string]string{
+		"database":            fmt.Sprintf("%s:%d/%s", dbConfig.Host, dbConfig.Port, dbConfig.Database),
+		"redis":               app.redis.Options().Addr,
+		"otlpEndpoint":        telemetry.OTLPEndpoint(getEnv),
+		"otlpProtocol":        telemetry.OTLPProtocol(getEnv),
+		"configFile":          getEnv("CONFIG_FILE", ""),
+		"metricsExport":       telemetry.MetricsExport(getEnv),
+		"seasonSchedule":      app.seasonSchedule.spec,
+		"rewardTiers":         strings.Join(tiers, ","),
+		"biomes":              strings.Join(biomes, ","),
+		"inputMethods":        strings.Join(inputs, ","),
+		"scoreTags":           strings.Join(tags, ","),
+		"extrasVersions":      fmt.Sprint(extrasVersions()),
+		"minSubmissionSchema": fmt.Sprint(app.cfg().Submissions.SchemaMinVersion),
+		"idempotencyTTL":      app.cfg().Submissions.IdempotencyTTL.String(),
+		"submissionMaxBody":   fmt.Sprint(app.cfg().Submissions.MaxBodyBytes),
+		"featuredRotation":    app.cfg().FeaturedRotation.String(),
+		"pipeline":            strings.Join(app.pipeline.names(), ","),
+		"rankEngine":          app.rankEngine,
+		"canaryPercent":       fmt.Sprint(app.canaryPercent),
+		"shutdownDelay":       app.lifecycle.delay.String(),
+		"clientErrorSample":   fmt.Sprintf("%g%%", app.clientErrorSamplePercent),
+	}
+	if app.seasonSchedule.spec == "" {
+		config["seasonSchedule"] = "none"
+	}
+	if app.accounts.enabled() {
+		config["accountTokenTTL"] = app.accounts.ttl.String()
+	}
+	if len(plugins) > 0 {
+		config["plugins"] = strings.Join(pluginNames(), ",")
+	}
+	return config
+}
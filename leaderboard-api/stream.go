@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// Comment lines keep idle connections open through proxies
+	sseHeartbeatInterval = 15 * time.Second
+	// How long a client waits before reconnecting
+	sseRetryMs = 3000
+	// Events buffered per client; a client this far behind misses events
+	sseClientBuffer = 64
+)
+
+// scoreStream fans accepted scores out to the Server-Sent Events clients on
+// this replica.
+type scoreStream struct {
+	mu      sync.Mutex
+	clients map[chan ScoreAcceptedEvent]struct{}
+	done    chan struct{}
+	closed  bool
+}
+
+func newScoreStream() *scoreStream {
+	return &scoreStream{
+		clients: make(map[chan ScoreAcceptedEvent]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (s *scoreStream) subscribe() chan ScoreAcceptedEvent {
+	ch := make(chan ScoreAcceptedEvent, sseClientBuffer)
+	s.mu.Lock()
+	s.clients[ch] = struct{}{}
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *scoreStream) unsubscribe(ch chan ScoreAcceptedEvent) {
+	s.mu.Lock()
+	delete(s.clients, ch)
+	s.mu.Unlock()
+}
+
+// publish delivers event to every client without blocking on slow ones.
+func (s *scoreStream) publish(event ScoreAcceptedEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.clients {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// close ends every stream so the server can shut down.
+func (s *scoreStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
+
+// watchScoreEvents feeds score.accepted events from every replica into the
+// local stream.
+func (app *App) watchScoreEvents(ctx context.Context) {
+	pubsub := app.redis.Subscribe(ctx, eventsChannel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		var event CloudEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil || event.Type != eventTypeScoreAccepted {
+			continue
+		}
+		var score ScoreAcceptedEvent
+		if err := json.Unmarshal(event.Data, &score); err != nil {
+			log.Printf("Failed to decode %s event: %v", event.Type, err)
+			continue
+		}
+		app.scoreStream.publish(score)
+	}
+}
+
+// streamScoresHandler streams accepted submissions as Server-Sent Events,
+// optionally only those of at least minScore or from one player.
+func (app *App) streamScoresHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "streamScores")
+	defer span.End()
+
+	var minScore int
+	if s := r.URL.Query().Get("minScore"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, "Invalid minScore", http.StatusBadRequest)
+			return
+		}
+		minScore = n
+	}
+	player := r.URL.Query().Get("player")
+	span.SetAttributes(attribute.Int("stream.min_score", minScore), attribute.String("stream.player", player))
+
+	// Streams stay open indefinitely, past the server's WriteTimeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear write deadline: %v", err)
+	}
+
+	events := app.scoreStream.subscribe()
+	defer app.scoreStream.unsubscribe(events)
+	scoreStreamClients.Add(ctx, 1)
+	defer scoreStreamClients.Add(ctx, -1)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Connection", "keep-alive")
+	// Stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetryMs)
+	if err := rc.Flush(); err != nil {
+		span.RecordError(err)
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	sent := 0
+	defer func() { span.SetAttributes(attribute.Int("stream.events", sent)) }()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-app.scoreStream.done:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case event := <-events:
+			// A masked player is only found by the masked name, which doesn't
+			// confirm who they are
+			event.PlayerName = app.nameMask()(event.PlayerName)
+			if event.Score < minScore || (player != "" && !strings.EqualFold(event.PlayerName, player)) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: score\ndata: %s\n\n", event.ID, data); err != nil {
+				return
+			}
+			sent++
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
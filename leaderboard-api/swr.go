@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// cacheModeExpire drops cached boards on every change and after CacheTTL
+	cacheModeExpire = "expire"
+	// cacheModeStaleWhileRevalidate keeps serving a board once it's stale and
+	// refreshes it in the background
+	cacheModeStaleWhileRevalidate = "stale-while-revalidate"
+
+	defaultCacheStaleTTL = time.Hour
+
+	// A board's fresh marker lives CacheTTL next to it; without it the board
+	// is stale
+	cacheFreshSuffix = ":fresh"
+)
+
+// staleWhileRevalidate reports whether top scores boards are served stale
+// while they are refreshed.
+func (app *App) staleWhileRevalidate() bool {
+	return app.cfg().CacheMode == cacheModeStaleWhileRevalidate
+}
+
+// cacheTopScores queries a top scores board cachedTopScoresLimit deep and
+// caches it, returning its JSON. In stale-while-revalidate mode the board is
+// kept for CacheStaleTTL and marked fresh for CacheTTL, unless the board
+// changed during the query.
+func (app *App) cacheTopScores(ctx context.Context, cacheKey string, tags []string) ([]byte, error) {
+	version, _ := app.changes.current()
+	leaderboard, err := app.queryTopScores(ctx, cachedTopScoresLimit, tags)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(leaderboard)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := app.cfg()
+	if cfg.CacheMode == cacheModeStaleWhileRevalidate {
+		app.cache.Set(ctx, cacheKey, data, cfg.CacheStaleTTL)
+		if current, _ := app.changes.current(); current == version {
+			app.cache.Set(ctx, cacheKey+cacheFreshSuffix, []byte("1"), cfg.CacheTTL)
+		}
+	} else {
+		app.cache.Set(ctx, cacheKey, data, cfg.CacheTTL)
+	}
+	if len(tags) > 0 {
+		app.cache.SAdd(ctx, cacheKeyTaggedTopKeys, cacheKey)
+	}
+	return data, nil
+}
+
+// revalidateTopScores refreshes a stale board in the background, one refresh
+// per board at a time, while the caller serves the stale copy.
+func (app *App) revalidateTopScores(ctx context.Context, cacheKey string, tags []string) {
+	if _, err := app.cache.Get(ctx, cacheKey+cacheFreshSuffix); err == nil {
+		return
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cache.stale", true))
+	if _, busy := app.revalidating.LoadOrStore(cacheKey, struct{}{}); busy {
+		return
+	}
+
+	// The refresh outlives the request, in a trace of its own linked to it
+	link := trace.LinkFromContext(ctx)
+	go func() {
+		defer app.revalidating.Delete(cacheKey)
+		ctx, span := tracer.Start(context.WithoutCancel(ctx), "revalidateTopScores",
+			trace.WithNewRoot(), trace.WithLinks(link))
+		defer span.End()
+
+		result := "success"
+		if _, err := app.cacheTopScores(ctx, cacheKey, tags); err != nil {
+			result = "error"
+			span.RecordError(err)
+			log.Printf("Failed to revalidate %s: %v", cacheKey, err)
+		}
+		cacheRevalidationsTotal.Add(ctx, 1, metric.WithAttributes(attribute.String("revalidation.result", result)))
+	}()
+}
+
+// staleCachedTopScores follows a new score. In stale-while-revalidate mode
+// the top scores boards are only marked stale, so reads keep being served
+// from them while the next one refreshes them; other boards are dropped.
+// Changes that must not be served stale, such as bans and erasures, drop
+// every board with invalidateCache instead.
+func (app *App) staleCachedTopScores(ctx context.Context) {
+	if !app.staleWhileRevalidate() {
+		app.invalidateCache(ctx)
+		return
+	}
+	if app.topView != nil {
+		app.topView.markDirty()
+	}
+	app.markTopScoresStale(ctx)
+}
+
+func (app *App) markTopScoresStale(ctx context.Context) {
+	markers := []string{cacheKeyTopScores + cacheFreshSuffix}
+	var filtered []string
+	if keys, err := app.cache.SMembers(ctx, cacheKeyTaggedTopKeys); err == nil {
+		for _, key := range keys {
+			if strings.HasPrefix(key, strings.TrimSuffix(cacheKeyTopScoresTagged, "%s")) {
+				markers = append(markers, key+cacheFreshSuffix)
+			} else {
+				filtered = append(filtered, key)
+			}
+		}
+	}
+	if err := app.cache.Del(ctx, append(markers, filtered...)...); err != nil {
+		log.Printf("Failed to mark cache stale: %v", err)
+	}
+}
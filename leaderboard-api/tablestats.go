@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const defaultTableStatsInterval = 5 * time.Minute
+
+// tableStatsTables are the tables reported on. scores is the one that grows
+// without bound.
+var tableStatsTables = []string{"scores"}
+
+// TableStats is the size and health of one table, from the Postgres
+// statistics views.
+type TableStats struct {
+	Table      string `json:"table"`
+	TotalBytes int64  `json:"totalBytes"`
+	TableBytes int64  `json:"tableBytes"`
+	IndexBytes int64  `json:"indexBytes"`
+	LiveRows   int64  `json:"liveRows"`
+	DeadRows   int64  `json:"deadRows"`
+	// BloatRatio estimates bloat as the share of rows that are dead, i.e. the
+	// space vacuum can reclaim
+	BloatRatio  float64      `json:"bloatRatio"`
+	SeqScans    int64        `json:"seqScans"`
+	SeqRowsRead int64        `json:"seqRowsRead"`
+	IndexScans  int64        `json:"indexScans"`
+	LastVacuum  *time.Time   `json:"lastVacuum,omitempty"`
+	Indexes     []IndexStats `json:"indexes"`
+}
+
+// IndexStats is the size and use of one index.
+type IndexStats struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+	Scans int64  `json:"scans"`
+}
+
+// tableStatsCache holds the latest stats for the metric callbacks.
+type tableStatsCache struct {
+	mu    sync.Mutex
+	stats []TableStats
+}
+
+func (c *tableStatsCache) set(stats []TableStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats = stats
+}
+
+func (c *tableStatsCache) get() []TableStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// tableStats reads the current stats of every reported table.
+func (app *App) tableStats(ctx context.Context) ([]TableStats, error) {
+	ctx, span := tracer.Start(ctx, "tableStats")
+	defer span.End()
+
+	start := time.Now()
+	defer func() {
+		store.ObserveQuery(ctx, "table_stats", start)
+	}()
+
+	var all []TableStats
+	for _, table := range tableStatsTables {
+		stats := TableStats{Table: table, Indexes: []IndexStats{}}
+		err := store.TableStatsQuery.QueryRow(ctx, app.db, table).Scan(&stats.TotalBytes, &stats.TableBytes, &stats.IndexBytes,
+			&stats.LiveRows, &stats.DeadRows, &stats.SeqScans, &stats.SeqRowsRead, &stats.IndexScans, &stats.LastVacuum)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		if rows := stats.LiveRows + stats.DeadRows; rows > 0 {
+			stats.BloatRatio = float64(stats.DeadRows) / float64(rows)
+		}
+
+		rows, err := store.IndexStatsQuery.Query(ctx, app.db, table)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		for rows.Next() {
+			var index IndexStats
+			if err := rows.Scan(&index.Name, &index.Bytes, &index.Scans); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			stats.Indexes = append(stats.Indexes, index)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		all = append(all, stats)
+	}
+	return all, nil
+}
+
+// runTableStats refreshes the table stats metrics on a schedule.
+func (app *App) runTableStats(ctx context.Context, interval time.Duration) {
+	refresh := func() {
+		stats, err := app.tableStats(ctx)
+		if err != nil {
+			log.Printf("Failed to read table stats: %v", err)
+			return
+		}
+		app.tableStatsCache.set(stats)
+	}
+	refresh()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
+
+// registerTableStatsMetrics reports the latest table stats at every
+// collection.
+func (app *App) registerTableStatsMetrics() error {
+	tableSize, err := meter.Int64ObservableGauge("db.table.size",
+		metric.WithDescription("Size of a table in bytes, by part (table, indexes or total)"),
+		metric.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+	indexSize, err := meter.Int64ObservableGauge("db.index.size",
+		metric.WithDescription("Size of an index in bytes"),
+		metric.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+	tableRows, err := meter.Int64ObservableGauge("db.table.rows",
+		metric.WithDescription("Estimated live and dead rows of a table"))
+	if err != nil {
+		return err
+	}
+	bloat, err := meter.Float64ObservableGauge("db.table.bloat.ratio",
+		metric.WithDescription("Share of a table's rows that are dead"))
+	if err != nil {
+		return err
+	}
+	scans, err := meter.Int64ObservableCounter("db.table.scans",
+		metric.WithDescription("Scans of a table since stats were reset, by kind (seq or index)"))
+	if err != nil {
+		return err
+	}
+	seqRows, err := meter.Int64ObservableCounter("db.table.seq_rows_read",
+		metric.WithDescription("Rows read by sequential scans of a table since stats were reset"))
+	if err != nil {
+		return err
+	}
+	indexScans, err := meter.Int64ObservableCounter("db.index.scans",
+		metric.WithDescription("Scans of an index since stats were reset"))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for _, stats := range app.tableStatsCache.get() {
+			table := attribute.String("db.table", stats.Table)
+			o.ObserveInt64(tableSize, stats.TableBytes, metric.WithAttributes(table, attribute.String("db.size.part", "table")))
+			o.ObserveInt64(tableSize, stats.IndexBytes, metric.WithAttributes(table, attribute.String("db.size.part", "indexes")))
+			o.ObserveInt64(tableSize, stats.TotalBytes, metric.WithAttributes(table, attribute.String("db.size.part", "total")))
+			o.ObserveInt64(tableRows, stats.LiveRows, metric.WithAttributes(table, attribute.String("db.rows.state", "live")))
+			o.ObserveInt64(tableRows, stats.DeadRows, metric.WithAttributes(table, attribute.String("db.rows.state", "dead")))
+			o.ObserveFloat64(bloat, stats.BloatRatio, metric.WithAttributes(table))
+			o.ObserveInt64(scans, stats.SeqScans, metric.WithAttributes(table, attribute.String("db.scan.kind", "seq")))
+			o.ObserveInt64(scans, stats.IndexScans, metric.WithAttributes(table, attribute.String("db.scan.kind", "index")))
+			o.ObserveInt64(seqRows, stats.SeqRowsRead, metric.WithAttributes(table))
+			for _, index := range stats.Indexes {
+				attrs := metric.WithAttributes(table, attribute.String("db.index", index.Name))
+				o.ObserveInt64(indexSize, index.Bytes, attrs)
+				o.ObserveInt64(indexScans, index.Scans, attrs)
+			}
+		}
+		return nil
+	}, tableSize, indexSize, tableRows, bloat, scans, seqRows, indexScans)
+	return err
+}
+
+// getTableStatsHandler reports the current table and index sizes, bloat
+// estimates and scan counts.
+func (app *App) getTableStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.tableStats(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to read table stats", http.StatusInternalServerError)
+		return
+	}
+	app.tableStatsCache.set(stats)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
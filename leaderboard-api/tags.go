@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	// Default community categories, overridable with SCORE_TAGS
+	defaultScoreTags = "no-powerups,speedrun"
+	maxScoreTags     = 5
+
+	// Tag-filtered boards are cached per filter; the set tracks keys to invalidate
+	cacheKeyTopScoresTagged = "leaderboard:top:tags:%s"
+	cacheKeyTaggedTopKeys   = "leaderboard:top:tagged-keys"
+
+	// Boards filtered on a column, e.g. a biome, are cached per value and limit
+	// and invalidated with the tag-filtered ones
+	cacheKeyFilteredTopScores = "leaderboard:top:%s:%s:%d"
+)
+
+// allowedScoreTags is the tag allowlist, loaded at startup.
+var allowedScoreTags = parseScoreTags(defaultScoreTags)
+
+func parseScoreTags(raw string) map[string]bool {
+	tags := make(map[string]bool)
+	for _, tag := range strings.Split(raw, ",") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			tags[tag] = true
+		}
+	}
+	return tags
+}
+
+// normalizeTags lowercases, de-duplicates and sorts tags, rejecting any that
+// are not on the allowlist.
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if !allowedScoreTags[tag] {
+			return nil, fmt.Errorf("unknown tag %q", tag)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxScoreTags {
+		return nil, fmt.Errorf("too many tags (max %d)", maxScoreTags)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+func checkTags(ctx context.Context, submission *ScoreSubmission) error {
+	tags, err := normalizeTags(submission.Tags)
+	if err != nil {
+		return err
+	}
+	submission.Tags = tags
+	return nil
+}
+
+// parseTagFilter reads repeated ?tag= parameters from a leaderboard query.
+func parseTagFilter(r *http.Request) ([]string, error) {
+	return normalizeTags(r.URL.Query()["tag"])
+}
+
+// topScoresCacheKey returns the cache key for the board matching every tag.
+func topScoresCacheKey(tags []string) string {
+	if len(tags) == 0 {
+		return cacheKeyTopScores
+	}
+	return fmt.Sprintf(cacheKeyTopScoresTagged, strings.Join(tags, ","))
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	mrand "math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	maxClientErrorBatch         = 50
+	maxClientErrorMessageLength = 1000
+	maxClientErrorsBody         = 256 << 10
+	maxClientErrorUserAgent     = 256
+
+	// How long an error counts as already seen, after which its next report
+	// is stored again whatever the sample
+	clientErrorSeenTTL = 24 * time.Hour
+)
+
+var (
+	clientErrorStackHashPattern = regexp.MustCompile(`^[0-9a-f]{8,64}$`)
+	clientVersionPattern        = regexp.MustCompile(`^[0-9A-Za-z.+-]{1,32}$`)
+)
+
+// ClientError is one error caught by the game. The stack itself never leaves
+// the browser; the client hashes it so the same bug groups together.
+type ClientError struct {
+	Message       string `json:"message"`
+	StackHash     string `json:"stackHash"`
+	ClientVersion string `json:"clientVersion"`
+}
+
+type ClientErrorBatch struct {
+	Errors []ClientError `json:"errors"`
+}
+
+type ClientErrorResponse struct {
+	Accepted int `json:"accepted"`
+	Stored   int `json:"stored"`
+}
+
+// ClientErrorGroup is every stored report of one stack hash in one client
+// version.
+type ClientErrorGroup struct {
+	StackHash     string    `json:"stackHash"`
+	ClientVersion string    `json:"clientVersion"`
+	Message       string    `json:"message"`
+	Stored        int       `json:"stored"`
+	FirstSeen     time.Time `json:"firstSeen"`
+	LastSeen      time.Time `json:"lastSeen"`
+}
+
+// clientErrorSamplePercent reads CLIENT_ERROR_SAMPLE_PERCENT, the share of
+// repeat reports stored. Every report is counted in the metrics either way.
+func clientErrorSamplePercent() (float64, error) {
+	percent, err := strconv.ParseFloat(getEnv("CLIENT_ERROR_SAMPLE_PERCENT", "10"), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("CLIENT_ERROR_SAMPLE_PERCENT must be between 0 and 100")
+	}
+	return percent, nil
+}
+
+func cacheKeyClientErrorSeen(version, stackHash string) string {
+	return "leaderboard:client-errors:seen:" + version + ":" + stackHash
+}
+
+func (app *App) submitClientErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "submitClientErrors")
+	defer span.End()
+
+	var batch ClientErrorBatch
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxClientErrorsBody)).Decode(&batch); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(batch.Errors) == 0 || len(batch.Errors) > maxClientErrorBatch {
+		http.Error(w, fmt.Sprintf("between 1 and %d errors required", maxClientErrorBatch), http.StatusBadRequest)
+		return
+	}
+	for i, report := range batch.Errors {
+		if !clientErrorStackHashPattern.MatchString(report.StackHash) {
+			http.Error(w, fmt.Sprintf("errors[%d]: stackHash must be 8 to 64 lowercase hex characters", i), http.StatusBadRequest)
+			return
+		}
+		if !clientVersionPattern.MatchString(report.ClientVersion) {
+			http.Error(w, fmt.Sprintf("errors[%d]: invalid clientVersion", i), http.StatusBadRequest)
+			return
+		}
+		batch.Errors[i].Message = truncateRunes(strings.TrimSpace(report.Message), maxClientErrorMessageLength)
+	}
+	span.SetAttributes(attribute.Int("client_errors.batch_size", len(batch.Errors)))
+
+	start := time.Now()
+	defer func() {
+		store.ObserveQuery(ctx, "submit_client_errors", start)
+	}()
+
+	userAgent := truncateRunes(r.UserAgent(), maxClientErrorUserAgent)
+	stored := 0
+	for _, report := range batch.Errors {
+		// The first report of an error is always kept, repeats only by sample
+		keep := app.clientErrorSamplePercent > 0 && mrand.Float64()*100 < app.clientErrorSamplePercent
+		first, err := app.redis.SetNX(ctx, cacheKeyClientErrorSeen(report.ClientVersion, report.StackHash), 1, clientErrorSeenTTL).Result()
+		if err == nil && first {
+			keep = true
+		}
+		clientErrorsTotal.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("client.version", report.ClientVersion),
+			attribute.Bool("client_error.stored", keep),
+		))
+		span.AddEvent("client_error", trace.WithAttributes(
+			attribute.String("client_error.stack_hash", report.StackHash),
+			attribute.String("client.version", report.ClientVersion),
+		))
+		if !keep {
+			continue
+		}
+
+		if _, err := store.InsertClientErrorQuery.Exec(ctx, app.db, report.StackHash, report.ClientVersion, report.Message, userAgent); err != nil {
+			span.RecordError(err)
+			http.Error(w, "Failed to save client errors", http.StatusInternalServerError)
+			return
+		}
+		stored++
+		log.Printf("🐛 Client error %s (client %s): %q", report.StackHash, report.ClientVersion, report.Message)
+	}
+	span.SetAttributes(attribute.Int("client_errors.stored", stored))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(ClientErrorResponse{Accepted: len(batch.Errors), Stored: stored})
+}
+
+// getClientErrorsHandler groups the stored client errors of a recent window,
+// most frequent first.
+func (app *App) getClientErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getClientErrors")
+	defer span.End()
+
+	window := 24 * time.Hour
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+	limit := 50
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	span.SetAttributes(attribute.String("client_errors.window", window.String()))
+
+	rows, err := store.GetClientErrorsQuery.Query(ctx, app.db, time.Now().Add(-window), limit)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch client errors", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	groups := []ClientErrorGroup{}
+	for rows.Next() {
+		var group ClientErrorGroup
+		if err := rows.Scan(&group.StackHash, &group.ClientVersion, &group.Message,
+			&group.Stored, &group.FirstSeen, &group.LastSeen); err != nil {
+			span.RecordError(err)
+			http.Error(w, "Failed to fetch client errors", http.StatusInternalServerError)
+			return
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch client errors", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups)
+}
+
+// truncateRunes cuts s to at most n characters without splitting one.
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Phases of a score submission, in the order they run. Together they cover
+// the submission from the first byte read to the rank being known.
+const (
+	phaseDecode   = "decode"   // reading and schema-checking the body
+	phaseValidate = "validate" // the validation pipeline, player and ban lookups
+	phaseInsert   = "insert"   // storing the score
+	phaseCache    = "cache"    // ranking, cache invalidation and fan-out
+	phaseRank     = "rank"     // reading back the score's rank
+)
+
+// debugTimingParam asks for the phase breakdown in the submission response.
+const debugTimingParam = "timing"
+
+// PhaseTiming is the time one phase of a submission took.
+type PhaseTiming struct {
+	Phase      string  `json:"phase"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+// phaseTimer splits a submission's latency into phases. Each lap ends the
+// phase that started at the previous one. A nil timer records nothing, so
+// submissions from gRPC or GraphQL skip the breakdown.
+type phaseTimer struct {
+	last   time.Time
+	phases []PhaseTiming
+}
+
+func newPhaseTimer(start time.Time) *phaseTimer {
+	return &phaseTimer{last: start}
+}
+
+type phaseTimerContextKey struct{}
+
+func withPhaseTimer(ctx context.Context, t *phaseTimer) context.Context {
+	return context.WithValue(ctx, phaseTimerContextKey{}, t)
+}
+
+func phaseTimerFromContext(ctx context.Context) *phaseTimer {
+	t, _ := ctx.Value(phaseTimerContextKey{}).(*phaseTimer)
+	return t
+}
+
+// lap ends phase, recording it on the current span and in
+// score.submission.phase.duration.seconds.
+func (t *phaseTimer) lap(ctx context.Context, phase string) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	elapsed := now.Sub(t.last)
+	t.last = now
+	t.phases = append(t.phases, PhaseTiming{Phase: phase, DurationMs: float64(elapsed.Microseconds()) / 1000})
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Float64("submission.phase."+phase+"_ms", float64(elapsed.Microseconds())/1000))
+	submissionPhaseDuration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(attribute.String("submission.phase", phase)))
+}
+
+// breakdown returns the phases timed so far.
+func (t *phaseTimer) breakdown() []PhaseTiming {
+	if t == nil {
+		return nil
+	}
+	return t.phases
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// topViewSize is how many scores top_scores_view holds, fixed by its
+	// migration
+	topViewSize = 1000
+
+	// Only one replica refreshes the view per debounce window
+	cacheKeyTopViewLock = "leaderboard:topview:lock"
+)
+
+// topScoresView serves the unfiltered board from top_scores_view, a
+// materialized view of the current season's top scores, so a cache miss reads
+// at most topViewSize rows by rank instead of sorting the scores table.
+// Changes to the board mark it dirty, and it is refreshed once the debounce
+// has passed, so a burst of submissions costs one refresh. Until then the
+// board lags by up to the debounce plus the refresh itself. It is also
+// refreshed every interval, to pick up changes made on other replicas or
+// outside the API.
+type topScoresView struct {
+	debounce    time.Duration
+	interval    time.Duration
+	dirty       atomic.Bool
+	refreshedAt atomic.Int64
+}
+
+// newTopScoresViewFromEnv reads TOP_VIEW_REFRESH_DEBOUNCE and
+// TOP_VIEW_REFRESH_INTERVAL. It returns nil when TOP_VIEW_ENABLED is false,
+// reading the board from the scores table as before.
+func newTopScoresViewFromEnv() (*topScoresView, error) {
+	if getEnv("TOP_VIEW_ENABLED", "true") != "true" {
+		return nil, nil
+	}
+	debounce, err := time.ParseDuration(getEnv("TOP_VIEW_REFRESH_DEBOUNCE", "2s"))
+	if err != nil || debounce <= 0 {
+		return nil, fmt.Errorf("TOP_VIEW_REFRESH_DEBOUNCE must be a positive duration")
+	}
+	interval, err := time.ParseDuration(getEnv("TOP_VIEW_REFRESH_INTERVAL", "1m"))
+	if err != nil || interval < debounce {
+		return nil, fmt.Errorf("TOP_VIEW_REFRESH_INTERVAL must be a duration no shorter than TOP_VIEW_REFRESH_DEBOUNCE")
+	}
+	return &topScoresView{debounce: debounce, interval: interval}, nil
+}
+
+// markDirty asks for a refresh at the end of the debounce window.
+func (v *topScoresView) markDirty() {
+	v.dirty.Store(true)
+}
+
+// serves reports whether the view can answer a board of limit entries.
+func (v *topScoresView) serves(ctx context.Context, limit int, tags []string) bool {
+	return v != nil && len(tags) == 0 && limit <= topViewSize && !demoScenario(ctx, demoPostgresRank)
+}
+
+// viewTopScores reads the top limit entries from the view.
+func (app *App) viewTopScores(ctx context.Context, limit int) ([]LeaderboardEntry, error) {
+	if refreshedAt := app.topView.refreshedAt.Load(); refreshedAt > 0 {
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.Int64("top_view.age_ms", time.Since(time.Unix(0, refreshedAt)).Milliseconds()))
+	}
+	rows, err := store.SelectTopViewQuery.Query(ctx, app.db, limit)
+	if err != nil {
+		return nil, store.Classify(err)
+	}
+	defer rows.Close()
+	return store.ScanEntries(rows)
+}
+
+// runTopViewRefresher refreshes the view when it is dirty or due, every
+// debounce, until ctx is done.
+func (app *App) runTopViewRefresher(ctx context.Context, v *topScoresView) {
+	log.Printf("✅ Serving the top %d from top_scores_view (refreshed %s after changes)", topViewSize, v.debounce)
+	ticker := time.NewTicker(v.debounce)
+	defer ticker.Stop()
+	lastRefresh := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if app.readOnly() || (!v.dirty.Load() && time.Since(lastRefresh) < v.interval) {
+			continue
+		}
+		acquired, err := app.redis.SetNX(ctx, cacheKeyTopViewLock, 1, v.debounce).Result()
+		if err == nil && !acquired {
+			// Another replica refreshed this window; stay dirty in case
+			// it started before our change
+			continue
+		}
+		// Changes from here on need another refresh
+		v.dirty.Store(false)
+		if err := app.refreshTopView(ctx); err != nil {
+			log.Printf("Failed to refresh top_scores_view: %v", err)
+			v.markDirty()
+			continue
+		}
+		lastRefresh = time.Now()
+	}
+}
+
+// refreshTopView refreshes the view, then drops the cached boards that may
+// have been filled from it before the refresh.
+func (app *App) refreshTopView(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "refreshTopView")
+	defer span.End()
+
+	if _, err := store.RefreshTopViewQuery.Exec(ctx, app.db); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	app.topView.refreshedAt.Store(time.Now().UnixNano())
+	if app.staleWhileRevalidate() {
+		app.markTopScoresStale(ctx)
+	} else {
+		app.dropCachedTopScores(ctx)
+	}
+	app.markSurrogateKeys(ctx, surrogateKeyLeaderboard)
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceParent returns the W3C traceparent of the span in ctx, or nil if there
+// is none. Each score stores the one it was submitted under.
+func traceParent(ctx context.Context) *string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if tp := carrier.Get("traceparent"); tp != "" {
+		return &tp
+	}
+	return nil
+}
+
+// submissionLinks links to the trace a score was submitted in, so work done on
+// it later (quarantine, moderation) can be followed back to the submission.
+// Scores stored before trace_parent existed have no link.
+func submissionLinks(scoreID int, tp string) []trace.Link {
+	if tp == "" {
+		return nil
+	}
+	carrier := propagation.MapCarrier{"traceparent": tp}
+	sc := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+	if !sc.IsValid() {
+		return nil
+	}
+	return []trace.Link{{
+		SpanContext: sc,
+		Attributes: []attribute.KeyValue{
+			attribute.String("link.type", "score.submission"),
+			attribute.Int("score.id", scoreID),
+		},
+	}}
+}
+
+// startScoreSpan starts a span for asynchronous work on a stored score, linked
+// to the score's submission trace.
+func startScoreSpan(ctx context.Context, name string, scoreID int, tp string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithLinks(submissionLinks(scoreID, tp)...),
+		trace.WithAttributes(attribute.Int("score.id", scoreID)),
+	)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// quarantineVerifiedReview holds a verified runner's run above the score
+// ceiling until a moderator confirms it.
+const quarantineVerifiedReview = "verified_review"
+
+// VerifiedRunner is a player, such as a streamer attempting a record, whose
+// runs may go past the score ceilings. Those runs are accepted but stay off
+// the board until a moderator confirms them.
+type VerifiedRunner struct {
+	PlayerID   string    `json:"playerId"`
+	PlayerName string    `json:"playerName"`
+	Note       string    `json:"note,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type VerifiedRunnerRequest struct {
+	Note string `json:"note"`
+}
+
+// isVerifiedRunner reports whether the submission comes from a verified
+// runner. Only signed-in submissions count, so the name can't be borrowed.
+// Lookup failures count as not verified.
+func (app *App) isVerifiedRunner(ctx context.Context, submission *ScoreSubmission) bool {
+	if submission.accountID == "" || submission.accountID != submission.PlayerID {
+		return false
+	}
+
+	verified, err := store.ScanExists(store.VerifiedRunnerQuery.QueryRow(ctx, app.db, submission.accountID))
+	if err != nil {
+		log.Printf("Failed to check verified runner: %v", err)
+		return false
+	}
+	return verified
+}
+
+// bypassCeiling lets a verified runner's score past a ceiling it broke, held
+// for manual confirmation. It returns the original error for everyone else.
+func (app *App) bypassCeiling(ctx context.Context, submission *ScoreSubmission, err error) error {
+	if err == nil || !app.isVerifiedRunner(ctx, submission) {
+		return err
+	}
+	submission.pendingReview = true
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("anti_cheat.verified_bypass", true))
+	return nil
+}
+
+func (app *App) getVerifiedRunnersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getVerifiedRunners")
+	defer span.End()
+
+	rows, err := store.ListVerifiedRunnersQuery.Query(ctx, app.db)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch verified runners", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	runners := []VerifiedRunner{}
+	for rows.Next() {
+		var runner VerifiedRunner
+		if err := rows.Scan(&runner.PlayerID, &runner.PlayerName, &runner.Note, &runner.CreatedAt); err != nil {
+			log.Printf("Failed to scan row: %v", err)
+			continue
+		}
+		runners = append(runners, runner)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runners)
+}
+
+// putVerifiedRunnerHandler verifies a player, by their tagged name.
+func (app *App) putVerifiedRunnerHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "putVerifiedRunner")
+	defer span.End()
+
+	playerName := mux.Vars(r)["name"]
+	var req VerifiedRunnerRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if len(req.Note) > maxReportReasonLength {
+		http.Error(w, fmt.Sprintf("note too long (max %d characters)", maxReportReasonLength), http.StatusBadRequest)
+		return
+	}
+
+	runner := VerifiedRunner{PlayerName: playerName, Note: req.Note}
+	err := store.VerifyRunnerQuery.QueryRow(ctx, app.db, playerName, req.Note).Scan(&runner.PlayerID, &runner.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Player not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to verify runner", http.StatusInternalServerError)
+		return
+	}
+	span.SetAttributes(attribute.String("player.id", runner.PlayerID))
+	log.Printf("🛡️ Verified runner added: %s", runner.PlayerID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runner)
+}
+
+func (app *App) deleteVerifiedRunnerHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "deleteVerifiedRunner")
+	defer span.End()
+
+	playerName := mux.Vars(r)["name"]
+	tag, err := store.UnverifyRunnerQuery.Exec(ctx, app.db, playerName)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to remove verified runner", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "Not a verified runner", http.StatusNotFound)
+		return
+	}
+	log.Printf("🛡️ Verified runner removed: %s", playerName)
+	w.WriteHeader(http.StatusNoContent)
+}
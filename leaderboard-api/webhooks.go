@@ -0,0 +1,558 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nicolevanderhoeven/spice-runner-leaderboard/internal/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	webhookSignatureHeader = "X-Spice-Signature"
+	webhookDeliveryHeader  = "X-Spice-Delivery"
+	webhookEventHeader     = "X-Spice-Event"
+	webhookSecretPrefix    = "whsec_"
+
+	// How much of a failed delivery's response is kept for the admin API
+	webhookMaxErrorLength = 512
+	// Deliveries listed per webhook by the admin API
+	webhookDeliveriesListed = 50
+)
+
+// webhookEventTypes are the events a webhook can subscribe to.
+var webhookEventTypes = []string{eventTypeScoreAccepted, eventTypeMilestoneReached, eventTypeReignStarted}
+
+// Webhook is an integration's subscription to leaderboard events. Events
+// lists the CloudEvents types it receives; empty means all of them. The
+// secret signing its deliveries is only returned when it's set.
+type Webhook struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// WebhookWithSecret is returned when a webhook is created or its secret set.
+type WebhookWithSecret struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookRequest creates or replaces a webhook. A missing secret is generated
+// on create and left as it is on update; Enabled defaults to true.
+type WebhookRequest struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Secret  string   `json:"secret,omitempty"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled,omitempty"`
+}
+
+// WebhookDelivery is one event's delivery to one webhook.
+type WebhookDelivery struct {
+	ID            int64      `json:"id"`
+	EventID       string     `json:"eventId"`
+	EventType     string     `json:"eventType"`
+	Attempts      int        `json:"attempts"`
+	LastStatus    *int       `json:"lastStatus,omitempty"`
+	LastError     *string    `json:"lastError,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	DeliveredAt   *time.Time `json:"deliveredAt,omitempty"`
+	FailedAt      *time.Time `json:"failedAt,omitempty"`
+}
+
+func (req *WebhookRequest) validate() error {
+	if !apiKeyNamePattern.MatchString(req.Name) {
+		return fmt.Errorf("name must be 1-64 lowercase letters, digits, '_' or '-'")
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if req.Secret != "" && (len(req.Secret) < 16 || len(req.Secret) > 128) {
+		return fmt.Errorf("secret must be 16-128 characters")
+	}
+	for _, event := range req.Events {
+		if !slices.Contains(webhookEventTypes, event) {
+			return fmt.Errorf("unknown event type %q", event)
+		}
+	}
+	if req.Events == nil {
+		req.Events = []string{}
+	}
+	return nil
+}
+
+// webhookDispatcher delivers events to webhooks. Events are queued in
+// webhook_deliveries as they are emitted, and every replica works the queue,
+// claiming due deliveries with SKIP LOCKED so each is sent by one replica at
+// a time. A failed delivery is retried with exponential backoff until it has
+// had maxAttempts; a claim that is never settled, as when a replica dies
+// mid-send, comes due again once its lease runs out.
+type webhookDispatcher struct {
+	client      *http.Client
+	poll        time.Duration
+	batchSize   int
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	retention   time.Duration
+}
+
+// newWebhookDispatcherFromEnv returns nil when WEBHOOKS_ENABLED is false.
+func newWebhookDispatcherFromEnv() (*webhookDispatcher, error) {
+	if getEnv("WEBHOOKS_ENABLED", "true") != "true" {
+		return nil, nil
+	}
+	poll, err := time.ParseDuration(getEnv("WEBHOOK_POLL_INTERVAL", "2s"))
+	if err != nil || poll <= 0 {
+		return nil, fmt.Errorf("WEBHOOK_POLL_INTERVAL must be a positive duration")
+	}
+	batchSize, err := strconv.Atoi(getEnv("WEBHOOK_BATCH_SIZE", "20"))
+	if err != nil || batchSize <= 0 {
+		return nil, fmt.Errorf("WEBHOOK_BATCH_SIZE must be a positive number")
+	}
+	timeout, err := time.ParseDuration(getEnv("WEBHOOK_TIMEOUT", "10s"))
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("WEBHOOK_TIMEOUT must be a positive duration")
+	}
+	maxAttempts, err := strconv.Atoi(getEnv("WEBHOOK_MAX_ATTEMPTS", "8"))
+	if err != nil || maxAttempts < 1 {
+		return nil, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be at least 1")
+	}
+	baseDelay, err := time.ParseDuration(getEnv("WEBHOOK_RETRY_BASE_DELAY", "30s"))
+	if err != nil || baseDelay <= 0 {
+		return nil, fmt.Errorf("WEBHOOK_RETRY_BASE_DELAY must be a positive duration")
+	}
+	maxDelay, err := time.ParseDuration(getEnv("WEBHOOK_RETRY_MAX_DELAY", "1h"))
+	if err != nil || maxDelay < baseDelay {
+		return nil, fmt.Errorf("WEBHOOK_RETRY_MAX_DELAY must be a duration no shorter than WEBHOOK_RETRY_BASE_DELAY")
+	}
+	retention, err := time.ParseDuration(getEnv("WEBHOOK_DELIVERY_RETENTION", "168h"))
+	if err != nil || retention <= 0 {
+		return nil, fmt.Errorf("WEBHOOK_DELIVERY_RETENTION must be a positive duration")
+	}
+	return &webhookDispatcher{
+		client:      &http.Client{Timeout: timeout},
+		poll:        poll,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+		maxDelay:    maxDelay,
+		retention:   retention,
+	}, nil
+}
+
+// backoff is the wait after a delivery's nth failed attempt: baseDelay
+// doubled n-1 times, capped at maxDelay.
+func (d *webhookDispatcher) backoff(n int) time.Duration {
+	if shift := n - 1; shift < 32 && d.baseDelay<<shift < d.maxDelay {
+		return d.baseDelay << shift
+	}
+	return d.maxDelay
+}
+
+// lease is how long a claimed delivery is left alone before another replica
+// may take it over.
+func (d *webhookDispatcher) lease() time.Duration {
+	return 2 * d.client.Timeout
+}
+
+// signWebhook returns the signature header for a delivery sent at ts:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">". Receivers recompute
+// it with their secret and should reject old timestamps to stop replays.
+func signWebhook(secret string, ts time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", ts.Unix())
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", ts.Unix(), hex.EncodeToString(mac.Sum(nil)))
+}
+
+// enqueueWebhooks queues event for every enabled webhook subscribed to it.
+// Like the events channel it is best-effort: a failure is logged, not
+// returned to the submitter.
+func (app *App) enqueueWebhooks(ctx context.Context, event *CloudEvent, body []byte) {
+	if app.webhooks == nil || app.readOnly() {
+		return
+	}
+	if _, err := store.EnqueueWebhookDeliveriesQuery.Exec(ctx, app.db, event.ID, event.Type, string(body)); err != nil {
+		log.Printf("Failed to queue %s webhooks: %v", event.Type, err)
+	}
+}
+
+// runWebhookDispatcher works the delivery queue until ctx is done, and prunes
+// settled deliveries once they are older than the retention.
+func (app *App) runWebhookDispatcher(ctx context.Context, d *webhookDispatcher) {
+	log.Printf("✅ Webhook delivery enabled (up to %d attempts)", d.maxAttempts)
+	ticker := time.NewTicker(d.poll)
+	defer ticker.Stop()
+	var lastPrune time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if app.readOnly() {
+			continue
+		}
+		// Keep going while full batches come back, so a backlog drains
+		// faster than one batch per tick
+		for app.dispatchWebhooks(ctx, d) == d.batchSize {
+		}
+		if time.Since(lastPrune) >= time.Hour {
+			lastPrune = time.Now()
+			if _, err := store.PruneWebhookDeliveriesQuery.Exec(ctx, app.db, d.retention.Seconds()); err != nil {
+				log.Printf("Failed to prune webhook deliveries: %v", err)
+			}
+		}
+	}
+}
+
+type claimedDelivery struct {
+	id        int64
+	eventID   string
+	eventType string
+	payload   []byte
+	attempts  int
+	webhook   string
+	url       string
+	secret    string
+}
+
+// dispatchWebhooks claims a batch of due deliveries and sends them
+// concurrently. It returns how many it claimed.
+func (app *App) dispatchWebhooks(ctx context.Context, d *webhookDispatcher) int {
+	rows, err := store.ClaimWebhookDeliveriesQuery.Query(ctx, app.db, d.batchSize, d.lease().Seconds())
+	if err != nil {
+		log.Printf("Failed to claim webhook deliveries: %v", err)
+		return 0
+	}
+	claimed, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (claimedDelivery, error) {
+		var c claimedDelivery
+		err := row.Scan(&c.id, &c.eventID, &c.eventType, &c.payload, &c.attempts, &c.webhook, &c.url, &c.secret)
+		return c, err
+	})
+	if err != nil {
+		log.Printf("Failed to claim webhook deliveries: %v", err)
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range claimed {
+		wg.Add(1)
+		go func(c claimedDelivery) {
+			defer wg.Done()
+			app.deliverWebhook(ctx, d, c)
+		}(c)
+	}
+	wg.Wait()
+	return len(claimed)
+}
+
+// deliverWebhook sends one claimed delivery and settles it: delivered on a
+// 2xx, failed for good once out of attempts, otherwise due again after the
+// backoff. The span continues the trace of the request that emitted the event.
+func (app *App) deliverWebhook(ctx context.Context, d *webhookDispatcher, c claimedDelivery) {
+	var event CloudEvent
+	if err := json.Unmarshal(c.payload, &event); err == nil {
+		ctx = event.Context(ctx)
+	}
+	ctx, span := tracer.Start(ctx, "deliverWebhook")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("webhook.name", c.webhook),
+		attribute.Int64("webhook.delivery_id", c.id),
+		attribute.Int("webhook.attempt", c.attempts),
+		attribute.String("cloudevents.event_type", c.eventType),
+		attribute.String("cloudevents.event_id", c.eventID),
+	)
+
+	status, err := d.send(ctx, c)
+	result := "delivered"
+	switch {
+	case err == nil:
+		_, err = store.SettleWebhookDeliveryQuery.Exec(ctx, app.db, c.id, status, nil, 0, true, false)
+	case c.attempts >= d.maxAttempts:
+		result = "failed"
+		span.RecordError(err)
+		log.Printf("⚠️ Giving up on webhook %s delivery %d after %d attempts: %v", c.webhook, c.id, c.attempts, err)
+		_, err = store.SettleWebhookDeliveryQuery.Exec(ctx, app.db, c.id, status, truncate(err.Error(), webhookMaxErrorLength), 0, false, true)
+	default:
+		result = "retrying"
+		span.RecordError(err)
+		_, err = store.SettleWebhookDeliveryQuery.Exec(ctx, app.db, c.id, status, truncate(err.Error(), webhookMaxErrorLength),
+			d.backoff(c.attempts).Seconds(), false, false)
+	}
+	if err != nil {
+		// The lease runs out and the delivery is sent again
+		log.Printf("Failed to settle webhook delivery %d: %v", c.id, err)
+	}
+	span.SetAttributes(attribute.String("webhook.result", result))
+	webhookDeliveriesTotal.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("webhook.result", result),
+		attribute.String("cloudevents.event_type", c.eventType),
+	))
+}
+
+// send posts the delivery, returning the response status if there was one.
+func (d *webhookDispatcher) send(ctx context.Context, c claimedDelivery) (*int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(c.payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	req.Header.Set("User-Agent", "spice-runner-leaderboard-webhooks")
+	req.Header.Set(webhookDeliveryHeader, strconv.FormatInt(c.id, 10))
+	req.Header.Set(webhookEventHeader, c.eventType)
+	req.Header.Set(webhookSignatureHeader, signWebhook(c.secret, time.Now(), c.payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	status := resp.StatusCode
+	if status < 200 || status >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxErrorLength))
+		return &status, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return &status, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + hex.EncodeToString(secret), nil
+}
+
+func scanWebhook(row pgx.CollectableRow) (Webhook, error) {
+	var hook Webhook
+	err := row.Scan(&hook.ID, &hook.Name, &hook.URL, &hook.Events, &hook.Enabled, &hook.CreatedAt, &hook.UpdatedAt)
+	return hook, err
+}
+
+func (app *App) getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getWebhooks")
+	defer span.End()
+
+	rows, err := store.ListWebhooksQuery.Query(ctx, app.db)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch webhooks", http.StatusInternalServerError)
+		return
+	}
+	hooks, err := pgx.CollectRows(rows, scanWebhook)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch webhooks", http.StatusInternalServerError)
+		return
+	}
+	if hooks == nil {
+		hooks = []Webhook{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+// createWebhookHandler registers a webhook. The secret is only in this
+// response, unless it's set again with an update.
+func (app *App) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "createWebhook")
+	defer span.End()
+
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			span.RecordError(err)
+			http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+			return
+		}
+		req.Secret = secret
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+
+	rows, err := store.CreateWebhookQuery.Query(ctx, app.db, req.Name, req.URL, req.Secret, req.Events, enabled)
+	var hook Webhook
+	if err == nil {
+		hook, err = pgx.CollectExactlyOneRow(rows, scanWebhook)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		http.Error(w, "A webhook with that name exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🪝 Webhook %s created", hook.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(WebhookWithSecret{Webhook: hook, Secret: req.Secret})
+}
+
+// updateWebhookHandler replaces a webhook's settings. Deliveries already
+// queued go to the new URL with the new secret.
+func (app *App) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "updateWebhook")
+	defer span.End()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+
+	rows, err := store.UpdateWebhookQuery.Query(ctx, app.db, id, req.Name, req.URL, req.Secret, req.Events, enabled)
+	var hook Webhook
+	if err == nil {
+		hook, err = pgx.CollectExactlyOneRow(rows, scanWebhook)
+	}
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	case errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation:
+		http.Error(w, "A webhook with that name exists", http.StatusConflict)
+		return
+	case err != nil:
+		span.RecordError(err)
+		http.Error(w, "Failed to update webhook", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🪝 Webhook %s updated", hook.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	if req.Secret != "" {
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(WebhookWithSecret{Webhook: hook, Secret: req.Secret})
+		return
+	}
+	json.NewEncoder(w).Encode(hook)
+}
+
+// deleteWebhookHandler removes a webhook along with its queued and past
+// deliveries.
+func (app *App) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "deleteWebhook")
+	defer span.End()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	var name string
+	err = store.DeleteWebhookQuery.QueryRow(ctx, app.db, id).Scan(&name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🪝 Webhook %s deleted", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getWebhookDeliveriesHandler lists a webhook's latest deliveries, to see why
+// an integration isn't receiving events.
+func (app *App) getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, span := tracer.Start(ctx, "getWebhookDeliveries")
+	defer span.End()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	rows, err := store.ListWebhookDeliveriesQuery.Query(ctx, app.db, id, webhookDeliveriesListed)
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+	deliveries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (WebhookDelivery, error) {
+		var d WebhookDelivery
+		err := row.Scan(&d.ID, &d.EventID, &d.EventType, &d.Attempts, &d.LastStatus, &d.LastError,
+			&d.CreatedAt, &d.NextAttemptAt, &d.DeliveredAt, &d.FailedAt)
+		return d, err
+	})
+	if err != nil {
+		span.RecordError(err)
+		http.Error(w, "Failed to fetch webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []WebhookDelivery{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
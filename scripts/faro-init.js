@@ -42,7 +42,11 @@
     // =========================================================================
     // Secondary Instance: Grafana Cloud Frontend O11y
     // =========================================================================
-    const grafanaCloudUrl = 'https://faro-collector-prod-us-central-0.grafana.net/collect/2e0bbd062f25d71c122cb237d06a4c43';
+    // Relayed by the leaderboard API, which holds the collector URL and adds
+    // geo and platform attributes
+    const grafanaCloudUrl = window.location.origin.includes('localhost')
+      ? 'http://localhost:8080/api/rum/collect'
+      : window.location.origin + '/spice/leaderboard/api/rum/collect';
     console.log('🔧 Initializing Faro (Grafana Cloud) with URL:', grafanaCloudUrl);
 
     const cloudFaro = window.GrafanaFaroWebSdk.initializeFaro({
@@ -70,7 +74,7 @@
 
     console.log('📊 Dual-send telemetry enabled:');
     console.log('   → Alloy:', alloyUrl);
-    console.log('   → Grafana Cloud:', grafanaCloudUrl.replace(/\/collect\/.*/, '/collect/[REDACTED]'));
+    console.log('   → Grafana Cloud (via leaderboard API):', grafanaCloudUrl);
     console.log('🔑 Session ID:', window.gameSessionId);
     console.log('🌐 User Agent:', navigator.userAgent);
     console.log('📱 Screen:', `${window.screen.width}x${window.screen.height}`);
@@ -20,6 +20,22 @@
   let playerName = null;
   let pendingSubmission = null; // Store score and sessionId while waiting for name
 
+  // Stable identity for this browser, so the API can tell two players with the
+  // same display name apart (duplicates get a discriminator like "Paul#4821")
+  let playerId = localStorage.getItem('spice-runner-player-id');
+  if (!playerId) {
+    playerId = window.crypto && window.crypto.randomUUID
+      ? window.crypto.randomUUID()
+      : Date.now().toString(36) + Math.random().toString(36).slice(2);
+    localStorage.setItem('spice-runner-player-id', playerId);
+  }
+
+  // How the current run is being played; touch and keyboard runs have
+  // separate leaderboards
+  let inputMethod = 'ontouchstart' in window ? 'touch' : 'keyboard';
+  window.addEventListener('keydown', function() { inputMethod = 'keyboard'; }, true);
+  window.addEventListener('touchstart', function() { inputMethod = 'touch'; }, true);
+
   // Setup modal handlers on page load
   window.addEventListener('load', function() {
     const modal = document.getElementById('player-name-modal');
@@ -124,7 +140,9 @@
         body: JSON.stringify({
           playerName: playerName,
           score: score,
-          sessionId: sessionId
+          sessionId: sessionId,
+          playerId: playerId,
+          inputMethod: inputMethod
         })
       });
 
@@ -135,6 +153,9 @@
 
       const result = await response.json();
       console.log('✅ Score submitted successfully:', result);
+      if (result.discriminator) {
+        console.log(`🏷️ Name already taken, you appear as ${result.playerName}`);
+      }
       
       // Show rank to player
       if (result.rank) {